@@ -0,0 +1,132 @@
+// Command export streams raw click events to a file or stdout for loading
+// into a data warehouse, e.g. from a nightly cron job:
+//
+//	export -user data@example.com -format parquet -from 2026-02-01 -to 2026-02-02 -out clicks.parquet
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/analytics"
+	"github.com/Unhyphenated/shrinks-backend/internal/export"
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+	"github.com/Unhyphenated/shrinks-backend/internal/util"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	_ = godotenv.Load()
+
+	shortCode := flag.String("link", "", "short code of the link to export")
+	email := flag.String("user", "", "email of the account to export (all of its links)")
+	format := flag.String("format", export.FormatCSV, "output format: csv, ndjson or parquet")
+	from := flag.String("from", "", "start of the range, inclusive (YYYY-MM-DD or RFC 3339, default 24h before -to)")
+	to := flag.String("to", "", "end of the range, exclusive (YYYY-MM-DD or RFC 3339, default now)")
+	out := flag.String("out", "", "output file (required)")
+	flag.Parse()
+
+	if (*shortCode == "") == (*email == "") {
+		log.Fatal("Exactly one of -link or -user is required")
+	}
+
+	// Not stdout: the store logs its startup message there
+	if *out == "" {
+		log.Fatal("-out is required")
+	}
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL environment variable is not set. Cannot connect to Postgres.")
+	}
+
+	filter, err := parseRange(*from, *to)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := storage.NewPostgresStore(dbURL)
+	if err != nil {
+		log.Fatalf("Failed to initialize database store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+
+	if *shortCode != "" {
+		link, err := store.GetLinkByCode(ctx, *shortCode)
+		if err != nil {
+			log.Fatalf("Failed to get link: %v", err)
+		}
+		if link == nil {
+			log.Fatalf("Link %s not found", *shortCode)
+		}
+		filter.LinkID = &link.ID
+	} else {
+		user, err := store.GetUserByEmail(ctx, *email)
+		if err != nil {
+			log.Fatalf("Failed to get user: %v", err)
+		}
+		if user == nil {
+			log.Fatalf("User %s not found", *email)
+		}
+		filter.UserID = &user.ID
+	}
+
+	output, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Failed to create output file: %v", err)
+	}
+	defer output.Close()
+
+	writer, err := export.NewWriter(*format, output)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The CLI doesn't need the visitor sketches, only the store
+	analyticsService := analytics.NewAnalyticsService(store, nil)
+
+	rows := 0
+	err = analyticsService.ExportEvents(ctx, filter, func(event *model.AnalyticsEvent) error {
+		rows++
+		return writer.Write(event)
+	})
+	if err != nil {
+		log.Fatalf("Export failed after %d rows: %v", rows, err)
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Fatalf("Failed to finish export: %v", err)
+	}
+
+	fmt.Printf("Exported %d events to %s\n", rows, *out)
+}
+
+func parseRange(from string, to string) (model.AnalyticsExportFilter, error) {
+	filter := model.AnalyticsExportFilter{To: time.Now().UTC()}
+
+	if to != "" {
+		parsed, err := util.ParseTimeParam(to)
+		if err != nil {
+			return filter, fmt.Errorf("invalid -to: %w", err)
+		}
+		filter.To = parsed
+	}
+
+	filter.From = filter.To.Add(-24 * time.Hour)
+	if from != "" {
+		parsed, err := util.ParseTimeParam(from)
+		if err != nil {
+			return filter, fmt.Errorf("invalid -from: %w", err)
+		}
+		filter.From = parsed
+	}
+
+	return filter, nil
+}
@@ -1,25 +1,46 @@
 package main
 
 import (
+	"archive/zip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Unhyphenated/shrinks-backend/internal/analytics"
 	"github.com/Unhyphenated/shrinks-backend/internal/auth"
 	"github.com/Unhyphenated/shrinks-backend/internal/cache"
+	"github.com/Unhyphenated/shrinks-backend/internal/export"
+	"github.com/Unhyphenated/shrinks-backend/internal/geoip"
+	"github.com/Unhyphenated/shrinks-backend/internal/mail"
 	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/notify"
+	"github.com/Unhyphenated/shrinks-backend/internal/oidc"
 	"github.com/Unhyphenated/shrinks-backend/internal/service"
 	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+	"github.com/Unhyphenated/shrinks-backend/internal/stream"
 	"github.com/Unhyphenated/shrinks-backend/internal/util"
 	"github.com/joho/godotenv"
 )
 
+const (
+	maxLiveConnections        = 1000
+	maxLiveConnectionsPerUser = 5
+	liveHeartbeatInterval     = 15 * time.Second
+	purgeInterval             = time.Hour
+	partitionInterval         = 24 * time.Hour
+	alertInterval             = time.Minute
+)
+
 func main() {
 	_ = godotenv.Load()
 
@@ -48,24 +69,159 @@ func main() {
 	}
 	defer cache.Close()
 
-	analyticsService := analytics.NewAnalyticsService(store)
-	linkService := service.NewLinkService(store, cache, analyticsService)
+	// GeoIP enrichment is optional; deployments without a database file still record clicks
+	var locator geoip.Locator
+	if geoipPath := os.Getenv("GEOIP_DB_PATH"); geoipPath != "" {
+		maxMindLocator, err := geoip.NewMaxMindLocator(geoipPath)
+		if err != nil {
+			log.Printf("GeoIP enrichment disabled: %v", err)
+		} else {
+			locator = maxMindLocator
+			defer maxMindLocator.Close()
+		}
+	}
+
+	visitorSecret := os.Getenv("VISITOR_HASH_SECRET")
+	if visitorSecret == "" {
+		// Unique visitor counts won't line up across replicas or restarts
+		log.Println("VISITOR_HASH_SECRET is not set, using a random per-process secret")
+		visitorSecret, err = auth.GenerateRefreshToken()
+		if err != nil {
+			log.Fatalf("Failed to generate visitor hash secret: %v", err)
+		}
+	}
+	// Each use gets its own key: hashed IPs are exported, and must not give
+	// away the visitor salt or click ID key
+	visitorHasher := analytics.NewVisitorHasher(util.DeriveSecret(visitorSecret, "visitor-salt"))
+
+	ipPrivacyMode, err := util.ParseIPPrivacyMode(os.Getenv("IP_PRIVACY_MODE"))
+	if err != nil {
+		log.Fatalf("Invalid IP_PRIVACY_MODE: %v", err)
+	}
+	privacy := util.PrivacyConfig{Mode: ipPrivacyMode, HashKey: []byte(util.DeriveSecret(visitorSecret, "ip-hash"))}
+
+	analyticsService := analytics.NewAnalyticsService(store, cache)
+
+	go analytics.NewPartitioner(store).Run(context.Background(), partitionInterval)
+
+	// Raw events are purged after the retention period; 0 keeps them forever
+	retentionDays := analytics.DefaultRetentionDays
+	if value := os.Getenv("ANALYTICS_RETENTION_DAYS"); value != "" {
+		retentionDays, err = strconv.Atoi(value)
+		if err != nil || retentionDays < 0 {
+			log.Fatalf("Invalid ANALYTICS_RETENTION_DAYS: %q", value)
+		}
+	}
+	analyticsService.RetentionDays = retentionDays
+	if retentionDays > 0 {
+		go analytics.NewPurger(store, retentionDays).Run(context.Background(), purgeInterval)
+	} else {
+		log.Println("ANALYTICS_RETENTION_DAYS is 0, raw analytics events are kept forever")
+	}
+
+	// Mail carries live reset and verification links, so it is only logged
+	// instead of sent when MAIL_LOG_ONLY asks for it, in development. Tokens
+	// in logged links are redacted unless MAIL_LOG_TOKENS is set too.
+	var mailer mail.Mailer
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		mailer = mail.NewSMTPMailer(smtpAddr, os.Getenv("SMTP_FROM"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	} else if os.Getenv("MAIL_LOG_ONLY") == "true" {
+		showTokens := os.Getenv("MAIL_LOG_TOKENS") == "true"
+		mailer = mail.LogMailer{ShowTokens: showTokens}
+		if showTokens {
+			log.Println("MAIL_LOG_ONLY and MAIL_LOG_TOKENS are set, outgoing mail will only be logged, links included")
+		} else {
+			log.Println("MAIL_LOG_ONLY is set, outgoing mail will only be logged with tokens redacted")
+		}
+	} else {
+		log.Fatal("SMTP_ADDR is not set; set MAIL_LOG_ONLY=true to log mail instead in development")
+	}
+
+	// Owners are mailed about traffic anomalies; a webhook can receive them too
+	notifiers := notify.Multi{&notify.EmailNotifier{Mailer: mailer}}
+	if webhookURL := os.Getenv("ALERT_WEBHOOK_URL"); webhookURL != "" {
+		notifiers = append(notifiers, notify.NewWebhookNotifier(webhookURL, os.Getenv("ALERT_WEBHOOK_SECRET")))
+	}
+	detector := analytics.NewDetector(store, cache, notifiers)
+	// Hashed or dropped IPs don't group into networks, so nothing to alert on
+	if ipPrivacyMode != util.IPPrivacyTruncate {
+		detector.NetworkShare = 0
+		log.Printf("IP_PRIVACY_MODE is %s, single-network traffic alerts are off", ipPrivacyMode)
+	}
+	go detector.Run(context.Background(), alertInterval)
+
+	// Live clicks go through Redis pub/sub so every replica can serve viewers
+	broker := stream.NewBroker(maxLiveConnections, maxLiveConnectionsPerUser)
+	relay := stream.NewRedisRelay(cache.Client, broker)
+	go relay.Run(context.Background())
+
+	// Click IDs have to verify on every replica and across restarts
+	clickIDSecret := os.Getenv("CLICK_ID_SECRET")
+	if clickIDSecret == "" {
+		clickIDSecret = util.DeriveSecret(visitorSecret, "click-id")
+	}
+	clickIDs := analytics.NewClickIDSigner(clickIDSecret)
+
+	linkService := service.NewLinkService(store, cache, analyticsService, relay)
+	linkService.ClickIDs = clickIDs
 	authService := auth.NewAuthService(store)
+	authService.Mailer = mailer
+	authService.AppURL = appURL()
+	authService.Cache = cache
+	authService.OIDC = oidcProviders()
+
+	// Expired sessions and old rotated tokens, on the retention purge schedule
+	go authService.RunRefreshTokenCleanup(context.Background(), purgeInterval)
+
+	shareService := service.NewShareService(store)
 
 	mux := http.NewServeMux()
 
-	mux.Handle("POST /api/v1/links/shorten", auth.OptionalAuth(handlerShorten(linkService)))
-	mux.HandleFunc("GET /api/v1/links/{shortCode}", handlerRedirect(linkService))
-	mux.Handle("GET /api/v1/links/{shortCode}/analytics", auth.RequireAuth(handlerLinkAnalytics(analyticsService, linkService)))
-	mux.Handle("GET /api/v1/links", auth.RequireAuth(handlerListLinks(linkService)))
-	mux.Handle("DELETE /api/v1/links/{shortCode}", auth.RequireAuth(handlerDeleteLink(linkService)))
+	mux.Handle("POST /api/v1/links/shorten", auth.AllowAPIKey(authService, auth.ScopeLinksWrite, auth.OptionalAuth(handlerShorten(linkService))))
+	mux.HandleFunc("GET /api/v1/links/{shortCode}", handlerRedirect(linkService, locator, visitorHasher, privacy))
+	mux.Handle("GET /api/v1/links/{shortCode}/analytics", auth.AllowAPIKey(authService, auth.ScopeAnalyticsRead, auth.RequireAuth(handlerLinkAnalytics(analyticsService, linkService))))
+	mux.Handle("POST /api/v1/links/{shortCode}/shares", auth.RequireAuth(handlerCreateShareToken(shareService, linkService)))
+	mux.Handle("GET /api/v1/links/{shortCode}/shares", auth.RequireAuth(handlerListShareTokens(shareService, linkService)))
+	mux.Handle("DELETE /api/v1/links/{shortCode}/shares/{id}", auth.RequireAuth(handlerRevokeShareToken(shareService, linkService)))
+	mux.HandleFunc("GET /api/v1/share/{token}", handlerSharedAnalytics(shareService, analyticsService))
+	mux.Handle("GET /api/v1/links/{shortCode}/live", auth.AllowQueryToken(auth.RequireAuth(handlerLiveClicks(linkService, broker, liveHeartbeatInterval))))
+	mux.Handle("PUT /api/v1/links/{shortCode}/conversion-tracking", auth.AllowAPIKey(authService, auth.ScopeLinksWrite, auth.RequireAuth(handlerSetConversionTracking(linkService))))
+	mux.HandleFunc("POST /api/v1/conversions", handlerConversion(analyticsService, clickIDs))
+	mux.HandleFunc("GET /api/v1/conversions/pixel.gif", handlerConversionPixel(analyticsService, clickIDs))
+	mux.Handle("GET /api/v1/links/{shortCode}/export", auth.AllowAPIKey(authService, auth.ScopeAnalyticsRead, auth.RequireAuth(handlerExportLinkEvents(analyticsService, linkService))))
+	mux.Handle("GET /api/v1/analytics", auth.AllowAPIKey(authService, auth.ScopeAnalyticsRead, auth.RequireAuth(handlerAccountAnalytics(analyticsService))))
+	mux.Handle("PUT /api/v1/analytics/retention", auth.RequireAuth(handlerSetRetention(analyticsService, retentionDays)))
+	mux.Handle("GET /api/v1/analytics/export", auth.AllowAPIKey(authService, auth.ScopeAnalyticsRead, auth.RequireAuth(handlerExportAccountEvents(analyticsService))))
+	mux.Handle("GET /api/v1/links", auth.AllowAPIKey(authService, auth.ScopeLinksRead, auth.RequireAuth(handlerListLinks(linkService))))
+	mux.Handle("DELETE /api/v1/links/{shortCode}", auth.AllowAPIKey(authService, auth.ScopeLinksWrite, auth.RequireAuth(handlerDeleteLink(linkService))))
 	mux.HandleFunc("GET /api/v1/links/stats", handlerGetGlobalStats(linkService))
 
 	mux.HandleFunc("POST /api/v1/auth/register", handlerRegister(authService))
 	mux.HandleFunc("POST /api/v1/auth/login", handlerLogin(authService))
+	mux.HandleFunc("POST /api/v1/auth/login/2fa", handlerVerifyTwoFactorLogin(authService))
 	mux.HandleFunc("POST /api/v1/auth/refresh", handlerRefresh(authService))
 	mux.HandleFunc("POST /api/v1/auth/logout", handlerLogout(authService))
-	mux.Handle("GET /api/v1/auth/me", auth.RequireAuth(handlerMe()))
+	mux.HandleFunc("GET /api/v1/auth/oidc/providers", handlerOIDCProviders(authService))
+	mux.HandleFunc("GET /api/v1/auth/oidc/{provider}/login", handlerOIDCLogin(authService, appURL()))
+	mux.HandleFunc("GET /api/v1/auth/oidc/{provider}/callback", handlerOIDCCallback(authService, appURL()))
+	mux.HandleFunc("POST /api/v1/auth/password-reset", handlerRequestPasswordReset(authService))
+	mux.HandleFunc("POST /api/v1/auth/password-reset/confirm", handlerConfirmPasswordReset(authService))
+	mux.Handle("GET /api/v1/auth/me", auth.RequireAuth(handlerMe(authService)))
+	mux.Handle("DELETE /api/v1/auth/me", auth.RequireAuth(handlerDeleteAccount(authService)))
+	mux.Handle("GET /api/v1/auth/me/export", auth.RequireAuth(handlerExportAccount(authService, linkService, analyticsService)))
+	mux.HandleFunc("POST /api/v1/auth/verify-email", handlerVerifyEmail(authService))
+	mux.Handle("POST /api/v1/auth/verify-email/resend", auth.RequireAuth(handlerResendVerification(authService)))
+	mux.Handle("PUT /api/v1/auth/password", auth.RequireAuth(handlerChangePassword(authService)))
+	mux.Handle("PUT /api/v1/auth/email", auth.RequireAuth(handlerChangeEmail(authService)))
+	mux.Handle("GET /api/v1/auth/sessions", auth.RequireAuth(handlerListSessions(authService)))
+	mux.Handle("DELETE /api/v1/auth/sessions/{id}", auth.RequireAuth(handlerRevokeSession(authService)))
+	mux.Handle("POST /api/v1/auth/logout-everywhere", auth.RequireAuth(handlerLogoutEverywhere(authService)))
+	mux.Handle("POST /api/v1/auth/api-keys", auth.RequireAuth(auth.RequireVerifiedEmail(authService, handlerCreateAPIKey(authService))))
+	mux.Handle("GET /api/v1/auth/api-keys", auth.RequireAuth(handlerListAPIKeys(authService)))
+	mux.Handle("DELETE /api/v1/auth/api-keys/{id}", auth.RequireAuth(handlerRevokeAPIKey(authService)))
+	mux.Handle("POST /api/v1/auth/2fa/enroll", auth.RequireAuth(handlerEnrollTwoFactor(authService)))
+	mux.Handle("POST /api/v1/auth/2fa/activate", auth.RequireAuth(handlerActivateTwoFactor(authService)))
+	mux.Handle("DELETE /api/v1/auth/2fa", auth.RequireAuth(handlerDisableTwoFactor(authService)))
 
 	mux.HandleFunc("GET /health", handlerHealth())
 
@@ -145,7 +301,7 @@ func handlerLogin(svc auth.AuthProvider) http.HandlerFunc {
 			return
 		}
 
-		authResp, err := svc.Login(r.Context(), req.Email, req.Password)
+		authResp, err := svc.Login(auth.WithSessionClient(r.Context(), sessionClient(r)), req.Email, req.Password)
 		if err != nil {
 			switch {
 			case errors.Is(err, auth.ErrInvalidEmail):
@@ -159,41 +315,205 @@ func handlerLogin(svc auth.AuthProvider) http.HandlerFunc {
 			return
 		}
 
-		isProduction := os.Getenv("ENV") == "production"
-		sameSite := http.SameSiteLaxMode
-		if isProduction {
-			sameSite = http.SameSiteStrictMode
+		// The password was right, but the session needs a second factor first
+		if authResp.TwoFactor != nil {
+			util.WriteJSON(w, http.StatusOK, authResp.TwoFactor)
+			return
 		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     "refresh_token",
-			Value:    authResp.RefreshToken,
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   isProduction,
-			SameSite: sameSite,
-			MaxAge:   3600 * 24 * 7, // 7 days
-		})
+		if err := auth.SetSessionCookies(w, authResp.RefreshToken); err != nil {
+			log.Printf("Login cookie error: %v", err)
+			util.WriteError(w, http.StatusInternalServerError, "Failed to login")
+			return
+		}
 
 		util.WriteJSON(w, http.StatusOK, authResp)
 	}
 }
 
-func handlerLogout(svc auth.AuthProvider) http.HandlerFunc {
+// handlerVerifyTwoFactorLogin finishes a login that was answered with a
+// challenge, and responds like a login without two-factor authentication.
+func handlerVerifyTwoFactorLogin(svc auth.AuthProvider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req model.LogoutRequest
+		var req model.TwoFactorLoginRequest
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
 			return
 		}
 
-		if req.RefreshToken == "" {
-			util.WriteError(w, http.StatusBadRequest, "Refresh token is required")
+		if req.ChallengeToken == "" || req.Code == "" {
+			util.WriteError(w, http.StatusBadRequest, "Challenge token and code are required")
+			return
+		}
+
+		authResp, err := svc.VerifyTwoFactorLogin(auth.WithSessionClient(r.Context(), sessionClient(r)), req.ChallengeToken, req.Code)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidTwoFactorChallenge):
+				util.WriteError(w, http.StatusUnauthorized, "Login expired or had too many attempts, please log in again")
+			case errors.Is(err, auth.ErrInvalidTwoFactorCode):
+				util.WriteError(w, http.StatusUnauthorized, "Invalid two-factor code")
+			default:
+				log.Printf("Two-factor login error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to login")
+			}
+			return
+		}
+
+		if err := auth.SetSessionCookies(w, authResp.RefreshToken); err != nil {
+			log.Printf("Two-factor login cookie error: %v", err)
+			util.WriteError(w, http.StatusInternalServerError, "Failed to login")
+			return
+		}
+
+		util.WriteJSON(w, http.StatusOK, authResp)
+	}
+}
+
+func handlerOIDCProviders(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		util.WriteJSON(w, http.StatusOK, svc.OIDCProviders())
+	}
+}
+
+// handlerOIDCLogin sends the browser to the provider. Failures send it back
+// to the frontend's login page, since this is a page load rather than an API
+// call.
+func handlerOIDCLogin(svc auth.AuthProvider, appURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authURL, flow, err := svc.BeginOIDCLogin(r.Context(), r.PathValue("provider"))
+		if err != nil {
+			if errors.Is(err, auth.ErrUnknownOIDCProvider) {
+				util.WriteError(w, http.StatusNotFound, "Unknown sign in provider")
+				return
+			}
+			log.Printf("OIDC login error: %v", err)
+			redirectLoginError(w, r, appURL, "provider_unavailable")
+			return
+		}
+
+		if err := auth.SetOIDCFlowCookie(w, flow); err != nil {
+			log.Printf("OIDC login cookie error: %v", err)
+			redirectLoginError(w, r, appURL, "provider_unavailable")
+			return
+		}
+
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// handlerOIDCCallback is where the provider sends the browser back. On
+// success the session cookies are set and the frontend picks the session up
+// with a refresh.
+func handlerOIDCCallback(svc auth.AuthProvider, appURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flow, ok := auth.OIDCFlowFromCookie(r)
+		auth.ClearOIDCFlowCookie(w)
+
+		// The user declined, or the provider refused the request
+		if r.URL.Query().Get("error") != "" {
+			redirectLoginError(w, r, appURL, "cancelled")
+			return
+		}
+
+		if !ok || flow.Provider != r.PathValue("provider") {
+			redirectLoginError(w, r, appURL, "expired")
+			return
+		}
+
+		ctx := auth.WithSessionClient(r.Context(), sessionClient(r))
+		authResp, err := svc.CompleteOIDCLogin(ctx, flow, r.URL.Query().Get("state"), r.URL.Query().Get("code"))
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidOIDCState), errors.Is(err, auth.ErrUnknownOIDCProvider):
+				redirectLoginError(w, r, appURL, "expired")
+			case errors.Is(err, auth.ErrOIDCEmailNotVerified):
+				redirectLoginError(w, r, appURL, "email_not_verified")
+			case errors.Is(err, auth.ErrOIDCAccountUnverified):
+				redirectLoginError(w, r, appURL, "account_unverified")
+			case errors.Is(err, auth.ErrUserAlreadyExists):
+				redirectLoginError(w, r, appURL, "account_exists")
+			default:
+				log.Printf("OIDC callback error: %v", err)
+				redirectLoginError(w, r, appURL, "failed")
+			}
+			return
+		}
+
+		// The frontend asks for the code and finishes the login. The challenge
+		// is short-lived and useless without a code, so it can be in the URL.
+		if authResp.TwoFactor != nil {
+			http.Redirect(w, r, strings.TrimRight(appURL, "/")+"/login?challenge="+url.QueryEscape(authResp.TwoFactor.Token), http.StatusFound)
+			return
+		}
+
+		if err := auth.SetSessionCookies(w, authResp.RefreshToken); err != nil {
+			log.Printf("OIDC callback cookie error: %v", err)
+			redirectLoginError(w, r, appURL, "failed")
+			return
+		}
+
+		http.Redirect(w, r, strings.TrimRight(appURL, "/")+"/", http.StatusFound)
+	}
+}
+
+func redirectLoginError(w http.ResponseWriter, r *http.Request, appURL string, reason string) {
+	http.Redirect(w, r, strings.TrimRight(appURL, "/")+"/login?error="+url.QueryEscape(reason), http.StatusFound)
+}
+
+var (
+	errMissingRefreshToken = errors.New("refresh token is required")
+	errInvalidCSRFToken    = errors.New("invalid CSRF token")
+)
+
+// refreshTokenFromRequest prefers a token in the JSON body, as sent by
+// non-browser clients. Otherwise it falls back to the HttpOnly cookie set at
+// login, which a cross-site request could make the browser attach, so that
+// path also needs a matching CSRF header.
+func refreshTokenFromRequest(r *http.Request) (string, bool, error) {
+	var req model.RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return "", false, err
+	}
+
+	if req.RefreshToken != "" {
+		return req.RefreshToken, false, nil
+	}
+
+	token := auth.RefreshTokenFromCookie(r)
+	if token == "" {
+		return "", false, errMissingRefreshToken
+	}
+
+	if !auth.ValidCSRF(r) {
+		return "", true, errInvalidCSRFToken
+	}
+
+	return token, true, nil
+}
+
+func handlerLogout(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		refreshToken, fromCookie, err := refreshTokenFromRequest(r)
+		if err != nil {
+			switch {
+			case errors.Is(err, errMissingRefreshToken):
+				util.WriteError(w, http.StatusBadRequest, "Refresh token is required")
+			case errors.Is(err, errInvalidCSRFToken):
+				util.WriteError(w, http.StatusForbidden, "Invalid CSRF token")
+			default:
+				util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			}
 			return
 		}
 
-		err := svc.Logout(r.Context(), req.RefreshToken)
+		// The browser session ends either way
+		if fromCookie {
+			auth.ClearSessionCookies(w)
+		}
+
+		err = svc.Logout(r.Context(), refreshToken)
 		if err != nil {
 			switch {
 			case errors.Is(err, auth.ErrInvalidRefreshToken):
@@ -212,25 +532,36 @@ func handlerLogout(svc auth.AuthProvider) http.HandlerFunc {
 
 func handlerRefresh(svc auth.AuthProvider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req model.RefreshTokenRequest
-
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
-			return
-		}
-
-		if req.RefreshToken == "" {
-			util.WriteError(w, http.StatusBadRequest, "Refresh token is required")
+		refreshToken, fromCookie, err := refreshTokenFromRequest(r)
+		if err != nil {
+			switch {
+			case errors.Is(err, errMissingRefreshToken):
+				util.WriteError(w, http.StatusBadRequest, "Refresh token is required")
+			case errors.Is(err, errInvalidCSRFToken):
+				util.WriteError(w, http.StatusForbidden, "Invalid CSRF token")
+			default:
+				util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			}
 			return
 		}
 
-		refreshResp, err := svc.RefreshAccessToken(r.Context(), req.RefreshToken)
+		refreshResp, err := svc.RefreshAccessToken(auth.WithSessionClient(r.Context(), sessionClient(r)), refreshToken)
 		if err != nil {
+			// A cookie that can no longer be refreshed is dead weight
+			rejected := errors.Is(err, auth.ErrInvalidRefreshToken) ||
+				errors.Is(err, auth.ErrRefreshTokenExpired) ||
+				errors.Is(err, auth.ErrRefreshTokenReused)
+			if fromCookie && rejected {
+				auth.ClearSessionCookies(w)
+			}
+
 			switch {
 			case errors.Is(err, auth.ErrInvalidRefreshToken):
 				util.WriteError(w, http.StatusUnauthorized, "Invalid refresh token")
 			case errors.Is(err, auth.ErrRefreshTokenExpired):
 				util.WriteError(w, http.StatusUnauthorized, "Refresh token has expired")
+			case errors.Is(err, auth.ErrRefreshTokenReused):
+				util.WriteError(w, http.StatusUnauthorized, "Refresh token was already used, please log in again")
 			default:
 				log.Printf("Refresh token error: %v", err)
 				util.WriteError(w, http.StatusInternalServerError, "Failed to refresh access token")
@@ -238,86 +569,110 @@ func handlerRefresh(svc auth.AuthProvider) http.HandlerFunc {
 			return
 		}
 
+		// Browsers get the rotated token as a cookie only, out of reach of scripts
+		if fromCookie {
+			if err := auth.SetSessionCookies(w, refreshResp.RefreshToken); err != nil {
+				log.Printf("Refresh cookie error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to refresh access token")
+				return
+			}
+			refreshResp.RefreshToken = ""
+		}
+
 		util.WriteJSON(w, http.StatusOK, refreshResp)
 	}
 }
 
-func handlerShorten(svc service.LinkProvider) http.HandlerFunc {
+func handlerRequestPasswordReset(svc auth.AuthProvider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req model.CreateLinkRequest
-
+		var req model.PasswordResetRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
 			return
 		}
 
-		if req.URL == "" {
-			util.WriteError(w, http.StatusBadRequest, "URL is required")
+		if req.Email == "" {
+			util.WriteError(w, http.StatusBadRequest, "Email is required")
 			return
 		}
 
-		var userID *uint64
-		claims, ok := auth.GetClaimsFromContext(r.Context())
-		if ok {
-			userID = &claims.UserID
+		if err := svc.RequestPasswordReset(r.Context(), req.Email); err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidEmail):
+				util.WriteError(w, http.StatusBadRequest, "Invalid email format")
+			default:
+				log.Printf("Password reset request error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to request password reset")
+			}
+			return
 		}
 
-		shortCode, err := svc.Shorten(r.Context(), req.URL, userID)
+		// Same answer whether or not the account exists
+		util.WriteJSON(w, http.StatusAccepted, "If an account exists for that email, a reset link has been sent")
+	}
+}
 
-		if err != nil {
+func handlerConfirmPasswordReset(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req model.ConfirmPasswordResetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		if req.Token == "" {
+			util.WriteError(w, http.StatusBadRequest, "Reset token is required")
+			return
+		}
+
+		if err := svc.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
 			switch {
-			case errors.Is(err, service.ErrInvalidURL):
-				util.WriteError(w, http.StatusBadRequest, "Invalid URL")
-			case errors.Is(err, service.ErrURLScheme):
-				util.WriteError(w, http.StatusBadRequest, "Invalid URL scheme")
-			case errors.Is(err, service.ErrURLHost):
-				util.WriteError(w, http.StatusBadRequest, "Invalid URL host")
+			case errors.Is(err, auth.ErrInvalidResetToken):
+				util.WriteError(w, http.StatusBadRequest, "Reset link is invalid or has expired")
+			case errors.Is(err, auth.ErrPasswordTooShort):
+				util.WriteError(w, http.StatusBadRequest, "Password must be at least 8 characters")
+			case errors.Is(err, auth.ErrPasswordTooLong):
+				util.WriteError(w, http.StatusBadRequest, "Password exceeds 72 characters")
 			default:
-				util.WriteError(w, http.StatusInternalServerError, "Failed to shorten URL")
+				log.Printf("Password reset error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to reset password")
 			}
 			return
 		}
 
-		resp := model.CreateLinkResponse{
-			ShortCode: shortCode,
-			LongURL:   req.URL,
-		}
-
-		util.WriteJSON(w, http.StatusCreated, resp)
+		util.WriteJSON(w, http.StatusOK, "Password has been reset, please log in again")
 	}
 }
 
-func handlerRedirect(svc service.LinkProvider) http.HandlerFunc {
+func handlerVerifyEmail(svc auth.AuthProvider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ua := util.ParseUserAgent(r.Header.Get("User-Agent"))
-		ip := util.GetIP(r.Header.Get("X-Forwarded-For"), r.RemoteAddr)
-
-		event := &model.AnalyticsEvent{
-			IPAddress:  util.AnonymizeIP(ip),
-			DeviceType: ua.DeviceType,
-			Browser:    ua.Browser,
-			OS:         ua.OS,
-			UserAgent:  r.Header.Get("User-Agent"),
+		var req model.VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			return
 		}
 
-		shortCode := r.PathValue("shortCode")
-
-		if shortCode == "" {
-			util.WriteError(w, http.StatusBadRequest, "Short URL code is required")
+		if req.Token == "" {
+			util.WriteError(w, http.StatusBadRequest, "Verification token is required")
 			return
 		}
 
-		longURL, err := svc.Redirect(r.Context(), shortCode, event)
-		if err != nil {
-			util.WriteError(w, http.StatusNotFound, "Link not found")
+		if err := svc.VerifyEmail(r.Context(), req.Token); err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidVerificationToken):
+				util.WriteError(w, http.StatusBadRequest, "Verification link is invalid or has expired")
+			default:
+				log.Printf("Verify email error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to verify email")
+			}
 			return
 		}
 
-		http.Redirect(w, r, longURL, http.StatusFound)
+		util.WriteJSON(w, http.StatusOK, "Email address verified")
 	}
 }
 
-func handlerLinkAnalytics(analyticsService analytics.AnalyticsProvider, linkService service.LinkProvider) http.HandlerFunc {
+func handlerResendVerification(svc auth.AuthProvider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims, ok := auth.GetClaimsFromContext(r.Context())
 		if !ok {
@@ -325,38 +680,72 @@ func handlerLinkAnalytics(analyticsService analytics.AnalyticsProvider, linkServ
 			return
 		}
 
-		shortCode := r.PathValue("shortCode")
-		period := r.URL.Query().Get("period")
-		if period == "" {
-			period = "30d"
+		if err := svc.ResendVerification(r.Context(), claims.UserID); err != nil {
+			switch {
+			case errors.Is(err, auth.ErrEmailAlreadyVerified):
+				util.WriteError(w, http.StatusConflict, "Email address is already verified")
+			case errors.Is(err, auth.ErrVerificationThrottled):
+				util.WriteError(w, http.StatusTooManyRequests, "A verification email was sent recently, please wait a minute")
+			case errors.Is(err, auth.ErrUserNotFound):
+				util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			default:
+				log.Printf("Resend verification error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to send verification email")
+			}
+			return
 		}
 
-		link, err := linkService.GetLinkByCode(r.Context(), shortCode)
-		if err != nil {
-			util.WriteError(w, http.StatusInternalServerError, "Failed to get link")
+		util.WriteJSON(w, http.StatusAccepted, "Verification email sent")
+	}
+}
+
+func handlerChangePassword(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		if link == nil {
-			util.WriteError(w, http.StatusNotFound, "Link not found")
+		var req model.ChangePasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
 			return
 		}
 
-		// Check ownership
-		if link.UserID == nil || *link.UserID != claims.UserID {
-			util.WriteError(w, http.StatusForbidden, "Not authorized to view analytics for this link")
+		if req.CurrentPassword == "" {
+			util.WriteError(w, http.StatusBadRequest, "Current password is required")
 			return
 		}
 
-		analyticsSummary, err := analyticsService.RetrieveAnalytics(r.Context(), link.ID, period)
-		if err != nil {
-			util.WriteError(w, http.StatusInternalServerError, "Failed to retrieve analytics")
+		// The session making the change stays logged in
+		keep := req.RefreshToken
+		if keep == "" {
+			keep = auth.RefreshTokenFromCookie(r)
+		}
+
+		if err := svc.ChangePassword(r.Context(), claims.UserID, req.CurrentPassword, req.NewPassword, keep); err != nil {
+			switch {
+			case errors.Is(err, auth.ErrIncorrectPassword):
+				util.WriteError(w, http.StatusForbidden, "Current password is incorrect")
+			case errors.Is(err, auth.ErrPasswordTooShort):
+				util.WriteError(w, http.StatusBadRequest, "Password must be at least 8 characters")
+			case errors.Is(err, auth.ErrPasswordTooLong):
+				util.WriteError(w, http.StatusBadRequest, "Password exceeds 72 characters")
+			case errors.Is(err, auth.ErrUserNotFound):
+				util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			default:
+				log.Printf("Change password error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to change password")
+			}
 			return
 		}
-		util.WriteJSON(w, http.StatusOK, analyticsSummary)
+
+		util.WriteJSON(w, http.StatusOK, "Password changed, other sessions have been logged out")
 	}
 }
-func handlerListLinks(linkService service.LinkProvider) http.HandlerFunc {
+
+func handlerChangeEmail(svc auth.AuthProvider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims, ok := auth.GetClaimsFromContext(r.Context())
 		if !ok {
@@ -364,27 +753,1207 @@ func handlerListLinks(linkService service.LinkProvider) http.HandlerFunc {
 			return
 		}
 
-		links, total, err := linkService.GetUserLinks(r.Context(), claims.UserID, 10, 0)
-		if err != nil {
-			util.WriteError(w, http.StatusInternalServerError, "Failed to list links")
+		var req model.ChangeEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
 			return
 		}
-		util.WriteJSON(w, http.StatusOK, map[string]interface{}{
-			"links": links,
-			"total": total,
-		})
-	}
-}
 
-func handlerDeleteLink(linkService service.LinkProvider) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		claims, ok := auth.GetClaimsFromContext(r.Context())
-		if !ok {
-			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		if req.Email == "" {
+			util.WriteError(w, http.StatusBadRequest, "Email is required")
 			return
 		}
 
-		shortCode := r.PathValue("shortCode")
+		if req.CurrentPassword == "" {
+			util.WriteError(w, http.StatusBadRequest, "Current password is required")
+			return
+		}
+
+		if err := svc.ChangeEmail(r.Context(), claims.UserID, req.CurrentPassword, req.Email); err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidEmail):
+				util.WriteError(w, http.StatusBadRequest, "Invalid email format")
+			case errors.Is(err, auth.ErrEmailUnchanged):
+				util.WriteError(w, http.StatusBadRequest, "New email is the same as the current one")
+			case errors.Is(err, auth.ErrIncorrectPassword):
+				util.WriteError(w, http.StatusForbidden, "Current password is incorrect")
+			case errors.Is(err, auth.ErrUserAlreadyExists):
+				util.WriteError(w, http.StatusConflict, "Email is already in use")
+			case errors.Is(err, auth.ErrUserNotFound):
+				util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			default:
+				log.Printf("Change email error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to change email")
+			}
+			return
+		}
+
+		util.WriteJSON(w, http.StatusOK, "Email changed, check your inbox to verify it")
+	}
+}
+
+func handlerDeleteAccount(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req model.DeleteAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		if req.CurrentPassword == "" {
+			util.WriteError(w, http.StatusBadRequest, "Current password is required")
+			return
+		}
+
+		if err := svc.DeleteAccount(r.Context(), claims.UserID, req.CurrentPassword, req.LinkPolicy); err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidLinkPolicy):
+				util.WriteError(w, http.StatusBadRequest, "Link policy must be 'delete' or 'anonymize'")
+			case errors.Is(err, auth.ErrIncorrectPassword):
+				util.WriteError(w, http.StatusForbidden, "Current password is incorrect")
+			case errors.Is(err, auth.ErrUserNotFound):
+				util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			default:
+				log.Printf("Delete account error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to delete account")
+			}
+			return
+		}
+
+		auth.ClearSessionCookies(w)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handlerEnrollTwoFactor(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req model.EnrollTwoFactorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		if req.CurrentPassword == "" {
+			util.WriteError(w, http.StatusBadRequest, "Current password is required")
+			return
+		}
+
+		enrollment, err := svc.EnrollTwoFactor(r.Context(), claims.UserID, req.CurrentPassword)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrIncorrectPassword):
+				util.WriteError(w, http.StatusForbidden, "Current password is incorrect")
+			case errors.Is(err, auth.ErrTwoFactorAlreadyEnabled):
+				util.WriteError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+			case errors.Is(err, auth.ErrUserNotFound):
+				util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			default:
+				log.Printf("Enroll two-factor error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to start two-factor enrollment")
+			}
+			return
+		}
+
+		util.WriteJSON(w, http.StatusOK, enrollment)
+	}
+}
+
+func handlerActivateTwoFactor(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req model.ActivateTwoFactorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		if req.Code == "" {
+			util.WriteError(w, http.StatusBadRequest, "Code is required")
+			return
+		}
+
+		activation, err := svc.ActivateTwoFactor(r.Context(), claims.UserID, req.Code)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidTwoFactorCode):
+				util.WriteError(w, http.StatusBadRequest, "Invalid two-factor code")
+			case errors.Is(err, auth.ErrTwoFactorNotEnrolled):
+				util.WriteError(w, http.StatusConflict, "Start two-factor enrollment first")
+			case errors.Is(err, auth.ErrTwoFactorAlreadyEnabled):
+				util.WriteError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+			case errors.Is(err, auth.ErrUserNotFound):
+				util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			default:
+				log.Printf("Activate two-factor error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+			}
+			return
+		}
+
+		util.WriteJSON(w, http.StatusOK, activation)
+	}
+}
+
+func handlerDisableTwoFactor(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req model.DisableTwoFactorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		if req.CurrentPassword == "" || req.Code == "" {
+			util.WriteError(w, http.StatusBadRequest, "Current password and code are required")
+			return
+		}
+
+		if err := svc.DisableTwoFactor(r.Context(), claims.UserID, req.CurrentPassword, req.Code); err != nil {
+			switch {
+			case errors.Is(err, auth.ErrIncorrectPassword):
+				util.WriteError(w, http.StatusForbidden, "Current password is incorrect")
+			case errors.Is(err, auth.ErrInvalidTwoFactorCode):
+				util.WriteError(w, http.StatusForbidden, "Invalid two-factor code")
+			case errors.Is(err, auth.ErrTwoFactorNotEnabled):
+				util.WriteError(w, http.StatusConflict, "Two-factor authentication is not enabled")
+			case errors.Is(err, auth.ErrUserNotFound):
+				util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			default:
+				log.Printf("Disable two-factor error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Links are read for the account export in pages of this size.
+const exportLinksPageSize = 100
+
+// handlerExportAccount returns a ZIP of everything stored about the user:
+// their profile, their links and every click on them. The profile and links
+// are read up front so failures there can still be reported; clicks are
+// streamed, and a failure part way through leaves the archive unfinished.
+func handlerExportAccount(authService auth.AuthProvider, linkService service.LinkProvider, analyticsService analytics.AnalyticsProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		user, err := authService.GetUser(r.Context(), claims.UserID)
+		if err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			log.Printf("Account export error: %v", err)
+			util.WriteError(w, http.StatusInternalServerError, "Failed to export account")
+			return
+		}
+
+		links := []model.Link{}
+		for {
+			page, total, err := linkService.GetUserLinks(r.Context(), claims.UserID, exportLinksPageSize, len(links))
+			if err != nil {
+				log.Printf("Account export error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to export account")
+				return
+			}
+			links = append(links, page...)
+			if len(page) == 0 || len(links) >= total {
+				break
+			}
+		}
+
+		now := time.Now().UTC()
+		filename := fmt.Sprintf("shrinks-export-%s.zip", now.Format("20060102T150405Z"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+		rc := http.NewResponseController(w)
+		_ = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+
+		archive := zip.NewWriter(w)
+
+		profile := map[string]interface{}{
+			"id":             user.ID,
+			"email":          user.Email,
+			"email_verified": user.EmailVerified,
+			"created_at":     user.CreatedAt,
+		}
+		if err := writeZipJSON(archive, "profile.json", profile); err != nil {
+			log.Printf("Account export error writing profile: %v", err)
+			return
+		}
+
+		if err := writeZipJSON(archive, "links.json", links); err != nil {
+			log.Printf("Account export error writing links: %v", err)
+			return
+		}
+
+		file, err := archive.Create("analytics.ndjson")
+		if err != nil {
+			log.Printf("Account export error: %v", err)
+			return
+		}
+
+		writer, err := export.NewWriter(export.FormatNDJSON, file)
+		if err != nil {
+			log.Printf("Account export error: %v", err)
+			return
+		}
+
+		filter := model.AnalyticsExportFilter{UserID: &claims.UserID, From: time.Unix(0, 0).UTC(), To: now}
+		rows := 0
+		err = analyticsService.ExportEvents(r.Context(), filter, func(event *model.AnalyticsEvent) error {
+			if err := writer.Write(event); err != nil {
+				return err
+			}
+
+			rows++
+			if rows%1000 == 0 {
+				_ = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Account export error after %d clicks: %v", rows, err)
+			return
+		}
+
+		if err := writer.Close(); err != nil {
+			log.Printf("Account export error closing writer: %v", err)
+			return
+		}
+
+		if err := archive.Close(); err != nil {
+			log.Printf("Account export error closing archive: %v", err)
+		}
+	}
+}
+
+func writeZipJSON(archive *zip.Writer, name string, v interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// maxSessionUserAgent bounds what a client can make us store per refresh token.
+const maxSessionUserAgent = 512
+
+// sessionClient describes the client logging in or refreshing, for the
+// sessions list. An unparseable forwarded IP is left out rather than stored.
+func sessionClient(r *http.Request) model.SessionClient {
+	ip := util.GetIP(r.Header.Get("X-Forwarded-For"), r.RemoteAddr)
+	if net.ParseIP(strings.TrimSpace(ip)) == nil {
+		ip = ""
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxSessionUserAgent {
+		userAgent = userAgent[:maxSessionUserAgent]
+	}
+
+	return model.SessionClient{UserAgent: userAgent, IPAddress: strings.TrimSpace(ip)}
+}
+
+func handlerListSessions(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		// Browser clients send their refresh cookie along, which marks their own session
+		sessions, err := svc.ListSessions(r.Context(), claims.UserID, auth.RefreshTokenFromCookie(r))
+		if err != nil {
+			log.Printf("List sessions error: %v", err)
+			util.WriteError(w, http.StatusInternalServerError, "Failed to list sessions")
+			return
+		}
+
+		util.WriteJSON(w, http.StatusOK, sessions)
+	}
+}
+
+func handlerRevokeSession(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		if err := svc.RevokeSession(r.Context(), claims.UserID, r.PathValue("id")); err != nil {
+			switch {
+			case errors.Is(err, auth.ErrSessionNotFound):
+				util.WriteError(w, http.StatusNotFound, "Session not found")
+			default:
+				log.Printf("Revoke session error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to revoke session")
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handlerCreateAPIKey(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req model.CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		key, err := svc.CreateAPIKey(r.Context(), claims.UserID, req.Name, req.Scopes)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidAPIKeyName):
+				util.WriteError(w, http.StatusBadRequest, "Name must be 1 to 100 characters")
+			case errors.Is(err, auth.ErrInvalidScope):
+				util.WriteError(w, http.StatusBadRequest, "Scopes must be one or more of links:read, links:write, analytics:read")
+			case errors.Is(err, auth.ErrTooManyAPIKeys):
+				util.WriteError(w, http.StatusConflict, "API key limit reached, revoke one first")
+			default:
+				log.Printf("Create API key error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to create API key")
+			}
+			return
+		}
+
+		util.WriteJSON(w, http.StatusCreated, key)
+	}
+}
+
+func handlerListAPIKeys(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		keys, err := svc.ListAPIKeys(r.Context(), claims.UserID)
+		if err != nil {
+			log.Printf("List API keys error: %v", err)
+			util.WriteError(w, http.StatusInternalServerError, "Failed to list API keys")
+			return
+		}
+
+		util.WriteJSON(w, http.StatusOK, keys)
+	}
+}
+
+func handlerRevokeAPIKey(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid API key ID")
+			return
+		}
+
+		if err := svc.RevokeAPIKey(r.Context(), claims.UserID, id); err != nil {
+			switch {
+			case errors.Is(err, auth.ErrAPIKeyNotFound):
+				util.WriteError(w, http.StatusNotFound, "API key not found")
+			default:
+				log.Printf("Revoke API key error: %v", err)
+				util.WriteError(w, http.StatusInternalServerError, "Failed to revoke API key")
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handlerLogoutEverywhere(svc auth.AuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		if err := svc.LogoutEverywhere(r.Context(), claims.UserID); err != nil {
+			log.Printf("Logout everywhere error: %v", err)
+			util.WriteError(w, http.StatusInternalServerError, "Failed to logout")
+			return
+		}
+
+		auth.ClearSessionCookies(w)
+		util.WriteJSON(w, http.StatusOK, "Logged out of all sessions")
+	}
+}
+
+func handlerShorten(svc service.LinkProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req model.CreateLinkRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		if req.URL == "" {
+			util.WriteError(w, http.StatusBadRequest, "URL is required")
+			return
+		}
+
+		var userID *uint64
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if ok {
+			userID = &claims.UserID
+		}
+
+		shortCode, err := svc.Shorten(r.Context(), req.URL, userID)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidURL):
+				util.WriteError(w, http.StatusBadRequest, "Invalid URL")
+			case errors.Is(err, service.ErrURLScheme):
+				util.WriteError(w, http.StatusBadRequest, "Invalid URL scheme")
+			case errors.Is(err, service.ErrURLHost):
+				util.WriteError(w, http.StatusBadRequest, "Invalid URL host")
+			default:
+				util.WriteError(w, http.StatusInternalServerError, "Failed to shorten URL")
+			}
+			return
+		}
+
+		resp := model.CreateLinkResponse{
+			ShortCode: shortCode,
+			LongURL:   req.URL,
+		}
+
+		util.WriteJSON(w, http.StatusCreated, resp)
+	}
+}
+
+func handlerRedirect(svc service.LinkProvider, locator geoip.Locator, hasher *analytics.VisitorHasher, privacy util.PrivacyConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ua := util.ParseClientInfo(r.Header)
+		ip := util.GetIP(r.Header.Get("X-Forwarded-For"), r.RemoteAddr)
+
+		// Visitors sending DNT or Sec-GPC are still counted, but only with
+		// the coarse device/browser/country breakdowns
+		optedOut := util.OptedOut(r.Header)
+
+		event := &model.AnalyticsEvent{
+			DeviceType: ua.DeviceType,
+			Browser:    ua.Browser,
+			OS:         ua.OS,
+			Referrer:   util.ReferrerHost(r.Header.Get("Referer")),
+			Language:   util.PrimaryLanguage(r.Header.Get("Accept-Language")),
+			Method:     r.Method,
+			// Bots send DNT too; the raw User-Agent is used to classify the
+			// click but only stored for visitors who didn't opt out
+			RawUserAgent: r.Header.Get("User-Agent"),
+		}
+
+		// Without IP and User-Agent opted-out clicks have no visitor hash, so
+		// they are neither repeat filtered nor counted as unique visitors
+		if !optedOut {
+			event.IPAddress = privacy.ProtectIP(ip)
+			event.UserAgent = r.Header.Get("User-Agent")
+
+			// Hash the raw IP; the anonymized one merges every visitor in a /24
+			if hasher != nil {
+				event.VisitorHash = hasher.Hash(ip, r.Header.Get("User-Agent"), time.Now())
+			}
+		}
+
+		// Geolocation has to use the raw IP, the anonymized one is too coarse
+		if locator != nil {
+			location, err := locator.Lookup(ip)
+			if err == nil {
+				event.Country = location.Country
+				if !optedOut {
+					event.Region = location.Region
+					event.City = location.City
+				}
+			}
+		}
+
+		shortCode := r.PathValue("shortCode")
+
+		if shortCode == "" {
+			util.WriteError(w, http.StatusBadRequest, "Short URL code is required")
+			return
+		}
+
+		longURL, err := svc.Redirect(r.Context(), shortCode, event)
+		if err != nil {
+			util.WriteError(w, http.StatusNotFound, "Link not found")
+			return
+		}
+
+		http.Redirect(w, r, longURL, http.StatusFound)
+	}
+}
+
+func handlerLinkAnalytics(analyticsService analytics.AnalyticsProvider, linkService service.LinkProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		shortCode := r.PathValue("shortCode")
+		query, err := parseAnalyticsQuery(r)
+		if err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid time zone")
+			return
+		}
+		query.IncludeFiltered = r.URL.Query().Get("include_filtered") == "true"
+
+		link, err := linkService.GetLinkByCode(r.Context(), shortCode)
+		if err != nil {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to get link")
+			return
+		}
+
+		if link == nil {
+			util.WriteError(w, http.StatusNotFound, "Link not found")
+			return
+		}
+
+		// Check ownership
+		if link.UserID == nil || *link.UserID != claims.UserID {
+			util.WriteError(w, http.StatusForbidden, "Not authorized to view analytics for this link")
+			return
+		}
+
+		analyticsSummary, err := analyticsService.RetrieveAnalytics(r.Context(), link.ID, query)
+		if err != nil {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to retrieve analytics")
+			return
+		}
+		util.WriteJSON(w, http.StatusOK, analyticsSummary)
+	}
+}
+
+// parseAnalyticsQuery reads the options shared by the owner and public
+// analytics views. The only error is an unknown time zone.
+func parseAnalyticsQuery(r *http.Request) (model.AnalyticsQuery, error) {
+	query := model.AnalyticsQuery{
+		Period:  r.URL.Query().Get("period"),
+		Compare: r.URL.Query().Get("compare") == "true",
+	}
+	if query.Period == "" {
+		query.Period = "30d"
+	}
+
+	// The heatmap is bucketed in the requester's time zone
+	location, err := util.ParseTimeZone(r.URL.Query().Get("tz"))
+	if err != nil {
+		return query, err
+	}
+	query.Location = location
+
+	return query, nil
+}
+
+func handlerCreateShareToken(shareService service.ShareProvider, linkService service.LinkProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req model.CreateShareTokenRequest
+		// An empty body creates a token that never expires
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		link, err := linkService.GetLinkByCode(r.Context(), r.PathValue("shortCode"))
+		if err != nil {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to get link")
+			return
+		}
+
+		if link == nil {
+			util.WriteError(w, http.StatusNotFound, "Link not found")
+			return
+		}
+
+		// Check ownership
+		if link.UserID == nil || *link.UserID != claims.UserID {
+			util.WriteError(w, http.StatusForbidden, "Not authorized to share analytics for this link")
+			return
+		}
+
+		shareToken, err := shareService.CreateShareToken(r.Context(), link.ID, req.ExpiresAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrShareExpiryInPast):
+				util.WriteError(w, http.StatusBadRequest, err.Error())
+			default:
+				util.WriteError(w, http.StatusInternalServerError, "Failed to create share token")
+			}
+			return
+		}
+
+		util.WriteJSON(w, http.StatusCreated, shareToken)
+	}
+}
+
+func handlerListShareTokens(shareService service.ShareProvider, linkService service.LinkProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		link, err := linkService.GetLinkByCode(r.Context(), r.PathValue("shortCode"))
+		if err != nil {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to get link")
+			return
+		}
+
+		if link == nil {
+			util.WriteError(w, http.StatusNotFound, "Link not found")
+			return
+		}
+
+		// Check ownership
+		if link.UserID == nil || *link.UserID != claims.UserID {
+			util.WriteError(w, http.StatusForbidden, "Not authorized to view share tokens for this link")
+			return
+		}
+
+		tokens, err := shareService.ListShareTokens(r.Context(), link.ID)
+		if err != nil {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to list share tokens")
+			return
+		}
+
+		util.WriteJSON(w, http.StatusOK, tokens)
+	}
+}
+
+func handlerRevokeShareToken(shareService service.ShareProvider, linkService service.LinkProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid share token ID")
+			return
+		}
+
+		link, err := linkService.GetLinkByCode(r.Context(), r.PathValue("shortCode"))
+		if err != nil {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to get link")
+			return
+		}
+
+		if link == nil {
+			util.WriteError(w, http.StatusNotFound, "Link not found")
+			return
+		}
+
+		// Check ownership
+		if link.UserID == nil || *link.UserID != claims.UserID {
+			util.WriteError(w, http.StatusForbidden, "Not authorized to revoke share tokens for this link")
+			return
+		}
+
+		if err := shareService.RevokeShareToken(r.Context(), link.ID, id); err != nil {
+			switch {
+			case errors.Is(err, service.ErrShareTokenNotFound):
+				util.WriteError(w, http.StatusNotFound, "Share token not found")
+			default:
+				util.WriteError(w, http.StatusInternalServerError, "Failed to revoke share token")
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handlerSharedAnalytics serves a link's analytics to anyone holding a valid
+// share token. Filtered traffic is never included.
+func handlerSharedAnalytics(shareService service.ShareProvider, analyticsService analytics.AnalyticsProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		shareToken, err := shareService.ResolveShareToken(r.Context(), r.PathValue("token"))
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrShareTokenNotFound):
+				util.WriteError(w, http.StatusNotFound, "Share link not found or expired")
+			default:
+				util.WriteError(w, http.StatusInternalServerError, "Failed to resolve share link")
+			}
+			return
+		}
+
+		query, err := parseAnalyticsQuery(r)
+		if err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid time zone")
+			return
+		}
+
+		analyticsSummary, err := analyticsService.RetrieveAnalytics(r.Context(), shareToken.LinkID, query)
+		if err != nil {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to retrieve analytics")
+			return
+		}
+
+		// Revoking has to take effect immediately
+		w.Header().Set("Cache-Control", "no-store")
+		util.WriteJSON(w, http.StatusOK, analyticsSummary)
+	}
+}
+
+func handlerAccountAnalytics(analyticsService analytics.AnalyticsProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		query := model.AnalyticsQuery{
+			Period:   r.URL.Query().Get("period"),
+			Interval: r.URL.Query().Get("interval"),
+		}
+		if query.Period == "" {
+			query.Period = "30d"
+		}
+
+		accountAnalytics, err := analyticsService.RetrieveAccountAnalytics(r.Context(), claims.UserID, query)
+		if err != nil {
+			switch {
+			case errors.Is(err, analytics.ErrInvalidInterval):
+				util.WriteError(w, http.StatusBadRequest, err.Error())
+			default:
+				util.WriteError(w, http.StatusInternalServerError, "Failed to retrieve analytics")
+			}
+			return
+		}
+		util.WriteJSON(w, http.StatusOK, accountAnalytics)
+	}
+}
+
+func handlerSetRetention(analyticsService analytics.AnalyticsProvider, defaultDays int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req model.RetentionSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		if err := analyticsService.SetRetention(r.Context(), claims.UserID, req.Days); err != nil {
+			switch {
+			case errors.Is(err, analytics.ErrInvalidRetention):
+				util.WriteError(w, http.StatusBadRequest, err.Error())
+			case errors.Is(err, analytics.ErrRetentionDisabled):
+				util.WriteError(w, http.StatusConflict, err.Error())
+			default:
+				util.WriteError(w, http.StatusInternalServerError, "Failed to update retention")
+			}
+			return
+		}
+
+		util.WriteJSON(w, http.StatusOK, model.RetentionSettings{Days: req.Days, DefaultDays: defaultDays})
+	}
+}
+
+func handlerSetConversionTracking(linkService service.LinkProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req model.ConversionTrackingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		link, err := linkService.GetLinkByCode(r.Context(), r.PathValue("shortCode"))
+		if err != nil {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to get link")
+			return
+		}
+
+		if link == nil {
+			util.WriteError(w, http.StatusNotFound, "Link not found")
+			return
+		}
+
+		// Check ownership
+		if link.UserID == nil || *link.UserID != claims.UserID {
+			util.WriteError(w, http.StatusForbidden, "Not authorized to update this link")
+			return
+		}
+
+		if err := linkService.SetConversionTracking(r.Context(), link, req.Enabled); err != nil {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to update conversion tracking")
+			return
+		}
+
+		util.WriteJSON(w, http.StatusOK, link)
+	}
+}
+
+// handlerConversion is called by destination sites, usually from another
+// origin. A text/plain body (as sent by navigator.sendBeacon) is accepted so
+// browsers don't need a preflight; the signed click ID is the only credential.
+func handlerConversion(analyticsService analytics.AnalyticsProvider, signer *analytics.ClickIDSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		var req model.ConversionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		if err := recordConversion(r.Context(), analyticsService, signer, req.ClickID); err != nil {
+			switch {
+			case errors.Is(err, analytics.ErrInvalidClickID), errors.Is(err, analytics.ErrClickIDExpired):
+				util.WriteError(w, http.StatusBadRequest, err.Error())
+			default:
+				util.WriteError(w, http.StatusInternalServerError, "Failed to record conversion")
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// transparentGIF is a 1x1 transparent GIF served by the conversion pixel.
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// handlerConversionPixel records a conversion from an <img> tag on the
+// destination's thank-you page. It always serves the pixel so a bad click ID
+// never shows up as a broken image.
+func handlerConversionPixel(analyticsService analytics.AnalyticsProvider, signer *analytics.ClickIDSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clickID := r.URL.Query().Get("click_id")
+		if err := recordConversion(r.Context(), analyticsService, signer, clickID); err != nil {
+			log.Printf("conversion pixel: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "image/gif")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(transparentGIF)
+	}
+}
+
+func recordConversion(ctx context.Context, analyticsService analytics.AnalyticsProvider, signer *analytics.ClickIDSigner, clickID string) error {
+	linkID, err := signer.Verify(clickID, time.Now())
+	if err != nil {
+		return err
+	}
+	return analyticsService.RecordConversion(ctx, linkID, clickID)
+}
+
+func handlerExportLinkEvents(analyticsService analytics.AnalyticsProvider, linkService service.LinkProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		shortCode := r.PathValue("shortCode")
+
+		link, err := linkService.GetLinkByCode(r.Context(), shortCode)
+		if err != nil {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to get link")
+			return
+		}
+
+		if link == nil {
+			util.WriteError(w, http.StatusNotFound, "Link not found")
+			return
+		}
+
+		if link.UserID == nil || *link.UserID != claims.UserID {
+			util.WriteError(w, http.StatusForbidden, "Not authorized to export analytics for this link")
+			return
+		}
+
+		filter := model.AnalyticsExportFilter{LinkID: &link.ID}
+		streamExport(w, r, analyticsService, filter, shortCode)
+	}
+}
+
+func handlerExportAccountEvents(analyticsService analytics.AnalyticsProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		filter := model.AnalyticsExportFilter{UserID: &claims.UserID}
+		streamExport(w, r, analyticsService, filter, "account")
+	}
+}
+
+// How long each batch of exported rows may take to reach the client. The
+// server-wide WriteTimeout would otherwise cut off large exports.
+const exportWriteTimeout = 30 * time.Second
+
+// streamExport writes events as they come off the database cursor. Once the
+// first row is out the status can't change, so later errors are only logged.
+func streamExport(w http.ResponseWriter, r *http.Request, analyticsService analytics.AnalyticsProvider, filter model.AnalyticsExportFilter, name string) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+
+	// Default to the previous 24 hours, which suits a nightly load
+	filter.To = time.Now().UTC()
+	if to := r.URL.Query().Get("to"); to != "" {
+		parsed, err := util.ParseTimeParam(to)
+		if err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid 'to' time")
+			return
+		}
+		filter.To = parsed
+	}
+
+	filter.From = filter.To.Add(-24 * time.Hour)
+	if from := r.URL.Query().Get("from"); from != "" {
+		parsed, err := util.ParseTimeParam(from)
+		if err != nil {
+			util.WriteError(w, http.StatusBadRequest, "Invalid 'from' time")
+			return
+		}
+		filter.From = parsed
+	}
+
+	if !filter.From.Before(filter.To) {
+		util.WriteError(w, http.StatusBadRequest, "'from' must be before 'to'")
+		return
+	}
+
+	writer, err := export.NewWriter(format, w)
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, "Unsupported export format")
+		return
+	}
+
+	filename := fmt.Sprintf("clicks-%s-%s-%s.%s", name, filter.From.Format("20060102T150405Z"), filter.To.Format("20060102T150405Z"), format)
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+
+	rows := 0
+	err = analyticsService.ExportEvents(r.Context(), filter, func(event *model.AnalyticsEvent) error {
+		if err := writer.Write(event); err != nil {
+			return err
+		}
+
+		rows++
+		if rows%1000 == 0 {
+			_ = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Export error after %d rows: %v", rows, err)
+		if rows == 0 {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to export analytics")
+		}
+		return
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Printf("Export error closing writer: %v", err)
+	}
+}
+
+func handlerLiveClicks(linkService service.LinkProvider, broker *stream.Broker, heartbeat time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		shortCode := r.PathValue("shortCode")
+
+		link, err := linkService.GetLinkByCode(r.Context(), shortCode)
+		if err != nil {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to get link")
+			return
+		}
+
+		if link == nil {
+			util.WriteError(w, http.StatusNotFound, "Link not found")
+			return
+		}
+
+		if link.UserID == nil || *link.UserID != claims.UserID {
+			util.WriteError(w, http.StatusForbidden, "Not authorized to view clicks for this link")
+			return
+		}
+
+		sub, err := broker.Subscribe(claims.UserID, link.ID)
+		if err != nil {
+			util.WriteError(w, http.StatusTooManyRequests, "Too many live connections")
+			return
+		}
+		defer broker.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no") // Stop nginx from buffering the stream
+
+		rc := http.NewResponseController(w)
+
+		// Each write gets its own deadline so the server-wide WriteTimeout
+		// doesn't end the stream
+		send := func(message string) error {
+			_ = rc.SetWriteDeadline(time.Now().Add(heartbeat + 10*time.Second))
+			if _, err := io.WriteString(w, message); err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+
+		if err := send("retry: 5000\n\n"); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				if err := send(": heartbeat\n\n"); err != nil {
+					return
+				}
+			case click, ok := <-sub.C:
+				if !ok {
+					return
+				}
+
+				payload, err := json.Marshal(click)
+				if err != nil {
+					log.Printf("Live click encode error: %v", err)
+					continue
+				}
+
+				if err := send(fmt.Sprintf("event: click\ndata: %s\n\n", payload)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func handlerListLinks(linkService service.LinkProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		links, total, err := linkService.GetUserLinks(r.Context(), claims.UserID, 10, 0)
+		if err != nil {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to list links")
+			return
+		}
+		util.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"links": links,
+			"total": total,
+		})
+	}
+}
+
+func handlerDeleteLink(linkService service.LinkProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		shortCode := r.PathValue("shortCode")
 		err := linkService.DeleteLink(r.Context(), shortCode, claims.UserID)
 		if err != nil {
 			switch {
@@ -408,18 +1977,38 @@ func handlerDeleteLink(linkService service.LinkProvider) http.HandlerFunc {
 
 func handlerCORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Conversions are posted from advertisers' sites without credentials,
+		// so any origin may send them, JSON bodies included
+		if r.URL.Path == "/api/v1/conversions" {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		origin := r.Header.Get("Origin")
 		allowedOrigins := getAllowedOrigins()
 
 		for _, allowed := range allowedOrigins {
 			if origin == allowed || allowed == "*" {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
+				// Lets the frontend send the session cookies with credentials: "include"
+				if origin == allowed {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
 				break
 			}
 		}
 
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+auth.CSRFHeader)
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -430,6 +2019,52 @@ func handlerCORSMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// appURL is where the frontend is served, for links in emails.
+func appURL() string {
+	if value := os.Getenv("APP_URL"); value != "" {
+		return value
+	}
+	return "http://localhost:3000"
+}
+
+// oidcProviders reads the "Sign in with" providers from the environment:
+// OIDC_PROVIDERS lists names such as google,keycloak, and each has
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET.
+// Callbacks go to OIDC_REDIRECT_BASE_URL, which defaults to APP_URL for a
+// frontend that proxies /api.
+func oidcProviders() map[string]*oidc.Provider {
+	providers := map[string]*oidc.Provider{}
+
+	redirectBase := os.Getenv("OIDC_REDIRECT_BASE_URL")
+	if redirectBase == "" {
+		redirectBase = appURL()
+	}
+	redirectBase = strings.TrimRight(redirectBase, "/")
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		config := oidc.Config{
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  redirectBase + "/api/v1/auth/oidc/" + url.PathEscape(name) + "/callback",
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			log.Fatalf("OIDC provider %q needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+
+		providers[name] = oidc.NewProvider(config)
+		log.Printf("Sign in with %s is enabled, callback %s", name, config.RedirectURL)
+	}
+
+	return providers
+}
+
 func getAllowedOrigins() []string {
 	origins := os.Getenv("ALLOWED_ORIGINS")
 	if origins == "" {
@@ -456,14 +2091,26 @@ func handlerHealth() http.HandlerFunc {
 	}
 }
 
-func handlerMe() http.HandlerFunc {
+func handlerMe(svc auth.AuthProvider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims, _ := auth.GetClaimsFromContext(r.Context())
 
+		verified, err := svc.EmailVerified(r.Context(), claims.UserID)
+		if err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				util.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			log.Printf("Email verification lookup error: %v", err)
+			util.WriteError(w, http.StatusInternalServerError, "Failed to get user")
+			return
+		}
+
 		// Return the user info based on the ID in the token claims
 		util.WriteJSON(w, http.StatusOK, map[string]interface{}{
-			"id":    claims.UserID,
-			"email": claims.Email,
+			"id":             claims.UserID,
+			"email":          claims.Email,
+			"email_verified": verified,
 		})
 	}
 }
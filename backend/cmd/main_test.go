@@ -3,12 +3,17 @@
 package main
 
 import (
+	"archive/zip"
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"errors" // Needed for simulating internal errors
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,9 +21,13 @@ import (
 	"github.com/Unhyphenated/shrinks-backend/internal/auth"
 	"github.com/Unhyphenated/shrinks-backend/internal/cache"
 	"github.com/Unhyphenated/shrinks-backend/internal/encoding"
+	"github.com/Unhyphenated/shrinks-backend/internal/export"
+	"github.com/Unhyphenated/shrinks-backend/internal/geoip"
 	"github.com/Unhyphenated/shrinks-backend/internal/model"
 	"github.com/Unhyphenated/shrinks-backend/internal/service"
 	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+	"github.com/Unhyphenated/shrinks-backend/internal/stream"
+	"github.com/Unhyphenated/shrinks-backend/internal/util"
 )
 
 type MockConfig struct {
@@ -53,7 +62,7 @@ func newMockAnalytics() *analytics.MockAnalytics {
 		RecordEventFn: func(ctx context.Context, event *model.AnalyticsEvent) error {
 			return nil
 		},
-		RetrieveAnalyticsFn: func(ctx context.Context, linkID uint64, period string) (*model.AnalyticsSummary, error) {
+		RetrieveAnalyticsFn: func(ctx context.Context, linkID uint64, query model.AnalyticsQuery) (*model.AnalyticsSummary, error) {
 			return nil, nil
 		},
 	}
@@ -87,7 +96,7 @@ func TestHandlerShorten_Success(t *testing.T) {
 	mockCache := newMockCache()
 	mockAnalytics := newMockAnalytics()
 
-	svc := service.NewLinkService(mockStore, mockCache, mockAnalytics)
+	svc := service.NewLinkService(mockStore, mockCache, mockAnalytics, nil)
 	handler := handlerShorten(svc)
 
 	reqBody := model.CreateLinkRequest{URL: expectedLongURL}
@@ -130,7 +139,7 @@ func TestHandlerShorten_InternalServerError(t *testing.T) {
 	mockCache := newMockCache()
 	mockAnalytics := newMockAnalytics()
 
-	svc := service.NewLinkService(mockStore, mockCache, mockAnalytics)
+	svc := service.NewLinkService(mockStore, mockCache, mockAnalytics, nil)
 	handler := handlerShorten(svc)
 
 	reqBody := model.CreateLinkRequest{URL: testURL}
@@ -159,7 +168,7 @@ func TestHandlerShorten_BadRequest(t *testing.T) {
 	mockStore := newMockStore(cfg)
 	mockCache := newMockCache()
 	mockAnalytics := newMockAnalytics()
-	svc := service.NewLinkService(mockStore, mockCache, mockAnalytics)
+	svc := service.NewLinkService(mockStore, mockCache, mockAnalytics, nil)
 	handler := handlerShorten(svc)
 
 	invalidBody := `{"not_a_url_field": "test"}`
@@ -187,8 +196,8 @@ func TestHandlerRedirect_Success(t *testing.T) {
 	mockCache := newMockCache()
 	mockAnalytics := newMockAnalytics()
 
-	svc := service.NewLinkService(mockStore, mockCache, mockAnalytics)
-	handler := handlerRedirect(svc)
+	svc := service.NewLinkService(mockStore, mockCache, mockAnalytics, nil)
+	handler := handlerRedirect(svc, nil, nil, util.PrivacyConfig{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/links/abc123", nil)
 	req.SetPathValue("shortCode", "abc123")
@@ -215,8 +224,8 @@ func TestHandlerRedirect_NotFound(t *testing.T) {
 	mockCache := newMockCache()
 	mockAnalytics := newMockAnalytics()
 
-	svc := service.NewLinkService(mockStore, mockCache, mockAnalytics)
-	handler := handlerRedirect(svc)
+	svc := service.NewLinkService(mockStore, mockCache, mockAnalytics, nil)
+	handler := handlerRedirect(svc, nil, nil, util.PrivacyConfig{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/links/nonexistent", nil)
 	req.SetPathValue("shortCode", "nonexistent")
@@ -229,6 +238,322 @@ func TestHandlerRedirect_NotFound(t *testing.T) {
 	}
 }
 
+func TestHandlerRedirect_GeoEnrichment(t *testing.T) {
+	var capturedEvent *model.AnalyticsEvent
+	var lookedUpIP string
+
+	mockLinkService := newMockLinkService()
+	mockLinkService.RedirectFn = func(ctx context.Context, shortCode string, event *model.AnalyticsEvent) (string, error) {
+		capturedEvent = event
+		return "https://example.com/destination", nil
+	}
+
+	locator := &geoip.MockLocator{
+		LookupFn: func(ip string) (geoip.Location, error) {
+			lookedUpIP = ip
+			return geoip.Location{Country: "GB", Region: "England", City: "London"}, nil
+		},
+	}
+
+	handler := handlerRedirect(mockLinkService, locator, analytics.NewVisitorHasher("test-secret"), util.PrivacyConfig{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/links/abc123", nil)
+	req.SetPathValue("shortCode", "abc123")
+	req.Header.Set("X-Forwarded-For", "81.2.69.142")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("Status = %d, want %d", rr.Code, http.StatusFound)
+	}
+
+	// Lookup must see the raw IP, storage only the anonymized one
+	if lookedUpIP != "81.2.69.142" {
+		t.Errorf("Lookup IP = %s, want 81.2.69.142", lookedUpIP)
+	}
+	if capturedEvent.IPAddress != "81.2.69.0" {
+		t.Errorf("IPAddress = %s, want 81.2.69.0", capturedEvent.IPAddress)
+	}
+	if capturedEvent.VisitorHash == "" {
+		t.Error("Expected visitor hash to be set")
+	}
+	if capturedEvent.Country != "GB" || capturedEvent.Region != "England" || capturedEvent.City != "London" {
+		t.Errorf("Location = %s/%s/%s, want GB/England/London", capturedEvent.Country, capturedEvent.Region, capturedEvent.City)
+	}
+}
+
+func TestHandlerRedirect_ClientHintsAndLanguage(t *testing.T) {
+	var capturedEvent *model.AnalyticsEvent
+
+	mockLinkService := newMockLinkService()
+	mockLinkService.RedirectFn = func(ctx context.Context, shortCode string, event *model.AnalyticsEvent) (string, error) {
+		capturedEvent = event
+		return "https://example.com/destination", nil
+	}
+
+	handler := handlerRedirect(mockLinkService, nil, nil, util.PrivacyConfig{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/links/abc123", nil)
+	req.SetPathValue("shortCode", "abc123")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36")
+	req.Header.Set("Sec-CH-UA-Platform", `"Android"`)
+	req.Header.Set("Sec-CH-UA-Mobile", "?0")
+	req.Header.Set("Accept-Language", "de-de,de;q=0.9,en;q=0.8")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("Status = %d, want %d", rr.Code, http.StatusFound)
+	}
+	if capturedEvent.OS != "Android" || capturedEvent.DeviceType != "Tablet" {
+		t.Errorf("Device = %s/%s, want Android/Tablet from client hints", capturedEvent.OS, capturedEvent.DeviceType)
+	}
+	if capturedEvent.Language != "de-DE" {
+		t.Errorf("Language = %q, want de-DE", capturedEvent.Language)
+	}
+}
+
+func TestHandlerRedirect_OptedOutSkipsIPAndUserAgent(t *testing.T) {
+	for _, header := range []string{"DNT", "Sec-GPC"} {
+		t.Run(header, func(t *testing.T) {
+			var capturedEvent *model.AnalyticsEvent
+
+			mockLinkService := newMockLinkService()
+			mockLinkService.RedirectFn = func(ctx context.Context, shortCode string, event *model.AnalyticsEvent) (string, error) {
+				capturedEvent = event
+				return "https://example.com/destination", nil
+			}
+
+			locator := &geoip.MockLocator{
+				LookupFn: func(ip string) (geoip.Location, error) {
+					return geoip.Location{Country: "GB", Region: "England", City: "London"}, nil
+				},
+			}
+
+			handler := handlerRedirect(mockLinkService, locator, analytics.NewVisitorHasher("test-secret"), util.PrivacyConfig{})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/links/abc123", nil)
+			req.SetPathValue("shortCode", "abc123")
+			req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148 Safari/604.1")
+			req.Header.Set(header, "1")
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusFound {
+				t.Fatalf("Status = %d, want %d", rr.Code, http.StatusFound)
+			}
+			if capturedEvent.IPAddress != "" || capturedEvent.UserAgent != "" || capturedEvent.VisitorHash != "" {
+				t.Errorf("Expected no IP, user agent or visitor hash, got %q/%q/%q", capturedEvent.IPAddress, capturedEvent.UserAgent, capturedEvent.VisitorHash)
+			}
+			if capturedEvent.RawUserAgent == "" {
+				t.Error("Expected the raw user agent to be kept for bot filtering")
+			}
+			if capturedEvent.City != "" {
+				t.Errorf("City = %s, want empty", capturedEvent.City)
+			}
+			if capturedEvent.DeviceType != "Mobile" || capturedEvent.Country != "GB" {
+				t.Errorf("DeviceType/Country = %s/%s, want Mobile/GB", capturedEvent.DeviceType, capturedEvent.Country)
+			}
+		})
+	}
+}
+
+func TestHandlerExportLinkEvents_NDJSON(t *testing.T) {
+	userID := uint64(1)
+	mockLinkService := &service.MockLinkService{
+		GetLinkByCodeFn: func(ctx context.Context, code string) (*model.Link, error) {
+			return &model.Link{ID: 100, UserID: &userID, ShortCode: "abc123"}, nil
+		},
+	}
+
+	var capturedFilter model.AnalyticsExportFilter
+	mockAnalytics := &analytics.MockAnalytics{
+		ExportEventsFn: func(ctx context.Context, filter model.AnalyticsExportFilter, fn func(event *model.AnalyticsEvent) error) error {
+			capturedFilter = filter
+			for i := uint64(1); i <= 3; i++ {
+				if err := fn(&model.AnalyticsEvent{ID: i, LinkID: 100, DeviceType: "Desktop"}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	handler := handlerExportLinkEvents(mockAnalytics, mockLinkService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/links/abc123/export?format=ndjson&from=2026-02-01&to=2026-02-02", nil)
+	req.SetPathValue("shortCode", "abc123")
+	ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: userID})
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if rr.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("Content-Type = %s, want application/x-ndjson", rr.Header().Get("Content-Type"))
+	}
+	if capturedFilter.LinkID == nil || *capturedFilter.LinkID != 100 {
+		t.Error("Expected export to be scoped to link 100")
+	}
+	if !capturedFilter.From.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) || !capturedFilter.To.Equal(time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Range = %v - %v, want 2026-02-01 - 2026-02-02", capturedFilter.From, capturedFilter.To)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(rr.Body.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Errorf("Got %d lines, want 3", len(lines))
+	}
+}
+
+func TestHandlerExportLinkEvents_Forbidden(t *testing.T) {
+	ownerID := uint64(1)
+	mockLinkService := &service.MockLinkService{
+		GetLinkByCodeFn: func(ctx context.Context, code string) (*model.Link, error) {
+			return &model.Link{ID: 100, UserID: &ownerID, ShortCode: "abc123"}, nil
+		},
+	}
+
+	handler := handlerExportLinkEvents(newMockAnalytics(), mockLinkService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/links/abc123/export", nil)
+	req.SetPathValue("shortCode", "abc123")
+	ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 999})
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusForbidden)
+	}
+}
+
+func TestHandlerExportAccountEvents_BadRequest(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"Unsupported format", "?format=xlsx"},
+		{"Invalid time", "?from=yesterday"},
+		{"Inverted range", "?from=2026-02-02&to=2026-02-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := handlerExportAccountEvents(newMockAnalytics())
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/analytics/export"+tt.query, nil)
+			ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 1})
+			req = req.WithContext(ctx)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Status = %d, want %d", rr.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestHandlerLiveClicks_StreamsClicks(t *testing.T) {
+	userID := uint64(1)
+	mockLinkService := &service.MockLinkService{
+		GetLinkByCodeFn: func(ctx context.Context, code string) (*model.Link, error) {
+			return &model.Link{ID: 100, UserID: &userID, ShortCode: "abc123"}, nil
+		},
+	}
+
+	broker := stream.NewBroker(10, 10)
+	handler := handlerLiveClicks(mockLinkService, broker, 20*time.Millisecond)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("shortCode", "abc123")
+		ctx := context.WithValue(r.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: userID})
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Content-Type = %s, want text/event-stream", resp.Header.Get("Content-Type"))
+	}
+
+	_ = broker.Publish(context.Background(), model.LiveClick{LinkID: 100, DeviceType: "Mobile"})
+
+	sawHeartbeat := false
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Stream ended before click arrived: %v", err)
+		}
+		if strings.HasPrefix(line, ": heartbeat") {
+			sawHeartbeat = true
+		}
+		if strings.HasPrefix(line, "data: ") {
+			var click model.LiveClick
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &click); err != nil {
+				t.Fatalf("Invalid click payload: %v", err)
+			}
+			if click.DeviceType != "Mobile" {
+				t.Errorf("DeviceType = %s, want Mobile", click.DeviceType)
+			}
+			break
+		}
+	}
+
+	// Keep reading until a heartbeat shows up
+	for !sawHeartbeat {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Stream ended before heartbeat: %v", err)
+		}
+		sawHeartbeat = strings.HasPrefix(line, ": heartbeat")
+	}
+}
+
+func TestHandlerLiveClicks_ConnectionLimit(t *testing.T) {
+	userID := uint64(1)
+	mockLinkService := &service.MockLinkService{
+		GetLinkByCodeFn: func(ctx context.Context, code string) (*model.Link, error) {
+			return &model.Link{ID: 100, UserID: &userID, ShortCode: "abc123"}, nil
+		},
+	}
+
+	broker := stream.NewBroker(10, 1)
+	_, _ = broker.Subscribe(userID, 100)
+
+	handler := handlerLiveClicks(mockLinkService, broker, time.Second)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/links/abc123/live", nil)
+	req.SetPathValue("shortCode", "abc123")
+	ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: userID})
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+}
+
 func TestHandlerHealth_Success(t *testing.T) {
 	handler := handlerHealth()
 
@@ -428,7 +753,7 @@ func TestHandlerLogin_NonExistentUser(t *testing.T) {
 func TestHandlerRefresh_Success(t *testing.T) {
 	mockAuthService := &auth.MockAuthService{
 		RefreshAccessTokenFn: func(ctx context.Context, refreshToken string) (model.RefreshTokenResponse, error) {
-			return model.RefreshTokenResponse{AccessToken: "new-access-token"}, nil
+			return model.RefreshTokenResponse{AccessToken: "new-access-token", RefreshToken: "rotated-refresh-token"}, nil
 		},
 	}
 
@@ -453,6 +778,10 @@ func TestHandlerRefresh_Success(t *testing.T) {
 	if resp.AccessToken != "new-access-token" {
 		t.Errorf("AccessToken = %s, want new-access-token", resp.AccessToken)
 	}
+
+	if resp.RefreshToken != "rotated-refresh-token" {
+		t.Errorf("RefreshToken = %s, want rotated-refresh-token", resp.RefreshToken)
+	}
 }
 
 // Test: Refresh with invalid token
@@ -499,6 +828,159 @@ func TestHandlerRefresh_ExpiredToken(t *testing.T) {
 	}
 }
 
+func TestHandlerRefresh_ReusedToken(t *testing.T) {
+	mockAuthService := &auth.MockAuthService{
+		RefreshAccessTokenFn: func(ctx context.Context, refreshToken string) (model.RefreshTokenResponse, error) {
+			return model.RefreshTokenResponse{}, auth.ErrRefreshTokenReused
+		},
+	}
+
+	handler := handlerRefresh(mockAuthService)
+
+	body := `{"refresh_token": "rotated-token"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+func findCookie(rr *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestHandlerRefresh_Cookie(t *testing.T) {
+	var presented string
+	mockAuthService := &auth.MockAuthService{
+		RefreshAccessTokenFn: func(ctx context.Context, refreshToken string) (model.RefreshTokenResponse, error) {
+			presented = refreshToken
+			return model.RefreshTokenResponse{AccessToken: "new-access-token", RefreshToken: "rotated-refresh-token"}, nil
+		},
+	}
+
+	handler := handlerRefresh(mockAuthService)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", nil)
+	req.AddCookie(&http.Cookie{Name: auth.RefreshCookieName, Value: "cookie-refresh-token"})
+	req.AddCookie(&http.Cookie{Name: auth.CSRFCookieName, Value: "csrf"})
+	req.Header.Set(auth.CSRFHeader, "csrf")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	if presented != "cookie-refresh-token" {
+		t.Errorf("Refreshed with %q, want cookie-refresh-token", presented)
+	}
+
+	var resp model.RefreshTokenResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	if resp.RefreshToken != "" {
+		t.Errorf("RefreshToken = %s, want it only in the cookie", resp.RefreshToken)
+	}
+
+	refresh := findCookie(rr, auth.RefreshCookieName)
+	if refresh == nil || refresh.Value != "rotated-refresh-token" || !refresh.HttpOnly {
+		t.Errorf("Refresh cookie = %+v, want HttpOnly rotated-refresh-token", refresh)
+	}
+
+	csrf := findCookie(rr, auth.CSRFCookieName)
+	if csrf == nil || csrf.Value == "" || csrf.Value == "csrf" || csrf.HttpOnly {
+		t.Errorf("CSRF cookie = %+v, want a new readable token", csrf)
+	}
+}
+
+func TestHandlerRefresh_CookieWithoutCSRF(t *testing.T) {
+	mockAuthService := &auth.MockAuthService{
+		RefreshAccessTokenFn: func(ctx context.Context, refreshToken string) (model.RefreshTokenResponse, error) {
+			t.Error("RefreshAccessToken should not be called without a CSRF token")
+			return model.RefreshTokenResponse{}, nil
+		},
+	}
+
+	handler := handlerRefresh(mockAuthService)
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"missing header", ""},
+		{"mismatched header", "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", nil)
+			req.AddCookie(&http.Cookie{Name: auth.RefreshCookieName, Value: "cookie-refresh-token"})
+			req.AddCookie(&http.Cookie{Name: auth.CSRFCookieName, Value: "csrf"})
+			if tt.header != "" {
+				req.Header.Set(auth.CSRFHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusForbidden {
+				t.Errorf("Status = %d, want %d", rr.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
+
+func TestHandlerRefresh_NoToken(t *testing.T) {
+	handler := handlerRefresh(&auth.MockAuthService{})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandlerRefresh_CookieReusedClearsCookies(t *testing.T) {
+	mockAuthService := &auth.MockAuthService{
+		RefreshAccessTokenFn: func(ctx context.Context, refreshToken string) (model.RefreshTokenResponse, error) {
+			return model.RefreshTokenResponse{}, auth.ErrRefreshTokenReused
+		},
+	}
+
+	handler := handlerRefresh(mockAuthService)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", nil)
+	req.AddCookie(&http.Cookie{Name: auth.RefreshCookieName, Value: "rotated-token"})
+	req.AddCookie(&http.Cookie{Name: auth.CSRFCookieName, Value: "csrf"})
+	req.Header.Set(auth.CSRFHeader, "csrf")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	if c := findCookie(rr, auth.RefreshCookieName); c == nil || c.MaxAge >= 0 {
+		t.Errorf("Refresh cookie = %+v, want it cleared", c)
+	}
+}
+
 // Test #83: Delete link returns 403 for non-owner
 func TestHandlerDeleteLink_Forbidden(t *testing.T) {
 	mockLinkService := &service.MockLinkService{}
@@ -563,7 +1045,7 @@ func TestHandlerAnalytics_Success(t *testing.T) {
 	}
 
 	mockAnalytics := &analytics.MockAnalytics{
-		RetrieveAnalyticsFn: func(ctx context.Context, linkID uint64, period string) (*model.AnalyticsSummary, error) {
+		RetrieveAnalyticsFn: func(ctx context.Context, linkID uint64, query model.AnalyticsQuery) (*model.AnalyticsSummary, error) {
 			return &model.AnalyticsSummary{
 				LinkID:         linkID,
 				TotalClicks:    42,
@@ -676,57 +1158,155 @@ func TestHandlerAnalytics_NotFound(t *testing.T) {
 	}
 }
 
-// Test #80: List links returns paginated results
-func TestHandlerListLinks_Success(t *testing.T) {
+func TestHandlerAnalytics_Compare(t *testing.T) {
 	userID := uint64(1)
 	mockLinkService := &service.MockLinkService{
-		GetUserLinksFn: func(ctx context.Context, uid uint64, limit, offset int) ([]model.Link, int, error) {
-			return []model.Link{
-				{ID: 1, ShortCode: "link1", LongURL: "https://example.com/1"},
-				{ID: 2, ShortCode: "link2", LongURL: "https://example.com/2"},
-			}, 5, nil // 5 total
+		GetLinkByCodeFn: func(ctx context.Context, code string) (*model.Link, error) {
+			return &model.Link{ID: 100, UserID: &userID, ShortCode: "abc123"}, nil
 		},
 	}
 
-	handler := handlerListLinks(mockLinkService)
-
-	req := httptest.NewRequest(http.MethodGet, "/api/v1/links?limit=2&offset=0", nil)
+	var gotQuery model.AnalyticsQuery
+	mockAnalytics := &analytics.MockAnalytics{
+		RetrieveAnalyticsFn: func(ctx context.Context, linkID uint64, query model.AnalyticsQuery) (*model.AnalyticsSummary, error) {
+			gotQuery = query
+			return &model.AnalyticsSummary{
+				LinkID:      linkID,
+				TotalClicks: 12,
+				Comparison: &model.AnalyticsComparison{
+					TotalClicks: model.Delta{Current: 12, Previous: 8, Change: 4},
+				},
+			}, nil
+		},
+	}
+
+	handler := handlerLinkAnalytics(mockAnalytics, mockLinkService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/links/abc123/analytics?period=7d&compare=true", nil)
+	req.SetPathValue("shortCode", "abc123")
 	ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: userID})
 	req = req.WithContext(ctx)
-
 	rr := httptest.NewRecorder()
+
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusOK {
-		t.Errorf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if !gotQuery.Compare || gotQuery.Period != "7d" {
+		t.Errorf("Query = %+v, want 7d with compare", gotQuery)
 	}
 
-	var resp map[string]interface{}
+	var resp model.AnalyticsSummary
 	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
-		t.Fatalf("Failed to decode: %v", err)
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Comparison == nil || resp.Comparison.TotalClicks.Change != 4 {
+		t.Errorf("Comparison = %+v, want total clicks change of 4", resp.Comparison)
 	}
+}
 
-	links := resp["links"].([]interface{})
-	if len(links) != 2 {
-		t.Errorf("Got %d links, want 2", len(links))
+func TestHandlerAnalytics_TimeZone(t *testing.T) {
+	userID := uint64(1)
+	mockLinkService := &service.MockLinkService{
+		GetLinkByCodeFn: func(ctx context.Context, code string) (*model.Link, error) {
+			return &model.Link{ID: 100, UserID: &userID, ShortCode: "abc123"}, nil
+		},
 	}
 
-	total := int(resp["total"].(float64))
-	if total != 5 {
-		t.Errorf("Total = %d, want 5", total)
+	var gotLocation *time.Location
+	mockAnalytics := &analytics.MockAnalytics{
+		RetrieveAnalyticsFn: func(ctx context.Context, linkID uint64, query model.AnalyticsQuery) (*model.AnalyticsSummary, error) {
+			gotLocation = query.Location
+			return &model.AnalyticsSummary{LinkID: linkID}, nil
+		},
+	}
+
+	handler := handlerLinkAnalytics(mockAnalytics, mockLinkService)
+
+	tests := []struct {
+		name   string
+		tz     string
+		status int
+		want   string
+	}{
+		{"Default", "", http.StatusOK, "UTC"},
+		{"IANA zone", "Asia/Tokyo", http.StatusOK, "Asia/Tokyo"},
+		{"Unknown zone", "Nowhere/Special", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotLocation = nil
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/links/abc123/analytics?tz="+tt.tz, nil)
+			req.SetPathValue("shortCode", "abc123")
+			ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: userID})
+			req = req.WithContext(ctx)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("Status = %d, want %d", rr.Code, tt.status)
+			}
+			if tt.want != "" && (gotLocation == nil || gotLocation.String() != tt.want) {
+				t.Errorf("Location = %v, want %s", gotLocation, tt.want)
+			}
+		})
 	}
 }
 
-// Test #81: List links returns 401 without auth
-func TestHandlerListLinks_Unauthorized(t *testing.T) {
-	mockLinkService := newMockLinkService()
+func TestHandlerAccountAnalytics_Success(t *testing.T) {
+	var gotUserID uint64
+	var gotQuery model.AnalyticsQuery
+	mockAnalytics := &analytics.MockAnalytics{
+		RetrieveAccountAnalyticsFn: func(ctx context.Context, userID uint64, query model.AnalyticsQuery) (*model.AccountAnalytics, error) {
+			gotUserID = userID
+			gotQuery = query
+			return &model.AccountAnalytics{
+				Period:      query.Period,
+				Interval:    query.Interval,
+				TotalClicks: 120,
+				TopLinks:    []model.TopLink{{ShortCode: "abc123", Clicks: 100}},
+			}, nil
+		},
+	}
 
-	handler := handlerListLinks(mockLinkService)
+	handler := handlerAccountAnalytics(mockAnalytics)
 
-	req := httptest.NewRequest(http.MethodGet, "/api/v1/links", nil)
-	// No auth
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/analytics?interval=week", nil)
+	ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7})
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if gotUserID != 7 {
+		t.Errorf("UserID = %d, want 7", gotUserID)
+	}
+	if gotQuery.Period != "30d" || gotQuery.Interval != "week" {
+		t.Errorf("Query = %+v, want period 30d, interval week", gotQuery)
+	}
+
+	var resp model.AccountAnalytics
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.TotalClicks != 120 || len(resp.TopLinks) != 1 {
+		t.Errorf("Response = %+v, want 120 clicks and one top link", resp)
+	}
+}
+
+func TestHandlerAccountAnalytics_Unauthorized(t *testing.T) {
+	handler := handlerAccountAnalytics(newMockAnalytics())
 
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/analytics", nil)
 	rr := httptest.NewRecorder()
+
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusUnauthorized {
@@ -734,85 +1314,1665 @@ func TestHandlerListLinks_Unauthorized(t *testing.T) {
 	}
 }
 
-// Test #82: Delete link returns 204
-func TestHandlerDeleteLink_Success(t *testing.T) {
-	userID := uint64(1)
-	deleteCalled := false
-
-	mockLinkService := &service.MockLinkService{
-		DeleteLinkFn: func(ctx context.Context, shortCode string, uid uint64) error {
-			deleteCalled = true
-			return nil // Success
+func TestHandlerAccountAnalytics_InvalidInterval(t *testing.T) {
+	mockAnalytics := &analytics.MockAnalytics{
+		RetrieveAccountAnalyticsFn: func(ctx context.Context, userID uint64, query model.AnalyticsQuery) (*model.AccountAnalytics, error) {
+			return nil, analytics.ErrInvalidInterval
 		},
 	}
 
-	handler := handlerDeleteLink(mockLinkService)
+	handler := handlerAccountAnalytics(mockAnalytics)
 
-	req := httptest.NewRequest(http.MethodDelete, "/api/v1/links/abc123", nil)
-	req.SetPathValue("shortCode", "abc123")
-	ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: userID})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/analytics?interval=hour", nil)
+	ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 1})
 	req = req.WithContext(ctx)
-
 	rr := httptest.NewRecorder()
+
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusNoContent {
-		t.Errorf("Status = %d, want %d", rr.Code, http.StatusNoContent)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusBadRequest)
 	}
+}
 
-	if !deleteCalled {
-		t.Error("DeleteLink was not called")
+func TestHandlerSetRetention(t *testing.T) {
+	mockAnalytics := &analytics.MockAnalytics{
+		SetRetentionFn: func(ctx context.Context, userID uint64, days *int) error {
+			if days != nil && *days == 7 {
+				return analytics.ErrRetentionDisabled
+			}
+			if days != nil && *days > 90 {
+				return fmt.Errorf("%w: must be between 1 and 90 days", analytics.ErrInvalidRetention)
+			}
+			return nil
+		},
+	}
+
+	handler := handlerSetRetention(mockAnalytics, 90)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"Override", `{"days": 30}`, http.StatusOK},
+		{"Reset to default", `{"days": null}`, http.StatusOK},
+		{"Longer than the default", `{"days": 365}`, http.StatusBadRequest},
+		{"Events kept forever", `{"days": 7}`, http.StatusConflict},
+		{"Malformed", `{"days": "thirty"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/analytics/retention", strings.NewReader(tt.body))
+			ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 1})
+			req = req.WithContext(ctx)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, tt.status, rr.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/analytics/retention", strings.NewReader(`{"days": 30}`))
+	ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 1})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req.WithContext(ctx))
+
+	var resp model.RetentionSettings
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Days == nil || *resp.Days != 30 || resp.DefaultDays != 90 {
+		t.Errorf("Response = %+v, want days 30, default 90", resp)
 	}
 }
 
-// Test #85: Logout returns 200
-func TestHandlerLogout_Success(t *testing.T) {
-	logoutCalled := false
+func TestHandlerCreateShareToken(t *testing.T) {
+	ownerID := uint64(1)
+	mockLinkService := &service.MockLinkService{
+		GetLinkByCodeFn: func(ctx context.Context, code string) (*model.Link, error) {
+			return &model.Link{ID: 100, UserID: &ownerID, ShortCode: "abc123"}, nil
+		},
+	}
 
-	mockAuthService := &auth.MockAuthService{
-		LogoutFn: func(ctx context.Context, refreshToken string) error {
-			logoutCalled = true
+	var gotExpiry *time.Time
+	mockShare := &service.MockShareService{
+		CreateShareTokenFn: func(ctx context.Context, linkID uint64, expiresAt *time.Time) (*model.CreateShareTokenResponse, error) {
+			gotExpiry = expiresAt
+			return &model.CreateShareTokenResponse{
+				ShareToken: model.ShareToken{ID: 1, LinkID: linkID, ExpiresAt: expiresAt},
+				Token:      "secret-token",
+			}, nil
+		},
+	}
+
+	handler := handlerCreateShareToken(mockShare, mockLinkService)
+
+	tests := []struct {
+		name       string
+		userID     uint64
+		body       string
+		status     int
+		wantExpiry bool
+	}{
+		{"No expiry", ownerID, "", http.StatusCreated, false},
+		{"With expiry", ownerID, `{"expires_at": "2030-01-01T00:00:00Z"}`, http.StatusCreated, true},
+		{"Not owner", 999, "", http.StatusForbidden, false},
+		{"Malformed", ownerID, `{"expires_at": "soon"}`, http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotExpiry = nil
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/links/abc123/shares", strings.NewReader(tt.body))
+			req.SetPathValue("shortCode", "abc123")
+			ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: tt.userID})
+			req = req.WithContext(ctx)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, tt.status, rr.Body.String())
+			}
+			if tt.status != http.StatusCreated {
+				return
+			}
+			if (gotExpiry != nil) != tt.wantExpiry {
+				t.Errorf("Expiry = %v, want set: %v", gotExpiry, tt.wantExpiry)
+			}
+
+			var resp model.CreateShareTokenResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Token != "secret-token" || resp.LinkID != 100 {
+				t.Errorf("Response = %+v, want the token for link 100", resp)
+			}
+		})
+	}
+}
+
+func TestHandlerRevokeShareToken(t *testing.T) {
+	ownerID := uint64(1)
+	mockLinkService := &service.MockLinkService{
+		GetLinkByCodeFn: func(ctx context.Context, code string) (*model.Link, error) {
+			return &model.Link{ID: 100, UserID: &ownerID, ShortCode: "abc123"}, nil
+		},
+	}
+	mockShare := &service.MockShareService{
+		RevokeShareTokenFn: func(ctx context.Context, linkID uint64, id uint64) error {
+			if id != 7 {
+				return service.ErrShareTokenNotFound
+			}
 			return nil
 		},
 	}
 
-	handler := handlerLogout(mockAuthService)
+	handler := handlerRevokeShareToken(mockShare, mockLinkService)
 
-	body := `{"refresh_token": "valid-token"}`
-	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/logout", bytes.NewReader([]byte(body)))
-	req.Header.Set("Content-Type", "application/json")
+	tests := []struct {
+		id     string
+		status int
+	}{
+		{"7", http.StatusNoContent},
+		{"8", http.StatusNotFound},
+		{"abc", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/links/abc123/shares/"+tt.id, nil)
+		req.SetPathValue("shortCode", "abc123")
+		req.SetPathValue("id", tt.id)
+		ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: ownerID})
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Errorf("Revoke %s: status = %d, want %d", tt.id, rr.Code, tt.status)
+		}
+	}
+}
 
+func TestHandlerSharedAnalytics(t *testing.T) {
+	mockShare := &service.MockShareService{
+		ResolveShareTokenFn: func(ctx context.Context, token string) (*model.ShareToken, error) {
+			if token != "good" {
+				return nil, service.ErrShareTokenNotFound
+			}
+			return &model.ShareToken{ID: 1, LinkID: 100}, nil
+		},
+	}
+
+	var gotQuery model.AnalyticsQuery
+	mockAnalytics := &analytics.MockAnalytics{
+		RetrieveAnalyticsFn: func(ctx context.Context, linkID uint64, query model.AnalyticsQuery) (*model.AnalyticsSummary, error) {
+			gotQuery = query
+			return &model.AnalyticsSummary{LinkID: linkID, TotalClicks: 9}, nil
+		},
+	}
+
+	handler := handlerSharedAnalytics(mockShare, mockAnalytics)
+
+	// No auth context: the token is the credential
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/share/good?period=7d&include_filtered=true", nil)
+	req.SetPathValue("token", "good")
 	rr := httptest.NewRecorder()
+
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusOK {
-		t.Errorf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if gotQuery.Period != "7d" || gotQuery.IncludeFiltered {
+		t.Errorf("Query = %+v, want 7d without filtered traffic", gotQuery)
+	}
+	if rr.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", rr.Header().Get("Cache-Control"))
 	}
 
-	if !logoutCalled {
-		t.Error("Logout was not called")
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/share/revoked", nil)
+	req.SetPathValue("token", "revoked")
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Revoked token status = %d, want %d", rr.Code, http.StatusNotFound)
 	}
 }
 
-// Test #86: Logout returns 401 for invalid token
-func TestHandlerLogout_InvalidToken(t *testing.T) {
-	mockAuthService := &auth.MockAuthService{
-		LogoutFn: func(ctx context.Context, refreshToken string) error {
-			return auth.ErrInvalidRefreshToken
+func TestHandlerSetConversionTracking(t *testing.T) {
+	ownerID := uint64(1)
+	var enabled bool
+	mockLinkService := &service.MockLinkService{
+		GetLinkByCodeFn: func(ctx context.Context, code string) (*model.Link, error) {
+			return &model.Link{ID: 100, UserID: &ownerID, ShortCode: "abc123"}, nil
+		},
+		SetConversionTrackingFn: func(ctx context.Context, link *model.Link, on bool) error {
+			enabled = on
+			link.ConversionTracking = on
+			return nil
 		},
 	}
 
-	handler := handlerLogout(mockAuthService)
+	handler := handlerSetConversionTracking(mockLinkService)
 
-	body := `{"refresh_token": "invalid-token"}`
-	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/logout", bytes.NewReader([]byte(body)))
-	req.Header.Set("Content-Type", "application/json")
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/links/abc123/conversion-tracking", strings.NewReader(`{"enabled": true}`))
+	req.SetPathValue("shortCode", "abc123")
+	ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: ownerID})
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req.WithContext(ctx))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var link model.Link
+	if err := json.NewDecoder(rr.Body).Decode(&link); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !enabled || !link.ConversionTracking {
+		t.Error("Conversion tracking should be enabled")
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/links/abc123/conversion-tracking", strings.NewReader(`{"enabled": true}`))
+	req.SetPathValue("shortCode", "abc123")
+	ctx = context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 2})
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req.WithContext(ctx))
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Non-owner status = %d, want %d", rr.Code, http.StatusForbidden)
+	}
+}
+
+func TestHandlerConversion(t *testing.T) {
+	signer := analytics.NewClickIDSigner("test-secret")
+	clickID, err := signer.Sign(100, time.Now())
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	expired, _ := signer.Sign(100, time.Now().Add(-analytics.ClickIDMaxAge-time.Hour))
+
+	var recorded []string
+	mockAnalytics := &analytics.MockAnalytics{
+		RecordConversionFn: func(ctx context.Context, linkID uint64, id string) error {
+			if linkID != 100 {
+				t.Errorf("Link ID = %d, want 100", linkID)
+			}
+			recorded = append(recorded, id)
+			return nil
+		},
+	}
+
+	handler := handlerConversion(mockAnalytics, signer)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"Valid", `{"click_id": "` + clickID + `"}`, http.StatusNoContent},
+		{"Forged", `{"click_id": "forged"}`, http.StatusBadRequest},
+		{"Expired", `{"click_id": "` + expired + `"}`, http.StatusBadRequest},
+		{"Malformed", `click_id=` + clickID, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Beacons arrive as text/plain, so no preflight is needed
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/conversions", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "text/plain")
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Errorf("Status = %d, want %d. Body: %s", rr.Code, tt.status, rr.Body.String())
+			}
+			if rr.Header().Get("Access-Control-Allow-Origin") != "*" {
+				t.Error("Conversions should be accepted from any origin")
+			}
+		})
+	}
+
+	if len(recorded) != 1 || recorded[0] != clickID {
+		t.Errorf("Recorded %v, want only the valid click ID", recorded)
+	}
+}
+
+func TestHandlerCORSMiddleware_ConversionPreflight(t *testing.T) {
+	t.Setenv("ALLOWED_ORIGINS", "http://localhost:3000")
 
+	called := false
+	handler := handlerCORSMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/conversions", nil)
+	req.Header.Set("Origin", "https://shop.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type")
 	rr := httptest.NewRecorder()
+
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusUnauthorized {
-		t.Errorf("Status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	if rr.Code != http.StatusNoContent || called {
+		t.Errorf("Status = %d, handler called %v; want the middleware to answer with 204", rr.Code, called)
+	}
+	if rr.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("Allow-Origin = %q, want *", rr.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if !strings.Contains(rr.Header().Get("Access-Control-Allow-Methods"), http.MethodPost) {
+		t.Errorf("Allow-Methods = %q, want POST", rr.Header().Get("Access-Control-Allow-Methods"))
+	}
+	if !strings.Contains(rr.Header().Get("Access-Control-Allow-Headers"), "Content-Type") {
+		t.Errorf("Allow-Headers = %q, want Content-Type", rr.Header().Get("Access-Control-Allow-Headers"))
+	}
+	if rr.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("Conversions should not allow credentials")
+	}
+
+	// Other routes stay limited to the configured origins
+	req = httptest.NewRequest(http.MethodOptions, "/api/v1/links", nil)
+	req.Header.Set("Origin", "https://shop.example.com")
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Allow-Origin = %q for an unlisted origin, want none", rr.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestHandlerConversionPixel(t *testing.T) {
+	signer := analytics.NewClickIDSigner("test-secret")
+	clickID, _ := signer.Sign(100, time.Now())
+
+	recorded := 0
+	mockAnalytics := &analytics.MockAnalytics{
+		RecordConversionFn: func(ctx context.Context, linkID uint64, id string) error {
+			recorded++
+			return nil
+		},
+	}
+
+	handler := handlerConversionPixel(mockAnalytics, signer)
+
+	for _, id := range []string{clickID, "forged"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/conversions/pixel.gif?click_id="+id, nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/gif" {
+			t.Errorf("Pixel for %q: status %d, type %q, want a 200 GIF", id, rr.Code, rr.Header().Get("Content-Type"))
+		}
+		if !bytes.HasPrefix(rr.Body.Bytes(), []byte("GIF89a")) {
+			t.Errorf("Pixel for %q is not a GIF", id)
+		}
+	}
+
+	if recorded != 1 {
+		t.Errorf("Recorded %d conversions, want 1", recorded)
+	}
+}
+
+// Test #80: List links returns paginated results
+func TestHandlerListLinks_Success(t *testing.T) {
+	userID := uint64(1)
+	mockLinkService := &service.MockLinkService{
+		GetUserLinksFn: func(ctx context.Context, uid uint64, limit, offset int) ([]model.Link, int, error) {
+			return []model.Link{
+				{ID: 1, ShortCode: "link1", LongURL: "https://example.com/1"},
+				{ID: 2, ShortCode: "link2", LongURL: "https://example.com/2"},
+			}, 5, nil // 5 total
+		},
+	}
+
+	handler := handlerListLinks(mockLinkService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/links?limit=2&offset=0", nil)
+	ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: userID})
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	var resp map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	links := resp["links"].([]interface{})
+	if len(links) != 2 {
+		t.Errorf("Got %d links, want 2", len(links))
+	}
+
+	total := int(resp["total"].(float64))
+	if total != 5 {
+		t.Errorf("Total = %d, want 5", total)
+	}
+}
+
+// Test #81: List links returns 401 without auth
+func TestHandlerListLinks_Unauthorized(t *testing.T) {
+	mockLinkService := newMockLinkService()
+
+	handler := handlerListLinks(mockLinkService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/links", nil)
+	// No auth
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+// Test #82: Delete link returns 204
+func TestHandlerDeleteLink_Success(t *testing.T) {
+	userID := uint64(1)
+	deleteCalled := false
+
+	mockLinkService := &service.MockLinkService{
+		DeleteLinkFn: func(ctx context.Context, shortCode string, uid uint64) error {
+			deleteCalled = true
+			return nil // Success
+		},
+	}
+
+	handler := handlerDeleteLink(mockLinkService)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/links/abc123", nil)
+	req.SetPathValue("shortCode", "abc123")
+	ctx := context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: userID})
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusNoContent)
+	}
+
+	if !deleteCalled {
+		t.Error("DeleteLink was not called")
+	}
+}
+
+// Test #85: Logout returns 200
+func TestHandlerLogout_Success(t *testing.T) {
+	logoutCalled := false
+
+	mockAuthService := &auth.MockAuthService{
+		LogoutFn: func(ctx context.Context, refreshToken string) error {
+			logoutCalled = true
+			return nil
+		},
+	}
+
+	handler := handlerLogout(mockAuthService)
+
+	body := `{"refresh_token": "valid-token"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/logout", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	if !logoutCalled {
+		t.Error("Logout was not called")
+	}
+}
+
+// Test #86: Logout returns 401 for invalid token
+func TestHandlerLogout_InvalidToken(t *testing.T) {
+	mockAuthService := &auth.MockAuthService{
+		LogoutFn: func(ctx context.Context, refreshToken string) error {
+			return auth.ErrInvalidRefreshToken
+		},
+	}
+
+	handler := handlerLogout(mockAuthService)
+
+	body := `{"refresh_token": "invalid-token"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/logout", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHandlerLogout_Cookie(t *testing.T) {
+	var loggedOut string
+	mockAuthService := &auth.MockAuthService{
+		LogoutFn: func(ctx context.Context, refreshToken string) error {
+			loggedOut = refreshToken
+			return nil
+		},
+	}
+
+	handler := handlerLogout(mockAuthService)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/logout", nil)
+	req.AddCookie(&http.Cookie{Name: auth.RefreshCookieName, Value: "cookie-refresh-token"})
+	req.AddCookie(&http.Cookie{Name: auth.CSRFCookieName, Value: "csrf"})
+	req.Header.Set(auth.CSRFHeader, "csrf")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	if loggedOut != "cookie-refresh-token" {
+		t.Errorf("Logged out %q, want cookie-refresh-token", loggedOut)
+	}
+
+	for _, name := range []string{auth.RefreshCookieName, auth.CSRFCookieName} {
+		if c := findCookie(rr, name); c == nil || c.MaxAge >= 0 {
+			t.Errorf("%s cookie = %+v, want it cleared", name, c)
+		}
+	}
+}
+
+func TestHandlerLogout_CookieWithoutCSRF(t *testing.T) {
+	mockAuthService := &auth.MockAuthService{
+		LogoutFn: func(ctx context.Context, refreshToken string) error {
+			t.Error("Logout should not be called without a CSRF token")
+			return nil
+		},
+	}
+
+	handler := handlerLogout(mockAuthService)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/logout", nil)
+	req.AddCookie(&http.Cookie{Name: auth.RefreshCookieName, Value: "cookie-refresh-token"})
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusForbidden)
+	}
+}
+
+func TestHandlerLogin_RecordsSessionClient(t *testing.T) {
+	var client model.SessionClient
+	mockAuthService := &auth.MockAuthService{
+		LoginFn: func(ctx context.Context, email, password string) (model.AuthResponse, error) {
+			client = auth.GetSessionClientFromContext(ctx)
+			return model.AuthResponse{AccessToken: "access-token", RefreshToken: "refresh-token"}, nil
+		},
+	}
+
+	handler := handlerLogin(mockAuthService)
+
+	body := `{"email": "test@example.com", "password": "password123"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewReader([]byte(body)))
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	if client.IPAddress != "203.0.113.7" || client.UserAgent != "Mozilla/5.0 (Windows NT 10.0; Win64; x64)" {
+		t.Errorf("Session client = %+v", client)
+	}
+}
+
+func TestSessionClient_DropsInvalidIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+	req.Header.Set("X-Forwarded-For", "not-an-ip")
+
+	if client := sessionClient(req); client.IPAddress != "" {
+		t.Errorf("IPAddress = %q, want empty", client.IPAddress)
+	}
+}
+
+func TestHandlerListSessions_MarksCookieSession(t *testing.T) {
+	var current string
+	mockAuthService := &auth.MockAuthService{
+		ListSessionsFn: func(ctx context.Context, userID uint64, currentRefreshToken string) ([]model.Session, error) {
+			if userID != 7 {
+				t.Errorf("userID = %d, want 7", userID)
+			}
+			current = currentRefreshToken
+			return []model.Session{{ID: "family-1", Current: true}, {ID: "family-2"}}, nil
+		},
+	}
+
+	handler := handlerListSessions(mockAuthService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/sessions", nil)
+	req.AddCookie(&http.Cookie{Name: auth.RefreshCookieName, Value: "cookie-refresh-token"})
+	req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	if current != "cookie-refresh-token" {
+		t.Errorf("Current token = %q, want the cookie", current)
+	}
+
+	var sessions []model.Session
+	if err := json.NewDecoder(rr.Body).Decode(&sessions); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(sessions) != 2 || !sessions[0].Current {
+		t.Errorf("Sessions = %+v", sessions)
+	}
+}
+
+func TestHandlerRevokeSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"revoked", nil, http.StatusNoContent},
+		{"unknown or not owned", auth.ErrSessionNotFound, http.StatusNotFound},
+		{"store failure", errors.New("db down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var revoked string
+			mockAuthService := &auth.MockAuthService{
+				RevokeSessionFn: func(ctx context.Context, userID uint64, sessionID string) error {
+					revoked = sessionID
+					return tt.err
+				},
+			}
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("DELETE /api/v1/auth/sessions/{id}", handlerRevokeSession(mockAuthService))
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/auth/sessions/family-1", nil)
+			req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+			rr := httptest.NewRecorder()
+
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if revoked != "family-1" {
+				t.Errorf("Revoked %q, want family-1", revoked)
+			}
+		})
+	}
+}
+
+func TestHandlerLogoutEverywhere(t *testing.T) {
+	var loggedOut uint64
+	mockAuthService := &auth.MockAuthService{
+		LogoutEverywhereFn: func(ctx context.Context, userID uint64) error {
+			loggedOut = userID
+			return nil
+		},
+	}
+
+	handler := handlerLogoutEverywhere(mockAuthService)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/logout-everywhere", nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if loggedOut != 7 {
+		t.Errorf("Logged out user %d, want 7", loggedOut)
+	}
+	if c := findCookie(rr, auth.RefreshCookieName); c == nil || c.MaxAge >= 0 {
+		t.Errorf("Refresh cookie = %+v, want it cleared", c)
+	}
+}
+
+func TestHandlerRequestPasswordReset(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+	}{
+		{"accepted", `{"email": "test@example.com"}`, nil, http.StatusAccepted},
+		{"missing email", `{}`, nil, http.StatusBadRequest},
+		{"invalid email", `{"email": "not-an-email"}`, auth.ErrInvalidEmail, http.StatusBadRequest},
+		{"store failure", `{"email": "test@example.com"}`, errors.New("db down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuthService := &auth.MockAuthService{
+				RequestPasswordResetFn: func(ctx context.Context, email string) error {
+					return tt.err
+				},
+			}
+
+			handler := handlerRequestPasswordReset(mockAuthService)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/password-reset", bytes.NewReader([]byte(tt.body)))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d. Body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerConfirmPasswordReset(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+	}{
+		{"reset", `{"token": "reset-token", "password": "new-password"}`, nil, http.StatusOK},
+		{"missing token", `{"password": "new-password"}`, nil, http.StatusBadRequest},
+		{"used or expired token", `{"token": "reset-token", "password": "new-password"}`, auth.ErrInvalidResetToken, http.StatusBadRequest},
+		{"short password", `{"token": "reset-token", "password": "short"}`, auth.ErrPasswordTooShort, http.StatusBadRequest},
+		{"store failure", `{"token": "reset-token", "password": "new-password"}`, errors.New("db down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotToken, gotPassword string
+			mockAuthService := &auth.MockAuthService{
+				ResetPasswordFn: func(ctx context.Context, token string, password string) error {
+					gotToken, gotPassword = token, password
+					return tt.err
+				},
+			}
+
+			handler := handlerConfirmPasswordReset(mockAuthService)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/password-reset/confirm", bytes.NewReader([]byte(tt.body)))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d. Body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK && (gotToken != "reset-token" || gotPassword != "new-password") {
+				t.Errorf("ResetPassword(%q, %q)", gotToken, gotPassword)
+			}
+		})
+	}
+}
+
+func TestHandlerVerifyEmail(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+	}{
+		{"verified", `{"token": "verify-token"}`, nil, http.StatusOK},
+		{"missing token", `{}`, nil, http.StatusBadRequest},
+		{"used or expired token", `{"token": "verify-token"}`, auth.ErrInvalidVerificationToken, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuthService := &auth.MockAuthService{
+				VerifyEmailFn: func(ctx context.Context, token string) error {
+					return tt.err
+				},
+			}
+
+			handler := handlerVerifyEmail(mockAuthService)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/verify-email", bytes.NewReader([]byte(tt.body)))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d. Body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerResendVerification(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"sent", nil, http.StatusAccepted},
+		{"already verified", auth.ErrEmailAlreadyVerified, http.StatusConflict},
+		{"throttled", auth.ErrVerificationThrottled, http.StatusTooManyRequests},
+		{"mail failure", errors.New("smtp down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuthService := &auth.MockAuthService{
+				ResendVerificationFn: func(ctx context.Context, userID uint64) error {
+					return tt.err
+				},
+			}
+
+			handler := handlerResendVerification(mockAuthService)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/verify-email/resend", nil)
+			req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d. Body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerMe_IncludesEmailVerified(t *testing.T) {
+	mockAuthService := &auth.MockAuthService{
+		EmailVerifiedFn: func(ctx context.Context, userID uint64) (bool, error) {
+			return true, nil
+		},
+	}
+
+	handler := handlerMe(mockAuthService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/me", nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7, Email: "test@example.com"}))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	var resp map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if resp["email_verified"] != true || resp["email"] != "test@example.com" {
+		t.Errorf("Response = %v", resp)
+	}
+}
+
+func TestHandlerChangePassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+	}{
+		{"changed", `{"current_password": "old-password", "new_password": "new-password"}`, nil, http.StatusOK},
+		{"missing current password", `{"new_password": "new-password"}`, nil, http.StatusBadRequest},
+		{"wrong current password", `{"current_password": "wrong", "new_password": "new-password"}`, auth.ErrIncorrectPassword, http.StatusForbidden},
+		{"short new password", `{"current_password": "old-password", "new_password": "short"}`, auth.ErrPasswordTooShort, http.StatusBadRequest},
+		{"long new password", `{"current_password": "old-password", "new_password": "x"}`, auth.ErrPasswordTooLong, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuthService := &auth.MockAuthService{
+				ChangePasswordFn: func(ctx context.Context, userID uint64, currentPassword string, newPassword string, currentRefreshToken string) error {
+					return tt.err
+				},
+			}
+
+			handler := handlerChangePassword(mockAuthService)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/auth/password", bytes.NewReader([]byte(tt.body)))
+			req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d. Body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerChangePassword_KeepsCurrentSession(t *testing.T) {
+	var kept string
+	mockAuthService := &auth.MockAuthService{
+		ChangePasswordFn: func(ctx context.Context, userID uint64, currentPassword string, newPassword string, currentRefreshToken string) error {
+			kept = currentRefreshToken
+			return nil
+		},
+	}
+
+	handler := handlerChangePassword(mockAuthService)
+
+	body := `{"current_password": "old-password", "new_password": "new-password"}`
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/auth/password", bytes.NewReader([]byte(body)))
+	req.AddCookie(&http.Cookie{Name: auth.RefreshCookieName, Value: "cookie-refresh-token"})
+	req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if kept != "cookie-refresh-token" {
+		t.Errorf("Kept session %q, want the cookie's", kept)
+	}
+}
+
+func TestHandlerChangeEmail(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+	}{
+		{"changed", `{"current_password": "password123", "email": "new@example.com"}`, nil, http.StatusOK},
+		{"missing email", `{"current_password": "password123"}`, nil, http.StatusBadRequest},
+		{"missing current password", `{"email": "new@example.com"}`, nil, http.StatusBadRequest},
+		{"invalid email", `{"current_password": "password123", "email": "nope"}`, auth.ErrInvalidEmail, http.StatusBadRequest},
+		{"wrong current password", `{"current_password": "wrong", "email": "new@example.com"}`, auth.ErrIncorrectPassword, http.StatusForbidden},
+		{"email taken", `{"current_password": "password123", "email": "taken@example.com"}`, auth.ErrUserAlreadyExists, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuthService := &auth.MockAuthService{
+				ChangeEmailFn: func(ctx context.Context, userID uint64, currentPassword string, newEmail string) error {
+					return tt.err
+				},
+			}
+
+			handler := handlerChangeEmail(mockAuthService)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/auth/email", bytes.NewReader([]byte(tt.body)))
+			req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d. Body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerDeleteAccount(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+	}{
+		{"deleted", `{"current_password": "password123"}`, nil, http.StatusNoContent},
+		{"anonymized", `{"current_password": "password123", "link_policy": "anonymize"}`, nil, http.StatusNoContent},
+		{"missing current password", `{"link_policy": "delete"}`, nil, http.StatusBadRequest},
+		{"invalid link policy", `{"current_password": "password123", "link_policy": "keep"}`, auth.ErrInvalidLinkPolicy, http.StatusBadRequest},
+		{"wrong current password", `{"current_password": "wrong"}`, auth.ErrIncorrectPassword, http.StatusForbidden},
+		{"store failure", `{"current_password": "password123"}`, errors.New("db down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPolicy string
+			mockAuthService := &auth.MockAuthService{
+				DeleteAccountFn: func(ctx context.Context, userID uint64, currentPassword string, linkPolicy string) error {
+					gotPolicy = linkPolicy
+					return tt.err
+				},
+			}
+
+			handler := handlerDeleteAccount(mockAuthService)
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/auth/me", bytes.NewReader([]byte(tt.body)))
+			req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d. Body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			if tt.wantStatus == http.StatusNoContent {
+				if cookie := findCookie(rr, auth.RefreshCookieName); cookie == nil || cookie.MaxAge >= 0 {
+					t.Error("Session cookies should be cleared")
+				}
+				if tt.name == "anonymized" && gotPolicy != auth.LinkPolicyAnonymize {
+					t.Errorf("Link policy = %q, want %q", gotPolicy, auth.LinkPolicyAnonymize)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerExportAccount(t *testing.T) {
+	userID := uint64(7)
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mockAuthService := &auth.MockAuthService{
+		GetUserFn: func(ctx context.Context, id uint64) (*model.User, error) {
+			return &model.User{ID: id, Email: "user@example.com", EmailVerified: true, CreatedAt: createdAt}, nil
+		},
+	}
+
+	// Two pages of links
+	var offsets []int
+	mockLinkService := &service.MockLinkService{
+		GetUserLinksFn: func(ctx context.Context, id uint64, limit int, offset int) ([]model.Link, int, error) {
+			offsets = append(offsets, offset)
+			total := limit + 1
+			if offset == 0 {
+				page := make([]model.Link, limit)
+				for i := range page {
+					page[i] = model.Link{ID: uint64(i + 1), UserID: &userID, ShortCode: fmt.Sprintf("c%d", i)}
+				}
+				return page, total, nil
+			}
+			return []model.Link{{ID: uint64(total), UserID: &userID, ShortCode: "last"}}, total, nil
+		},
+	}
+
+	var capturedFilter model.AnalyticsExportFilter
+	mockAnalytics := &analytics.MockAnalytics{
+		ExportEventsFn: func(ctx context.Context, filter model.AnalyticsExportFilter, fn func(event *model.AnalyticsEvent) error) error {
+			capturedFilter = filter
+			for i := uint64(1); i <= 2; i++ {
+				if err := fn(&model.AnalyticsEvent{ID: i, LinkID: 1, Country: "NZ"}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	handler := handlerExportAccount(mockAuthService, mockLinkService, mockAnalytics)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/me/export", nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: userID}))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Content-Type = %q, want application/zip", ct)
+	}
+	if len(offsets) != 2 || offsets[1] != exportLinksPageSize {
+		t.Errorf("Link page offsets = %v, want [0 %d]", offsets, exportLinksPageSize)
+	}
+	if capturedFilter.UserID == nil || *capturedFilter.UserID != userID || capturedFilter.LinkID != nil {
+		t.Errorf("Filter = %+v, want the user's events", capturedFilter)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatalf("Response is not a ZIP: %v", err)
+	}
+
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", f.Name, err)
+		}
+		files[f.Name] = data
+	}
+
+	var profile map[string]interface{}
+	if err := json.Unmarshal(files["profile.json"], &profile); err != nil {
+		t.Fatalf("Failed to decode profile.json: %v", err)
+	}
+	if profile["email"] != "user@example.com" || profile["email_verified"] != true {
+		t.Errorf("Profile = %v", profile)
+	}
+
+	var links []model.Link
+	if err := json.Unmarshal(files["links.json"], &links); err != nil {
+		t.Fatalf("Failed to decode links.json: %v", err)
+	}
+	if len(links) != exportLinksPageSize+1 || links[len(links)-1].ShortCode != "last" {
+		t.Errorf("Links = %d, want every page", len(links))
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(files["analytics.ndjson"])), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Clicks = %d, want 2", len(lines))
+	}
+	var record export.Record
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Failed to decode click: %v", err)
+	}
+	if record.EventID != 1 || record.Country != "NZ" {
+		t.Errorf("Click = %+v", record)
+	}
+}
+
+func TestHandlerExportAccount_LinksError(t *testing.T) {
+	mockAuthService := &auth.MockAuthService{
+		GetUserFn: func(ctx context.Context, id uint64) (*model.User, error) {
+			return &model.User{ID: id}, nil
+		},
+	}
+	mockLinkService := &service.MockLinkService{
+		GetUserLinksFn: func(ctx context.Context, id uint64, limit int, offset int) ([]model.Link, int, error) {
+			return nil, 0, errors.New("db down")
+		},
+	}
+
+	handler := handlerExportAccount(mockAuthService, mockLinkService, newMockAnalytics())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/me/export", nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct == "application/zip" {
+		t.Error("Failed export should not be sent as a ZIP")
+	}
+}
+
+func TestHandlerCreateAPIKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+	}{
+		{"created", `{"name": "ci", "scopes": ["links:write"]}`, nil, http.StatusCreated},
+		{"invalid payload", `{"name": `, nil, http.StatusBadRequest},
+		{"invalid name", `{"name": "", "scopes": ["links:write"]}`, auth.ErrInvalidAPIKeyName, http.StatusBadRequest},
+		{"invalid scope", `{"name": "ci", "scopes": ["admin"]}`, auth.ErrInvalidScope, http.StatusBadRequest},
+		{"limit reached", `{"name": "ci", "scopes": ["links:write"]}`, auth.ErrTooManyAPIKeys, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuthService := &auth.MockAuthService{
+				CreateAPIKeyFn: func(ctx context.Context, userID uint64, name string, scopes []string) (model.CreateAPIKeyResponse, error) {
+					if tt.err != nil {
+						return model.CreateAPIKeyResponse{}, tt.err
+					}
+					return model.CreateAPIKeyResponse{
+						APIKey: model.APIKey{ID: 1, Name: name, Prefix: "shk_abcdefgh", Scopes: scopes},
+						Key:    "shk_abcdefghsecret",
+					}, nil
+				},
+			}
+
+			handler := handlerCreateAPIKey(mockAuthService)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/api-keys", bytes.NewReader([]byte(tt.body)))
+			req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			if tt.wantStatus == http.StatusCreated {
+				var resp map[string]interface{}
+				if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if resp["key"] != "shk_abcdefghsecret" || resp["prefix"] != "shk_abcdefgh" {
+					t.Errorf("Response = %v, want the key and its prefix", resp)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerListAPIKeys_HidesSecrets(t *testing.T) {
+	mockAuthService := &auth.MockAuthService{
+		ListAPIKeysFn: func(ctx context.Context, userID uint64) ([]model.APIKey, error) {
+			return []model.APIKey{{ID: 1, UserID: userID, Email: "user@example.com", Name: "ci", Prefix: "shk_abcdefgh", Scopes: []string{"links:read"}}}, nil
+		},
+	}
+
+	handler := handlerListAPIKeys(mockAuthService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/api-keys", nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	body := rr.Body.String()
+	if strings.Contains(body, "user@example.com") || strings.Contains(body, `"key"`) {
+		t.Errorf("Listed keys leak owner details or secrets: %s", body)
+	}
+	if !strings.Contains(body, "shk_abcdefgh") {
+		t.Errorf("Listed keys should include the prefix: %s", body)
+	}
+}
+
+func TestHandlerRevokeAPIKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		err        error
+		wantStatus int
+	}{
+		{"revoked", "3", nil, http.StatusNoContent},
+		{"not found", "4", auth.ErrAPIKeyNotFound, http.StatusNotFound},
+		{"invalid id", "abc", nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotID uint64
+			mockAuthService := &auth.MockAuthService{
+				RevokeAPIKeyFn: func(ctx context.Context, userID uint64, id uint64) error {
+					gotID = id
+					return tt.err
+				},
+			}
+
+			mux := http.NewServeMux()
+			mux.Handle("DELETE /api/v1/auth/api-keys/{id}", handlerRevokeAPIKey(mockAuthService))
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/auth/api-keys/"+tt.id, nil)
+			req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+			rr := httptest.NewRecorder()
+
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d. Body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusNoContent && gotID != 3 {
+				t.Errorf("Revoked ID = %d, want 3", gotID)
+			}
+		})
+	}
+}
+
+func TestHandlerOIDCLogin(t *testing.T) {
+	mockAuthService := &auth.MockAuthService{
+		BeginOIDCLoginFn: func(ctx context.Context, provider string) (string, auth.OIDCFlow, error) {
+			if provider != "keycloak" {
+				return "", auth.OIDCFlow{}, auth.ErrUnknownOIDCProvider
+			}
+			return "https://sso.example.com/authorize?state=abc", auth.OIDCFlow{Provider: provider, State: "abc"}, nil
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/auth/oidc/{provider}/login", handlerOIDCLogin(mockAuthService, "https://app.example.com"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/keycloak/login", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusFound, rr.Body.String())
+	}
+	if location := rr.Header().Get("Location"); location != "https://sso.example.com/authorize?state=abc" {
+		t.Errorf("Location = %q, want the provider", location)
+	}
+	cookie := findCookie(rr, auth.OIDCFlowCookieName)
+	if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("Flow cookie = %+v, want an HttpOnly Lax cookie", cookie)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/other/login", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Unknown provider status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandlerOIDCCallback(t *testing.T) {
+	flow := auth.OIDCFlow{Provider: "keycloak", State: "abc", Nonce: "n", Verifier: "v"}
+
+	tests := []struct {
+		name         string
+		path         string
+		withCookie   bool
+		err          error
+		wantLocation string
+	}{
+		{"success", "/api/v1/auth/oidc/keycloak/callback?state=abc&code=xyz", true, nil, "https://app.example.com/"},
+		{"no flow cookie", "/api/v1/auth/oidc/keycloak/callback?state=abc&code=xyz", false, nil, "https://app.example.com/login?error=expired"},
+		{"other provider", "/api/v1/auth/oidc/google/callback?state=abc&code=xyz", true, nil, "https://app.example.com/login?error=expired"},
+		{"cancelled", "/api/v1/auth/oidc/keycloak/callback?error=access_denied&state=abc", true, nil, "https://app.example.com/login?error=cancelled"},
+		{"bad state", "/api/v1/auth/oidc/keycloak/callback?state=forged&code=xyz", true, auth.ErrInvalidOIDCState, "https://app.example.com/login?error=expired"},
+		{"email not verified", "/api/v1/auth/oidc/keycloak/callback?state=abc&code=xyz", true, auth.ErrOIDCEmailNotVerified, "https://app.example.com/login?error=email_not_verified"},
+		{"account unverified", "/api/v1/auth/oidc/keycloak/callback?state=abc&code=xyz", true, auth.ErrOIDCAccountUnverified, "https://app.example.com/login?error=account_unverified"},
+		{"provider failure", "/api/v1/auth/oidc/keycloak/callback?state=abc&code=xyz", true, auth.ErrOIDCFailed, "https://app.example.com/login?error=failed"},
+		{"two-factor challenge", "/api/v1/auth/oidc/keycloak/callback?state=abc&code=xyz", true, nil, "https://app.example.com/login?challenge=challenge-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotFlow auth.OIDCFlow
+			var gotCode string
+			mockAuthService := &auth.MockAuthService{
+				CompleteOIDCLoginFn: func(ctx context.Context, flow auth.OIDCFlow, state string, code string) (model.AuthResponse, error) {
+					gotFlow, gotCode = flow, code
+					if tt.err != nil {
+						return model.AuthResponse{}, tt.err
+					}
+					if tt.name == "two-factor challenge" {
+						return model.AuthResponse{TwoFactor: &model.TwoFactorChallenge{Token: "challenge-token"}}, nil
+					}
+					return model.AuthResponse{AccessToken: "access", RefreshToken: "refresh", User: model.User{ID: 7}}, nil
+				},
+			}
+
+			mux := http.NewServeMux()
+			mux.Handle("GET /api/v1/auth/oidc/{provider}/callback", handlerOIDCCallback(mockAuthService, "https://app.example.com"))
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.withCookie {
+				set := httptest.NewRecorder()
+				if err := auth.SetOIDCFlowCookie(set, flow); err != nil {
+					t.Fatalf("SetOIDCFlowCookie failed: %v", err)
+				}
+				req.AddCookie(findCookie(set, auth.OIDCFlowCookieName))
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusFound {
+				t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusFound, rr.Body.String())
+			}
+			if location := rr.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", location, tt.wantLocation)
+			}
+
+			// The flow is single use whatever the outcome
+			if cookie := findCookie(rr, auth.OIDCFlowCookieName); cookie == nil || cookie.MaxAge >= 0 {
+				t.Errorf("Flow cookie = %+v, want it cleared", cookie)
+			}
+
+			refresh := findCookie(rr, auth.RefreshCookieName)
+			if tt.wantLocation == "https://app.example.com/" {
+				if refresh == nil || refresh.Value != "refresh" {
+					t.Errorf("Refresh cookie = %+v, want the new session", refresh)
+				}
+				if gotFlow != flow || gotCode != "xyz" {
+					t.Errorf("CompleteOIDCLogin got flow %+v and code %q", gotFlow, gotCode)
+				}
+			} else if refresh != nil {
+				t.Errorf("Failed login set a refresh cookie: %+v", refresh)
+			}
+		})
+	}
+}
+
+func TestHandlerLogin_TwoFactorChallenge(t *testing.T) {
+	expiresAt := time.Now().Add(5 * time.Minute)
+	mockAuthService := &auth.MockAuthService{
+		LoginFn: func(ctx context.Context, email, password string) (model.AuthResponse, error) {
+			return model.AuthResponse{
+				TwoFactor: &model.TwoFactorChallenge{Token: "challenge-token", ExpiresAt: expiresAt},
+			}, nil
+		},
+	}
+
+	handler := handlerLogin(mockAuthService)
+
+	body := `{"email": "test@example.com", "password": "password123"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewReader([]byte(body)))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d. Body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	var resp map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if resp["challenge_token"] != "challenge-token" {
+		t.Errorf("Response = %v, want the challenge", resp)
+	}
+	if _, ok := resp["access_token"]; ok {
+		t.Errorf("Response = %v, want no tokens", resp)
+	}
+	if cookie := findCookie(rr, auth.RefreshCookieName); cookie != nil {
+		t.Errorf("Refresh cookie = %+v, want none before the code", cookie)
+	}
+}
+
+func TestHandlerVerifyTwoFactorLogin(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+	}{
+		{"verified", `{"challenge_token": "challenge", "code": "123456"}`, nil, http.StatusOK},
+		{"missing code", `{"challenge_token": "challenge"}`, nil, http.StatusBadRequest},
+		{"wrong code", `{"challenge_token": "challenge", "code": "000000"}`, auth.ErrInvalidTwoFactorCode, http.StatusUnauthorized},
+		{"expired challenge", `{"challenge_token": "old", "code": "123456"}`, auth.ErrInvalidTwoFactorChallenge, http.StatusUnauthorized},
+		{"store failure", `{"challenge_token": "challenge", "code": "123456"}`, errors.New("db down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotChallenge, gotCode string
+			mockAuthService := &auth.MockAuthService{
+				VerifyTwoFactorLoginFn: func(ctx context.Context, challengeToken string, code string) (model.AuthResponse, error) {
+					gotChallenge, gotCode = challengeToken, code
+					if tt.err != nil {
+						return model.AuthResponse{}, tt.err
+					}
+					return model.AuthResponse{AccessToken: "access", RefreshToken: "refresh", User: model.User{ID: 7}}, nil
+				},
+			}
+
+			handler := handlerVerifyTwoFactorLogin(mockAuthService)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login/2fa", bytes.NewReader([]byte(tt.body)))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d. Body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			refresh := findCookie(rr, auth.RefreshCookieName)
+			if tt.wantStatus == http.StatusOK {
+				if refresh == nil || refresh.Value != "refresh" {
+					t.Errorf("Refresh cookie = %+v, want the new session", refresh)
+				}
+				if gotChallenge != "challenge" || gotCode != "123456" {
+					t.Errorf("VerifyTwoFactorLogin got %q and %q", gotChallenge, gotCode)
+				}
+			} else if refresh != nil {
+				t.Errorf("Failed login set a refresh cookie: %+v", refresh)
+			}
+		})
+	}
+}
+
+func TestHandlerEnrollTwoFactor(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+	}{
+		{"enrolled", `{"current_password": "password123"}`, nil, http.StatusOK},
+		{"missing current password", `{}`, nil, http.StatusBadRequest},
+		{"wrong current password", `{"current_password": "wrong"}`, auth.ErrIncorrectPassword, http.StatusForbidden},
+		{"already enabled", `{"current_password": "password123"}`, auth.ErrTwoFactorAlreadyEnabled, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuthService := &auth.MockAuthService{
+				EnrollTwoFactorFn: func(ctx context.Context, userID uint64, currentPassword string) (model.EnrollTwoFactorResponse, error) {
+					if tt.err != nil {
+						return model.EnrollTwoFactorResponse{}, tt.err
+					}
+					return model.EnrollTwoFactorResponse{Secret: "SECRET", ProvisioningURI: "otpauth://totp/Shrinks:user@example.com?secret=SECRET"}, nil
+				},
+			}
+
+			handler := handlerEnrollTwoFactor(mockAuthService)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/2fa/enroll", bytes.NewReader([]byte(tt.body)))
+			req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d. Body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(rr.Body.String(), `"provisioning_uri":"otpauth://`) {
+				t.Errorf("Body = %s, want the provisioning URI", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerActivateTwoFactor(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+	}{
+		{"activated", `{"code": "123456"}`, nil, http.StatusOK},
+		{"missing code", `{}`, nil, http.StatusBadRequest},
+		{"wrong code", `{"code": "000000"}`, auth.ErrInvalidTwoFactorCode, http.StatusBadRequest},
+		{"not enrolled", `{"code": "123456"}`, auth.ErrTwoFactorNotEnrolled, http.StatusConflict},
+		{"already enabled", `{"code": "123456"}`, auth.ErrTwoFactorAlreadyEnabled, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuthService := &auth.MockAuthService{
+				ActivateTwoFactorFn: func(ctx context.Context, userID uint64, code string) (model.ActivateTwoFactorResponse, error) {
+					if tt.err != nil {
+						return model.ActivateTwoFactorResponse{}, tt.err
+					}
+					return model.ActivateTwoFactorResponse{RecoveryCodes: []string{"ABCD-EFGH-IJKL-MNOP"}}, nil
+				},
+			}
+
+			handler := handlerActivateTwoFactor(mockAuthService)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/2fa/activate", bytes.NewReader([]byte(tt.body)))
+			req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d. Body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(rr.Body.String(), "ABCD-EFGH-IJKL-MNOP") {
+				t.Errorf("Body = %s, want the recovery codes", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerDisableTwoFactor(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+	}{
+		{"disabled", `{"current_password": "password123", "code": "123456"}`, nil, http.StatusNoContent},
+		{"missing code", `{"current_password": "password123"}`, nil, http.StatusBadRequest},
+		{"wrong current password", `{"current_password": "wrong", "code": "123456"}`, auth.ErrIncorrectPassword, http.StatusForbidden},
+		{"wrong code", `{"current_password": "password123", "code": "000000"}`, auth.ErrInvalidTwoFactorCode, http.StatusForbidden},
+		{"not enabled", `{"current_password": "password123", "code": "123456"}`, auth.ErrTwoFactorNotEnabled, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuthService := &auth.MockAuthService{
+				DisableTwoFactorFn: func(ctx context.Context, userID uint64, currentPassword string, code string) error {
+					return tt.err
+				},
+			}
+
+			handler := handlerDisableTwoFactor(mockAuthService)
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/auth/2fa", bytes.NewReader([]byte(tt.body)))
+			req = req.WithContext(context.WithValue(req.Context(), auth.ClaimsContextKey, &auth.Claims{UserID: 7}))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d. Body: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+		})
 	}
 }
 
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE analytics ADD COLUMN country VARCHAR(2);
+ALTER TABLE analytics ADD COLUMN region VARCHAR(100);
+ALTER TABLE analytics ADD COLUMN city VARCHAR(100);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analytics DROP COLUMN city;
+ALTER TABLE analytics DROP COLUMN region;
+ALTER TABLE analytics DROP COLUMN country;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE analytics ADD COLUMN visitor_hash VARCHAR(64);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analytics DROP COLUMN visitor_hash;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE analytics ADD COLUMN filtered BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE analytics ADD COLUMN filter_reason VARCHAR(20);
+
+-- Backfill what can be classified after the fact: known bots
+UPDATE analytics SET filtered = TRUE, filter_reason = 'bot' WHERE device_type = 'Bot';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analytics DROP COLUMN filter_reason;
+ALTER TABLE analytics DROP COLUMN filtered;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Keyed hashes don't fit in INET. host() also drops the "/32" suffix that
+-- ip_address::text used to return.
+ALTER TABLE analytics ALTER COLUMN ip_address TYPE TEXT USING host(ip_address);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE analytics SET ip_address = NULL WHERE ip_address !~ '[.:]';
+ALTER TABLE analytics ALTER COLUMN ip_address TYPE INET USING ip_address::inet;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE analytics ADD COLUMN referrer VARCHAR(255);
+
+-- Daily per-link click counts, one row per dimension value. Account-wide
+-- dashboards read from here instead of scanning raw events.
+CREATE TABLE analytics_rollups (
+    link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    bucket DATE NOT NULL,
+    dimension VARCHAR(20) NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (link_id, bucket, dimension, value)
+);
+
+CREATE INDEX idx_analytics_rollups_dimension_bucket ON analytics_rollups(dimension, bucket);
+
+-- Backfill from existing raw events
+INSERT INTO analytics_rollups (link_id, bucket, dimension, value, clicks)
+SELECT link_id, bucket, dimension, value, COUNT(*)
+FROM (
+    SELECT a.link_id, (a.clicked_at AT TIME ZONE 'UTC')::date AS bucket, d.dimension, d.value
+    FROM analytics a
+    CROSS JOIN LATERAL (VALUES
+        ('total', ''),
+        ('referrer', ''),
+        ('country', COALESCE(a.country, '')),
+        ('device', COALESCE(a.device_type, '')),
+        ('browser', COALESCE(a.browser, '')),
+        ('os', COALESCE(a.os, ''))
+    ) AS d(dimension, value)
+    WHERE NOT a.filtered
+) events
+GROUP BY link_id, bucket, dimension, value;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS analytics_rollups;
+ALTER TABLE analytics DROP COLUMN referrer;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Per-account override of how long raw analytics events are kept. NULL uses
+-- the deployment default (ANALYTICS_RETENTION_DAYS). Rollups are kept forever.
+ALTER TABLE users ADD COLUMN analytics_retention_days INTEGER CHECK (analytics_retention_days > 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN analytics_retention_days;
+-- +goose StatementEnd
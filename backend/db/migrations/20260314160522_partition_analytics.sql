@@ -0,0 +1,104 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+
+-- Converts analytics into a table range-partitioned by month on clicked_at.
+-- The existing table is attached as one partition covering everything up to
+-- the start of the month after next, so no rows are copied. The CHECK
+-- constraint is validated before the swap, which lets SET NOT NULL and ATTACH
+-- skip their full-table scans; the swap itself only holds locks briefly.
+-- Later partitions are created ahead of time by the server (see
+-- analytics.Partitioner) and dropped once past retention.
+
+-- +goose StatementBegin
+UPDATE analytics SET clicked_at = to_timestamp(0) WHERE clicked_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DO $$
+BEGIN
+    EXECUTE format(
+        'ALTER TABLE analytics ADD CONSTRAINT analytics_legacy_range CHECK (clicked_at IS NOT NULL AND clicked_at < %L) NOT VALID',
+        (date_trunc('month', now() AT TIME ZONE 'UTC') + interval '2 months') AT TIME ZONE 'UTC'
+    );
+END $$;
+-- +goose StatementEnd
+
+-- Only takes a SHARE UPDATE EXCLUSIVE lock, so clicks keep being recorded
+-- +goose StatementBegin
+ALTER TABLE analytics VALIDATE CONSTRAINT analytics_legacy_range;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DO $$
+DECLARE
+    -- Recomputed rather than passed along; if the month rolled over since the
+    -- constraint was added this is later, and the constraint still implies it
+    boundary TIMESTAMPTZ := (date_trunc('month', now() AT TIME ZONE 'UTC') + interval '2 months') AT TIME ZONE 'UTC';
+    month_start TIMESTAMPTZ;
+BEGIN
+    ALTER TABLE analytics RENAME TO analytics_legacy;
+    ALTER TABLE analytics_legacy RENAME CONSTRAINT analytics_pkey TO analytics_legacy_pkey;
+    ALTER INDEX idx_analytics_clicked_at RENAME TO idx_analytics_legacy_clicked_at;
+    ALTER INDEX idx_analytics_link_id_clicked_at RENAME TO idx_analytics_legacy_link_id_clicked_at;
+    ALTER TABLE analytics_legacy ALTER COLUMN clicked_at SET NOT NULL;
+
+    -- No primary key on the parent: it would have to include clicked_at.
+    -- Each partition has its own on id, and ids come from one sequence.
+    CREATE TABLE analytics (LIKE analytics_legacy INCLUDING DEFAULTS) PARTITION BY RANGE (clicked_at);
+    ALTER TABLE analytics ADD CONSTRAINT analytics_link_id_fkey
+        FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE;
+    CREATE INDEX idx_analytics_clicked_at ON analytics(clicked_at);
+    CREATE INDEX idx_analytics_link_id_clicked_at ON analytics(link_id, clicked_at);
+
+    -- Keep the id sequence alive when the legacy partition is eventually dropped
+    ALTER SEQUENCE analytics_id_seq OWNED BY analytics.id;
+
+    -- Matching indexes and the foreign key are attached rather than rebuilt
+    EXECUTE format('ALTER TABLE analytics ATTACH PARTITION analytics_legacy FOR VALUES FROM (MINVALUE) TO (%L)', boundary);
+
+    FOR i IN 0..2 LOOP
+        month_start := boundary + make_interval(months => i);
+        EXECUTE format(
+            'CREATE TABLE %I PARTITION OF analytics (PRIMARY KEY (id)) FOR VALUES FROM (%L) TO (%L)',
+            'analytics_' || to_char(month_start AT TIME ZONE 'UTC', '"y"YYYY"m"MM'),
+            month_start,
+            month_start + interval '1 month'
+        );
+    END LOOP;
+END $$;
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- Folds every partition back into one plain table. Unlike the Up migration
+-- this copies rows, so it is slow on large tables.
+
+-- +goose StatementBegin
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM pg_inherits
+        WHERE inhparent = 'analytics'::regclass AND inhrelid = to_regclass('analytics_legacy')
+    ) THEN
+        ALTER TABLE analytics DETACH PARTITION analytics_legacy;
+    ELSE
+        -- The legacy partition was already dropped by retention
+        CREATE TABLE analytics_legacy (LIKE analytics INCLUDING DEFAULTS);
+        ALTER TABLE analytics_legacy ADD CONSTRAINT analytics_legacy_pkey PRIMARY KEY (id);
+        ALTER TABLE analytics_legacy ADD FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE;
+        CREATE INDEX idx_analytics_legacy_clicked_at ON analytics_legacy(clicked_at);
+        CREATE INDEX idx_analytics_legacy_link_id_clicked_at ON analytics_legacy(link_id, clicked_at);
+    END IF;
+
+    ALTER TABLE analytics_legacy DROP CONSTRAINT IF EXISTS analytics_legacy_range;
+    INSERT INTO analytics_legacy SELECT * FROM analytics;
+
+    ALTER SEQUENCE analytics_id_seq OWNED BY analytics_legacy.id;
+    DROP TABLE analytics;
+
+    ALTER TABLE analytics_legacy RENAME TO analytics;
+    ALTER TABLE analytics RENAME CONSTRAINT analytics_legacy_pkey TO analytics_pkey;
+    ALTER INDEX idx_analytics_legacy_clicked_at RENAME TO idx_analytics_clicked_at;
+    ALTER INDEX idx_analytics_legacy_link_id_clicked_at RENAME TO idx_analytics_link_id_clicked_at;
+END $$;
+-- +goose StatementEnd
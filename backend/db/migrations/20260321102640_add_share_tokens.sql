@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Read-only public access to one link's analytics. Only the SHA-256 of the
+-- token is stored; revoking deletes the row.
+CREATE TABLE share_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_share_tokens_link_id ON share_tokens(link_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS share_tokens;
+-- +goose StatementEnd
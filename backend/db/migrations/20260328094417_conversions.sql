@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Links with conversion tracking get a signed click ID appended on redirect;
+-- the destination reports it back once the visitor converts.
+ALTER TABLE links ADD COLUMN conversion_tracking BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE analytics ADD COLUMN click_id VARCHAR(64);
+
+-- One row per converted click, so repeated reports are counted once
+CREATE TABLE conversions (
+    click_id VARCHAR(64) PRIMARY KEY,
+    link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    converted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_conversions_link_id ON conversions(link_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS conversions;
+ALTER TABLE analytics DROP COLUMN IF EXISTS click_id;
+ALTER TABLE links DROP COLUMN IF EXISTS conversion_tracking;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Primary Accept-Language of the visitor, e.g. "en-US"
+ALTER TABLE analytics ADD COLUMN language VARCHAR(35);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analytics DROP COLUMN IF EXISTS language;
+-- +goose StatementEnd
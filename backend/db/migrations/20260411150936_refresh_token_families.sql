@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Each login starts a family of refresh tokens. Using one rotates it: the
+-- old token is marked rotated and a new one joins the family. Presenting a
+-- rotated token again means it leaked, so the whole family is revoked.
+ALTER TABLE refresh_tokens ADD COLUMN family_id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE refresh_tokens ADD COLUMN rotated_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM refresh_tokens WHERE rotated_at IS NOT NULL;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS rotated_at;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS family_id;
+-- +goose StatementEnd
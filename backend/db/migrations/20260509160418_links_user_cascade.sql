@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Links used to outlive their owner, staying live with nobody able to manage
+-- them. Account deletion now decides what happens to them explicitly, and
+-- anonymized links are detached before the user row goes.
+ALTER TABLE links DROP CONSTRAINT links_user_id_fkey;
+ALTER TABLE links ADD CONSTRAINT links_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE links DROP CONSTRAINT links_user_id_fkey;
+ALTER TABLE links ADD CONSTRAINT links_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Personal API keys for scripts. Only a hash of the key is kept; the prefix
+-- is its first few characters, so users can tell their keys apart.
+CREATE TABLE api_keys (
+    id SERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(255) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS api_keys;
+-- +goose StatementEnd
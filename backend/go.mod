@@ -7,9 +7,20 @@ toolchain go1.24.11
 require (
 	github.com/golang-jwt/jwt/v5 v5.3.0
 	github.com/mileusna/useragent v1.3.5
+	github.com/oschwald/geoip2-golang v1.11.0
+	github.com/parquet-go/parquet-go v0.25.1
 	github.com/redis/go-redis/v9 v9.17.2
 )
 
+require (
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/oschwald/maxminddb-golang v1.13.0 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	golang.org/x/sys v0.39.0 // indirect
+)
+
 require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
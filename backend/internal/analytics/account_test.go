@@ -0,0 +1,109 @@
+//go:build unit
+
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+func newAccountMockStore() *storage.MockStore {
+	return &storage.MockStore{
+		GetUserClicksOverTimeFn: func(ctx context.Context, userID uint64, since time.Time, interval string) ([]model.ClicksByDate, error) {
+			return []model.ClicksByDate{{Date: "2026-02-01", Clicks: 3}, {Date: "2026-02-02", Clicks: 4}}, nil
+		},
+		GetUserTopLinksFn: func(ctx context.Context, userID uint64, since time.Time, limit int) ([]model.TopLink, error) {
+			return []model.TopLink{{ShortCode: "abc123", Clicks: 7}}, nil
+		},
+		GetUserTopValuesFn: func(ctx context.Context, userID uint64, dimension string, since time.Time, limit int) ([]model.DimensionCount, error) {
+			return []model.DimensionCount{{Value: "", Clicks: 5}, {Value: "x", Clicks: 2}}, nil
+		},
+		GetUserLinksCreatedFn: func(ctx context.Context, userID uint64, since time.Time, interval string) ([]model.LinksCreated, error) {
+			return []model.LinksCreated{{Date: "2026-02-01", Links: 2}}, nil
+		},
+	}
+}
+
+func TestRetrieveAccountAnalytics_Aggregates(t *testing.T) {
+	store := newAccountMockStore()
+
+	var gotInterval string
+	var gotDimensions []string
+	clicksOverTime := store.GetUserClicksOverTimeFn
+	store.GetUserClicksOverTimeFn = func(ctx context.Context, userID uint64, since time.Time, interval string) ([]model.ClicksByDate, error) {
+		gotInterval = interval
+		return clicksOverTime(ctx, userID, since, interval)
+	}
+	topValues := store.GetUserTopValuesFn
+	store.GetUserTopValuesFn = func(ctx context.Context, userID uint64, dimension string, since time.Time, limit int) ([]model.DimensionCount, error) {
+		gotDimensions = append(gotDimensions, dimension)
+		return topValues(ctx, userID, dimension, since, limit)
+	}
+
+	svc := NewAnalyticsService(store, nil)
+
+	result, err := svc.RetrieveAccountAnalytics(context.Background(), 1, model.AnalyticsQuery{Period: "30d"})
+	if err != nil {
+		t.Fatalf("RetrieveAccountAnalytics failed: %v", err)
+	}
+
+	if gotInterval != "day" || result.Interval != "day" {
+		t.Errorf("Interval = %q/%q, want day by default", gotInterval, result.Interval)
+	}
+	if result.TotalClicks != 7 {
+		t.Errorf("TotalClicks = %d, want 7", result.TotalClicks)
+	}
+	if len(gotDimensions) != 3 || gotDimensions[0] != storage.DimensionReferrer || gotDimensions[1] != storage.DimensionCountry || gotDimensions[2] != storage.DimensionDevice {
+		t.Errorf("Dimensions = %v, want referrer, country, device", gotDimensions)
+	}
+	if result.TopReferrers[0].Value != "Direct" {
+		t.Errorf("Empty referrer = %q, want Direct", result.TopReferrers[0].Value)
+	}
+	if result.TopCountries[0].Value != "Unknown" {
+		t.Errorf("Empty country = %q, want Unknown", result.TopCountries[0].Value)
+	}
+	if len(result.TopLinks) != 1 || len(result.LinksCreated) != 1 {
+		t.Errorf("TopLinks/LinksCreated = %d/%d, want 1/1", len(result.TopLinks), len(result.LinksCreated))
+	}
+}
+
+func TestRetrieveAccountAnalytics_InvalidInterval(t *testing.T) {
+	svc := NewAnalyticsService(newAccountMockStore(), nil)
+
+	_, err := svc.RetrieveAccountAnalytics(context.Background(), 1, model.AnalyticsQuery{Period: "30d", Interval: "hour"})
+	if !errors.Is(err, ErrInvalidInterval) {
+		t.Errorf("err = %v, want ErrInvalidInterval", err)
+	}
+}
+
+func TestRetrieveAnalytics_GroupsByReferrer(t *testing.T) {
+	store := &storage.MockStore{
+		GetAnalyticsEventsFn: func(ctx context.Context, linkID uint64, period time.Time) ([]*model.AnalyticsEvent, error) {
+			return []*model.AnalyticsEvent{
+				{IPAddress: "1.1.1.0", Referrer: "google.com"},
+				{IPAddress: "2.2.2.0", Referrer: "google.com"},
+				{IPAddress: "3.3.3.0"},
+			}, nil
+		},
+	}
+
+	svc := NewAnalyticsService(store, nil)
+
+	summary, err := svc.RetrieveAnalytics(context.Background(), 1, model.AnalyticsQuery{Period: "7d"})
+	if err != nil {
+		t.Fatalf("RetrieveAnalytics failed: %v", err)
+	}
+
+	referrers := make(map[string]int)
+	for _, r := range summary.ClicksByReferrer {
+		referrers[r.Referrer] = r.Clicks
+	}
+	if referrers["google.com"] != 2 || referrers["Direct"] != 1 {
+		t.Errorf("ClicksByReferrer = %v, want google.com:2 Direct:1", referrers)
+	}
+}
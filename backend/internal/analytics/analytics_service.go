@@ -2,79 +2,363 @@ package analytics
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"time"
 
+	"github.com/Unhyphenated/shrinks-backend/internal/cache"
 	"github.com/Unhyphenated/shrinks-backend/internal/model"
 	"github.com/Unhyphenated/shrinks-backend/internal/storage"
 	"github.com/Unhyphenated/shrinks-backend/internal/util"
 )
 
+var (
+	ErrExportScope     = errors.New("export needs a link or user")
+	ErrInvalidRange    = errors.New("start of range must be before its end")
+	ErrInvalidInterval = errors.New("interval must be day, week or month")
+)
+
+// Entries returned per top-N list on the account dashboard.
+const accountTopLimit = 10
+
 type AnalyticsProvider interface {
 	RecordEvent(ctx context.Context, event *model.AnalyticsEvent) error
-	RetrieveAnalytics(ctx context.Context, linkID uint64, periodString string) (*model.AnalyticsSummary, error)
+	RetrieveAnalytics(ctx context.Context, linkID uint64, query model.AnalyticsQuery) (*model.AnalyticsSummary, error)
+	ExportEvents(ctx context.Context, filter model.AnalyticsExportFilter, fn func(event *model.AnalyticsEvent) error) error
+	RetrieveAccountAnalytics(ctx context.Context, userID uint64, query model.AnalyticsQuery) (*model.AccountAnalytics, error)
+	SetRetention(ctx context.Context, userID uint64, days *int) error
+	RecordConversion(ctx context.Context, linkID uint64, clickID string) error
 }
 type AnalyticsService struct {
-	Store storage.AnalyticsStore
+	Store    storage.AnalyticsStore
+	Visitors cache.VisitorCounter // Optional; falls back to counting distinct visitors in the events
+	Filter   FilterPolicy
+
+	// Deployment default for raw events, which overrides can only shorten;
+	// 0 keeps them forever
+	RetentionDays int
 }
 
-func NewAnalyticsService(store storage.AnalyticsStore) *AnalyticsService {
-	return &AnalyticsService{Store: store}
+func NewAnalyticsService(store storage.AnalyticsStore, visitors cache.VisitorCounter) *AnalyticsService {
+	return &AnalyticsService{Store: store, Visitors: visitors, Filter: DefaultFilterPolicy(), RetentionDays: DefaultRetentionDays}
 }
 
+// RecordEvent flags filtered traffic instead of dropping it, so it can still
+// be inspected with AnalyticsQuery.IncludeFiltered.
 func (as *AnalyticsService) RecordEvent(ctx context.Context, event *model.AnalyticsEvent) error {
+	event.FilterReason = as.Filter.Classify(event)
+
+	if event.FilterReason == "" && as.Filter.RepeatWindow > 0 && as.Visitors != nil && event.VisitorHash != "" {
+		repeat, err := as.Visitors.IsRepeatClick(ctx, event.LinkID, event.VisitorHash, as.Filter.RepeatWindow)
+		if err != nil {
+			log.Printf("failed to check repeat click: %v", err)
+		} else if repeat {
+			event.FilterReason = FilterReasonRepeat
+		}
+	}
+
+	event.Filtered = event.FilterReason != ""
+
 	err := as.Store.SaveAnalyticsEvent(ctx, event)
 
 	if err != nil {
 		return err
 	}
 
+	// The event is already persisted, so a sketch failure only costs accuracy
+	if as.Visitors != nil && event.VisitorHash != "" && !event.Filtered {
+		if err := as.Visitors.AddVisitor(ctx, event.LinkID, event.ClickedAt, event.VisitorHash); err != nil {
+			log.Printf("failed to add visitor to sketch: %v", err)
+		}
+	}
+
 	return nil
 }
 
-func (as *AnalyticsService) RetrieveAnalytics(ctx context.Context, linkID uint64, periodString string) (*model.AnalyticsSummary, error) {
-	period, err := util.ParsePeriodToTime(periodString)
+func (as *AnalyticsService) RetrieveAnalytics(ctx context.Context, linkID uint64, query model.AnalyticsQuery) (*model.AnalyticsSummary, error) {
+	period, err := util.ParsePeriodToTime(query.Period)
 	if err != nil {
 		return nil, fmt.Errorf("failure to parse time: %w", err)
 	}
 
-	events, err := as.Store.GetAnalyticsEvents(ctx, linkID, period)
+	now := time.Now().UTC()
+
+	// The previous period has the same length and ends where this one starts,
+	// so both are covered by a single fetch
+	fetchFrom := period
+	previousStart := period.Add(-now.Sub(period))
+	if query.Compare {
+		fetchFrom = previousStart
+	}
+
+	events, err := as.Store.GetAnalyticsEvents(ctx, linkID, fetchFrom)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get analytics events: %w", err)
 	}
 
-	dateMap := make(map[string]int)
-	deviceMap := make(map[string]int)
-	browserMap := make(map[string]int)
-	osMap := make(map[string]int)
-	uniqueIPs := make(map[string]struct{})
+	location := query.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	current := newBreakdown(location)
+	previous := newBreakdown(location)
 
 	for _, event := range events {
-		uniqueIPs[event.IPAddress] = struct{}{}
-		dateMap[event.ClickedAt.Format("2006-01-02")]++
-		deviceMap[event.DeviceType]++
-		browserMap[event.Browser]++
-		osMap[event.OS]++
+		if query.Compare && event.ClickedAt.Before(period) {
+			previous.add(event, query.IncludeFiltered)
+		} else {
+			current.add(event, query.IncludeFiltered)
+		}
+	}
+
+	summary := current.summary(linkID, query.Period)
+	summary.TimeZone = location.String()
+
+	// Sketches only hold unfiltered visitors
+	if as.Visitors != nil && !query.IncludeFiltered {
+		count, err := as.Visitors.CountVisitors(ctx, linkID, period, now)
+		if err != nil {
+			log.Printf("failed to count visitors from sketches (using events): %v", err)
+		} else {
+			summary.UniqueVisitors = count
+		}
+	}
+
+	if query.Compare {
+		previousSummary := previous.summary(linkID, query.Period)
+
+		if as.Visitors != nil && !query.IncludeFiltered {
+			count, err := as.Visitors.CountVisitors(ctx, linkID, previousStart, period)
+			if err != nil {
+				log.Printf("failed to count previous visitors from sketches (using events): %v", err)
+			} else {
+				previousSummary.UniqueVisitors = count
+			}
+		}
+
+		summary.Comparison = compare(current, previous, summary, previousSummary, previousStart, period)
+	}
+
+	return summary, nil
+}
+
+// RecordConversion counts a conversion once per click; repeated reports are
+// accepted but ignored.
+func (as *AnalyticsService) RecordConversion(ctx context.Context, linkID uint64, clickID string) error {
+	if _, err := as.Store.SaveConversion(ctx, linkID, clickID); err != nil {
+		return fmt.Errorf("failed to record conversion: %w", err)
+	}
+	return nil
+}
+
+// ExportEvents streams raw events in clicked_at order without loading them
+// all into memory.
+func (as *AnalyticsService) ExportEvents(ctx context.Context, filter model.AnalyticsExportFilter, fn func(event *model.AnalyticsEvent) error) error {
+	if filter.LinkID == nil && filter.UserID == nil {
+		return ErrExportScope
+	}
+
+	if !filter.From.Before(filter.To) {
+		return ErrInvalidRange
+	}
+
+	return as.Store.StreamAnalyticsEvents(ctx, filter, fn)
+}
+
+// RetrieveAccountAnalytics aggregates across all of the user's links. It
+// reads the daily rollups rather than raw events, so the cost does not grow
+// with the number of links or clicks.
+func (as *AnalyticsService) RetrieveAccountAnalytics(ctx context.Context, userID uint64, query model.AnalyticsQuery) (*model.AccountAnalytics, error) {
+	period, err := util.ParsePeriodToTime(query.Period)
+	if err != nil {
+		return nil, fmt.Errorf("failure to parse time: %w", err)
+	}
+
+	interval := query.Interval
+	if interval == "" {
+		interval = "day"
+	}
+	if interval != "day" && interval != "week" && interval != "month" {
+		return nil, ErrInvalidInterval
 	}
 
+	result := &model.AccountAnalytics{Period: query.Period, Interval: interval}
+
+	result.ClicksOverTime, err = as.Store.GetUserClicksOverTime(ctx, userID, period, interval)
+	if err != nil {
+		return nil, err
+	}
+	for _, bucket := range result.ClicksOverTime {
+		result.TotalClicks += bucket.Clicks
+	}
+
+	result.TopLinks, err = as.Store.GetUserTopLinks(ctx, userID, period, accountTopLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	result.TopReferrers, err = as.Store.GetUserTopValues(ctx, userID, storage.DimensionReferrer, period, accountTopLimit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range result.TopReferrers {
+		result.TopReferrers[i].Value = orDirect(result.TopReferrers[i].Value)
+	}
+
+	result.TopCountries, err = as.Store.GetUserTopValues(ctx, userID, storage.DimensionCountry, period, accountTopLimit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range result.TopCountries {
+		result.TopCountries[i].Value = orUnknown(result.TopCountries[i].Value)
+	}
+
+	result.TopDevices, err = as.Store.GetUserTopValues(ctx, userID, storage.DimensionDevice, period, accountTopLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	result.LinksCreated, err = as.Store.GetUserLinksCreated(ctx, userID, period, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// breakdown counts events per dimension for one period.
+type breakdown struct {
+	totalClicks    int
+	filteredClicks int
+	conversions    int
+	visitors       map[string]struct{}
+	dates          map[string]int
+	devices        map[string]int
+	browsers       map[string]int
+	oses           map[string]int
+	countries      map[string]int
+	cities         map[cityKey]int
+	referrers      map[string]int
+	languages      map[string]int
+	heatmap        model.Heatmap
+	location       *time.Location
+}
+
+func newBreakdown(location *time.Location) *breakdown {
+	return &breakdown{
+		location:  location,
+		visitors:  make(map[string]struct{}),
+		dates:     make(map[string]int),
+		devices:   make(map[string]int),
+		browsers:  make(map[string]int),
+		oses:      make(map[string]int),
+		countries: make(map[string]int),
+		cities:    make(map[cityKey]int),
+		referrers: make(map[string]int),
+		languages: make(map[string]int),
+	}
+}
+
+func (b *breakdown) add(event *model.AnalyticsEvent, includeFiltered bool) {
+	if event.Filtered {
+		b.filteredClicks++
+		if !includeFiltered {
+			return
+		}
+	}
+
+	b.totalClicks++
+	if event.Converted {
+		b.conversions++
+	}
+	// Opted-out visitors can't be told apart, so their clicks count but never
+	// as unique visitors; otherwise they would all merge into one
+	if id := visitorID(event); id != "" {
+		b.visitors[id] = struct{}{}
+	}
+	b.dates[event.ClickedAt.Format("2006-01-02")]++
+	b.devices[event.DeviceType]++
+	b.browsers[event.Browser]++
+	b.oses[event.OS]++
+	b.countries[orUnknown(event.Country)]++
+	b.cities[cityKey{city: orUnknown(event.City), country: orUnknown(event.Country)}]++
+	b.referrers[orDirect(event.Referrer)]++
+	b.languages[orUnknown(event.Language)]++
+
+	clickedAt := event.ClickedAt.In(b.location)
+	b.heatmap[clickedAt.Weekday()][clickedAt.Hour()]++
+}
+
+func (b *breakdown) summary(linkID uint64, period string) *model.AnalyticsSummary {
 	summary := &model.AnalyticsSummary{
 		LinkID:         linkID,
-		Period:         periodString,
-		TotalClicks:    len(events),
-		UniqueVisitors: len(uniqueIPs),
+		Period:         period,
+		TotalClicks:    b.totalClicks,
+		FilteredClicks: b.filteredClicks,
+		UniqueVisitors: len(b.visitors),
+		VisitorScope:   model.VisitorScopeDaily,
+		Conversions:    b.conversions,
+		Heatmap:        b.heatmap,
+	}
+	if b.totalClicks > 0 {
+		summary.ConversionRate = float64(b.conversions) / float64(b.totalClicks)
 	}
 
-	for date, clicks := range dateMap {
+	for date, clicks := range b.dates {
 		summary.ClicksByDate = append(summary.ClicksByDate, model.ClicksByDate{Date: date, Clicks: clicks})
 	}
-	for device, clicks := range deviceMap {
+	for device, clicks := range b.devices {
 		summary.ClicksByDevice = append(summary.ClicksByDevice, model.ClicksByDevice{Device: device, Clicks: clicks})
 	}
-	for browser, clicks := range browserMap {
+	for browser, clicks := range b.browsers {
 		summary.ClicksByBrowser = append(summary.ClicksByBrowser, model.ClicksByBrowser{Browser: browser, Clicks: clicks})
 	}
-	for os, clicks := range osMap {
+	for os, clicks := range b.oses {
 		summary.ClicksByOS = append(summary.ClicksByOS, model.ClicksByOS{OS: os, Clicks: clicks})
 	}
+	for country, clicks := range b.countries {
+		summary.ClicksByCountry = append(summary.ClicksByCountry, model.ClicksByCountry{Country: country, Clicks: clicks})
+	}
+	for key, clicks := range b.cities {
+		summary.ClicksByCity = append(summary.ClicksByCity, model.ClicksByCity{City: key.city, Country: key.country, Clicks: clicks})
+	}
+	for referrer, clicks := range b.referrers {
+		summary.ClicksByReferrer = append(summary.ClicksByReferrer, model.ClicksByReferrer{Referrer: referrer, Clicks: clicks})
+	}
+	for language, clicks := range b.languages {
+		summary.ClicksByLanguage = append(summary.ClicksByLanguage, model.ClicksByLanguage{Language: language, Clicks: clicks})
+	}
 
-	return summary, nil
+	return summary
+}
+
+// Cities are keyed together with their country since names like "Springfield" are not unique.
+type cityKey struct {
+	city    string
+	country string
+}
+
+// Events recorded before visitor hashing only have the anonymized IP to go on.
+// Events of opted-out visitors have neither and get "".
+func visitorID(event *model.AnalyticsEvent) string {
+	if event.VisitorHash != "" {
+		return event.VisitorHash
+	}
+	return event.IPAddress
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "Unknown"
+	}
+	return value
+}
+
+func orDirect(referrer string) string {
+	if referrer == "" {
+		return "Direct"
+	}
+	return referrer
 }
@@ -30,7 +30,12 @@ func TestMain(m *testing.M) {
 		panic("Failed to connect to DB: " + err.Error())
 	}
 
-	testService = NewAnalyticsService(testStore)
+	testService = NewAnalyticsService(testStore, nil)
+
+	// The server normally keeps these created ahead
+	if err := NewPartitioner(testStore).Maintain(context.Background()); err != nil {
+		panic("Failed to create analytics partitions: " + err.Error())
+	}
 
 	exitCode := m.Run()
 
@@ -136,7 +141,7 @@ func TestRetrieveAnalytics_AggregatesCorrectly(t *testing.T) {
 		})
 	}
 
-	summary, err := testService.RetrieveAnalytics(ctx, link.ID, "7d")
+	summary, err := testService.RetrieveAnalytics(ctx, link.ID, model.AnalyticsQuery{Period: "7d"})
 	if err != nil {
 		t.Fatalf("RetrieveAnalytics failed: %v", err)
 	}
@@ -174,7 +179,7 @@ func TestRetrieveAnalytics_GroupsByDevice(t *testing.T) {
 		})
 	}
 
-	summary, err := testService.RetrieveAnalytics(ctx, link.ID, "7d")
+	summary, err := testService.RetrieveAnalytics(ctx, link.ID, model.AnalyticsQuery{Period: "7d"})
 	if err != nil {
 		t.Fatalf("RetrieveAnalytics failed: %v", err)
 	}
@@ -227,7 +232,7 @@ func TestRetrieveAnalytics_GroupsByDate(t *testing.T) {
 		})
 	}
 
-	summary, err := testService.RetrieveAnalytics(ctx, link.ID, "7d")
+	summary, err := testService.RetrieveAnalytics(ctx, link.ID, model.AnalyticsQuery{Period: "7d"})
 	if err != nil {
 		t.Fatalf("RetrieveAnalytics failed: %v", err)
 	}
@@ -264,7 +269,7 @@ func TestRetrieveAnalytics_GroupsByBrowser(t *testing.T) {
 		})
 	}
 
-	summary, err := testService.RetrieveAnalytics(ctx, link.ID, "7d")
+	summary, err := testService.RetrieveAnalytics(ctx, link.ID, model.AnalyticsQuery{Period: "7d"})
 	if err != nil {
 		t.Fatalf("RetrieveAnalytics failed: %v", err)
 	}
@@ -306,7 +311,7 @@ func TestRetrieveAnalytics_GroupsByOS(t *testing.T) {
 		})
 	}
 
-	summary, err := testService.RetrieveAnalytics(ctx, link.ID, "7d")
+	summary, err := testService.RetrieveAnalytics(ctx, link.ID, model.AnalyticsQuery{Period: "7d"})
 	if err != nil {
 		t.Fatalf("RetrieveAnalytics failed: %v", err)
 	}
@@ -348,7 +353,7 @@ func TestRetrieveAnalytics_UniqueVisitors(t *testing.T) {
 		})
 	}
 
-	summary, err := testService.RetrieveAnalytics(ctx, link.ID, "7d")
+	summary, err := testService.RetrieveAnalytics(ctx, link.ID, model.AnalyticsQuery{Period: "7d"})
 	if err != nil {
 		t.Fatalf("RetrieveAnalytics failed: %v", err)
 	}
@@ -360,6 +365,10 @@ func TestRetrieveAnalytics_UniqueVisitors(t *testing.T) {
 	if summary.UniqueVisitors != 3 {
 		t.Errorf("UniqueVisitors = %d, want 3", summary.UniqueVisitors)
 	}
+
+	if summary.VisitorScope != model.VisitorScopeDaily {
+		t.Errorf("VisitorScope = %q, want %q", summary.VisitorScope, model.VisitorScopeDaily)
+	}
 }
 
 // Test #64: RetrieveAnalytics returns zeros for no events
@@ -379,7 +388,7 @@ func TestRetrieveAnalytics_EmptyForNoEvents(t *testing.T) {
 
 	// No events
 
-	summary, err := testService.RetrieveAnalytics(ctx, link.ID, "7d")
+	summary, err := testService.RetrieveAnalytics(ctx, link.ID, model.AnalyticsQuery{Period: "7d"})
 	if err != nil {
 		t.Fatalf("RetrieveAnalytics failed: %v", err)
 	}
@@ -0,0 +1,159 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/cache"
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/notify"
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+const (
+	defaultAlertWindow   = 15 * time.Minute
+	defaultAlertBaseline = 7 * 24 * time.Hour
+	defaultAlertCooldown = 6 * time.Hour
+)
+
+// Detector periodically compares each link's recent clicks against its own
+// history and notifies the owner about sudden spikes, traffic dominated by a
+// single network, or an unusual share of bots.
+type Detector struct {
+	Store    storage.AnalyticsStore
+	Limiter  cache.AlertLimiter // Optional; without it every pass re-notifies
+	Notifier notify.Notifier
+
+	Window       time.Duration // Recent traffic looked at on each pass
+	Baseline     time.Duration // History before the window the spike is measured against
+	MinClicks    int           // Below this a link is never flagged
+	SpikeFactor  float64       // Flag when clicks reach this multiple of the expected rate
+	NetworkShare float64       // Flag when one network sends this share of all clicks; zero disables it
+	BotShare     float64       // Flag when bots make up this share of all clicks
+	Cooldown     time.Duration // Minimum time between alerts of one kind for a link
+}
+
+func NewDetector(store storage.AnalyticsStore, limiter cache.AlertLimiter, notifier notify.Notifier) *Detector {
+	return &Detector{
+		Store:        store,
+		Limiter:      limiter,
+		Notifier:     notifier,
+		Window:       defaultAlertWindow,
+		Baseline:     defaultAlertBaseline,
+		MinClicks:    50,
+		SpikeFactor:  5,
+		NetworkShare: 0.5,
+		BotShare:     0.5,
+		Cooldown:     defaultAlertCooldown,
+	}
+}
+
+// Check looks at the last window of traffic once and returns the alerts it
+// notified about. Alerts still in cooldown are skipped, and a failing
+// notifier is logged so the remaining alerts are still sent.
+func (d *Detector) Check(ctx context.Context) ([]model.Alert, error) {
+	now := time.Now().UTC()
+	since := now.Add(-d.Window)
+
+	traffic, err := d.Store.GetLinkTraffic(ctx, since, since.Add(-d.Baseline), d.MinClicks)
+	if err != nil {
+		return nil, err
+	}
+
+	sent := []model.Alert{}
+	for _, t := range traffic {
+		for _, alert := range d.detect(t, now) {
+			if d.Limiter != nil {
+				claimed, err := d.Limiter.ClaimAlert(ctx, alert.LinkID, alert.Kind, d.Cooldown)
+				if err != nil {
+					log.Printf("alerts: failed to claim %s for link %d: %v", alert.Kind, alert.LinkID, err)
+					continue
+				}
+				if !claimed {
+					continue
+				}
+			}
+
+			if err := d.Notifier.Notify(ctx, alert); err != nil {
+				log.Printf("alerts: failed to notify %s for link %d: %v", alert.Kind, alert.LinkID, err)
+				continue
+			}
+			sent = append(sent, alert)
+		}
+	}
+
+	return sent, nil
+}
+
+func (d *Detector) detect(t model.LinkTraffic, now time.Time) []model.Alert {
+	alerts := []model.Alert{}
+	newAlert := func(kind string, clicks int, message string) model.Alert {
+		return model.Alert{
+			Kind:       kind,
+			LinkID:     t.LinkID,
+			ShortCode:  t.ShortCode,
+			UserID:     t.UserID,
+			OwnerEmail: t.OwnerEmail,
+			Message:    message,
+			Clicks:     clicks,
+			Window:     d.Window.String(),
+			DetectedAt: now,
+		}
+	}
+
+	// Scale the baseline down to one window; a link with no history is
+	// expected to get at least one click so new links can still spike.
+	expected := float64(t.BaselineClicks) * d.Window.Seconds() / d.Baseline.Seconds()
+	if expected < 1 {
+		expected = 1
+	}
+	if t.Clicks >= d.MinClicks && float64(t.Clicks) >= d.SpikeFactor*expected {
+		alerts = append(alerts, newAlert(model.AlertClickSpike, t.Clicks,
+			fmt.Sprintf("%d clicks in the last %s, %.0fx the usual rate", t.Clicks, d.Window, float64(t.Clicks)/expected)))
+	}
+
+	if t.AllClicks >= d.MinClicks {
+		if d.NetworkShare > 0 && t.TopNetworkHits >= d.MinClicks && share(t.TopNetworkHits, t.AllClicks) >= d.NetworkShare {
+			alerts = append(alerts, newAlert(model.AlertSingleNetwork, t.AllClicks,
+				fmt.Sprintf("%.0f%% of clicks in the last %s came from network %s", 100*share(t.TopNetworkHits, t.AllClicks), d.Window, t.TopNetwork)))
+		}
+		if share(t.BotClicks, t.AllClicks) >= d.BotShare {
+			alerts = append(alerts, newAlert(model.AlertBotShare, t.AllClicks,
+				fmt.Sprintf("%.0f%% of clicks in the last %s were from bots", 100*share(t.BotClicks, t.AllClicks), d.Window)))
+		}
+	}
+
+	return alerts
+}
+
+func share(part int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+// Run checks once per interval until ctx is done.
+func (d *Detector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		alerts, err := d.Check(ctx)
+		if err != nil {
+			log.Printf("alerts: check failed: %v", err)
+			continue
+		}
+		if len(alerts) > 0 {
+			log.Printf("alerts: sent %d alerts", len(alerts))
+		}
+	}
+}
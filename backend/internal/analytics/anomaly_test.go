@@ -0,0 +1,183 @@
+//go:build unit
+
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/cache"
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/notify"
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+func trafficStore(traffic ...model.LinkTraffic) *storage.MockStore {
+	return &storage.MockStore{
+		GetLinkTrafficFn: func(ctx context.Context, since time.Time, baselineSince time.Time, minClicks int) ([]model.LinkTraffic, error) {
+			return traffic, nil
+		},
+	}
+}
+
+func alertKinds(alerts []model.Alert) []string {
+	kinds := []string{}
+	for _, alert := range alerts {
+		kinds = append(kinds, alert.Kind)
+	}
+	return kinds
+}
+
+func TestDetector_Detect(t *testing.T) {
+	d := NewDetector(nil, nil, nil)
+
+	// 7 days of baseline is 672 windows of 15 minutes
+	tests := []struct {
+		name    string
+		traffic model.LinkTraffic
+		want    []string
+	}{
+		{
+			name:    "Steady traffic",
+			traffic: model.LinkTraffic{Clicks: 100, AllClicks: 110, BaselineClicks: 67200, TopNetworkHits: 5},
+			want:    []string{},
+		},
+		{
+			name:    "Spike over baseline",
+			traffic: model.LinkTraffic{Clicks: 600, AllClicks: 620, BaselineClicks: 67200, TopNetworkHits: 5},
+			want:    []string{model.AlertClickSpike},
+		},
+		{
+			name:    "New link spike",
+			traffic: model.LinkTraffic{Clicks: 60, AllClicks: 60, TopNetworkHits: 2},
+			want:    []string{model.AlertClickSpike},
+		},
+		{
+			name:    "Spike below minimum clicks",
+			traffic: model.LinkTraffic{Clicks: 40, AllClicks: 40, TopNetworkHits: 2},
+			want:    []string{},
+		},
+		{
+			name:    "Single network",
+			traffic: model.LinkTraffic{Clicks: 100, AllClicks: 100, BaselineClicks: 67200, TopNetwork: "203.0.113.0", TopNetworkHits: 80},
+			want:    []string{model.AlertSingleNetwork},
+		},
+		{
+			name:    "Bot share",
+			traffic: model.LinkTraffic{Clicks: 40, AllClicks: 120, BotClicks: 80, BaselineClicks: 67200, TopNetworkHits: 5},
+			want:    []string{model.AlertBotShare},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := alertKinds(d.detect(tt.traffic, time.Now()))
+			if len(got) != len(tt.want) {
+				t.Fatalf("Alerts = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Alerts = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDetector_Detect_NetworkAlertDisabled(t *testing.T) {
+	d := NewDetector(nil, nil, nil)
+	d.NetworkShare = 0
+
+	// In hash mode the "network" is one hashed IP
+	traffic := model.LinkTraffic{Clicks: 100, AllClicks: 100, BaselineClicks: 67200, TopNetwork: "9f2c4e1ab0d3", TopNetworkHits: 100}
+	if got := alertKinds(d.detect(traffic, time.Now())); len(got) != 0 {
+		t.Errorf("Alerts = %v, want none", got)
+	}
+}
+
+func TestDetector_Check_NotifiesOwner(t *testing.T) {
+	store := trafficStore(model.LinkTraffic{LinkID: 1, ShortCode: "abc", UserID: 7, OwnerEmail: "owner@example.com", Clicks: 600, AllClicks: 600, TopNetworkHits: 5})
+	notifier := &notify.MockNotifier{}
+
+	sent, err := NewDetector(store, nil, notifier).Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if len(sent) != 1 || len(notifier.Received()) != 1 {
+		t.Fatalf("Sent %d alerts, notifier got %d, want 1", len(sent), len(notifier.Received()))
+	}
+
+	alert := notifier.Received()[0]
+	if alert.Kind != model.AlertClickSpike || alert.UserID != 7 || alert.OwnerEmail != "owner@example.com" || alert.ShortCode != "abc" {
+		t.Errorf("Alert = %+v, want a click spike for abc owned by user 7", alert)
+	}
+}
+
+func TestDetector_Check_RespectsCooldown(t *testing.T) {
+	store := trafficStore(model.LinkTraffic{LinkID: 1, Clicks: 600, AllClicks: 600, TopNetworkHits: 5})
+	notifier := &notify.MockNotifier{}
+	claimed := map[string]bool{}
+	limiter := &cache.MockAlertLimiter{
+		ClaimAlertFn: func(ctx context.Context, linkID uint64, kind string, cooldown time.Duration) (bool, error) {
+			if cooldown != defaultAlertCooldown {
+				t.Errorf("Cooldown = %s, want %s", cooldown, defaultAlertCooldown)
+			}
+			if claimed[kind] {
+				return false, nil
+			}
+			claimed[kind] = true
+			return true, nil
+		},
+	}
+
+	d := NewDetector(store, limiter, notifier)
+	for i := 0; i < 3; i++ {
+		if _, err := d.Check(context.Background()); err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+	}
+
+	if len(notifier.Received()) != 1 {
+		t.Errorf("Notified %d times, want 1 within the cooldown", len(notifier.Received()))
+	}
+}
+
+func TestDetector_Check_NotifierFailure(t *testing.T) {
+	store := trafficStore(
+		model.LinkTraffic{LinkID: 1, Clicks: 600, AllClicks: 600, TopNetworkHits: 5},
+		model.LinkTraffic{LinkID: 2, Clicks: 600, AllClicks: 600, TopNetworkHits: 5},
+	)
+	calls := 0
+	notifier := &notify.MockNotifier{NotifyFn: func(ctx context.Context, alert model.Alert) error {
+		calls++
+		if alert.LinkID == 1 {
+			return errors.New("webhook down")
+		}
+		return nil
+	}}
+
+	sent, err := NewDetector(store, nil, notifier).Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Notifier called %d times, want 2", calls)
+	}
+	if len(sent) != 1 || sent[0].LinkID != 2 {
+		t.Errorf("Sent = %v, want only link 2", sent)
+	}
+}
+
+func TestDetector_Check_StoreError(t *testing.T) {
+	store := &storage.MockStore{
+		GetLinkTrafficFn: func(ctx context.Context, since time.Time, baselineSince time.Time, minClicks int) ([]model.LinkTraffic, error) {
+			return nil, errors.New("db down")
+		},
+	}
+
+	if _, err := NewDetector(store, nil, &notify.MockNotifier{}).Check(context.Background()); err == nil {
+		t.Error("Expected store error")
+	}
+}
@@ -0,0 +1,95 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrInvalidClickID = errors.New("invalid click ID")
+	ErrClickIDExpired = errors.New("click ID has expired")
+)
+
+const (
+	// ClickIDParam is the query parameter added to tracked destination URLs.
+	ClickIDParam = "shrinks_cid"
+
+	// Conversions reported later than this after the click are ignored.
+	ClickIDMaxAge = 30 * 24 * time.Hour
+
+	clickIDPayloadSize = 24 // Link ID, unix seconds and a random nonce
+	clickIDMACSize     = 16
+)
+
+// ClickIDSigner issues click IDs that carry the link and click time, signed
+// so a destination site can report conversions without being able to forge
+// them for other links.
+type ClickIDSigner struct {
+	Secret []byte
+}
+
+func NewClickIDSigner(secret string) *ClickIDSigner {
+	return &ClickIDSigner{Secret: []byte(secret)}
+}
+
+func (s *ClickIDSigner) Sign(linkID uint64, at time.Time) (string, error) {
+	payload := make([]byte, clickIDPayloadSize)
+	binary.BigEndian.PutUint64(payload[0:8], linkID)
+	binary.BigEndian.PutUint64(payload[8:16], uint64(at.Unix()))
+	if _, err := rand.Read(payload[16:]); err != nil {
+		return "", fmt.Errorf("failed to generate click ID: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(append(payload, s.mac(payload)...)), nil
+}
+
+// Verify checks the signature and age of a click ID and returns the link it
+// was issued for.
+func (s *ClickIDSigner) Verify(clickID string, now time.Time) (uint64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(clickID)
+	if err != nil || len(raw) != clickIDPayloadSize+clickIDMACSize {
+		return 0, ErrInvalidClickID
+	}
+
+	payload, mac := raw[:clickIDPayloadSize], raw[clickIDPayloadSize:]
+	if !hmac.Equal(mac, s.mac(payload)) {
+		return 0, ErrInvalidClickID
+	}
+
+	clickedAt := time.Unix(int64(binary.BigEndian.Uint64(payload[8:16])), 0)
+	if now.Sub(clickedAt) > ClickIDMaxAge {
+		return 0, ErrClickIDExpired
+	}
+
+	return binary.BigEndian.Uint64(payload[0:8]), nil
+}
+
+func (s *ClickIDSigner) mac(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write(payload)
+	return mac.Sum(nil)[:clickIDMACSize]
+}
+
+// AppendClickID adds the click ID to the destination's query string, keeping
+// its existing parameters in their original order.
+func AppendClickID(longURL string, clickID string) string {
+	parsed, err := url.Parse(longURL)
+	if err != nil {
+		return longURL
+	}
+
+	param := ClickIDParam + "=" + url.QueryEscape(clickID)
+	if parsed.RawQuery == "" {
+		parsed.RawQuery = param
+	} else {
+		parsed.RawQuery += "&" + param
+	}
+	return parsed.String()
+}
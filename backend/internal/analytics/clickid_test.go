@@ -0,0 +1,112 @@
+//go:build unit
+
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+func TestClickIDSigner_RoundTrip(t *testing.T) {
+	signer := NewClickIDSigner("test-secret")
+	now := time.Now()
+
+	first, err := signer.Sign(42, now)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	second, _ := signer.Sign(42, now)
+	if first == second {
+		t.Error("Click IDs for separate clicks should differ")
+	}
+
+	linkID, err := signer.Verify(first, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if linkID != 42 {
+		t.Errorf("Link ID = %d, want 42", linkID)
+	}
+}
+
+func TestClickIDSigner_Rejects(t *testing.T) {
+	signer := NewClickIDSigner("test-secret")
+	now := time.Now()
+	clickID, _ := signer.Sign(42, now)
+
+	// Flip a character in the middle so the decoded payload changes
+	tampered := []byte(clickID)
+	if tampered[5] == 'A' {
+		tampered[5] = 'B'
+	} else {
+		tampered[5] = 'A'
+	}
+
+	tests := []struct {
+		name    string
+		signer  *ClickIDSigner
+		clickID string
+		now     time.Time
+		want    error
+	}{
+		{name: "Empty", signer: signer, clickID: "", now: now, want: ErrInvalidClickID},
+		{name: "Not base64", signer: signer, clickID: "not a click id!", now: now, want: ErrInvalidClickID},
+		{name: "Tampered", signer: signer, clickID: string(tampered), now: now, want: ErrInvalidClickID},
+		{name: "Other secret", signer: NewClickIDSigner("other-secret"), clickID: clickID, now: now, want: ErrInvalidClickID},
+		{name: "Expired", signer: signer, clickID: clickID, now: now.Add(ClickIDMaxAge + time.Hour), want: ErrClickIDExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.signer.Verify(tt.clickID, tt.now); !errors.Is(err, tt.want) {
+				t.Errorf("Verify error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendClickID(t *testing.T) {
+	tests := []struct {
+		longURL string
+		want    string
+	}{
+		{longURL: "https://example.com", want: "https://example.com?shrinks_cid=abc"},
+		{longURL: "https://example.com/p?b=2&a=1", want: "https://example.com/p?b=2&a=1&shrinks_cid=abc"},
+		{longURL: "https://example.com/p#section", want: "https://example.com/p?shrinks_cid=abc#section"},
+	}
+
+	for _, tt := range tests {
+		if got := AppendClickID(tt.longURL, "abc"); got != tt.want {
+			t.Errorf("AppendClickID(%q) = %q, want %q", tt.longURL, got, tt.want)
+		}
+	}
+}
+
+func TestRetrieveAnalytics_Conversions(t *testing.T) {
+	store := &storage.MockStore{
+		GetAnalyticsEventsFn: func(ctx context.Context, linkID uint64, period time.Time) ([]*model.AnalyticsEvent, error) {
+			return []*model.AnalyticsEvent{
+				{ClickID: "a", Converted: true},
+				{ClickID: "b"},
+				{ClickID: "c"},
+				{ClickID: "d", Converted: true, Filtered: true, FilterReason: FilterReasonBot},
+			}, nil
+		},
+	}
+
+	summary, err := NewAnalyticsService(store, nil).RetrieveAnalytics(context.Background(), 1, model.AnalyticsQuery{Period: "7d"})
+	if err != nil {
+		t.Fatalf("RetrieveAnalytics failed: %v", err)
+	}
+	if summary.Conversions != 1 {
+		t.Errorf("Conversions = %d, want 1 (filtered clicks excluded)", summary.Conversions)
+	}
+	if summary.ConversionRate < 0.333 || summary.ConversionRate > 0.334 {
+		t.Errorf("ConversionRate = %f, want 1/3", summary.ConversionRate)
+	}
+}
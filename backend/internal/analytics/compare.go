@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+// compare takes the visitor counts from the summaries since they may come
+// from the sketches rather than the breakdowns.
+func compare(current *breakdown, previous *breakdown, summary *model.AnalyticsSummary, previousSummary *model.AnalyticsSummary, previousFrom time.Time, previousTo time.Time) *model.AnalyticsComparison {
+	return &model.AnalyticsComparison{
+		PreviousFrom:   previousFrom,
+		PreviousTo:     previousTo,
+		TotalClicks:    newDelta(current.totalClicks, previous.totalClicks),
+		UniqueVisitors: newDelta(summary.UniqueVisitors, previousSummary.UniqueVisitors),
+		Conversions:    newDelta(current.conversions, previous.conversions),
+		Devices:        dimensionDeltas(current.devices, previous.devices),
+		Browsers:       dimensionDeltas(current.browsers, previous.browsers),
+		OS:             dimensionDeltas(current.oses, previous.oses),
+		Countries:      dimensionDeltas(current.countries, previous.countries),
+		Cities:         dimensionDeltas(cityLabels(current.cities), cityLabels(previous.cities)),
+		Referrers:      dimensionDeltas(current.referrers, previous.referrers),
+		Languages:      dimensionDeltas(current.languages, previous.languages),
+	}
+}
+
+func cityLabels(cities map[cityKey]int) map[string]int {
+	labels := make(map[string]int, len(cities))
+	for key, clicks := range cities {
+		labels[key.city+", "+key.country] = clicks
+	}
+	return labels
+}
+
+// dimensionDeltas covers values seen in either period, so a country that
+// stopped sending clicks shows up with Current 0. Sorted by current clicks.
+func dimensionDeltas(current map[string]int, previous map[string]int) []model.DimensionDelta {
+	deltas := []model.DimensionDelta{}
+
+	for value, clicks := range current {
+		deltas = append(deltas, model.DimensionDelta{Value: value, Delta: newDelta(clicks, previous[value])})
+	}
+	for value, clicks := range previous {
+		if _, ok := current[value]; !ok {
+			deltas = append(deltas, model.DimensionDelta{Value: value, Delta: newDelta(0, clicks)})
+		}
+	}
+
+	sort.Slice(deltas, func(i, j int) bool {
+		if deltas[i].Current != deltas[j].Current {
+			return deltas[i].Current > deltas[j].Current
+		}
+		return deltas[i].Value < deltas[j].Value
+	})
+
+	return deltas
+}
+
+func newDelta(current int, previous int) model.Delta {
+	delta := model.Delta{
+		Current:  current,
+		Previous: previous,
+		Change:   current - previous,
+	}
+
+	if previous > 0 {
+		// Rounded to one decimal place
+		percent := math.Round(float64(delta.Change)/float64(previous)*1000) / 10
+		delta.PercentChange = &percent
+	}
+
+	return delta
+}
@@ -0,0 +1,186 @@
+//go:build unit
+
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/cache"
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+func TestNewDelta(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  int
+		previous int
+		change   int
+		percent  *float64
+	}{
+		{"Growth", 15, 10, 5, ptr(50.0)},
+		{"Decline", 2, 3, -1, ptr(-33.3)},
+		{"Unchanged", 4, 4, 0, ptr(0.0)},
+		{"No previous clicks", 5, 0, 5, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := newDelta(tt.current, tt.previous)
+			if delta.Change != tt.change {
+				t.Errorf("Change = %d, want %d", delta.Change, tt.change)
+			}
+			if (delta.PercentChange == nil) != (tt.percent == nil) {
+				t.Fatalf("PercentChange = %v, want %v", delta.PercentChange, tt.percent)
+			}
+			if tt.percent != nil && *delta.PercentChange != *tt.percent {
+				t.Errorf("PercentChange = %v, want %v", *delta.PercentChange, *tt.percent)
+			}
+		})
+	}
+}
+
+func TestRetrieveAnalytics_Compare(t *testing.T) {
+	now := time.Now().UTC()
+	var fetchedFrom time.Time
+
+	store := &storage.MockStore{
+		GetAnalyticsEventsFn: func(ctx context.Context, linkID uint64, period time.Time) ([]*model.AnalyticsEvent, error) {
+			fetchedFrom = period
+			return []*model.AnalyticsEvent{
+				// Previous 7 days
+				{VisitorHash: "a", DeviceType: "Desktop", Country: "GB", ClickedAt: now.AddDate(0, 0, -10)},
+				{VisitorHash: "b", DeviceType: "Mobile", Country: "FR", ClickedAt: now.AddDate(0, 0, -9)},
+				// Current 7 days
+				{VisitorHash: "a", DeviceType: "Desktop", Country: "GB", ClickedAt: now.AddDate(0, 0, -2)},
+				{VisitorHash: "c", DeviceType: "Desktop", Country: "GB", ClickedAt: now.AddDate(0, 0, -1)},
+				{VisitorHash: "d", DeviceType: "Desktop", ClickedAt: now},
+			}, nil
+		},
+	}
+
+	svc := NewAnalyticsService(store, nil)
+
+	summary, err := svc.RetrieveAnalytics(context.Background(), 1, model.AnalyticsQuery{Period: "7d", Compare: true})
+	if err != nil {
+		t.Fatalf("RetrieveAnalytics failed: %v", err)
+	}
+
+	if want := now.AddDate(0, 0, -14); fetchedFrom.Sub(want).Abs() > time.Minute {
+		t.Errorf("Fetched from %v, want about %v", fetchedFrom, want)
+	}
+	if summary.TotalClicks != 3 {
+		t.Errorf("TotalClicks = %d, want 3 (current period only)", summary.TotalClicks)
+	}
+
+	comparison := summary.Comparison
+	if comparison == nil {
+		t.Fatal("Comparison not set")
+	}
+	if comparison.TotalClicks.Previous != 2 || comparison.TotalClicks.Change != 1 || *comparison.TotalClicks.PercentChange != 50 {
+		t.Errorf("TotalClicks delta = %+v, want 3 vs 2 (+50%%)", comparison.TotalClicks)
+	}
+	if comparison.UniqueVisitors.Current != 3 || comparison.UniqueVisitors.Previous != 2 {
+		t.Errorf("UniqueVisitors delta = %+v, want 3 vs 2", comparison.UniqueVisitors)
+	}
+
+	countries := make(map[string]model.Delta)
+	for _, d := range comparison.Countries {
+		countries[d.Value] = d.Delta
+	}
+	if countries["GB"].Change != 1 {
+		t.Errorf("GB change = %d, want 1", countries["GB"].Change)
+	}
+	// Gone from the current period, but still listed
+	if fr := countries["FR"]; fr.Current != 0 || fr.Previous != 1 {
+		t.Errorf("FR delta = %+v, want 0 vs 1", fr)
+	}
+	if unknown := countries["Unknown"]; unknown.Current != 1 || unknown.PercentChange != nil {
+		t.Errorf("Unknown delta = %+v, want 1 vs 0 with no percentage", unknown)
+	}
+	if comparison.Devices[0].Value != "Desktop" {
+		t.Errorf("Devices not sorted by current clicks: %+v", comparison.Devices)
+	}
+}
+
+func TestRetrieveAnalytics_CompareUsesSketches(t *testing.T) {
+	store := &storage.MockStore{
+		GetAnalyticsEventsFn: func(ctx context.Context, linkID uint64, period time.Time) ([]*model.AnalyticsEvent, error) {
+			return nil, nil
+		},
+	}
+
+	var ranges [][2]time.Time
+	visitors := &cache.MockVisitorCounter{
+		CountVisitorsFn: func(ctx context.Context, linkID uint64, from time.Time, to time.Time) (int, error) {
+			ranges = append(ranges, [2]time.Time{from, to})
+			return 10 * len(ranges), nil
+		},
+	}
+
+	svc := NewAnalyticsService(store, visitors)
+
+	summary, err := svc.RetrieveAnalytics(context.Background(), 1, model.AnalyticsQuery{Period: "7d", Compare: true})
+	if err != nil {
+		t.Fatalf("RetrieveAnalytics failed: %v", err)
+	}
+
+	if len(ranges) != 2 {
+		t.Fatalf("CountVisitors called %d times, want 2", len(ranges))
+	}
+	// The previous period ends where the current one starts
+	if !ranges[1][1].Equal(ranges[0][0]) {
+		t.Errorf("Previous range ends at %v, want %v", ranges[1][1], ranges[0][0])
+	}
+	if summary.Comparison.UniqueVisitors.Current != 10 || summary.Comparison.UniqueVisitors.Previous != 20 {
+		t.Errorf("UniqueVisitors delta = %+v, want 10 vs 20", summary.Comparison.UniqueVisitors)
+	}
+}
+
+func TestRetrieveAnalytics_NoComparisonByDefault(t *testing.T) {
+	store := &storage.MockStore{
+		GetAnalyticsEventsFn: func(ctx context.Context, linkID uint64, period time.Time) ([]*model.AnalyticsEvent, error) {
+			return nil, nil
+		},
+	}
+
+	summary, err := NewAnalyticsService(store, nil).RetrieveAnalytics(context.Background(), 1, model.AnalyticsQuery{Period: "7d"})
+	if err != nil {
+		t.Fatalf("RetrieveAnalytics failed: %v", err)
+	}
+	if summary.Comparison != nil {
+		t.Error("Comparison should only be set when requested")
+	}
+}
+
+func ptr(f float64) *float64 {
+	return &f
+}
+
+func TestRetrieveAnalytics_ClicksByLanguage(t *testing.T) {
+	store := &storage.MockStore{
+		GetAnalyticsEventsFn: func(ctx context.Context, linkID uint64, period time.Time) ([]*model.AnalyticsEvent, error) {
+			return []*model.AnalyticsEvent{
+				{VisitorHash: "a", Language: "en-US"},
+				{VisitorHash: "b", Language: "en-US"},
+				{VisitorHash: "c", Language: "de-DE"},
+				{VisitorHash: "d"},
+			}, nil
+		},
+	}
+
+	summary, err := NewAnalyticsService(store, nil).RetrieveAnalytics(context.Background(), 1, model.AnalyticsQuery{Period: "7d"})
+	if err != nil {
+		t.Fatalf("RetrieveAnalytics failed: %v", err)
+	}
+
+	got := map[string]int{}
+	for _, language := range summary.ClicksByLanguage {
+		got[language.Language] = language.Clicks
+	}
+	if got["en-US"] != 2 || got["de-DE"] != 1 || got["Unknown"] != 1 {
+		t.Errorf("ClicksByLanguage = %v, want en-US 2, de-DE 1, Unknown 1", got)
+	}
+}
@@ -0,0 +1,116 @@
+package analytics
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+const (
+	FilterReasonBot     = "bot"
+	FilterReasonPreview = "link_preview"
+	FilterReasonHead    = "head_request"
+	FilterReasonRepeat  = "repeat_click"
+)
+
+// Link-preview fetchers unfurl a link when it is pasted into a chat; they are
+// checked before bots since several of them also identify as one.
+var previewAgents = []string{
+	"facebookexternalhit",
+	"facebot",
+	"twitterbot",
+	"slackbot",
+	"linkedinbot",
+	"discordbot",
+	"whatsapp",
+	"telegrambot",
+	"skypeuripreview",
+	"pinterestbot",
+	"redditbot",
+	"embedly",
+	"iframely",
+	"vkshare",
+	"google-pagerenderer",
+	"mastodon",
+}
+
+// Catches crawlers and HTTP clients the user-agent parser doesn't flag as bots.
+// Crawlers are named since "bot" alone also matches devices like CUBOT phones.
+var botAgents = []string{
+	"googlebot",
+	"bingbot",
+	"yandexbot",
+	"duckduckbot",
+	"applebot",
+	"amazonbot",
+	"gptbot",
+	"ahrefsbot",
+	"semrushbot",
+	"mj12bot",
+	"dotbot",
+	"petalbot",
+	"crawl",
+	"spider",
+	"slurp",
+	"headlesschrome",
+	"curl/",
+	"wget/",
+	"python-requests",
+	"go-http-client",
+}
+
+// Other agents calling themselves a bot, as a word of its own.
+var botWord = regexp.MustCompile(`\bbot\b`)
+
+type FilterPolicy struct {
+	ExcludeBots     bool
+	ExcludePreviews bool
+	ExcludeHead     bool
+	RepeatWindow    time.Duration // Zero disables repeat-click filtering
+}
+
+func DefaultFilterPolicy() FilterPolicy {
+	return FilterPolicy{
+		ExcludeBots:     true,
+		ExcludePreviews: true,
+		ExcludeHead:     true,
+		RepeatWindow:    30 * time.Second,
+	}
+}
+
+// Classify returns the reason the event should be filtered, or "" for a
+// regular click. Repeat clicks need shared state and are handled in RecordEvent.
+// It prefers RawUserAgent, so bots sending DNT or Sec-GPC are still caught.
+func (p FilterPolicy) Classify(event *model.AnalyticsEvent) string {
+	if p.ExcludeHead && event.Method == http.MethodHead {
+		return FilterReasonHead
+	}
+
+	userAgent := event.RawUserAgent
+	if userAgent == "" {
+		userAgent = event.UserAgent
+	}
+	userAgent = strings.ToLower(userAgent)
+
+	if p.ExcludePreviews && containsAny(userAgent, previewAgents) {
+		return FilterReasonPreview
+	}
+
+	if p.ExcludeBots && (event.DeviceType == "Bot" || containsAny(userAgent, botAgents) || botWord.MatchString(userAgent)) {
+		return FilterReasonBot
+	}
+
+	return ""
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
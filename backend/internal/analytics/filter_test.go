@@ -0,0 +1,196 @@
+//go:build unit
+
+package analytics
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/cache"
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+func TestFilterPolicy_Classify(t *testing.T) {
+	policy := DefaultFilterPolicy()
+
+	tests := []struct {
+		name  string
+		event model.AnalyticsEvent
+		want  string
+	}{
+		{
+			name:  "Regular browser click",
+			event: model.AnalyticsEvent{Method: http.MethodGet, DeviceType: "Desktop", UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0.0.0"},
+			want:  "",
+		},
+		{
+			name:  "HEAD request",
+			event: model.AnalyticsEvent{Method: http.MethodHead, DeviceType: "Desktop", UserAgent: "Mozilla/5.0"},
+			want:  FilterReasonHead,
+		},
+		{
+			name:  "Parser flagged bot",
+			event: model.AnalyticsEvent{Method: http.MethodGet, DeviceType: "Bot", UserAgent: "Mozilla/5.0 (compatible; Googlebot/2.1)"},
+			want:  FilterReasonBot,
+		},
+		{
+			name:  "HTTP client",
+			event: model.AnalyticsEvent{Method: http.MethodGet, DeviceType: "Unknown", UserAgent: "curl/8.4.0"},
+			want:  FilterReasonBot,
+		},
+		{
+			name:  "Slack unfurl",
+			event: model.AnalyticsEvent{Method: http.MethodGet, DeviceType: "Bot", UserAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"},
+			want:  FilterReasonPreview,
+		},
+		{
+			name:  "Facebook preview",
+			event: model.AnalyticsEvent{Method: http.MethodGet, DeviceType: "Unknown", UserAgent: "facebookexternalhit/1.1"},
+			want:  FilterReasonPreview,
+		},
+		{
+			name:  "Named crawler",
+			event: model.AnalyticsEvent{Method: http.MethodGet, DeviceType: "Unknown", UserAgent: "Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)"},
+			want:  FilterReasonBot,
+		},
+		{
+			name:  "Generic bot",
+			event: model.AnalyticsEvent{Method: http.MethodGet, DeviceType: "Unknown", UserAgent: "uptime-bot/1.2"},
+			want:  FilterReasonBot,
+		},
+		{
+			name:  "CUBOT phone",
+			event: model.AnalyticsEvent{Method: http.MethodGet, DeviceType: "Mobile", UserAgent: "Mozilla/5.0 (Linux; Android 11; CUBOT NOTE 20) AppleWebKit/537.36 Chrome/96.0.4664.104 Mobile Safari/537.36"},
+			want:  "",
+		},
+		{
+			name:  "Opted-out HTTP client",
+			event: model.AnalyticsEvent{Method: http.MethodGet, DeviceType: "Unknown", RawUserAgent: "python-requests/2.31"},
+			want:  FilterReasonBot,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Classify(&tt.event); got != tt.want {
+				t.Errorf("Classify = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterPolicy_Disabled(t *testing.T) {
+	policy := FilterPolicy{}
+
+	event := model.AnalyticsEvent{Method: http.MethodHead, DeviceType: "Bot", UserAgent: "Googlebot"}
+	if got := policy.Classify(&event); got != "" {
+		t.Errorf("Classify = %q, want empty with all filters disabled", got)
+	}
+}
+
+func TestRecordEvent_FlagsRepeatClicks(t *testing.T) {
+	var saved []model.AnalyticsEvent
+	var sketched []string
+	seen := make(map[string]bool)
+
+	store := &storage.MockStore{
+		SaveAnalyticsEventFn: func(ctx context.Context, event *model.AnalyticsEvent) error {
+			saved = append(saved, *event)
+			return nil
+		},
+	}
+	visitors := &cache.MockVisitorCounter{
+		IsRepeatClickFn: func(ctx context.Context, linkID uint64, visitorHash string, window time.Duration) (bool, error) {
+			repeat := seen[visitorHash]
+			seen[visitorHash] = true
+			return repeat, nil
+		},
+		AddVisitorFn: func(ctx context.Context, linkID uint64, day time.Time, visitorHash string) error {
+			sketched = append(sketched, visitorHash)
+			return nil
+		},
+	}
+
+	svc := NewAnalyticsService(store, visitors)
+
+	for i := 0; i < 2; i++ {
+		event := &model.AnalyticsEvent{LinkID: 1, Method: http.MethodGet, DeviceType: "Desktop", UserAgent: "Mozilla/5.0", VisitorHash: "visitor-a", ClickedAt: time.Now()}
+		if err := svc.RecordEvent(context.Background(), event); err != nil {
+			t.Fatalf("RecordEvent failed: %v", err)
+		}
+	}
+
+	if len(saved) != 2 {
+		t.Fatalf("Saved %d events, want 2 (filtered events are kept)", len(saved))
+	}
+	if saved[0].Filtered {
+		t.Error("First click should not be filtered")
+	}
+	if !saved[1].Filtered || saved[1].FilterReason != FilterReasonRepeat {
+		t.Errorf("Second click = %v/%q, want filtered as %q", saved[1].Filtered, saved[1].FilterReason, FilterReasonRepeat)
+	}
+	if len(sketched) != 1 {
+		t.Errorf("Added %d visitors to sketch, want 1", len(sketched))
+	}
+}
+
+func TestRecordEvent_BotSkipsRepeatCheck(t *testing.T) {
+	repeatChecked := false
+
+	store := &storage.MockStore{
+		SaveAnalyticsEventFn: func(ctx context.Context, event *model.AnalyticsEvent) error { return nil },
+	}
+	visitors := &cache.MockVisitorCounter{
+		IsRepeatClickFn: func(ctx context.Context, linkID uint64, visitorHash string, window time.Duration) (bool, error) {
+			repeatChecked = true
+			return false, nil
+		},
+	}
+
+	svc := NewAnalyticsService(store, visitors)
+
+	event := &model.AnalyticsEvent{LinkID: 1, Method: http.MethodGet, DeviceType: "Bot", UserAgent: "Googlebot/2.1", VisitorHash: "crawler"}
+	if err := svc.RecordEvent(context.Background(), event); err != nil {
+		t.Fatalf("RecordEvent failed: %v", err)
+	}
+
+	if !event.Filtered || event.FilterReason != FilterReasonBot {
+		t.Errorf("Event = %v/%q, want filtered as %q", event.Filtered, event.FilterReason, FilterReasonBot)
+	}
+	if repeatChecked {
+		t.Error("Bot traffic should not claim a repeat-click slot")
+	}
+}
+
+func TestRetrieveAnalytics_IncludeFiltered(t *testing.T) {
+	store := &storage.MockStore{
+		GetAnalyticsEventsFn: func(ctx context.Context, linkID uint64, period time.Time) ([]*model.AnalyticsEvent, error) {
+			return []*model.AnalyticsEvent{
+				{IPAddress: "1.1.1.0", DeviceType: "Desktop"},
+				{IPAddress: "2.2.2.0", DeviceType: "Mobile"},
+				{IPAddress: "3.3.3.0", DeviceType: "Bot", Filtered: true, FilterReason: FilterReasonBot},
+			}, nil
+		},
+	}
+
+	svc := NewAnalyticsService(store, nil)
+
+	summary, err := svc.RetrieveAnalytics(context.Background(), 1, model.AnalyticsQuery{Period: "7d"})
+	if err != nil {
+		t.Fatalf("RetrieveAnalytics failed: %v", err)
+	}
+	if summary.TotalClicks != 2 || summary.FilteredClicks != 1 || summary.UniqueVisitors != 2 {
+		t.Errorf("Excluded: clicks=%d filtered=%d visitors=%d, want 2/1/2", summary.TotalClicks, summary.FilteredClicks, summary.UniqueVisitors)
+	}
+
+	summary, err = svc.RetrieveAnalytics(context.Background(), 1, model.AnalyticsQuery{Period: "7d", IncludeFiltered: true})
+	if err != nil {
+		t.Fatalf("RetrieveAnalytics failed: %v", err)
+	}
+	if summary.TotalClicks != 3 || summary.UniqueVisitors != 3 {
+		t.Errorf("Included: clicks=%d visitors=%d, want 3/3", summary.TotalClicks, summary.UniqueVisitors)
+	}
+}
@@ -0,0 +1,89 @@
+//go:build unit
+
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+func TestRetrieveAnalytics_HeatmapInTimeZone(t *testing.T) {
+	// Wednesday 2026-02-04 02:30 UTC is Tuesday 21:30 in New York
+	clickedAt := time.Date(2026, 2, 4, 2, 30, 0, 0, time.UTC)
+
+	store := &storage.MockStore{
+		GetAnalyticsEventsFn: func(ctx context.Context, linkID uint64, period time.Time) ([]*model.AnalyticsEvent, error) {
+			return []*model.AnalyticsEvent{
+				{IPAddress: "1.1.1.0", ClickedAt: clickedAt},
+				{IPAddress: "2.2.2.0", ClickedAt: clickedAt.Add(10 * time.Minute)},
+				{IPAddress: "3.3.3.0", ClickedAt: clickedAt, Filtered: true, FilterReason: FilterReasonBot},
+			}, nil
+		},
+	}
+
+	svc := NewAnalyticsService(store, nil)
+
+	summary, err := svc.RetrieveAnalytics(context.Background(), 1, model.AnalyticsQuery{Period: "7d"})
+	if err != nil {
+		t.Fatalf("RetrieveAnalytics failed: %v", err)
+	}
+	if summary.TimeZone != "UTC" || summary.Heatmap[time.Wednesday][2] != 2 {
+		t.Errorf("UTC heatmap[Wed][2] = %d in %s, want 2 in UTC", summary.Heatmap[time.Wednesday][2], summary.TimeZone)
+	}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+
+	summary, err = svc.RetrieveAnalytics(context.Background(), 1, model.AnalyticsQuery{Period: "7d", Location: newYork})
+	if err != nil {
+		t.Fatalf("RetrieveAnalytics failed: %v", err)
+	}
+	if summary.TimeZone != "America/New_York" {
+		t.Errorf("TimeZone = %s, want America/New_York", summary.TimeZone)
+	}
+	if summary.Heatmap[time.Tuesday][21] != 2 {
+		t.Errorf("New York heatmap[Tue][21] = %d, want 2", summary.Heatmap[time.Tuesday][21])
+	}
+
+	total := 0
+	for _, day := range summary.Heatmap {
+		for _, clicks := range day {
+			total += clicks
+		}
+	}
+	if total != summary.TotalClicks {
+		t.Errorf("Heatmap holds %d clicks, want %d", total, summary.TotalClicks)
+	}
+}
+
+func TestRetrieveAnalytics_OptedOutClicksNotUnique(t *testing.T) {
+	clickedAt := time.Now().Add(-time.Hour)
+
+	store := &storage.MockStore{
+		GetAnalyticsEventsFn: func(ctx context.Context, linkID uint64, period time.Time) ([]*model.AnalyticsEvent, error) {
+			return []*model.AnalyticsEvent{
+				{VisitorHash: "visitor-a", ClickedAt: clickedAt},
+				{ClickedAt: clickedAt},
+				{ClickedAt: clickedAt},
+			}, nil
+		},
+	}
+
+	svc := NewAnalyticsService(store, nil)
+
+	summary, err := svc.RetrieveAnalytics(context.Background(), 1, model.AnalyticsQuery{Period: "7d"})
+	if err != nil {
+		t.Fatalf("RetrieveAnalytics failed: %v", err)
+	}
+
+	// Opted-out clicks count, but can't be told apart from each other
+	if summary.TotalClicks != 3 || summary.UniqueVisitors != 1 {
+		t.Errorf("TotalClicks/UniqueVisitors = %d/%d, want 3/1", summary.TotalClicks, summary.UniqueVisitors)
+	}
+}
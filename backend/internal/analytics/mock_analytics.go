@@ -8,7 +8,12 @@ import (
 
 type MockAnalytics struct {
 	RecordEventFn       func(ctx context.Context, event *model.AnalyticsEvent) error
-	RetrieveAnalyticsFn func(ctx context.Context, linkID uint64, period string) (*model.AnalyticsSummary, error)
+	RetrieveAnalyticsFn func(ctx context.Context, linkID uint64, query model.AnalyticsQuery) (*model.AnalyticsSummary, error)
+	ExportEventsFn      func(ctx context.Context, filter model.AnalyticsExportFilter, fn func(event *model.AnalyticsEvent) error) error
+
+	RetrieveAccountAnalyticsFn func(ctx context.Context, userID uint64, query model.AnalyticsQuery) (*model.AccountAnalytics, error)
+	SetRetentionFn             func(ctx context.Context, userID uint64, days *int) error
+	RecordConversionFn         func(ctx context.Context, linkID uint64, clickID string) error
 }
 
 // Ensure MockAnalytics implements AnalyticsProvider interface
@@ -21,9 +26,37 @@ func (m *MockAnalytics) RecordEvent(ctx context.Context, event *model.AnalyticsE
 	return nil // Default: no-op
 }
 
-func (m *MockAnalytics) RetrieveAnalytics(ctx context.Context, linkID uint64, period string) (*model.AnalyticsSummary, error) {
+func (m *MockAnalytics) RetrieveAnalytics(ctx context.Context, linkID uint64, query model.AnalyticsQuery) (*model.AnalyticsSummary, error) {
 	if m.RetrieveAnalyticsFn != nil {
-		return m.RetrieveAnalyticsFn(ctx, linkID, period)
+		return m.RetrieveAnalyticsFn(ctx, linkID, query)
+	}
+	return nil, nil // Default: no-op
+}
+
+func (m *MockAnalytics) ExportEvents(ctx context.Context, filter model.AnalyticsExportFilter, fn func(event *model.AnalyticsEvent) error) error {
+	if m.ExportEventsFn != nil {
+		return m.ExportEventsFn(ctx, filter, fn)
+	}
+	return nil // Default: no events
+}
+
+func (m *MockAnalytics) RetrieveAccountAnalytics(ctx context.Context, userID uint64, query model.AnalyticsQuery) (*model.AccountAnalytics, error) {
+	if m.RetrieveAccountAnalyticsFn != nil {
+		return m.RetrieveAccountAnalyticsFn(ctx, userID, query)
 	}
 	return nil, nil // Default: no-op
 }
+
+func (m *MockAnalytics) SetRetention(ctx context.Context, userID uint64, days *int) error {
+	if m.SetRetentionFn != nil {
+		return m.SetRetentionFn(ctx, userID, days)
+	}
+	return nil // Default: no-op
+}
+
+func (m *MockAnalytics) RecordConversion(ctx context.Context, linkID uint64, clickID string) error {
+	if m.RecordConversionFn != nil {
+		return m.RecordConversionFn(ctx, linkID, clickID)
+	}
+	return nil // Default: no-op
+}
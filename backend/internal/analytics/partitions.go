@@ -0,0 +1,51 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+const defaultPartitionMonthsAhead = 3
+
+// Partitioner keeps monthly analytics partitions created ahead of time, so
+// inserts never hit a month without one. Old partitions are dropped by the
+// Purger.
+type Partitioner struct {
+	Store       storage.AnalyticsStore
+	MonthsAhead int
+}
+
+func NewPartitioner(store storage.AnalyticsStore) *Partitioner {
+	return &Partitioner{Store: store, MonthsAhead: defaultPartitionMonthsAhead}
+}
+
+func (p *Partitioner) Maintain(ctx context.Context) error {
+	created, err := p.Store.EnsureAnalyticsPartitions(ctx, time.Now().UTC().AddDate(0, p.MonthsAhead, 0))
+	for _, name := range created {
+		log.Printf("partitions: created %s", name)
+	}
+	return err
+}
+
+// Run maintains partitions once at startup and then every interval until
+// ctx is done. Creation uses IF NOT EXISTS; a replica that loses a race
+// logs the error and is caught up on its next run.
+func (p *Partitioner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Maintain(ctx); err != nil {
+			log.Printf("partitions: maintenance failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+//go:build unit
+
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+func TestPartitioner_MaintainsAhead(t *testing.T) {
+	var through time.Time
+	store := &storage.MockStore{
+		EnsureAnalyticsPartitionsFn: func(ctx context.Context, t time.Time) ([]string, error) {
+			through = t
+			return []string{"analytics_y2026m06"}, nil
+		},
+	}
+
+	if err := NewPartitioner(store).Maintain(context.Background()); err != nil {
+		t.Fatalf("Maintain failed: %v", err)
+	}
+
+	want := time.Now().UTC().AddDate(0, defaultPartitionMonthsAhead, 0)
+	if through.Sub(want).Abs() > time.Minute {
+		t.Errorf("Ensured through %v, want about %v", through, want)
+	}
+}
+
+func TestPartitioner_ReturnsError(t *testing.T) {
+	store := &storage.MockStore{
+		EnsureAnalyticsPartitionsFn: func(ctx context.Context, t time.Time) ([]string, error) {
+			return nil, errors.New("permission denied")
+		},
+	}
+
+	if err := NewPartitioner(store).Maintain(context.Background()); err == nil {
+		t.Error("Expected error")
+	}
+}
@@ -0,0 +1,138 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+var (
+	ErrInvalidRetention  = errors.New("invalid retention")
+	ErrRetentionDisabled = errors.New("raw events are kept forever on this deployment, so retention can't be shortened")
+)
+
+const (
+	DefaultRetentionDays = 90
+
+	purgeBatchSize  = 5000
+	purgeBatchPause = 100 * time.Millisecond
+)
+
+// Purger deletes raw events past their retention. Rollups are kept, so
+// account dashboards keep working for older periods.
+type Purger struct {
+	Store       storage.AnalyticsStore
+	DefaultDays int
+	BatchSize   int
+	BatchPause  time.Duration // Gives other queries room between batches
+}
+
+func NewPurger(store storage.AnalyticsStore, defaultDays int) *Purger {
+	return &Purger{
+		Store:       store,
+		DefaultDays: defaultDays,
+		BatchSize:   purgeBatchSize,
+		BatchPause:  purgeBatchPause,
+	}
+}
+
+// PurgeOnce first drops whole partitions past the deployment default, which
+// no account keeps longer, then deletes the remaining expired events of
+// accounts with shorter retention in batches. It returns how many
+// events were deleted in batches; dropped partitions are only logged.
+func (p *Purger) PurgeOnce(ctx context.Context) (int64, error) {
+	if err := p.dropExpiredPartitions(ctx); err != nil {
+		// Batched deletes still enforce retention, just more slowly
+		log.Printf("retention: failed to drop expired partitions: %v", err)
+	}
+
+	start := time.Now()
+	var total int64
+	batches := 0
+
+	for {
+		deleted, err := p.Store.PurgeAnalyticsEvents(ctx, p.DefaultDays, p.BatchSize)
+		if err != nil {
+			log.Printf("retention: purge failed after %d events in %d batches: %v", total, batches, err)
+			return total, err
+		}
+
+		total += deleted
+		batches++
+
+		if deleted < int64(p.BatchSize) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("retention: purge interrupted after %d events in %d batches", total, batches)
+			return total, ctx.Err()
+		case <-time.After(p.BatchPause):
+		}
+	}
+
+	log.Printf("retention: purged %d analytics events in %d batches (%s, default retention %d days)",
+		total, batches, time.Since(start).Round(time.Millisecond), p.DefaultDays)
+
+	return total, nil
+}
+
+func (p *Purger) dropExpiredPartitions(ctx context.Context) error {
+	partitions, err := p.Store.ListAnalyticsPartitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -p.DefaultDays)
+	for _, partition := range partitions {
+		if partition.To.IsZero() || partition.To.After(cutoff) {
+			continue
+		}
+
+		if err := p.Store.DropAnalyticsPartition(ctx, partition.Name); err != nil {
+			return err
+		}
+		log.Printf("retention: dropped partition %s (events before %s)", partition.Name, partition.To.Format(time.DateOnly))
+	}
+
+	return nil
+}
+
+// Run purges once at startup and then every interval until ctx is done.
+// Replicas running it concurrently only contend on the same rows.
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, _ = p.PurgeOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetRetention overrides how long the user's raw events are kept. A nil
+// days reverts to the deployment default. Accounts can only shorten
+// retention: a longer one would keep every partition from being dropped.
+// Deployments that keep events forever run no purge to enforce an override,
+// so none can be set.
+func (as *AnalyticsService) SetRetention(ctx context.Context, userID uint64, days *int) error {
+	if days != nil && as.RetentionDays == 0 {
+		return ErrRetentionDisabled
+	}
+
+	if days != nil && (*days < 1 || *days > as.RetentionDays) {
+		return fmt.Errorf("%w: must be between 1 and %d days", ErrInvalidRetention, as.RetentionDays)
+	}
+
+	return as.Store.SetAnalyticsRetention(ctx, userID, days)
+}
@@ -0,0 +1,192 @@
+//go:build unit
+
+package analytics
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+// withoutPartitions stubs the partition lookups so only batched deletes run.
+func withoutPartitions(store *storage.MockStore) *storage.MockStore {
+	store.ListAnalyticsPartitionsFn = func(ctx context.Context) ([]model.AnalyticsPartition, error) {
+		return nil, nil
+	}
+	return store
+}
+
+func TestPurger_DeletesInBatches(t *testing.T) {
+	remaining := int64(12)
+	calls := 0
+
+	store := &storage.MockStore{
+		PurgeAnalyticsEventsFn: func(ctx context.Context, defaultDays int, batchSize int) (int64, error) {
+			calls++
+			if defaultDays != 30 {
+				t.Errorf("defaultDays = %d, want 30", defaultDays)
+			}
+			deleted := min(remaining, int64(batchSize))
+			remaining -= deleted
+			return deleted, nil
+		},
+	}
+
+	purger := NewPurger(withoutPartitions(store), 30)
+	purger.BatchSize = 5
+	purger.BatchPause = 0
+
+	total, err := purger.PurgeOnce(context.Background())
+	if err != nil {
+		t.Fatalf("PurgeOnce failed: %v", err)
+	}
+	if total != 12 {
+		t.Errorf("Purged %d events, want 12", total)
+	}
+	// 5 + 5 + 2, the short batch ends the run
+	if calls != 3 {
+		t.Errorf("Store called %d times, want 3", calls)
+	}
+}
+
+func TestPurger_StopsOnError(t *testing.T) {
+	calls := 0
+	store := &storage.MockStore{
+		PurgeAnalyticsEventsFn: func(ctx context.Context, defaultDays int, batchSize int) (int64, error) {
+			calls++
+			if calls == 2 {
+				return 0, errors.New("lock timeout")
+			}
+			return int64(batchSize), nil
+		},
+	}
+
+	purger := NewPurger(withoutPartitions(store), 90)
+	purger.BatchPause = 0
+
+	total, err := purger.PurgeOnce(context.Background())
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+	if total != int64(purger.BatchSize) {
+		t.Errorf("Purged %d events before failing, want %d", total, purger.BatchSize)
+	}
+}
+
+func TestPurger_StopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	store := &storage.MockStore{
+		PurgeAnalyticsEventsFn: func(ctx context.Context, defaultDays int, batchSize int) (int64, error) {
+			cancel()
+			return int64(batchSize), nil
+		},
+	}
+
+	_, err := NewPurger(withoutPartitions(store), 90).PurgeOnce(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestPurger_DropsExpiredPartitions(t *testing.T) {
+	month := func(monthsAgo int) time.Time {
+		now := time.Now().UTC()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -monthsAgo, 0)
+	}
+
+	var dropped []string
+	store := &storage.MockStore{
+		ListAnalyticsPartitionsFn: func(ctx context.Context) ([]model.AnalyticsPartition, error) {
+			return []model.AnalyticsPartition{
+				{Name: "analytics_legacy", To: month(8)},
+				{Name: "analytics_old", From: month(8), To: month(7)},
+				{Name: "analytics_past_default", From: month(5), To: month(4)},
+				{Name: "analytics_recent", From: month(2), To: month(1)},
+				{Name: "analytics_current", From: month(0), To: month(-1)},
+			}, nil
+		},
+		DropAnalyticsPartitionFn: func(ctx context.Context, name string) error {
+			dropped = append(dropped, name)
+			return nil
+		},
+		PurgeAnalyticsEventsFn: func(ctx context.Context, defaultDays int, batchSize int) (int64, error) {
+			return 0, nil
+		},
+	}
+
+	purger := NewPurger(store, 90)
+	if _, err := purger.PurgeOnce(context.Background()); err != nil {
+		t.Fatalf("PurgeOnce failed: %v", err)
+	}
+
+	// Only partitions entirely older than the default retention go
+	want := []string{"analytics_legacy", "analytics_old", "analytics_past_default"}
+	if !slices.Equal(dropped, want) {
+		t.Errorf("Dropped %v, want %v", dropped, want)
+	}
+}
+
+func TestPurger_BatchesWhenPartitionDropFails(t *testing.T) {
+	purged := false
+	store := &storage.MockStore{
+		ListAnalyticsPartitionsFn: func(ctx context.Context) ([]model.AnalyticsPartition, error) {
+			return nil, errors.New("connection reset")
+		},
+		PurgeAnalyticsEventsFn: func(ctx context.Context, defaultDays int, batchSize int) (int64, error) {
+			purged = true
+			return 0, nil
+		},
+	}
+
+	if _, err := NewPurger(store, 90).PurgeOnce(context.Background()); err != nil {
+		t.Fatalf("PurgeOnce failed: %v", err)
+	}
+	if !purged {
+		t.Error("Batched purge should still run")
+	}
+}
+
+func TestSetRetention_Validates(t *testing.T) {
+	var saved *int
+	store := &storage.MockStore{
+		SetAnalyticsRetentionFn: func(ctx context.Context, userID uint64, days *int) error {
+			saved = days
+			return nil
+		},
+	}
+	svc := NewAnalyticsService(store, nil)
+	svc.RetentionDays = 90
+
+	// Longer than the deployment default isn't allowed
+	for _, days := range []int{0, -1, 91} {
+		if err := svc.SetRetention(context.Background(), 1, &days); !errors.Is(err, ErrInvalidRetention) {
+			t.Errorf("SetRetention(%d) err = %v, want ErrInvalidRetention", days, err)
+		}
+	}
+
+	days := 30
+	if err := svc.SetRetention(context.Background(), 1, &days); err != nil || saved == nil || *saved != 30 {
+		t.Errorf("SetRetention(30) = %v, saved %v", err, saved)
+	}
+
+	// nil reverts to the default
+	if err := svc.SetRetention(context.Background(), 1, nil); err != nil || saved != nil {
+		t.Errorf("SetRetention(nil) = %v, saved %v", err, saved)
+	}
+
+	// Nothing would enforce an override on deployments keeping events forever
+	svc.RetentionDays = 0
+	days = 30
+	if err := svc.SetRetention(context.Background(), 1, &days); !errors.Is(err, ErrRetentionDisabled) {
+		t.Errorf("SetRetention(30) without purging err = %v, want ErrRetentionDisabled", err)
+	}
+	if err := svc.SetRetention(context.Background(), 1, nil); err != nil {
+		t.Errorf("SetRetention(nil) without purging = %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// VisitorHasher derives a pseudonymous visitor ID from the raw IP and
+// User-Agent. The salt is derived from the secret and the UTC date, so it
+// rotates daily: the same visitor can't be linked across days and the hash
+// can't be reversed by brute forcing the IPv4 space without the secret. The
+// flip side is that unique visitor counts over several days add up each day's
+// visitors (see model.VisitorScopeDaily).
+type VisitorHasher struct {
+	Secret []byte
+}
+
+func NewVisitorHasher(secret string) *VisitorHasher {
+	return &VisitorHasher{Secret: []byte(secret)}
+}
+
+func (h *VisitorHasher) Hash(ip string, userAgent string, at time.Time) string {
+	mac := hmac.New(sha256.New, h.dailySalt(at))
+	mac.Write([]byte(ip))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userAgent))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h *VisitorHasher) dailySalt(at time.Time) []byte {
+	mac := hmac.New(sha256.New, h.Secret)
+	mac.Write([]byte(at.UTC().Format("2006-01-02")))
+	return mac.Sum(nil)
+}
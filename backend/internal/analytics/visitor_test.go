@@ -0,0 +1,64 @@
+//go:build unit
+
+package analytics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVisitorHasher_StableWithinDay(t *testing.T) {
+	hasher := NewVisitorHasher("test-secret")
+	morning := time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)
+	evening := time.Date(2026, 2, 1, 22, 0, 0, 0, time.UTC)
+
+	first := hasher.Hash("203.0.113.50", "Mozilla/5.0", morning)
+	second := hasher.Hash("203.0.113.50", "Mozilla/5.0", evening)
+
+	if first != second {
+		t.Error("Expected same hash for same visitor on the same day")
+	}
+	if len(first) != 64 {
+		t.Errorf("Hash length = %d, want 64", len(first))
+	}
+}
+
+func TestVisitorHasher_RotatesDaily(t *testing.T) {
+	hasher := NewVisitorHasher("test-secret")
+	day := time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	today := hasher.Hash("203.0.113.50", "Mozilla/5.0", day)
+	tomorrow := hasher.Hash("203.0.113.50", "Mozilla/5.0", day.Add(24*time.Hour))
+
+	if today == tomorrow {
+		t.Error("Expected hash to change when the day rotates")
+	}
+}
+
+// Visitors behind the same NAT'd /24 must not collapse into one, which is
+// what happened when counting anonymized IPs.
+func TestVisitorHasher_DistinguishesVisitors(t *testing.T) {
+	hasher := NewVisitorHasher("test-secret")
+	now := time.Now()
+
+	hashes := map[string]struct{}{
+		hasher.Hash("203.0.113.50", "Mozilla/5.0", now): {},
+		hasher.Hash("203.0.113.51", "Mozilla/5.0", now): {},
+		hasher.Hash("203.0.113.50", "curl/8.0", now):    {},
+	}
+
+	if len(hashes) != 3 {
+		t.Errorf("Got %d distinct hashes, want 3", len(hashes))
+	}
+}
+
+func TestVisitorHasher_DependsOnSecret(t *testing.T) {
+	now := time.Now()
+
+	a := NewVisitorHasher("secret-a").Hash("203.0.113.50", "Mozilla/5.0", now)
+	b := NewVisitorHasher("secret-b").Hash("203.0.113.50", "Mozilla/5.0", now)
+
+	if a == b {
+		t.Error("Expected different hashes for different secrets")
+	}
+}
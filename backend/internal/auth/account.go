@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	netmail "net/mail"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/mail"
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+	ErrEmailUnchanged    = errors.New("new email is the same as the current one")
+	ErrInvalidLinkPolicy = errors.New("link policy must be delete or anonymize")
+)
+
+// What happens to a deleted account's links
+const (
+	LinkPolicyDelete    = "delete"
+	LinkPolicyAnonymize = "anonymize"
+)
+
+// checkPassword loads the user and confirms they know their password, for
+// changes that a stolen access token alone shouldn't allow.
+func (as *AuthService) checkPassword(ctx context.Context, userID uint64, password string) (*model.User, error) {
+	user, err := as.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrIncorrectPassword
+	}
+
+	return user, nil
+}
+
+// ChangePassword replaces the user's password and logs out every other
+// session. The session currentRefreshToken belongs to, if any, stays logged
+// in.
+func (as *AuthService) ChangePassword(ctx context.Context, userID uint64, currentPassword string, newPassword string, currentRefreshToken string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	if _, err := as.checkPassword(ctx, userID, currentPassword); err != nil {
+		return err
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	keep, err := as.sessionID(ctx, userID, currentRefreshToken)
+	if err != nil {
+		return err
+	}
+
+	return as.Store.UpdatePassword(ctx, userID, string(passwordHash), keep)
+}
+
+// ChangeEmail moves the account to a new address, which has to be verified
+// again. The old address is told about the change in case it wasn't the
+// owner who made it. Access tokens keep the old email until refreshed.
+func (as *AuthService) ChangeEmail(ctx context.Context, userID uint64, currentPassword string, newEmail string) error {
+	if _, err := netmail.ParseAddress(newEmail); err != nil {
+		return ErrInvalidEmail
+	}
+
+	user, err := as.checkPassword(ctx, userID, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	if newEmail == user.Email {
+		return ErrEmailUnchanged
+	}
+
+	if err := as.Store.UpdateUserEmail(ctx, userID, newEmail); err != nil {
+		if errors.Is(err, storage.ErrUniqueViolation) {
+			return ErrUserAlreadyExists
+		}
+		return err
+	}
+
+	if err := as.sendVerification(ctx, userID, newEmail, time.Time{}); err != nil {
+		log.Printf("auth: failed to send verification mail to user %d: %v", userID, err)
+	}
+
+	if err := as.mailer().Send(ctx, emailChangedMessage(user.Email, newEmail)); err != nil {
+		log.Printf("auth: failed to notify user %d of email change: %v", userID, err)
+	}
+
+	return nil
+}
+
+// GetUser returns the account, for the data export.
+func (as *AuthService) GetUser(ctx context.Context, userID uint64) (*model.User, error) {
+	user, err := as.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+// DeleteAccount removes the user and logs out all their sessions. Their links
+// are deleted with their analytics, or with LinkPolicyAnonymize kept live
+// without an owner and with visitor details stripped from their clicks. An
+// empty policy deletes.
+func (as *AuthService) DeleteAccount(ctx context.Context, userID uint64, currentPassword string, linkPolicy string) error {
+	if linkPolicy == "" {
+		linkPolicy = LinkPolicyDelete
+	}
+	if linkPolicy != LinkPolicyDelete && linkPolicy != LinkPolicyAnonymize {
+		return ErrInvalidLinkPolicy
+	}
+
+	if _, err := as.checkPassword(ctx, userID, currentPassword); err != nil {
+		return err
+	}
+
+	shortCodes, err := as.Store.DeleteUser(ctx, userID, linkPolicy == LinkPolicyAnonymize)
+	if err != nil {
+		return err
+	}
+
+	// Cached links carry the old owner, or would keep deleted links redirecting
+	if as.Cache != nil {
+		for _, shortCode := range shortCodes {
+			if err := as.Cache.Delete(ctx, shortCode); err != nil {
+				log.Printf("auth: failed to evict link %s of deleted user %d: %v", shortCode, userID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func emailChangedMessage(to string, newEmail string) mail.Message {
+	return mail.Message{
+		To:      to,
+		Subject: "Your Shrinks email address was changed",
+		Body: fmt.Sprintf(
+			"The email address on your Shrinks account was changed to %s.\n\n"+
+				"If you didn't make this change, reset your password from the sign in page and contact support.\n",
+			newEmail,
+		),
+	}
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+var (
+	ErrInvalidAPIKey     = errors.New("invalid API key")
+	ErrAPIKeyNotFound    = errors.New("API key not found")
+	ErrInvalidAPIKeyName = errors.New("API key name must be 1 to 100 characters")
+	ErrInvalidScope      = errors.New("unknown or missing API key scope")
+	ErrTooManyAPIKeys    = errors.New("too many API keys")
+)
+
+// What an API key may be used for. Endpoints without a scope only accept
+// access tokens, so a leaked key can't manage the account.
+const (
+	ScopeLinksRead     = "links:read"
+	ScopeLinksWrite    = "links:write"
+	ScopeAnalyticsRead = "analytics:read"
+)
+
+var apiKeyScopes = []string{ScopeLinksRead, ScopeLinksWrite, ScopeAnalyticsRead}
+
+const (
+	// APIKeyPrefix marks API keys, both for the middleware and for secret scanners.
+	APIKeyPrefix = "shk_"
+	// Characters of the key kept in the clear to tell keys apart in lists.
+	apiKeyDisplayLength = len(APIKeyPrefix) + 8
+	maxAPIKeyName       = 100
+	maxAPIKeysPerUser   = 25
+)
+
+// CreateAPIKey issues a new key with the given scopes. The key is only
+// returned here; afterwards just its hash and prefix are known.
+func (as *AuthService) CreateAPIKey(ctx context.Context, userID uint64, name string, scopes []string) (model.CreateAPIKeyResponse, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxAPIKeyName {
+		return model.CreateAPIKeyResponse{}, ErrInvalidAPIKeyName
+	}
+
+	if len(scopes) == 0 {
+		return model.CreateAPIKeyResponse{}, ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			return model.CreateAPIKeyResponse{}, ErrInvalidScope
+		}
+	}
+	scopes = slices.Compact(slices.Sorted(slices.Values(scopes)))
+
+	secret, err := GenerateRefreshToken()
+	if err != nil {
+		return model.CreateAPIKeyResponse{}, err
+	}
+	key := APIKeyPrefix + secret
+
+	created, err := as.Store.CreateAPIKey(ctx, userID, name, key[:apiKeyDisplayLength], HashRefreshToken(key), scopes, maxAPIKeysPerUser)
+	if err != nil {
+		return model.CreateAPIKeyResponse{}, err
+	}
+
+	if created == nil {
+		return model.CreateAPIKeyResponse{}, ErrTooManyAPIKeys
+	}
+
+	return model.CreateAPIKeyResponse{APIKey: *created, Key: key}, nil
+}
+
+func (as *AuthService) ListAPIKeys(ctx context.Context, userID uint64) ([]model.APIKey, error) {
+	return as.Store.ListAPIKeys(ctx, userID)
+}
+
+// RevokeAPIKey deletes one of the user's keys; requests using it fail from
+// then on.
+func (as *AuthService) RevokeAPIKey(ctx context.Context, userID uint64, id uint64) error {
+	deleted, err := as.Store.DeleteAPIKey(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	if !deleted {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey returns the key a request presented and marks it used.
+func (as *AuthService) AuthenticateAPIKey(ctx context.Context, key string) (*model.APIKey, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := as.Store.UseAPIKey(ctx, HashRefreshToken(key))
+	if err != nil {
+		return nil, err
+	}
+
+	if apiKey == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	return apiKey, nil
+}
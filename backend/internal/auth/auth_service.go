@@ -3,10 +3,14 @@ package auth
 import (
 	"context"
 	"errors"
-	"net/mail"
+	"log"
+	netmail "net/mail"
 	"time"
 
+	"github.com/Unhyphenated/shrinks-backend/internal/cache"
+	"github.com/Unhyphenated/shrinks-backend/internal/mail"
 	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/oidc"
 	"github.com/Unhyphenated/shrinks-backend/internal/storage"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -17,21 +21,53 @@ var (
 	ErrPasswordTooLong      = errors.New("password exceeds 72 characters")
 	ErrInvalidCredentials   = errors.New("invalid email or password")
 	ErrUserAlreadyExists    = errors.New("user already exists")
+	ErrUserNotFound         = errors.New("user not found")
 	ErrInvalidRefreshToken  = errors.New("invalid refresh token")
 	ErrRefreshTokenExpired  = errors.New("refresh token has expired")
 	ErrRefreshTokenNotFound = errors.New("refresh token not found")
 	ErrDeletingRefreshToken = errors.New("failed to delete refresh token")
+	ErrRefreshTokenReused   = errors.New("refresh token was already used")
 )
 
+// Each rotation extends the session by this long from the time of use.
+const refreshTokenLifetime = 7 * 24 * time.Hour
+
 type AuthProvider interface {
 	Register(ctx context.Context, email string, password string) (model.RegisterResponse, error)
 	Login(ctx context.Context, email string, password string) (model.AuthResponse, error)
 	RefreshAccessToken(ctx context.Context, refreshToken string) (model.RefreshTokenResponse, error)
 	Logout(ctx context.Context, refreshToken string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, password string) error
+	ResendVerification(ctx context.Context, userID uint64) error
+	VerifyEmail(ctx context.Context, token string) error
+	EmailVerified(ctx context.Context, userID uint64) (bool, error)
+	ChangePassword(ctx context.Context, userID uint64, currentPassword string, newPassword string, currentRefreshToken string) error
+	ChangeEmail(ctx context.Context, userID uint64, currentPassword string, newEmail string) error
+	ListSessions(ctx context.Context, userID uint64, currentRefreshToken string) ([]model.Session, error)
+	RevokeSession(ctx context.Context, userID uint64, sessionID string) error
+	LogoutEverywhere(ctx context.Context, userID uint64) error
+	GetUser(ctx context.Context, userID uint64) (*model.User, error)
+	DeleteAccount(ctx context.Context, userID uint64, currentPassword string, linkPolicy string) error
+	CreateAPIKey(ctx context.Context, userID uint64, name string, scopes []string) (model.CreateAPIKeyResponse, error)
+	ListAPIKeys(ctx context.Context, userID uint64) ([]model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID uint64, id uint64) error
+	AuthenticateAPIKey(ctx context.Context, key string) (*model.APIKey, error)
+	OIDCProviders() []string
+	BeginOIDCLogin(ctx context.Context, provider string) (string, OIDCFlow, error)
+	CompleteOIDCLogin(ctx context.Context, flow OIDCFlow, state string, code string) (model.AuthResponse, error)
+	EnrollTwoFactor(ctx context.Context, userID uint64, currentPassword string) (model.EnrollTwoFactorResponse, error)
+	ActivateTwoFactor(ctx context.Context, userID uint64, code string) (model.ActivateTwoFactorResponse, error)
+	DisableTwoFactor(ctx context.Context, userID uint64, currentPassword string, code string) error
+	VerifyTwoFactorLogin(ctx context.Context, challengeToken string, code string) (model.AuthResponse, error)
 }
 
 type AuthService struct {
-	Store storage.AuthStore
+	Store  storage.AuthStore
+	Mailer mail.Mailer               // Sends account emails; only logged when nil
+	AppURL string                    // Frontend base URL that emailed links point to
+	Cache  cache.Cache               // Optional; deleted accounts' links are evicted from it
+	OIDC   map[string]*oidc.Provider // "Sign in with" providers by name
 }
 
 func NewAuthService(s storage.AuthStore) *AuthService {
@@ -39,15 +75,11 @@ func NewAuthService(s storage.AuthStore) *AuthService {
 }
 
 func (as *AuthService) Register(ctx context.Context, email string, password string) (model.RegisterResponse, error) {
-	if len(password) < 8 {
-		return model.RegisterResponse{}, ErrPasswordTooShort
-	}
-
-	if len(password) > 72 {
-		return model.RegisterResponse{}, ErrPasswordTooLong
+	if err := validatePassword(password); err != nil {
+		return model.RegisterResponse{}, err
 	}
 
-	_, err := mail.ParseAddress(email)
+	_, err := netmail.ParseAddress(email)
 	if err != nil {
 		return model.RegisterResponse{}, ErrInvalidEmail
 	}
@@ -67,13 +99,35 @@ func (as *AuthService) Register(ctx context.Context, email string, password stri
 		return model.RegisterResponse{}, err
 	}
 
+	// The account works without it; the user can ask for another link
+	if err := as.sendVerification(ctx, userID, email, time.Time{}); err != nil {
+		log.Printf("auth: failed to send verification mail to user %d: %v", userID, err)
+	}
+
 	return model.RegisterResponse{
 		UserID: userID,
 	}, nil
 }
 
+// bcrypt only looks at the first 72 bytes, so longer passwords are refused
+// rather than silently truncated.
+func validatePassword(password string) error {
+	if len(password) < 8 {
+		return ErrPasswordTooShort
+	}
+
+	if len(password) > 72 {
+		return ErrPasswordTooLong
+	}
+
+	return nil
+}
+
+// Login checks the password and starts a session. Users with two-factor
+// authentication get a challenge in TwoFactor instead of tokens, to finish
+// with VerifyTwoFactorLogin.
 func (as *AuthService) Login(ctx context.Context, email string, password string) (model.AuthResponse, error) {
-	_, err := mail.ParseAddress(email)
+	_, err := netmail.ParseAddress(email)
 	if err != nil {
 		return model.AuthResponse{}, ErrInvalidEmail
 	}
@@ -88,7 +142,12 @@ func (as *AuthService) Login(ctx context.Context, email string, password string)
 		return model.AuthResponse{}, ErrInvalidCredentials
 	}
 
-	accessToken, err := GenerateToken(user.ID, email)
+	return as.startSession(ctx, user)
+}
+
+// issueTokens starts a new session for a user who has proven who they are.
+func (as *AuthService) issueTokens(ctx context.Context, user *model.User) (model.AuthResponse, error) {
+	accessToken, err := GenerateToken(user.ID, user.Email)
 	if err != nil {
 		return model.AuthResponse{}, err
 	}
@@ -100,9 +159,9 @@ func (as *AuthService) Login(ctx context.Context, email string, password string)
 
 	tokenHash := HashRefreshToken(refreshToken)
 
-	expiresAt := time.Now().Add(7 * 24 * time.Hour)
+	expiresAt := time.Now().Add(refreshTokenLifetime)
 
-	err = as.Store.CreateRefreshToken(ctx, user.ID, tokenHash, expiresAt)
+	err = as.Store.CreateRefreshToken(ctx, user.ID, tokenHash, expiresAt, GetSessionClientFromContext(ctx))
 	if err != nil {
 		return model.AuthResponse{}, err
 	}
@@ -114,6 +173,10 @@ func (as *AuthService) Login(ctx context.Context, email string, password string)
 	}, nil
 }
 
+// RefreshAccessToken exchanges a refresh token for a new access token and a
+// new refresh token; the presented one stops working. Presenting a token that
+// was already exchanged means it was copied, so every token descended from
+// the same login is revoked and the user has to log in again.
 func (as *AuthService) RefreshAccessToken(ctx context.Context, refreshToken string) (model.RefreshTokenResponse, error) {
 	tokenHash := HashRefreshToken(refreshToken)
 
@@ -126,6 +189,10 @@ func (as *AuthService) RefreshAccessToken(ctx context.Context, refreshToken stri
 		return model.RefreshTokenResponse{}, ErrInvalidRefreshToken
 	}
 
+	if storedToken.RotatedAt != nil {
+		return model.RefreshTokenResponse{}, as.revokeFamily(ctx, storedToken)
+	}
+
 	if time.Now().After(storedToken.ExpiresAt) {
 		return model.RefreshTokenResponse{}, ErrRefreshTokenExpired
 	}
@@ -139,16 +206,40 @@ func (as *AuthService) RefreshAccessToken(ctx context.Context, refreshToken stri
 		return model.RefreshTokenResponse{}, ErrInvalidRefreshToken
 	}
 
+	newRefreshToken, err := GenerateRefreshToken()
+	if err != nil {
+		return model.RefreshTokenResponse{}, err
+	}
+
+	err = as.Store.RotateRefreshToken(ctx, storedToken, HashRefreshToken(newRefreshToken), time.Now().Add(refreshTokenLifetime), GetSessionClientFromContext(ctx))
+	if err != nil {
+		// Lost a race with another request presenting the same token
+		if errors.Is(err, storage.ErrRefreshTokenRotated) {
+			return model.RefreshTokenResponse{}, as.revokeFamily(ctx, storedToken)
+		}
+		return model.RefreshTokenResponse{}, err
+	}
+
 	accessToken, err := GenerateToken(user.ID, user.Email)
 	if err != nil {
 		return model.RefreshTokenResponse{}, err
 	}
 
 	return model.RefreshTokenResponse{
-		AccessToken: accessToken,
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
 	}, nil
 }
 
+func (as *AuthService) revokeFamily(ctx context.Context, token *model.RefreshToken) error {
+	log.Printf("auth: refresh token reuse for user %d, revoking token family", token.UserID)
+
+	if err := as.Store.DeleteRefreshTokenFamily(ctx, token.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
 func (as *AuthService) Logout(ctx context.Context, refreshToken string) error {
 	tokenHash := HashRefreshToken(refreshToken)
 	token, err := as.Store.GetRefreshToken(ctx, tokenHash)
@@ -161,7 +252,8 @@ func (as *AuthService) Logout(ctx context.Context, refreshToken string) error {
 		return ErrRefreshTokenNotFound
 	}
 
-	if err := as.Store.DeleteRefreshToken(ctx, tokenHash); err != nil {
+	// Earlier tokens in the family are only kept to detect reuse
+	if err := as.Store.DeleteRefreshTokenFamily(ctx, token.FamilyID); err != nil {
 		return ErrDeletingRefreshToken
 	}
 
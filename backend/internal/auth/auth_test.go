@@ -4,12 +4,22 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Unhyphenated/shrinks-backend/internal/cache"
+	"github.com/Unhyphenated/shrinks-backend/internal/mail"
+	"github.com/Unhyphenated/shrinks-backend/internal/mail/mailtest"
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/oidc"
+	"github.com/Unhyphenated/shrinks-backend/internal/oidc/oidctest"
 	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+	"github.com/Unhyphenated/shrinks-backend/internal/totp"
 	"github.com/joho/godotenv"
 )
 
@@ -644,3 +654,988 @@ func TestAuthService_Logout_CannotReuseToken(t *testing.T) {
 		t.Errorf("Expected ErrInvalidRefreshToken, got %v", err)
 	}
 }
+
+func TestAuthService_RefreshAccessToken_RotatesToken(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	os.Setenv("JWT_SECRET", "test-secret-123")
+	defer os.Unsetenv("JWT_SECRET")
+
+	service := NewAuthService(testStore)
+	email := "refresh-rotate-test@example.com"
+	password := "password123"
+
+	cleanupUsers(t, email)
+	defer cleanupUsers(t, email)
+
+	if _, err := service.Register(context.Background(), email, password); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	loginResp, err := service.Login(context.Background(), email, password)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	first, err := service.RefreshAccessToken(context.Background(), loginResp.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshAccessToken failed: %v", err)
+	}
+	if first.RefreshToken == "" || first.RefreshToken == loginResp.RefreshToken {
+		t.Fatal("Expected a new refresh token")
+	}
+
+	// The new token keeps working and rotates again
+	second, err := service.RefreshAccessToken(context.Background(), first.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshAccessToken with rotated token failed: %v", err)
+	}
+
+	old, err := testStore.GetRefreshToken(context.Background(), HashRefreshToken(loginResp.RefreshToken))
+	if err != nil {
+		t.Fatalf("GetRefreshToken failed: %v", err)
+	}
+	current, err := testStore.GetRefreshToken(context.Background(), HashRefreshToken(second.RefreshToken))
+	if err != nil {
+		t.Fatalf("GetRefreshToken failed: %v", err)
+	}
+	if old == nil || current == nil || old.FamilyID != current.FamilyID {
+		t.Error("Rotated tokens should share the login's family")
+	}
+	if old.RotatedAt == nil || current.RotatedAt != nil {
+		t.Error("Only the current token should be unrotated")
+	}
+}
+
+func TestAuthService_RefreshAccessToken_ReuseRevokesFamily(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	os.Setenv("JWT_SECRET", "test-secret-123")
+	defer os.Unsetenv("JWT_SECRET")
+
+	service := NewAuthService(testStore)
+	email := "refresh-reuse-test@example.com"
+	password := "password123"
+
+	cleanupUsers(t, email)
+	defer cleanupUsers(t, email)
+
+	if _, err := service.Register(context.Background(), email, password); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	stolen, err := service.Login(context.Background(), email, password)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	otherDevice, err := service.Login(context.Background(), email, password)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	rotated, err := service.RefreshAccessToken(context.Background(), stolen.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshAccessToken failed: %v", err)
+	}
+
+	// An attacker replays the original token
+	if _, err := service.RefreshAccessToken(context.Background(), stolen.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Replay error = %v, want ErrRefreshTokenReused", err)
+	}
+
+	// The legitimate successor is revoked too
+	if _, err := service.RefreshAccessToken(context.Background(), rotated.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Successor error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	// Other logins are separate families and keep working
+	if _, err := service.RefreshAccessToken(context.Background(), otherDevice.RefreshToken); err != nil {
+		t.Errorf("Other session should be unaffected: %v", err)
+	}
+}
+
+func TestAuthService_Sessions(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	os.Setenv("JWT_SECRET", "test-secret-123")
+	defer os.Unsetenv("JWT_SECRET")
+
+	service := NewAuthService(testStore)
+	email := "sessions-service-test@example.com"
+	password := "password123"
+
+	cleanupUsers(t, email)
+	defer cleanupUsers(t, email)
+
+	reg, err := service.Register(context.Background(), email, password)
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	laptopCtx := WithSessionClient(context.Background(), model.SessionClient{
+		UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		IPAddress: "203.0.113.7",
+	})
+	laptop, err := service.Login(laptopCtx, email, password)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	phone, err := service.Login(context.Background(), email, password)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	sessions, err := service.ListSessions(context.Background(), reg.UserID, phone.RefreshToken)
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Sessions = %d, want 2", len(sessions))
+	}
+
+	var laptopSession *model.Session
+	for i := range sessions {
+		if sessions[i].IPAddress == "203.0.113.7" {
+			laptopSession = &sessions[i]
+		} else if !sessions[i].Current {
+			t.Error("The phone session should be current")
+		}
+	}
+	if laptopSession == nil {
+		t.Fatal("Laptop session missing")
+	}
+	if laptopSession.Current || laptopSession.OS != "macOS" || laptopSession.DeviceType != "Desktop" {
+		t.Errorf("Laptop session = %+v", laptopSession)
+	}
+
+	if err := service.RevokeSession(context.Background(), reg.UserID, laptopSession.ID); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+	if _, err := service.RefreshAccessToken(context.Background(), laptop.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Revoked session refresh error = %v, want ErrInvalidRefreshToken", err)
+	}
+	if err := service.RevokeSession(context.Background(), reg.UserID, laptopSession.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Second revoke error = %v, want ErrSessionNotFound", err)
+	}
+
+	if err := service.LogoutEverywhere(context.Background(), reg.UserID); err != nil {
+		t.Fatalf("LogoutEverywhere failed: %v", err)
+	}
+	if _, err := service.RefreshAccessToken(context.Background(), phone.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh after logout everywhere error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestAuthService_PasswordReset(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	os.Setenv("JWT_SECRET", "test-secret-123")
+	defer os.Unsetenv("JWT_SECRET")
+
+	server := mailtest.NewServer()
+	defer server.Close()
+
+	service := NewAuthService(testStore)
+	service.Mailer = mail.NewSMTPMailer(server.Addr, "no-reply@shrinks.test", "", "")
+	service.AppURL = "https://app.shrinks.test/"
+	email := "password-reset-test@example.com"
+
+	cleanupUsers(t, email)
+	defer cleanupUsers(t, email)
+
+	if _, err := service.Register(context.Background(), email, "old-password"); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	session, err := service.Login(context.Background(), email, "old-password")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	// Unknown accounts look the same to the caller but get no mail
+	if err := service.RequestPasswordReset(context.Background(), "nobody-reset-test@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset for unknown email failed: %v", err)
+	}
+
+	if err := service.RequestPasswordReset(context.Background(), email); err != nil {
+		t.Fatalf("RequestPasswordReset failed: %v", err)
+	}
+	// A second request right away doesn't send another mail
+	if err := service.RequestPasswordReset(context.Background(), email); err != nil {
+		t.Fatalf("Repeated RequestPasswordReset failed: %v", err)
+	}
+
+	// Registering also sent a verification mail
+	var resets []mailtest.Message
+	for _, msg := range server.Messages() {
+		if strings.Contains(msg.Data, "Subject: Reset your Shrinks password") {
+			resets = append(resets, msg)
+		}
+	}
+	if len(resets) != 1 {
+		t.Fatalf("Sent %d reset mails, want 1", len(resets))
+	}
+	if len(resets[0].To) != 1 || resets[0].To[0] != email {
+		t.Errorf("Mail sent to %v, want %s", resets[0].To, email)
+	}
+
+	token := tokenFromMail(t, mail.Message{Body: resets[0].Data}, "https://app.shrinks.test/reset-password")
+
+	if err := service.ResetPassword(context.Background(), token, "short"); !errors.Is(err, ErrPasswordTooShort) {
+		t.Errorf("Short password error = %v, want ErrPasswordTooShort", err)
+	}
+
+	if err := service.ResetPassword(context.Background(), token, "new-password"); err != nil {
+		t.Fatalf("ResetPassword failed: %v", err)
+	}
+
+	if err := service.ResetPassword(context.Background(), token, "another-password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("Reused token error = %v, want ErrInvalidResetToken", err)
+	}
+
+	if _, err := service.RefreshAccessToken(context.Background(), session.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh after reset error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	if _, err := service.Login(context.Background(), email, "old-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Old password login error = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := service.Login(context.Background(), email, "new-password"); err != nil {
+		t.Errorf("New password login failed: %v", err)
+	}
+}
+
+func TestAuthService_PasswordReset_ExpiredToken(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	service := NewAuthService(testStore)
+	email := "password-reset-expired-test@example.com"
+
+	cleanupUsers(t, email)
+	defer cleanupUsers(t, email)
+
+	reg, err := service.Register(context.Background(), email, "old-password")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	token := "expired-reset-token"
+	_, err = testStore.CreatePasswordResetToken(context.Background(), reg.UserID, HashRefreshToken(token), time.Now().Add(-time.Minute), time.Now())
+	if err != nil {
+		t.Fatalf("CreatePasswordResetToken failed: %v", err)
+	}
+
+	if err := service.ResetPassword(context.Background(), token, "new-password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("Expired token error = %v, want ErrInvalidResetToken", err)
+	}
+}
+
+// tokenFromMail pulls the token out of the emailed link to path.
+func tokenFromMail(t *testing.T, msg mail.Message, path string) string {
+	t.Helper()
+
+	prefix := path + "?token="
+	start := strings.Index(msg.Body, prefix)
+	if start < 0 {
+		t.Fatalf("Link to %s missing from mail:\n%s", path, msg.Body)
+	}
+	token, err := url.QueryUnescape(strings.Fields(msg.Body[start+len(prefix):])[0])
+	if err != nil {
+		t.Fatalf("Bad token in link: %v", err)
+	}
+	return token
+}
+
+func TestAuthService_EmailVerification(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	mailer := &mail.MockMailer{}
+	service := NewAuthService(testStore)
+	service.Mailer = mailer
+	service.AppURL = "https://app.shrinks.test"
+	email := "verify-email-test@example.com"
+
+	cleanupUsers(t, email)
+	defer cleanupUsers(t, email)
+
+	reg, err := service.Register(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	messages := mailer.Messages()
+	if len(messages) != 1 || messages[0].To != email {
+		t.Fatalf("Registration mails = %+v, want one to %s", messages, email)
+	}
+	token := tokenFromMail(t, messages[0], "https://app.shrinks.test/verify-email")
+
+	verified, err := service.EmailVerified(context.Background(), reg.UserID)
+	if err != nil {
+		t.Fatalf("EmailVerified failed: %v", err)
+	}
+	if verified {
+		t.Error("New accounts should start unverified")
+	}
+
+	// The registration mail counts towards the resend throttle
+	if err := service.ResendVerification(context.Background(), reg.UserID); !errors.Is(err, ErrVerificationThrottled) {
+		t.Errorf("Immediate resend error = %v, want ErrVerificationThrottled", err)
+	}
+
+	if err := service.VerifyEmail(context.Background(), token); err != nil {
+		t.Fatalf("VerifyEmail failed: %v", err)
+	}
+	if err := service.VerifyEmail(context.Background(), token); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("Reused token error = %v, want ErrInvalidVerificationToken", err)
+	}
+
+	verified, err = service.EmailVerified(context.Background(), reg.UserID)
+	if err != nil {
+		t.Fatalf("EmailVerified failed: %v", err)
+	}
+	if !verified {
+		t.Error("Email should be verified")
+	}
+
+	if err := service.ResendVerification(context.Background(), reg.UserID); !errors.Is(err, ErrEmailAlreadyVerified) {
+		t.Errorf("Resend after verifying error = %v, want ErrEmailAlreadyVerified", err)
+	}
+}
+
+func TestAuthService_EmailVerification_ExpiredToken(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	service := NewAuthService(testStore)
+	service.Mailer = &mail.MockMailer{}
+	email := "verify-email-expired-test@example.com"
+
+	cleanupUsers(t, email)
+	defer cleanupUsers(t, email)
+
+	reg, err := service.Register(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	token := "expired-verification-token"
+	_, err = testStore.CreateEmailVerificationToken(context.Background(), reg.UserID, email, HashRefreshToken(token), time.Now().Add(-time.Minute), time.Time{})
+	if err != nil {
+		t.Fatalf("CreateEmailVerificationToken failed: %v", err)
+	}
+
+	if err := service.VerifyEmail(context.Background(), token); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("Expired token error = %v, want ErrInvalidVerificationToken", err)
+	}
+}
+
+func TestAuthService_ChangePassword(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	os.Setenv("JWT_SECRET", "test-secret-123")
+	defer os.Unsetenv("JWT_SECRET")
+
+	service := NewAuthService(testStore)
+	service.Mailer = &mail.MockMailer{}
+	email := "change-password-test@example.com"
+
+	cleanupUsers(t, email)
+	defer cleanupUsers(t, email)
+
+	reg, err := service.Register(context.Background(), email, "old-password")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	current, err := service.Login(context.Background(), email, "old-password")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	other, err := service.Login(context.Background(), email, "old-password")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	if err := service.ChangePassword(context.Background(), reg.UserID, "wrong-password", "new-password", current.RefreshToken); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("Wrong password error = %v, want ErrIncorrectPassword", err)
+	}
+	if err := service.ChangePassword(context.Background(), reg.UserID, "old-password", "short", current.RefreshToken); !errors.Is(err, ErrPasswordTooShort) {
+		t.Errorf("Short password error = %v, want ErrPasswordTooShort", err)
+	}
+
+	if err := service.ChangePassword(context.Background(), reg.UserID, "old-password", "new-password", current.RefreshToken); err != nil {
+		t.Fatalf("ChangePassword failed: %v", err)
+	}
+
+	if _, err := service.RefreshAccessToken(context.Background(), current.RefreshToken); err != nil {
+		t.Errorf("Current session should stay logged in: %v", err)
+	}
+	if _, err := service.RefreshAccessToken(context.Background(), other.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Other session refresh error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	if _, err := service.Login(context.Background(), email, "new-password"); err != nil {
+		t.Errorf("New password login failed: %v", err)
+	}
+}
+
+func TestAuthService_ChangeEmail(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	os.Setenv("JWT_SECRET", "test-secret-123")
+	defer os.Unsetenv("JWT_SECRET")
+
+	mailer := &mail.MockMailer{}
+	service := NewAuthService(testStore)
+	service.Mailer = mailer
+	email := "change-email-test@example.com"
+	newEmail := "change-email-new-test@example.com"
+	takenEmail := "change-email-taken-test@example.com"
+
+	cleanupUsers(t, email, newEmail, takenEmail)
+	defer cleanupUsers(t, email, newEmail, takenEmail)
+
+	reg, err := service.Register(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if _, err := service.Register(context.Background(), takenEmail, "password123"); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := service.VerifyEmail(context.Background(), tokenFromMail(t, mailer.Messages()[0], "/verify-email")); err != nil {
+		t.Fatalf("VerifyEmail failed: %v", err)
+	}
+
+	if err := service.ChangeEmail(context.Background(), reg.UserID, "wrong-password", newEmail); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("Wrong password error = %v, want ErrIncorrectPassword", err)
+	}
+	if err := service.ChangeEmail(context.Background(), reg.UserID, "password123", takenEmail); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("Taken email error = %v, want ErrUserAlreadyExists", err)
+	}
+
+	sent := len(mailer.Messages())
+	if err := service.ChangeEmail(context.Background(), reg.UserID, "password123", newEmail); err != nil {
+		t.Fatalf("ChangeEmail failed: %v", err)
+	}
+
+	user, err := testStore.GetUserByID(context.Background(), reg.UserID)
+	if err != nil {
+		t.Fatalf("GetUserByID failed: %v", err)
+	}
+	if user.Email != newEmail || user.EmailVerified {
+		t.Errorf("User = %s verified=%v, want unverified %s", user.Email, user.EmailVerified, newEmail)
+	}
+
+	// One mail verifies the new address, the other warns the old one
+	messages := mailer.Messages()[sent:]
+	if len(messages) != 2 {
+		t.Fatalf("Sent %d mails, want 2", len(messages))
+	}
+	recipients := map[string]bool{messages[0].To: true, messages[1].To: true}
+	if !recipients[email] || !recipients[newEmail] {
+		t.Errorf("Mails went to %v, want %s and %s", recipients, email, newEmail)
+	}
+
+	if _, err := service.Login(context.Background(), newEmail, "password123"); err != nil {
+		t.Errorf("Login with new email failed: %v", err)
+	}
+}
+
+func TestAuthService_DeleteAccount(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	os.Setenv("JWT_SECRET", "test-secret-123")
+	defer os.Unsetenv("JWT_SECRET")
+
+	var evicted []string
+	service := NewAuthService(testStore)
+	service.Mailer = &mail.MockMailer{}
+	service.Cache = &cache.MockCache{
+		DeleteFn: func(ctx context.Context, key string) error {
+			evicted = append(evicted, key)
+			return nil
+		},
+	}
+	email := "delete-account-test@example.com"
+
+	cleanupUsers(t, email)
+	defer cleanupUsers(t, email)
+
+	reg, err := service.Register(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	login, err := service.Login(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	shortCode, err := testStore.SaveLink(context.Background(), "https://example.com/delete-account", &reg.UserID)
+	if err != nil {
+		t.Fatalf("SaveLink failed: %v", err)
+	}
+
+	if err := service.DeleteAccount(context.Background(), reg.UserID, "password123", "keep"); !errors.Is(err, ErrInvalidLinkPolicy) {
+		t.Errorf("Invalid policy error = %v, want ErrInvalidLinkPolicy", err)
+	}
+	if err := service.DeleteAccount(context.Background(), reg.UserID, "wrong-password", ""); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("Wrong password error = %v, want ErrIncorrectPassword", err)
+	}
+
+	if err := service.DeleteAccount(context.Background(), reg.UserID, "password123", ""); err != nil {
+		t.Fatalf("DeleteAccount failed: %v", err)
+	}
+
+	if len(evicted) != 1 || evicted[0] != shortCode {
+		t.Errorf("Evicted = %v, want [%s]", evicted, shortCode)
+	}
+	if _, err := service.GetUser(context.Background(), reg.UserID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUser error = %v, want ErrUserNotFound", err)
+	}
+	if _, err := service.RefreshAccessToken(context.Background(), login.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh error = %v, want ErrInvalidRefreshToken", err)
+	}
+	if link, err := testStore.GetLinkByCode(context.Background(), shortCode); err != nil || link != nil {
+		t.Errorf("Link = %+v, %v, want it deleted", link, err)
+	}
+}
+
+func TestAuthService_APIKeys(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	service := NewAuthService(testStore)
+	service.Mailer = &mail.MockMailer{}
+	email := "api-keys-service-test@example.com"
+
+	cleanupUsers(t, email)
+	defer cleanupUsers(t, email)
+
+	reg, err := service.Register(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	if _, err := service.CreateAPIKey(context.Background(), reg.UserID, "  ", []string{ScopeLinksRead}); !errors.Is(err, ErrInvalidAPIKeyName) {
+		t.Errorf("Blank name error = %v, want ErrInvalidAPIKeyName", err)
+	}
+	if _, err := service.CreateAPIKey(context.Background(), reg.UserID, "ci", []string{"admin"}); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Unknown scope error = %v, want ErrInvalidScope", err)
+	}
+	if _, err := service.CreateAPIKey(context.Background(), reg.UserID, "ci", nil); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("No scope error = %v, want ErrInvalidScope", err)
+	}
+
+	created, err := service.CreateAPIKey(context.Background(), reg.UserID, "ci", []string{ScopeLinksWrite, ScopeLinksRead, ScopeLinksWrite})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, APIKeyPrefix) || !strings.HasPrefix(created.Key, created.Prefix) {
+		t.Errorf("Key %q should start with %q and its prefix %q", created.Key, APIKeyPrefix, created.Prefix)
+	}
+	if len(created.Scopes) != 2 {
+		t.Errorf("Scopes = %v, want duplicates dropped", created.Scopes)
+	}
+
+	key, err := service.AuthenticateAPIKey(context.Background(), created.Key)
+	if err != nil {
+		t.Fatalf("AuthenticateAPIKey failed: %v", err)
+	}
+	if key.UserID != reg.UserID {
+		t.Errorf("UserID = %d, want %d", key.UserID, reg.UserID)
+	}
+	if _, err := service.AuthenticateAPIKey(context.Background(), created.Key+"x"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Wrong key error = %v, want ErrInvalidAPIKey", err)
+	}
+
+	if err := service.RevokeAPIKey(context.Background(), reg.UserID, created.ID+1000000); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Unknown key revoke error = %v, want ErrAPIKeyNotFound", err)
+	}
+	if err := service.RevokeAPIKey(context.Background(), reg.UserID, created.ID); err != nil {
+		t.Fatalf("RevokeAPIKey failed: %v", err)
+	}
+	if _, err := service.AuthenticateAPIKey(context.Background(), created.Key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Revoked key error = %v, want ErrInvalidAPIKey", err)
+	}
+}
+
+// oidcLogin signs in through the fake provider as its current user.
+func oidcLogin(t *testing.T, service *AuthService, provider *oidctest.Server) (model.AuthResponse, error) {
+	t.Helper()
+
+	authURL, flow, err := service.BeginOIDCLogin(context.Background(), "fake")
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin failed: %v", err)
+	}
+
+	callback, err := provider.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize failed: %v", err)
+	}
+
+	return service.CompleteOIDCLogin(context.Background(), flow, callback.Query().Get("state"), callback.Query().Get("code"))
+}
+
+func TestAuthService_OIDCLogin(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+	os.Setenv("JWT_SECRET", "test-secret-123")
+
+	provider := oidctest.NewServer("shrinks", "client-secret")
+	defer provider.Close()
+
+	service := NewAuthService(testStore)
+	service.Mailer = &mail.MockMailer{}
+	service.OIDC = map[string]*oidc.Provider{
+		"fake": oidc.NewProvider(oidc.Config{
+			Issuer:       provider.URL,
+			ClientID:     "shrinks",
+			ClientSecret: "client-secret",
+			RedirectURL:  "https://app.shrinks.test/api/v1/auth/oidc/fake/callback",
+		}),
+	}
+
+	newEmail := "oidc-new-test@example.com"
+	existingEmail := "oidc-existing-test@example.com"
+	unverifiedEmail := "oidc-unverified-test@example.com"
+	cleanupUsers(t, newEmail, existingEmail, unverifiedEmail)
+	defer cleanupUsers(t, newEmail, existingEmail, unverifiedEmail)
+
+	if names := service.OIDCProviders(); len(names) != 1 || names[0] != "fake" {
+		t.Errorf("OIDCProviders = %v, want [fake]", names)
+	}
+	if _, _, err := service.BeginOIDCLogin(context.Background(), "other"); !errors.Is(err, ErrUnknownOIDCProvider) {
+		t.Errorf("Unknown provider error = %v, want ErrUnknownOIDCProvider", err)
+	}
+
+	// An unknown identity with a verified address gets a new, verified account
+	provider.SetUser(oidctest.User{Subject: "new-subject", Email: newEmail, EmailVerified: true})
+	resp, err := oidcLogin(t, service, provider)
+	if err != nil {
+		t.Fatalf("Login as new user failed: %v", err)
+	}
+	if resp.AccessToken == "" || resp.RefreshToken == "" || resp.User.Email != newEmail {
+		t.Errorf("Response = %+v, want tokens for %s", resp, newEmail)
+	}
+	verified, err := service.EmailVerified(context.Background(), resp.User.ID)
+	if err != nil {
+		t.Fatalf("EmailVerified failed: %v", err)
+	}
+	if !verified {
+		t.Error("Account created through the provider should be verified")
+	}
+
+	// The same identity signs in to the same account, even with another address
+	provider.SetUser(oidctest.User{Subject: "new-subject", Email: "changed@example.com"})
+	again, err := oidcLogin(t, service, provider)
+	if err != nil {
+		t.Fatalf("Second login failed: %v", err)
+	}
+	if again.User.ID != resp.User.ID {
+		t.Errorf("Second login UserID = %d, want %d", again.User.ID, resp.User.ID)
+	}
+
+	// An existing verified account is linked by email
+	existing, err := service.Register(context.Background(), existingEmail, "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if _, err := testStore.Pool.Exec(context.Background(), "UPDATE users SET email_verified = TRUE WHERE id = $1", existing.UserID); err != nil {
+		t.Fatalf("Failed to verify user: %v", err)
+	}
+	provider.SetUser(oidctest.User{Subject: "existing-subject", Email: existingEmail, EmailVerified: true})
+	linked, err := oidcLogin(t, service, provider)
+	if err != nil {
+		t.Fatalf("Login linking existing user failed: %v", err)
+	}
+	if linked.User.ID != existing.UserID {
+		t.Errorf("Linked UserID = %d, want %d", linked.User.ID, existing.UserID)
+	}
+
+	// Addresses the provider doesn't vouch for are never matched
+	provider.SetUser(oidctest.User{Subject: "unverified-subject", Email: existingEmail})
+	if _, err := oidcLogin(t, service, provider); !errors.Is(err, ErrOIDCEmailNotVerified) {
+		t.Errorf("Unverified provider email error = %v, want ErrOIDCEmailNotVerified", err)
+	}
+
+	// Nor are local accounts whose address was never verified
+	if _, err := service.Register(context.Background(), unverifiedEmail, "password123"); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	provider.SetUser(oidctest.User{Subject: "takeover-subject", Email: unverifiedEmail, EmailVerified: true})
+	if _, err := oidcLogin(t, service, provider); !errors.Is(err, ErrOIDCAccountUnverified) {
+		t.Errorf("Unverified account error = %v, want ErrOIDCAccountUnverified", err)
+	}
+
+	// A callback must carry the state of the login that started it
+	authURL, flow, err := service.BeginOIDCLogin(context.Background(), "fake")
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin failed: %v", err)
+	}
+	callback, err := provider.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize failed: %v", err)
+	}
+	if _, err := service.CompleteOIDCLogin(context.Background(), flow, "forged", callback.Query().Get("code")); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("Wrong state error = %v, want ErrInvalidOIDCState", err)
+	}
+	if _, err := service.CompleteOIDCLogin(context.Background(), flow, flow.State, "bogus-code"); !errors.Is(err, ErrOIDCFailed) {
+		t.Errorf("Bad code error = %v, want ErrOIDCFailed", err)
+	}
+}
+
+// enableTwoFactor turns on two-factor authentication for a user and returns
+// the secret, the step the activation code used and the recovery codes.
+func enableTwoFactor(t *testing.T, service *AuthService, userID uint64, password string) (string, int64, []string) {
+	t.Helper()
+
+	enrollment, err := service.EnrollTwoFactor(context.Background(), userID, password)
+	if err != nil {
+		t.Fatalf("EnrollTwoFactor failed: %v", err)
+	}
+
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(enrollment.Secret, step)
+	activation, err := service.ActivateTwoFactor(context.Background(), userID, code)
+	if err != nil {
+		t.Fatalf("ActivateTwoFactor failed: %v", err)
+	}
+
+	return enrollment.Secret, step, activation.RecoveryCodes
+}
+
+func TestAuthService_TwoFactor(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+	os.Setenv("JWT_SECRET", "test-secret-123")
+
+	mailer := &mail.MockMailer{}
+	service := NewAuthService(testStore)
+	service.Mailer = mailer
+	email := "two-factor-test@example.com"
+
+	cleanupUsers(t, email)
+	defer cleanupUsers(t, email)
+
+	reg, err := service.Register(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	if _, err := service.EnrollTwoFactor(context.Background(), reg.UserID, "wrong-password"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("Wrong password error = %v, want ErrIncorrectPassword", err)
+	}
+	if _, err := service.ActivateTwoFactor(context.Background(), reg.UserID, "123456"); !errors.Is(err, ErrTwoFactorNotEnrolled) {
+		t.Errorf("Activate before enrolling error = %v, want ErrTwoFactorNotEnrolled", err)
+	}
+
+	enrollment, err := service.EnrollTwoFactor(context.Background(), reg.UserID, "password123")
+	if err != nil {
+		t.Fatalf("EnrollTwoFactor failed: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/") || !strings.Contains(enrollment.ProvisioningURI, enrollment.Secret) {
+		t.Errorf("ProvisioningURI = %q, want an otpauth URI with the secret", enrollment.ProvisioningURI)
+	}
+
+	// Enrolling alone doesn't change the login
+	resp, err := service.Login(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if resp.TwoFactor != nil || resp.AccessToken == "" {
+		t.Error("Login should not ask for a code before activation")
+	}
+
+	if _, err := service.ActivateTwoFactor(context.Background(), reg.UserID, "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("Wrong code error = %v, want ErrInvalidTwoFactorCode", err)
+	}
+
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(enrollment.Secret, step)
+	activation, err := service.ActivateTwoFactor(context.Background(), reg.UserID, code)
+	if err != nil {
+		t.Fatalf("ActivateTwoFactor failed: %v", err)
+	}
+	if len(activation.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("Recovery codes = %d, want %d", len(activation.RecoveryCodes), recoveryCodeCount)
+	}
+	if _, err := service.EnrollTwoFactor(context.Background(), reg.UserID, "password123"); !errors.Is(err, ErrTwoFactorAlreadyEnabled) {
+		t.Errorf("Enroll again error = %v, want ErrTwoFactorAlreadyEnabled", err)
+	}
+
+	// The password now only gets a challenge
+	resp, err = service.Login(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if resp.TwoFactor == nil || resp.TwoFactor.Token == "" {
+		t.Fatal("Login should return a challenge")
+	}
+	if resp.AccessToken != "" || resp.RefreshToken != "" {
+		t.Error("Login should not return tokens before the code")
+	}
+	challenge := resp.TwoFactor.Token
+
+	// The activation code can't be used again
+	if _, err := service.VerifyTwoFactorLogin(context.Background(), challenge, code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("Replayed code error = %v, want ErrInvalidTwoFactorCode", err)
+	}
+	if _, err := service.VerifyTwoFactorLogin(context.Background(), "forged", code); !errors.Is(err, ErrInvalidTwoFactorChallenge) {
+		t.Errorf("Unknown challenge error = %v, want ErrInvalidTwoFactorChallenge", err)
+	}
+
+	next, _ := totp.Code(enrollment.Secret, step+1)
+	session, err := service.VerifyTwoFactorLogin(context.Background(), challenge, next)
+	if err != nil {
+		t.Fatalf("VerifyTwoFactorLogin failed: %v", err)
+	}
+	if session.AccessToken == "" || session.RefreshToken == "" || session.User.ID != reg.UserID {
+		t.Errorf("Session = %+v, want tokens for user %d", session, reg.UserID)
+	}
+	if _, err := service.VerifyTwoFactorLogin(context.Background(), challenge, next); !errors.Is(err, ErrInvalidTwoFactorChallenge) {
+		t.Errorf("Used challenge error = %v, want ErrInvalidTwoFactorChallenge", err)
+	}
+
+	// Recovery codes work once, however they are typed
+	resp, err = service.Login(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	recovery := strings.ToLower(activation.RecoveryCodes[0])
+	if _, err := service.VerifyTwoFactorLogin(context.Background(), resp.TwoFactor.Token, recovery); err != nil {
+		t.Fatalf("Login with recovery code failed: %v", err)
+	}
+	resp, err = service.Login(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if _, err := service.VerifyTwoFactorLogin(context.Background(), resp.TwoFactor.Token, recovery); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("Reused recovery code error = %v, want ErrInvalidTwoFactorCode", err)
+	}
+
+	if err := service.DisableTwoFactor(context.Background(), reg.UserID, "password123", "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("Disable with wrong code error = %v, want ErrInvalidTwoFactorCode", err)
+	}
+	if err := service.DisableTwoFactor(context.Background(), reg.UserID, "password123", activation.RecoveryCodes[1]); err != nil {
+		t.Fatalf("DisableTwoFactor failed: %v", err)
+	}
+	if err := service.DisableTwoFactor(context.Background(), reg.UserID, "password123", activation.RecoveryCodes[2]); !errors.Is(err, ErrTwoFactorNotEnabled) {
+		t.Errorf("Disable again error = %v, want ErrTwoFactorNotEnabled", err)
+	}
+
+	resp, err = service.Login(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if resp.TwoFactor != nil || resp.AccessToken == "" {
+		t.Error("Login should return tokens once two-factor authentication is off")
+	}
+
+	// Verification mail, then one notice each for turning it on and off
+	if messages := mailer.Messages(); len(messages) != 3 {
+		t.Errorf("Mails = %d, want 3", len(messages))
+	}
+}
+
+func TestAuthService_TwoFactor_AttemptsLimited(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+	os.Setenv("JWT_SECRET", "test-secret-123")
+
+	service := NewAuthService(testStore)
+	service.Mailer = &mail.MockMailer{}
+	email := "two-factor-attempts-test@example.com"
+
+	cleanupUsers(t, email)
+	defer cleanupUsers(t, email)
+
+	reg, err := service.Register(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	secret, step, _ := enableTwoFactor(t, service, reg.UserID, "password123")
+
+	resp, err := service.Login(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	for range maxTwoFactorAttempts {
+		if _, err := service.VerifyTwoFactorLogin(context.Background(), resp.TwoFactor.Token, "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("Wrong code error = %v, want ErrInvalidTwoFactorCode", err)
+		}
+	}
+
+	// Logging in again doesn't give more guesses
+	again, err := service.Login(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	code, _ := totp.Code(secret, step+1)
+	if _, err := service.VerifyTwoFactorLogin(context.Background(), again.TwoFactor.Token, code); !errors.Is(err, ErrInvalidTwoFactorChallenge) {
+		t.Errorf("Right code after too many attempts error = %v, want ErrInvalidTwoFactorChallenge", err)
+	}
+}
+
+func TestAuthService_TwoFactor_OIDCLogin(t *testing.T) {
+	if testStore == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+	os.Setenv("JWT_SECRET", "test-secret-123")
+
+	provider := oidctest.NewServer("shrinks", "client-secret")
+	defer provider.Close()
+
+	service := NewAuthService(testStore)
+	service.Mailer = &mail.MockMailer{}
+	service.OIDC = map[string]*oidc.Provider{
+		"fake": oidc.NewProvider(oidc.Config{
+			Issuer:       provider.URL,
+			ClientID:     "shrinks",
+			ClientSecret: "client-secret",
+			RedirectURL:  "https://app.shrinks.test/api/v1/auth/oidc/fake/callback",
+		}),
+	}
+	email := "two-factor-oidc-test@example.com"
+
+	cleanupUsers(t, email)
+	defer cleanupUsers(t, email)
+
+	reg, err := service.Register(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if _, err := testStore.Pool.Exec(context.Background(), "UPDATE users SET email_verified = TRUE WHERE id = $1", reg.UserID); err != nil {
+		t.Fatalf("Failed to verify user: %v", err)
+	}
+	enableTwoFactor(t, service, reg.UserID, "password123")
+
+	// A provider login is a first factor like the password
+	provider.SetUser(oidctest.User{Subject: "two-factor-subject", Email: email, EmailVerified: true})
+	resp, err := oidcLogin(t, service, provider)
+	if err != nil {
+		t.Fatalf("Provider login failed: %v", err)
+	}
+	if resp.TwoFactor == nil || resp.AccessToken != "" {
+		t.Errorf("Provider login = %+v, want a challenge", resp)
+	}
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+)
+
+const (
+	RefreshCookieName = "refresh_token"
+
+	// The CSRF cookie is readable by the frontend, which echoes it in the
+	// header. A cross-site form can make the browser send the cookies but
+	// can't read them to set the header (double-submit).
+	CSRFCookieName = "csrf_token"
+	CSRFHeader     = "X-CSRF-Token"
+
+	sessionCookieMaxAge = 3600 * 24 * 7 // Matches refreshTokenLifetime
+
+	// Holds an OIDCFlow while the user is away at the provider, and is only
+	// sent back to the provider callbacks.
+	OIDCFlowCookieName   = "oidc_flow"
+	oidcFlowCookiePath   = "/api/v1/auth/oidc/"
+	oidcFlowCookieMaxAge = 10 * 60
+)
+
+// SetSessionCookies stores the refresh token in an HttpOnly cookie alongside
+// a fresh CSRF token.
+func SetSessionCookies(w http.ResponseWriter, refreshToken string) error {
+	csrfToken, err := GenerateRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, sessionCookie(RefreshCookieName, refreshToken, true, sessionCookieMaxAge))
+	http.SetCookie(w, sessionCookie(CSRFCookieName, csrfToken, false, sessionCookieMaxAge))
+	return nil
+}
+
+func ClearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, sessionCookie(RefreshCookieName, "", true, -1))
+	http.SetCookie(w, sessionCookie(CSRFCookieName, "", false, -1))
+}
+
+func sessionCookie(name string, value string, httpOnly bool, maxAge int) *http.Cookie {
+	isProduction := os.Getenv("ENV") == "production"
+	sameSite := http.SameSiteLaxMode
+	if isProduction {
+		sameSite = http.SameSiteStrictMode
+	}
+
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: httpOnly,
+		Secure:   isProduction,
+		SameSite: sameSite,
+		MaxAge:   maxAge,
+	}
+}
+
+// RefreshTokenFromCookie returns the refresh token cookie, or "" if absent.
+func RefreshTokenFromCookie(r *http.Request) string {
+	cookie, err := r.Cookie(RefreshCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// ValidCSRF reports whether the CSRF header matches the CSRF cookie.
+func ValidCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(CSRFCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	header := r.Header.Get(CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
+
+// SetOIDCFlowCookie remembers a provider login in progress. It is Lax even in
+// production, since the provider sends the user back with a cross-site
+// redirect.
+func SetOIDCFlowCookie(w http.ResponseWriter, flow OIDCFlow) error {
+	value, err := json.Marshal(flow)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, oidcFlowCookie(base64.RawURLEncoding.EncodeToString(value), oidcFlowCookieMaxAge))
+	return nil
+}
+
+func ClearOIDCFlowCookie(w http.ResponseWriter) {
+	http.SetCookie(w, oidcFlowCookie("", -1))
+}
+
+// OIDCFlowFromCookie returns the provider login this browser started, if any.
+func OIDCFlowFromCookie(r *http.Request) (OIDCFlow, bool) {
+	cookie, err := r.Cookie(OIDCFlowCookieName)
+	if err != nil {
+		return OIDCFlow{}, false
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return OIDCFlow{}, false
+	}
+
+	var flow OIDCFlow
+	if err := json.Unmarshal(value, &flow); err != nil {
+		return OIDCFlow{}, false
+	}
+	return flow, true
+}
+
+func oidcFlowCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     OIDCFlowCookieName,
+		Value:    value,
+		Path:     oidcFlowCookiePath,
+		HttpOnly: true,
+		Secure:   os.Getenv("ENV") == "production",
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   maxAge,
+	}
+}
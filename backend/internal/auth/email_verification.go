@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/mail"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+	ErrVerificationThrottled    = errors.New("a verification email was sent recently")
+	ErrEmailNotVerified         = errors.New("email is not verified")
+)
+
+const (
+	emailVerificationLifetime = 24 * time.Hour
+	// Resending is refused until this long has passed since the last mail.
+	emailVerificationCooldown = time.Minute
+)
+
+// sendVerification mails a verification link for the given address. A zero
+// notSince skips the resend throttle, e.g. right after registering.
+func (as *AuthService) sendVerification(ctx context.Context, userID uint64, email string, notSince time.Time) error {
+	token, err := GenerateRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	created, err := as.Store.CreateEmailVerificationToken(ctx, userID, email, HashRefreshToken(token), time.Now().Add(emailVerificationLifetime), notSince)
+	if err != nil {
+		return err
+	}
+
+	if !created {
+		return ErrVerificationThrottled
+	}
+
+	return as.mailer().Send(ctx, verificationMessage(email, as.link("/verify-email", token)))
+}
+
+// ResendVerification mails the user a new verification link. Earlier links
+// keep working until they expire.
+func (as *AuthService) ResendVerification(ctx context.Context, userID uint64) error {
+	user, err := as.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	return as.sendVerification(ctx, user.ID, user.Email, time.Now().Add(-emailVerificationCooldown))
+}
+
+// VerifyEmail marks the address a verification link was sent to as verified.
+func (as *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	if token == "" {
+		return ErrInvalidVerificationToken
+	}
+
+	verified, err := as.Store.VerifyEmail(ctx, HashRefreshToken(token))
+	if err != nil {
+		return err
+	}
+
+	if !verified {
+		return ErrInvalidVerificationToken
+	}
+
+	return nil
+}
+
+// EmailVerified reports whether the user has verified their current address.
+func (as *AuthService) EmailVerified(ctx context.Context, userID uint64) (bool, error) {
+	user, err := as.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if user == nil {
+		return false, ErrUserNotFound
+	}
+
+	return user.EmailVerified, nil
+}
+
+func verificationMessage(to string, link string) mail.Message {
+	return mail.Message{
+		To:      to,
+		Subject: "Verify your Shrinks email address",
+		Body: fmt.Sprintf(
+			"Confirm that this is your email address by opening the link below within the next 24 hours:\n%s\n\n"+
+				"If you didn't create a Shrinks account, you can ignore this email.\n",
+			link,
+		),
+	}
+}
@@ -0,0 +1,112 @@
+//go:build unit
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+type stubVerifier struct {
+	verified bool
+	err      error
+}
+
+func (s stubVerifier) EmailVerified(ctx context.Context, userID uint64) (bool, error) {
+	return s.verified, s.err
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     bool
+		verifier   stubVerifier
+		wantStatus int
+	}{
+		{"verified", true, stubVerifier{verified: true}, http.StatusOK},
+		{"unverified", true, stubVerifier{}, http.StatusForbidden},
+		{"deleted user", true, stubVerifier{err: ErrUserNotFound}, http.StatusUnauthorized},
+		{"lookup failure", true, stubVerifier{err: errors.New("db down")}, http.StatusInternalServerError},
+		{"no claims", false, stubVerifier{verified: true}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/keys", nil)
+			if tt.claims {
+				req = req.WithContext(context.WithValue(req.Context(), ClaimsContextKey, &Claims{UserID: 1}))
+			}
+			rr := httptest.NewRecorder()
+
+			RequireVerifiedEmail(tt.verifier, next).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+type stubAuthenticator struct {
+	key *model.APIKey
+	err error
+}
+
+func (s stubAuthenticator) AuthenticateAPIKey(ctx context.Context, key string) (*model.APIKey, error) {
+	return s.key, s.err
+}
+
+func TestAllowAPIKey(t *testing.T) {
+	scoped := &model.APIKey{UserID: 9, Email: "ci@example.com", Scopes: []string{ScopeLinksRead, ScopeLinksWrite}}
+
+	tests := []struct {
+		name          string
+		authorization string
+		authenticator stubAuthenticator
+		wantStatus    int
+		wantUserID    uint64
+	}{
+		{"key with scope", "Bearer shk_secret", stubAuthenticator{key: scoped}, http.StatusOK, 9},
+		{"key without scope", "Bearer shk_secret", stubAuthenticator{key: &model.APIKey{UserID: 9, Scopes: []string{ScopeAnalyticsRead}}}, http.StatusForbidden, 0},
+		{"unknown key", "Bearer shk_unknown", stubAuthenticator{err: ErrInvalidAPIKey}, http.StatusUnauthorized, 0},
+		{"lookup failure", "Bearer shk_secret", stubAuthenticator{err: errors.New("db down")}, http.StatusInternalServerError, 0},
+		// Anything that isn't an API key is left to RequireAuth
+		{"access token", "Bearer not-a-jwt", stubAuthenticator{key: scoped}, http.StatusUnauthorized, 0},
+		{"no credentials", "", stubAuthenticator{key: scoped}, http.StatusUnauthorized, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUserID uint64
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claims, _ := GetClaimsFromContext(r.Context())
+				gotUserID = claims.UserID
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/links/shorten", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+
+			AllowAPIKey(tt.authenticator, ScopeLinksWrite, RequireAuth(next)).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if gotUserID != tt.wantUserID {
+				t.Errorf("UserID = %d, want %d", gotUserID, tt.wantUserID)
+			}
+		})
+	}
+}
@@ -10,6 +10,35 @@ type MockAuthService struct {
 	LoginFn              func(ctx context.Context, email, password string) (model.AuthResponse, error)
 	RefreshAccessTokenFn func(ctx context.Context, refreshToken string) (model.RefreshTokenResponse, error)
 	LogoutFn             func(ctx context.Context, refreshToken string) error
+	ListSessionsFn       func(ctx context.Context, userID uint64, currentRefreshToken string) ([]model.Session, error)
+	RevokeSessionFn      func(ctx context.Context, userID uint64, sessionID string) error
+	LogoutEverywhereFn   func(ctx context.Context, userID uint64) error
+
+	RequestPasswordResetFn func(ctx context.Context, email string) error
+	ResetPasswordFn        func(ctx context.Context, token string, password string) error
+
+	ResendVerificationFn func(ctx context.Context, userID uint64) error
+	VerifyEmailFn        func(ctx context.Context, token string) error
+	EmailVerifiedFn      func(ctx context.Context, userID uint64) (bool, error)
+
+	ChangePasswordFn func(ctx context.Context, userID uint64, currentPassword string, newPassword string, currentRefreshToken string) error
+	ChangeEmailFn    func(ctx context.Context, userID uint64, currentPassword string, newEmail string) error
+
+	GetUserFn       func(ctx context.Context, userID uint64) (*model.User, error)
+	DeleteAccountFn func(ctx context.Context, userID uint64, currentPassword string, linkPolicy string) error
+
+	CreateAPIKeyFn       func(ctx context.Context, userID uint64, name string, scopes []string) (model.CreateAPIKeyResponse, error)
+	ListAPIKeysFn        func(ctx context.Context, userID uint64) ([]model.APIKey, error)
+	RevokeAPIKeyFn       func(ctx context.Context, userID uint64, id uint64) error
+	AuthenticateAPIKeyFn func(ctx context.Context, key string) (*model.APIKey, error)
+
+	OIDCProvidersFn        func() []string
+	BeginOIDCLoginFn       func(ctx context.Context, provider string) (string, OIDCFlow, error)
+	CompleteOIDCLoginFn    func(ctx context.Context, flow OIDCFlow, state string, code string) (model.AuthResponse, error)
+	EnrollTwoFactorFn      func(ctx context.Context, userID uint64, currentPassword string) (model.EnrollTwoFactorResponse, error)
+	ActivateTwoFactorFn    func(ctx context.Context, userID uint64, code string) (model.ActivateTwoFactorResponse, error)
+	DisableTwoFactorFn     func(ctx context.Context, userID uint64, currentPassword string, code string) error
+	VerifyTwoFactorLoginFn func(ctx context.Context, challengeToken string, code string) (model.AuthResponse, error)
 }
 
 func (m *MockAuthService) Register(ctx context.Context, email, password string) (model.RegisterResponse, error) {
@@ -27,3 +56,95 @@ func (m *MockAuthService) RefreshAccessToken(ctx context.Context, refreshToken s
 func (m *MockAuthService) Logout(ctx context.Context, refreshToken string) error {
 	return m.LogoutFn(ctx, refreshToken)
 }
+
+func (m *MockAuthService) ListSessions(ctx context.Context, userID uint64, currentRefreshToken string) ([]model.Session, error) {
+	return m.ListSessionsFn(ctx, userID, currentRefreshToken)
+}
+
+func (m *MockAuthService) RevokeSession(ctx context.Context, userID uint64, sessionID string) error {
+	return m.RevokeSessionFn(ctx, userID, sessionID)
+}
+
+func (m *MockAuthService) LogoutEverywhere(ctx context.Context, userID uint64) error {
+	return m.LogoutEverywhereFn(ctx, userID)
+}
+
+func (m *MockAuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	return m.RequestPasswordResetFn(ctx, email)
+}
+
+func (m *MockAuthService) ResetPassword(ctx context.Context, token string, password string) error {
+	return m.ResetPasswordFn(ctx, token, password)
+}
+
+func (m *MockAuthService) ResendVerification(ctx context.Context, userID uint64) error {
+	return m.ResendVerificationFn(ctx, userID)
+}
+
+func (m *MockAuthService) VerifyEmail(ctx context.Context, token string) error {
+	return m.VerifyEmailFn(ctx, token)
+}
+
+func (m *MockAuthService) EmailVerified(ctx context.Context, userID uint64) (bool, error) {
+	return m.EmailVerifiedFn(ctx, userID)
+}
+
+func (m *MockAuthService) ChangePassword(ctx context.Context, userID uint64, currentPassword string, newPassword string, currentRefreshToken string) error {
+	return m.ChangePasswordFn(ctx, userID, currentPassword, newPassword, currentRefreshToken)
+}
+
+func (m *MockAuthService) ChangeEmail(ctx context.Context, userID uint64, currentPassword string, newEmail string) error {
+	return m.ChangeEmailFn(ctx, userID, currentPassword, newEmail)
+}
+
+func (m *MockAuthService) GetUser(ctx context.Context, userID uint64) (*model.User, error) {
+	return m.GetUserFn(ctx, userID)
+}
+
+func (m *MockAuthService) DeleteAccount(ctx context.Context, userID uint64, currentPassword string, linkPolicy string) error {
+	return m.DeleteAccountFn(ctx, userID, currentPassword, linkPolicy)
+}
+
+func (m *MockAuthService) CreateAPIKey(ctx context.Context, userID uint64, name string, scopes []string) (model.CreateAPIKeyResponse, error) {
+	return m.CreateAPIKeyFn(ctx, userID, name, scopes)
+}
+
+func (m *MockAuthService) ListAPIKeys(ctx context.Context, userID uint64) ([]model.APIKey, error) {
+	return m.ListAPIKeysFn(ctx, userID)
+}
+
+func (m *MockAuthService) RevokeAPIKey(ctx context.Context, userID uint64, id uint64) error {
+	return m.RevokeAPIKeyFn(ctx, userID, id)
+}
+
+func (m *MockAuthService) AuthenticateAPIKey(ctx context.Context, key string) (*model.APIKey, error) {
+	return m.AuthenticateAPIKeyFn(ctx, key)
+}
+
+func (m *MockAuthService) OIDCProviders() []string {
+	return m.OIDCProvidersFn()
+}
+
+func (m *MockAuthService) BeginOIDCLogin(ctx context.Context, provider string) (string, OIDCFlow, error) {
+	return m.BeginOIDCLoginFn(ctx, provider)
+}
+
+func (m *MockAuthService) CompleteOIDCLogin(ctx context.Context, flow OIDCFlow, state string, code string) (model.AuthResponse, error) {
+	return m.CompleteOIDCLoginFn(ctx, flow, state, code)
+}
+
+func (m *MockAuthService) EnrollTwoFactor(ctx context.Context, userID uint64, currentPassword string) (model.EnrollTwoFactorResponse, error) {
+	return m.EnrollTwoFactorFn(ctx, userID, currentPassword)
+}
+
+func (m *MockAuthService) ActivateTwoFactor(ctx context.Context, userID uint64, code string) (model.ActivateTwoFactorResponse, error) {
+	return m.ActivateTwoFactorFn(ctx, userID, code)
+}
+
+func (m *MockAuthService) DisableTwoFactor(ctx context.Context, userID uint64, currentPassword string, code string) error {
+	return m.DisableTwoFactorFn(ctx, userID, currentPassword, code)
+}
+
+func (m *MockAuthService) VerifyTwoFactorLogin(ctx context.Context, challengeToken string, code string) (model.AuthResponse, error) {
+	return m.VerifyTwoFactorLoginFn(ctx, challengeToken, code)
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/oidc"
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+var (
+	ErrUnknownOIDCProvider   = errors.New("unknown sign in provider")
+	ErrInvalidOIDCState      = errors.New("sign in state is missing or does not match")
+	ErrOIDCFailed            = errors.New("sign in with provider failed")
+	ErrOIDCEmailNotVerified  = errors.New("provider did not vouch for the email address")
+	ErrOIDCAccountUnverified = errors.New("an account with this email exists but its email is not verified")
+)
+
+// OIDCFlow is what a provider login needs to remember between sending the
+// user off and them coming back. It is kept in a cookie on the browser that
+// started the login, which is what ties the callback to that browser.
+type OIDCFlow struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"` // PKCE code verifier
+}
+
+// OIDCProviders lists the names of the configured providers, sorted.
+func (as *AuthService) OIDCProviders() []string {
+	names := make([]string, 0, len(as.OIDC))
+	for name := range as.OIDC {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// BeginOIDCLogin returns the provider URL to send the user to, and the flow
+// to keep until they come back to CompleteOIDCLogin.
+func (as *AuthService) BeginOIDCLogin(ctx context.Context, provider string) (string, OIDCFlow, error) {
+	p, ok := as.OIDC[provider]
+	if !ok {
+		return "", OIDCFlow{}, ErrUnknownOIDCProvider
+	}
+
+	flow := OIDCFlow{Provider: provider}
+	for _, value := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		random, err := oidc.NewVerifier()
+		if err != nil {
+			return "", OIDCFlow{}, err
+		}
+		*value = random
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		return "", OIDCFlow{}, err
+	}
+
+	return authURL, flow, nil
+}
+
+// CompleteOIDCLogin finishes a provider login with the state and code from
+// the callback and starts a session, or returns a challenge like Login for
+// users with two-factor authentication. A provider account that isn't linked
+// yet is linked to the user with the same email, or gets a new user, but only
+// if the provider says the address is verified. Linking to an account whose
+// own address was never verified is refused: whoever registered it may not
+// own the address.
+func (as *AuthService) CompleteOIDCLogin(ctx context.Context, flow OIDCFlow, state string, code string) (model.AuthResponse, error) {
+	p, ok := as.OIDC[flow.Provider]
+	if !ok {
+		return model.AuthResponse{}, ErrUnknownOIDCProvider
+	}
+
+	if flow.State == "" || subtle.ConstantTimeCompare([]byte(flow.State), []byte(state)) != 1 {
+		return model.AuthResponse{}, ErrInvalidOIDCState
+	}
+
+	identity, err := p.Exchange(ctx, code, flow.Verifier, flow.Nonce)
+	if err != nil {
+		return model.AuthResponse{}, fmt.Errorf("%w: %v", ErrOIDCFailed, err)
+	}
+
+	user, err := as.Store.GetUserByIdentity(ctx, flow.Provider, identity.Subject)
+	if err != nil {
+		return model.AuthResponse{}, err
+	}
+
+	if user != nil {
+		return as.startSession(ctx, user)
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return model.AuthResponse{}, ErrOIDCEmailNotVerified
+	}
+
+	user, err = as.Store.GetUserByEmail(ctx, identity.Email)
+	if err != nil {
+		return model.AuthResponse{}, err
+	}
+
+	if user != nil {
+		if !user.EmailVerified {
+			return model.AuthResponse{}, ErrOIDCAccountUnverified
+		}
+
+		if err := as.Store.CreateIdentity(ctx, user.ID, flow.Provider, identity.Subject); err != nil {
+			if errors.Is(err, storage.ErrUniqueViolation) {
+				// A concurrent login linked the account first
+				return model.AuthResponse{}, ErrUserAlreadyExists
+			}
+			return model.AuthResponse{}, err
+		}
+		return as.startSession(ctx, user)
+	}
+
+	userID, err := as.Store.CreateIdentityUser(ctx, identity.Email, flow.Provider, identity.Subject)
+	if err != nil {
+		if errors.Is(err, storage.ErrUniqueViolation) {
+			// Someone registered the address or linked the account meanwhile
+			return model.AuthResponse{}, ErrUserAlreadyExists
+		}
+		return model.AuthResponse{}, err
+	}
+
+	user, err = as.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return model.AuthResponse{}, err
+	}
+
+	if user == nil {
+		return model.AuthResponse{}, ErrUserNotFound
+	}
+
+	return as.startSession(ctx, user)
+}
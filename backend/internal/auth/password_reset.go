@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/mail"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+const (
+	passwordResetLifetime = time.Hour
+	// Another reset mail is only sent once this long has passed since the last one.
+	passwordResetCooldown = time.Minute
+)
+
+// RequestPasswordReset mails the user a single-use link to set a new
+// password. Unknown emails succeed silently so the endpoint can't be used to
+// find out who has an account; mail failures are only logged for the same
+// reason.
+func (as *AuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	if _, err := netmail.ParseAddress(email); err != nil {
+		return ErrInvalidEmail
+	}
+
+	user, err := as.Store.GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	token, err := GenerateRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	created, err := as.Store.CreatePasswordResetToken(ctx, user.ID, HashRefreshToken(token), now.Add(passwordResetLifetime), now.Add(-passwordResetCooldown))
+	if err != nil {
+		return err
+	}
+
+	if !created {
+		return nil
+	}
+
+	if err := as.mailer().Send(ctx, passwordResetMessage(user.Email, as.link("/reset-password", token))); err != nil {
+		log.Printf("auth: failed to send password reset mail to user %d: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset.
+// Every session of the user is logged out, since whoever held them may be
+// the reason for the reset.
+func (as *AuthService) ResetPassword(ctx context.Context, token string, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+
+	if token == "" {
+		return ErrInvalidResetToken
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	reset, err := as.Store.ResetPassword(ctx, HashRefreshToken(token), string(passwordHash))
+	if err != nil {
+		return err
+	}
+
+	if !reset {
+		return ErrInvalidResetToken
+	}
+
+	return nil
+}
+
+func (as *AuthService) mailer() mail.Mailer {
+	if as.Mailer == nil {
+		return mail.LogMailer{}
+	}
+	return as.Mailer
+}
+
+// link builds a frontend URL carrying a token for emailed links.
+func (as *AuthService) link(path string, token string) string {
+	return strings.TrimRight(as.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+func passwordResetMessage(to string, link string) mail.Message {
+	return mail.Message{
+		To:      to,
+		Subject: "Reset your Shrinks password",
+		Body: fmt.Sprintf(
+			"We received a request to reset the password for your Shrinks account.\n\n"+
+				"Choose a new password here within the next hour:\n%s\n\n"+
+				"If you didn't ask for this, you can ignore this email and your password won't change.\n",
+			link,
+		),
+	}
+}
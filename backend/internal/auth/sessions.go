@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/util"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+const sessionClientContextKey contextKey = "session_client"
+
+// WithSessionClient records the client a login or refresh comes from. It is
+// stored with the refresh token issued to it, for the sessions list.
+func WithSessionClient(ctx context.Context, client model.SessionClient) context.Context {
+	return context.WithValue(ctx, sessionClientContextKey, client)
+}
+
+func GetSessionClientFromContext(ctx context.Context) model.SessionClient {
+	client, _ := ctx.Value(sessionClientContextKey).(model.SessionClient)
+	return client
+}
+
+// ListSessions returns the user's active logins. The one the given refresh
+// token belongs to, if any, is marked current.
+func (as *AuthService) ListSessions(ctx context.Context, userID uint64, currentRefreshToken string) ([]model.Session, error) {
+	sessions, err := as.Store.ListUserSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	currentFamily, err := as.sessionID(ctx, userID, currentRefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		info := util.ParseUserAgent(sessions[i].UserAgent)
+		sessions[i].DeviceType = info.DeviceType
+		sessions[i].Browser = strings.TrimSpace(info.Browser)
+		sessions[i].OS = info.OS
+		sessions[i].Current = sessions[i].ID == currentFamily
+	}
+
+	return sessions, nil
+}
+
+// sessionID returns the session a refresh token belongs to, or "" when the
+// token is empty, unknown or someone else's.
+func (as *AuthService) sessionID(ctx context.Context, userID uint64, refreshToken string) (string, error) {
+	if refreshToken == "" {
+		return "", nil
+	}
+
+	token, err := as.Store.GetRefreshToken(ctx, HashRefreshToken(refreshToken))
+	if err != nil {
+		return "", err
+	}
+
+	if token == nil || token.UserID != userID {
+		return "", nil
+	}
+
+	return token.FamilyID, nil
+}
+
+// RevokeSession logs one of the user's sessions out. Access tokens already
+// issued to it stay valid until they expire.
+func (as *AuthService) RevokeSession(ctx context.Context, userID uint64, sessionID string) error {
+	deleted, err := as.Store.DeleteUserSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if !deleted {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// LogoutEverywhere revokes every session of the user, including the current one.
+func (as *AuthService) LogoutEverywhere(ctx context.Context, userID uint64) error {
+	return as.Store.DeleteUserRefreshTokens(ctx, userID)
+}
+
+// PruneRefreshTokens deletes expired sessions and the rotated tokens of live
+// ones once they are past refreshTokenLifetime, so the table doesn't grow
+// with every refresh.
+func (as *AuthService) PruneRefreshTokens(ctx context.Context) (int64, error) {
+	deleted, err := as.Store.PruneRefreshTokens(ctx, time.Now().Add(-refreshTokenLifetime))
+	if err != nil {
+		log.Printf("auth: failed to prune refresh tokens: %v", err)
+		return 0, err
+	}
+
+	log.Printf("auth: pruned %d refresh tokens", deleted)
+	return deleted, nil
+}
+
+// RunRefreshTokenCleanup prunes once at startup and then every interval until
+// ctx is done. Replicas running it concurrently only contend on the same rows.
+func (as *AuthService) RunRefreshTokenCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, _ = as.PruneRefreshTokens(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/mail"
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/totp"
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled      = errors.New("two-factor enrollment was not started")
+	ErrInvalidTwoFactorCode      = errors.New("invalid two-factor code")
+	ErrInvalidTwoFactorChallenge = errors.New("login challenge is invalid or expired")
+)
+
+const (
+	// Names the account in authenticator apps
+	totpIssuer = "Shrinks"
+
+	twoFactorChallengeLifetime = 5 * time.Minute
+	// Wrong codes allowed across a user's unexpired challenges
+	maxTwoFactorAttempts = 5
+
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 10 // 16 base32 characters
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollTwoFactor starts setting up an authenticator app with a new secret.
+// Nothing changes at login until ActivateTwoFactor confirms the app works.
+func (as *AuthService) EnrollTwoFactor(ctx context.Context, userID uint64, currentPassword string) (model.EnrollTwoFactorResponse, error) {
+	user, err := as.checkPassword(ctx, userID, currentPassword)
+	if err != nil {
+		return model.EnrollTwoFactorResponse{}, err
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return model.EnrollTwoFactorResponse{}, err
+	}
+
+	stored, err := as.Store.SetTOTPSecret(ctx, userID, secret)
+	if err != nil {
+		return model.EnrollTwoFactorResponse{}, err
+	}
+
+	if !stored {
+		return model.EnrollTwoFactorResponse{}, ErrTwoFactorAlreadyEnabled
+	}
+
+	return model.EnrollTwoFactorResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ActivateTwoFactor turns two-factor authentication on once the user shows
+// a code from the enrolled secret. It returns the recovery codes, which
+// aren't kept in the clear and can't be shown again.
+func (as *AuthService) ActivateTwoFactor(ctx context.Context, userID uint64, code string) (model.ActivateTwoFactorResponse, error) {
+	twoFactor, err := as.Store.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return model.ActivateTwoFactorResponse{}, err
+	}
+
+	if twoFactor == nil {
+		return model.ActivateTwoFactorResponse{}, ErrUserNotFound
+	}
+
+	if twoFactor.Enabled {
+		return model.ActivateTwoFactorResponse{}, ErrTwoFactorAlreadyEnabled
+	}
+
+	if twoFactor.Secret == "" {
+		return model.ActivateTwoFactorResponse{}, ErrTwoFactorNotEnrolled
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, normalizeCode(code), time.Now())
+	if !ok {
+		return model.ActivateTwoFactorResponse{}, ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = generateRecoveryCode()
+		if err != nil {
+			return model.ActivateTwoFactorResponse{}, err
+		}
+		hashes[i] = HashRefreshToken(normalizeCode(codes[i]))
+	}
+
+	enabled, err := as.Store.EnableTwoFactor(ctx, userID, twoFactor.Secret, step, hashes)
+	if err != nil {
+		return model.ActivateTwoFactorResponse{}, err
+	}
+
+	// Enrollment started again, or finished, since the secret was read
+	if !enabled {
+		return model.ActivateTwoFactorResponse{}, ErrTwoFactorNotEnrolled
+	}
+
+	as.notifyTwoFactorChange(ctx, userID, true)
+
+	return model.ActivateTwoFactorResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off. It takes the
+// password and a current code or recovery code, so that neither a stolen
+// session nor a stolen password is enough.
+func (as *AuthService) DisableTwoFactor(ctx context.Context, userID uint64, currentPassword string, code string) error {
+	if _, err := as.checkPassword(ctx, userID, currentPassword); err != nil {
+		return err
+	}
+
+	twoFactor, err := as.Store.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if twoFactor == nil || !twoFactor.Enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err := as.checkSecondFactor(ctx, userID, twoFactor, code); err != nil {
+		return err
+	}
+
+	if err := as.Store.DisableTwoFactor(ctx, userID); err != nil {
+		return err
+	}
+
+	as.notifyTwoFactorChange(ctx, userID, false)
+
+	return nil
+}
+
+// VerifyTwoFactorLogin finishes a login that Login answered with a
+// challenge, given a code from the authenticator app or a recovery code.
+func (as *AuthService) VerifyTwoFactorLogin(ctx context.Context, challengeToken string, code string) (model.AuthResponse, error) {
+	tokenHash := HashRefreshToken(challengeToken)
+
+	userID, err := as.Store.AttemptTwoFactorChallenge(ctx, tokenHash, maxTwoFactorAttempts)
+	if err != nil {
+		return model.AuthResponse{}, err
+	}
+
+	if userID == 0 {
+		return model.AuthResponse{}, ErrInvalidTwoFactorChallenge
+	}
+
+	user, err := as.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return model.AuthResponse{}, err
+	}
+
+	twoFactor, err := as.Store.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return model.AuthResponse{}, err
+	}
+
+	// Turned off since the challenge was issued; start over
+	if user == nil || twoFactor == nil || !twoFactor.Enabled {
+		return model.AuthResponse{}, ErrInvalidTwoFactorChallenge
+	}
+
+	if err := as.checkSecondFactor(ctx, userID, twoFactor, code); err != nil {
+		return model.AuthResponse{}, err
+	}
+
+	used, err := as.Store.DeleteTwoFactorChallenge(ctx, tokenHash)
+	if err != nil {
+		return model.AuthResponse{}, err
+	}
+
+	if !used {
+		return model.AuthResponse{}, ErrInvalidTwoFactorChallenge
+	}
+
+	return as.issueTokens(ctx, user)
+}
+
+// startSession is where every kind of login ends once the first factor is
+// proven: users with two-factor authentication get a challenge, everyone
+// else a session.
+func (as *AuthService) startSession(ctx context.Context, user *model.User) (model.AuthResponse, error) {
+	if !user.TwoFactorEnabled {
+		return as.issueTokens(ctx, user)
+	}
+
+	token, err := GenerateRefreshToken()
+	if err != nil {
+		return model.AuthResponse{}, err
+	}
+
+	expiresAt := time.Now().Add(twoFactorChallengeLifetime)
+	if err := as.Store.CreateTwoFactorChallenge(ctx, user.ID, HashRefreshToken(token), expiresAt); err != nil {
+		return model.AuthResponse{}, err
+	}
+
+	return model.AuthResponse{
+		TwoFactor: &model.TwoFactorChallenge{Token: token, ExpiresAt: expiresAt},
+	}, nil
+}
+
+// checkSecondFactor accepts a TOTP code no older than the last one used, or
+// an unused recovery code, using it up.
+func (as *AuthService) checkSecondFactor(ctx context.Context, userID uint64, twoFactor *model.TwoFactor, code string) error {
+	code = normalizeCode(code)
+
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(twoFactor.Secret, code, time.Now())
+		if !ok || step <= twoFactor.LastStep {
+			return ErrInvalidTwoFactorCode
+		}
+
+		used, err := as.Store.UseTOTPStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	if code == "" {
+		return ErrInvalidTwoFactorCode
+	}
+
+	used, err := as.Store.UseRecoveryCode(ctx, userID, HashRefreshToken(code))
+	if err != nil {
+		return err
+	}
+
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// generateRecoveryCode returns a code like ABCD-EFGH-IJKL-MNOP.
+func generateRecoveryCode() (string, error) {
+	bytes := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	encoded := recoveryCodeEncoding.EncodeToString(bytes)
+
+	groups := make([]string, 0, len(encoded)/4)
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// normalizeCode drops the spaces and dashes people type or paste along with
+// codes, and ignores case.
+func normalizeCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
+
+func (as *AuthService) notifyTwoFactorChange(ctx context.Context, userID uint64, enabled bool) {
+	user, err := as.Store.GetUserByID(ctx, userID)
+	if err != nil || user == nil {
+		log.Printf("auth: failed to load user %d to notify of two-factor change: %v", userID, err)
+		return
+	}
+
+	if err := as.mailer().Send(ctx, twoFactorChangedMessage(user.Email, enabled)); err != nil {
+		log.Printf("auth: failed to notify user %d of two-factor change: %v", userID, err)
+	}
+}
+
+func twoFactorChangedMessage(to string, enabled bool) mail.Message {
+	state := "turned off"
+	if enabled {
+		state = "turned on"
+	}
+
+	return mail.Message{
+		To:      to,
+		Subject: "Two-factor authentication was " + state,
+		Body: fmt.Sprintf(
+			"Two-factor authentication was %s for your Shrinks account.\n\n"+
+				"If you didn't make this change, reset your password from the sign in page and contact support.\n",
+			state,
+		),
+	}
+}
@@ -0,0 +1,25 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AlertLimiter keeps the anomaly detector from re-notifying an owner about
+// the same link and kind of alert on every pass.
+type AlertLimiter interface {
+	ClaimAlert(ctx context.Context, linkID uint64, kind string, cooldown time.Duration) (bool, error)
+}
+
+// ClaimAlert reports whether the caller may send the alert. The first claim
+// in a cooldown holds the key, so only one replica notifies.
+func (c *RedisCache) ClaimAlert(ctx context.Context, linkID uint64, kind string, cooldown time.Duration) (bool, error) {
+	key := fmt.Sprintf("alert:%d:%s", linkID, kind)
+
+	claimed, err := c.Client.SetNX(ctx, key, 1, cooldown).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim alert: %w", err)
+	}
+	return claimed, nil
+}
@@ -43,3 +43,47 @@ func (m *MockCache) Close() {
 		m.CloseFn()
 	}
 }
+
+type MockVisitorCounter struct {
+	AddVisitorFn    func(ctx context.Context, linkID uint64, day time.Time, visitorHash string) error
+	CountVisitorsFn func(ctx context.Context, linkID uint64, from time.Time, to time.Time) (int, error)
+	IsRepeatClickFn func(ctx context.Context, linkID uint64, visitorHash string, window time.Duration) (bool, error)
+}
+
+// Ensure MockVisitorCounter implements cache.VisitorCounter interface
+var _ VisitorCounter = (*MockVisitorCounter)(nil)
+
+func (m *MockVisitorCounter) AddVisitor(ctx context.Context, linkID uint64, day time.Time, visitorHash string) error {
+	if m.AddVisitorFn != nil {
+		return m.AddVisitorFn(ctx, linkID, day, visitorHash)
+	}
+	return nil // Default: no-op
+}
+
+func (m *MockVisitorCounter) CountVisitors(ctx context.Context, linkID uint64, from time.Time, to time.Time) (int, error) {
+	if m.CountVisitorsFn != nil {
+		return m.CountVisitorsFn(ctx, linkID, from, to)
+	}
+	return 0, nil // Default: no visitors
+}
+
+func (m *MockVisitorCounter) IsRepeatClick(ctx context.Context, linkID uint64, visitorHash string, window time.Duration) (bool, error) {
+	if m.IsRepeatClickFn != nil {
+		return m.IsRepeatClickFn(ctx, linkID, visitorHash, window)
+	}
+	return false, nil // Default: first click
+}
+
+type MockAlertLimiter struct {
+	ClaimAlertFn func(ctx context.Context, linkID uint64, kind string, cooldown time.Duration) (bool, error)
+}
+
+// Ensure MockAlertLimiter implements cache.AlertLimiter interface
+var _ AlertLimiter = (*MockAlertLimiter)(nil)
+
+func (m *MockAlertLimiter) ClaimAlert(ctx context.Context, linkID uint64, kind string, cooldown time.Duration) (bool, error) {
+	if m.ClaimAlertFn != nil {
+		return m.ClaimAlertFn(ctx, linkID, kind, cooldown)
+	}
+	return true, nil // Default: always claimed
+}
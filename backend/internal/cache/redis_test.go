@@ -222,3 +222,68 @@ func TestCache_WithUserID(t *testing.T) {
 		t.Errorf("UserID = %d, want %d", *retrieved.UserID, userID)
 	}
 }
+
+func TestVisitors_CountMergesDays(t *testing.T) {
+	if testCache == nil {
+		t.Skip("REDIS_URL not set")
+	}
+
+	ctx := context.Background()
+	linkID := uint64(999001)
+	day1 := time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+
+	for _, key := range visitorKeys(linkID, day1, day2) {
+		cleanup(key)
+		defer cleanup(key)
+	}
+
+	// "b" visits on both days and must only be counted once over the range
+	_ = testCache.AddVisitor(ctx, linkID, day1, "a")
+	_ = testCache.AddVisitor(ctx, linkID, day1, "b")
+	_ = testCache.AddVisitor(ctx, linkID, day2, "b")
+	_ = testCache.AddVisitor(ctx, linkID, day2, "c")
+
+	count, err := testCache.CountVisitors(ctx, linkID, day1, day1)
+	if err != nil {
+		t.Fatalf("CountVisitors failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Day 1 count = %d, want 2", count)
+	}
+
+	count, err = testCache.CountVisitors(ctx, linkID, day1, day2)
+	if err != nil {
+		t.Fatalf("CountVisitors failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Range count = %d, want 3", count)
+	}
+}
+
+func TestAlerts_ClaimOncePerCooldown(t *testing.T) {
+	if testCache == nil {
+		t.Skip("REDIS_URL not set")
+	}
+
+	ctx := context.Background()
+	linkID := uint64(999002)
+	cleanup("alert:999002:click_spike")
+	defer cleanup("alert:999002:click_spike")
+
+	claimed, err := testCache.ClaimAlert(ctx, linkID, "click_spike", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimAlert failed: %v", err)
+	}
+	if !claimed {
+		t.Fatal("First claim should succeed")
+	}
+
+	claimed, err = testCache.ClaimAlert(ctx, linkID, "click_spike", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimAlert failed: %v", err)
+	}
+	if claimed {
+		t.Error("Second claim within the cooldown should fail")
+	}
+}
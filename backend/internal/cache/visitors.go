@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Daily sketches are kept a little over a year so "365d" ranges still resolve.
+const visitorSketchTTL = 400 * 24 * time.Hour
+
+// VisitorCounter tracks approximate unique visitors per link and day using
+// HyperLogLog sketches, which stay at ~12KB per key regardless of traffic.
+// It also remembers recent clicks so repeats within a window can be filtered.
+type VisitorCounter interface {
+	AddVisitor(ctx context.Context, linkID uint64, day time.Time, visitorHash string) error
+	CountVisitors(ctx context.Context, linkID uint64, from time.Time, to time.Time) (int, error)
+	IsRepeatClick(ctx context.Context, linkID uint64, visitorHash string, window time.Duration) (bool, error)
+}
+
+func visitorKey(linkID uint64, day time.Time) string {
+	return fmt.Sprintf("visitors:%d:%s", linkID, day.UTC().Format("2006-01-02"))
+}
+
+// visitorKeys returns one key per UTC day in [from, to].
+func visitorKeys(linkID uint64, from time.Time, to time.Time) []string {
+	keys := []string{}
+	day := from.UTC().Truncate(24 * time.Hour)
+	for !day.After(to.UTC()) {
+		keys = append(keys, visitorKey(linkID, day))
+		day = day.Add(24 * time.Hour)
+	}
+	return keys
+}
+
+func (c *RedisCache) AddVisitor(ctx context.Context, linkID uint64, day time.Time, visitorHash string) error {
+	key := visitorKey(linkID, day)
+
+	pipe := c.Client.Pipeline()
+	pipe.PFAdd(ctx, key, visitorHash)
+	pipe.Expire(ctx, key, visitorSketchTTL)
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to add visitor to sketch: %w", err)
+	}
+	return nil
+}
+
+// CountVisitors merges the daily sketches covering the range; PFCOUNT over
+// several keys returns the cardinality of their union. Visitor hashes rotate
+// daily, so for ranges over a day that is the sum of daily unique visitors,
+// not the number of distinct people.
+func (c *RedisCache) CountVisitors(ctx context.Context, linkID uint64, from time.Time, to time.Time) (int, error) {
+	keys := visitorKeys(linkID, from, to)
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	count, err := c.Client.PFCount(ctx, keys...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count visitors: %w", err)
+	}
+	return int(count), nil
+}
+
+// IsRepeatClick reports whether the visitor already clicked the link within
+// the window. The first click in a window claims the key, so concurrent
+// replicas agree on which click counts.
+func (c *RedisCache) IsRepeatClick(ctx context.Context, linkID uint64, visitorHash string, window time.Duration) (bool, error) {
+	key := fmt.Sprintf("click:%d:%s", linkID, visitorHash)
+
+	claimed, err := c.Client.SetNX(ctx, key, 1, window).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check repeat click: %w", err)
+	}
+	return !claimed, nil
+}
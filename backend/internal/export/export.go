@@ -0,0 +1,180 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/parquet-go/parquet-go"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+// Parquet keeps the current row group in memory, so it is cut regularly to
+// keep memory flat on large exports.
+const parquetRowGroupSize = 10000
+
+// Record is the flat, stable shape of an exported click. Column names are
+// part of the contract with warehouse loaders, so only ever add to it.
+type Record struct {
+	EventID      uint64    `json:"event_id" parquet:"event_id"`
+	LinkID       uint64    `json:"link_id" parquet:"link_id"`
+	ClickedAt    time.Time `json:"clicked_at" parquet:"clicked_at,timestamp(millisecond)"`
+	IPAddress    string    `json:"ip_address" parquet:"ip_address"`
+	UserAgent    string    `json:"user_agent" parquet:"user_agent"`
+	DeviceType   string    `json:"device_type" parquet:"device_type"`
+	Browser      string    `json:"browser" parquet:"browser"`
+	OS           string    `json:"os" parquet:"os"`
+	Country      string    `json:"country" parquet:"country"`
+	Region       string    `json:"region" parquet:"region"`
+	City         string    `json:"city" parquet:"city"`
+	VisitorHash  string    `json:"visitor_hash" parquet:"visitor_hash"`
+	Filtered     bool      `json:"filtered" parquet:"filtered"`
+	FilterReason string    `json:"filter_reason" parquet:"filter_reason"`
+	Referrer     string    `json:"referrer" parquet:"referrer"`
+	Language     string    `json:"language" parquet:"language"`
+}
+
+var csvHeader = []string{
+	"event_id", "link_id", "clicked_at", "ip_address", "user_agent", "device_type", "browser",
+	"os", "country", "region", "city", "visitor_hash", "filtered", "filter_reason", "referrer",
+	"language",
+}
+
+func NewRecord(event *model.AnalyticsEvent) Record {
+	return Record{
+		EventID:      event.ID,
+		LinkID:       event.LinkID,
+		ClickedAt:    event.ClickedAt.UTC(),
+		IPAddress:    event.IPAddress,
+		UserAgent:    event.UserAgent,
+		DeviceType:   event.DeviceType,
+		Browser:      event.Browser,
+		OS:           event.OS,
+		Country:      event.Country,
+		Region:       event.Region,
+		City:         event.City,
+		VisitorHash:  event.VisitorHash,
+		Filtered:     event.Filtered,
+		FilterReason: event.FilterReason,
+		Referrer:     event.Referrer,
+		Language:     event.Language,
+	}
+}
+
+type Writer interface {
+	Write(event *model.AnalyticsEvent) error
+	// Close flushes buffered rows and, for Parquet, writes the file footer.
+	// It does not close the underlying io.Writer.
+	Close() error
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatNDJSON:
+		return &ndjsonWriter{encoder: json.NewEncoder(w)}, nil
+	case FormatParquet:
+		return &parquetWriter{writer: parquet.NewGenericWriter[Record](w)}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+}
+
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/octet-stream"
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	return &csvWriter{writer: writer}, nil
+}
+
+func (cw *csvWriter) Write(event *model.AnalyticsEvent) error {
+	record := NewRecord(event)
+	return cw.writer.Write([]string{
+		strconv.FormatUint(record.EventID, 10),
+		strconv.FormatUint(record.LinkID, 10),
+		record.ClickedAt.Format(time.RFC3339Nano),
+		record.IPAddress,
+		record.UserAgent,
+		record.DeviceType,
+		record.Browser,
+		record.OS,
+		record.Country,
+		record.Region,
+		record.City,
+		record.VisitorHash,
+		strconv.FormatBool(record.Filtered),
+		record.FilterReason,
+		record.Referrer,
+		record.Language,
+	})
+}
+
+func (cw *csvWriter) Close() error {
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (nw *ndjsonWriter) Write(event *model.AnalyticsEvent) error {
+	return nw.encoder.Encode(NewRecord(event))
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
+
+type parquetWriter struct {
+	writer  *parquet.GenericWriter[Record]
+	pending int
+}
+
+func (pw *parquetWriter) Write(event *model.AnalyticsEvent) error {
+	if _, err := pw.writer.Write([]Record{NewRecord(event)}); err != nil {
+		return fmt.Errorf("failed to write parquet row: %w", err)
+	}
+
+	pw.pending++
+	if pw.pending >= parquetRowGroupSize {
+		pw.pending = 0
+		if err := pw.writer.Flush(); err != nil {
+			return fmt.Errorf("failed to flush parquet row group: %w", err)
+		}
+	}
+	return nil
+}
+
+func (pw *parquetWriter) Close() error {
+	return pw.writer.Close()
+}
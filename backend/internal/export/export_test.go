@@ -0,0 +1,109 @@
+//go:build unit
+
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/parquet-go/parquet-go"
+)
+
+func sampleEvents() []*model.AnalyticsEvent {
+	clickedAt := time.Date(2026, 2, 1, 12, 30, 0, 0, time.UTC)
+	return []*model.AnalyticsEvent{
+		{ID: 1, LinkID: 100, IPAddress: "1.1.1.0", UserAgent: "Mozilla/5.0, \"quoted\"", DeviceType: "Desktop", Browser: "Chrome 120", OS: "Windows", Country: "GB", City: "London", ClickedAt: clickedAt},
+		{ID: 2, LinkID: 100, DeviceType: "Bot", Filtered: true, FilterReason: "bot", ClickedAt: clickedAt.Add(time.Minute)},
+	}
+}
+
+func writeAll(t *testing.T, format string) *bytes.Buffer {
+	var buf bytes.Buffer
+	writer, err := NewWriter(format, &buf)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	for _, event := range sampleEvents() {
+		if err := writer.Write(event); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return &buf
+}
+
+func TestNewWriter_CSV(t *testing.T) {
+	buf := writeAll(t, FormatCSV)
+
+	rows, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Output is not valid CSV: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Got %d rows, want header + 2", len(rows))
+	}
+	if rows[0][0] != "event_id" {
+		t.Errorf("Header starts with %s, want event_id", rows[0][0])
+	}
+	if rows[1][4] != "Mozilla/5.0, \"quoted\"" {
+		t.Errorf("user_agent = %s, want it escaped and round-tripped", rows[1][4])
+	}
+	if rows[2][12] != "true" || rows[2][13] != "bot" {
+		t.Errorf("filtered/filter_reason = %s/%s, want true/bot", rows[2][12], rows[2][13])
+	}
+}
+
+func TestNewWriter_NDJSON(t *testing.T) {
+	buf := writeAll(t, FormatNDJSON)
+
+	var records []Record
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Line is not valid JSON: %v", err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Got %d records, want 2", len(records))
+	}
+	if records[0].Country != "GB" || records[0].LinkID != 100 {
+		t.Errorf("Record = %+v, want GB click on link 100", records[0])
+	}
+}
+
+func TestNewWriter_Parquet(t *testing.T) {
+	buf := writeAll(t, FormatParquet)
+
+	records, err := parquet.Read[Record](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Output is not valid Parquet: %v", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Got %d records, want 2", len(records))
+	}
+	if !records[0].ClickedAt.Equal(sampleEvents()[0].ClickedAt) {
+		t.Errorf("ClickedAt = %v, want %v", records[0].ClickedAt, sampleEvents()[0].ClickedAt)
+	}
+	if !records[1].Filtered {
+		t.Error("Expected second record to be filtered")
+	}
+}
+
+func TestNewWriter_UnsupportedFormat(t *testing.T) {
+	_, err := NewWriter("xlsx", &bytes.Buffer{})
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Error = %v, want ErrUnsupportedFormat", err)
+	}
+}
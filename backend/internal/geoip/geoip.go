@@ -0,0 +1,64 @@
+package geoip
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+type Location struct {
+	Country string
+	Region  string
+	City    string
+}
+
+type Locator interface {
+	Lookup(ip string) (Location, error)
+	Close()
+}
+
+type MaxMindLocator struct {
+	Reader *geoip2.Reader
+}
+
+// NewMaxMindLocator opens a MaxMind City database (GeoLite2-City or GeoIP2-City).
+func NewMaxMindLocator(path string) (*MaxMindLocator, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+
+	return &MaxMindLocator{Reader: reader}, nil
+}
+
+// Lookup must be called with the raw client IP, before it is anonymized.
+func (l *MaxMindLocator) Lookup(ip string) (Location, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return Location{}, fmt.Errorf("invalid IP address: %q", ip)
+	}
+
+	record, err := l.Reader.City(parsedIP)
+	if err != nil {
+		return Location{}, fmt.Errorf("failed to look up IP: %w", err)
+	}
+
+	location := Location{
+		Country: record.Country.IsoCode,
+		City:    record.City.Names["en"],
+	}
+
+	if len(record.Subdivisions) > 0 {
+		location.Region = record.Subdivisions[0].Names["en"]
+	}
+
+	return location, nil
+}
+
+func (l *MaxMindLocator) Close() {
+	if err := l.Reader.Close(); err != nil {
+		log.Printf("geoip: failed to close database: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+//go:build unit
+
+package geoip
+
+import (
+	"testing"
+)
+
+// testdata/GeoIP2-City-Test.mmdb only contains a handful of networks:
+// 81.2.69.0/24 (London), 89.160.20.0/24 (Linköping), 216.160.83.0/24 (Milton)
+// and 2001:218::/32 (Japan, country only).
+func newTestLocator(t *testing.T) *MaxMindLocator {
+	locator, err := NewMaxMindLocator("testdata/GeoIP2-City-Test.mmdb")
+	if err != nil {
+		t.Fatalf("Failed to open fixture database: %v", err)
+	}
+	t.Cleanup(locator.Close)
+	return locator
+}
+
+func TestLookup_IPv4City(t *testing.T) {
+	locator := newTestLocator(t)
+
+	location, err := locator.Lookup("81.2.69.142")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+
+	if location.Country != "GB" {
+		t.Errorf("Country = %s, want GB", location.Country)
+	}
+	if location.Region != "England" {
+		t.Errorf("Region = %s, want England", location.Region)
+	}
+	if location.City != "London" {
+		t.Errorf("City = %s, want London", location.City)
+	}
+}
+
+func TestLookup_IPv6CountryOnly(t *testing.T) {
+	locator := newTestLocator(t)
+
+	location, err := locator.Lookup("2001:218::1")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+
+	if location.Country != "JP" {
+		t.Errorf("Country = %s, want JP", location.Country)
+	}
+	if location.Region != "" || location.City != "" {
+		t.Errorf("Expected empty region/city, got %q/%q", location.Region, location.City)
+	}
+}
+
+func TestLookup_UnknownNetwork(t *testing.T) {
+	locator := newTestLocator(t)
+
+	location, err := locator.Lookup("10.0.0.1")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+
+	if location != (Location{}) {
+		t.Errorf("Location = %+v, want empty", location)
+	}
+}
+
+func TestLookup_InvalidIP(t *testing.T) {
+	locator := newTestLocator(t)
+
+	_, err := locator.Lookup("not-an-ip")
+	if err == nil {
+		t.Error("Expected error for invalid IP")
+	}
+}
+
+func TestNewMaxMindLocator_MissingFile(t *testing.T) {
+	_, err := NewMaxMindLocator("testdata/does-not-exist.mmdb")
+	if err == nil {
+		t.Error("Expected error for missing database file")
+	}
+}
@@ -0,0 +1,22 @@
+package geoip
+
+type MockLocator struct {
+	LookupFn func(ip string) (Location, error)
+	CloseFn  func()
+}
+
+// Ensure MockLocator implements Locator interface
+var _ Locator = (*MockLocator)(nil)
+
+func (m *MockLocator) Lookup(ip string) (Location, error) {
+	if m.LookupFn != nil {
+		return m.LookupFn(ip)
+	}
+	return Location{}, nil // Default: unknown location
+}
+
+func (m *MockLocator) Close() {
+	if m.CloseFn != nil {
+		m.CloseFn()
+	}
+}
@@ -48,8 +48,8 @@ func TestMain(m *testing.M) {
 	}
 
 	testAuth = auth.NewAuthService(testStore)
-	testAnalytics = analytics.NewAnalyticsService(testStore)
-	testLink = service.NewLinkService(testStore, testCache, testAnalytics)
+	testAnalytics = analytics.NewAnalyticsService(testStore, nil)
+	testLink = service.NewLinkService(testStore, testCache, testAnalytics, nil)
 
 	os.Setenv("JWT_SECRET", "integration-test-secret")
 
@@ -147,7 +147,7 @@ func TestFullFlow_CreateClickAnalytics(t *testing.T) {
 	}
 
 	// 5. Retrieve analytics
-	summary, err := testAnalytics.RetrieveAnalytics(ctx, link.ID, "7d")
+	summary, err := testAnalytics.RetrieveAnalytics(ctx, link.ID, model.AnalyticsQuery{Period: "7d"})
 	if err != nil {
 		t.Fatalf("RetrieveAnalytics failed: %v", err)
 	}
@@ -0,0 +1,106 @@
+//go:build unit
+
+package mail
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/mail/mailtest"
+)
+
+func TestSMTPMailer_Send(t *testing.T) {
+	server := mailtest.NewServer()
+	defer server.Close()
+
+	mailer := NewSMTPMailer(server.Addr, "alerts@shrinks.test", "user", "pass")
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "owner@example.com",
+		Subject: "Click spike on abc123",
+		Body:    "Line one\n.Line starting with a dot",
+	})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Server received %d messages, want 1", len(messages))
+	}
+
+	msg := messages[0]
+	if msg.From != "alerts@shrinks.test" || len(msg.To) != 1 || msg.To[0] != "owner@example.com" {
+		t.Errorf("Envelope = %s -> %v", msg.From, msg.To)
+	}
+	if !strings.Contains(msg.Data, "Subject: Click spike on abc123") {
+		t.Errorf("Subject header missing:\n%s", msg.Data)
+	}
+	if !strings.Contains(msg.Data, "\n.Line starting with a dot") {
+		t.Errorf("Body not preserved:\n%s", msg.Data)
+	}
+	if server.Username != "user" || server.Password != "pass" {
+		t.Errorf("Auth = %s/%s, want user/pass", server.Username, server.Password)
+	}
+}
+
+func TestSMTPMailer_RejectsHeaderInjection(t *testing.T) {
+	server := mailtest.NewServer()
+	defer server.Close()
+
+	mailer := NewSMTPMailer(server.Addr, "alerts@shrinks.test", "", "")
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "owner@example.com",
+		Subject: "Hello\r\nBcc: victim@example.com",
+	})
+	if err == nil {
+		t.Fatal("Expected error for CRLF in subject")
+	}
+	if len(server.Messages()) != 0 {
+		t.Error("Nothing should have been sent")
+	}
+}
+
+func TestSMTPMailer_ConnectionRefused(t *testing.T) {
+	server := mailtest.NewServer()
+	addr := server.Addr
+	server.Close()
+
+	if err := NewSMTPMailer(addr, "a@b.test", "", "").Send(context.Background(), Message{To: "c@d.test"}); err == nil {
+		t.Error("Expected error when the server is down")
+	}
+}
+
+func TestLogMailer_RedactsTokens(t *testing.T) {
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	msg := Message{
+		To:      "owner@example.com",
+		Subject: "Reset your password",
+		Body:    "Reset it here: https://shrinks.test/reset-password?token=secret-token&lang=en\n",
+	}
+
+	if err := (LogMailer{}).Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if strings.Contains(logged.String(), "secret-token") {
+		t.Errorf("Token was logged: %s", logged.String())
+	}
+	if !strings.Contains(logged.String(), "?token=REDACTED&lang=en") {
+		t.Errorf("Log = %s, want the link with its token redacted", logged.String())
+	}
+
+	logged.Reset()
+	if err := (LogMailer{ShowTokens: true}).Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if !strings.Contains(logged.String(), "secret-token") {
+		t.Errorf("Log = %s, want the token with ShowTokens", logged.String())
+	}
+}
@@ -0,0 +1,162 @@
+// Package mailtest provides a fake SMTP server for tests, in the spirit of
+// net/http/httptest. It speaks just enough SMTP for net/smtp clients.
+package mailtest
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"strings"
+	"sync"
+)
+
+type Message struct {
+	From string
+	To   []string
+	Data string // Headers and body, with dot-stuffing removed
+}
+
+type Server struct {
+	Addr string // 127.0.0.1:port
+
+	// Credentials sent with AUTH PLAIN, if any
+	Username string
+	Password string
+
+	listener net.Listener
+	mu       sync.Mutex
+	messages []Message
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server on a random local port. Close it when done.
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("mailtest: failed to listen: " + err.Error())
+	}
+
+	s := &Server{Addr: listener.Addr().String(), listener: listener}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost ESMTP mailtest")
+
+	var msg Message
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			s.auth(line)
+			reply("235 2.7.0 Authentication successful")
+		case "MAIL":
+			msg = Message{From: addressOf(line)}
+			reply("250 OK")
+		case "RCPT":
+			msg.To = append(msg.To, addressOf(line))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			msg.Data = readData(reader)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "RSET", "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (s *Server) auth(line string) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return
+	}
+	decoded, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return
+	}
+	// identity \0 username \0 password
+	parts := strings.Split(string(decoded), "\x00")
+	if len(parts) == 3 {
+		s.mu.Lock()
+		s.Username, s.Password = parts[1], parts[2]
+		s.mu.Unlock()
+	}
+}
+
+func addressOf(line string) string {
+	start := strings.Index(line, "<")
+	end := strings.LastIndex(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+func readData(reader *bufio.Reader) string {
+	var b strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return b.String()
+		}
+		trimmed := strings.TrimRight(line, "\r\n")
+		if trimmed == "." {
+			return b.String()
+		}
+		b.WriteString(strings.TrimPrefix(trimmed, "."))
+		b.WriteString("\n")
+	}
+}
@@ -0,0 +1,33 @@
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// MockMailer records sent messages. SendFn, when set, is called instead.
+type MockMailer struct {
+	SendFn func(ctx context.Context, msg Message) error
+
+	mu   sync.Mutex
+	Sent []Message
+}
+
+var _ Mailer = (*MockMailer)(nil)
+
+func (m *MockMailer) Send(ctx context.Context, msg Message) error {
+	if m.SendFn != nil {
+		return m.SendFn(ctx, msg)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Sent = append(m.Sent, msg)
+	return nil
+}
+
+func (m *MockMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.Sent...)
+}
@@ -4,10 +4,12 @@ import "time"
 
 // User Models
 type User struct {
-	ID           uint64    `db:"id"`
-	Email        string    `db:"email"`
-	PasswordHash string    `db:"password_hash" json:"-"`
-	CreatedAt    time.Time `db:"created_at"`
+	ID               uint64    `db:"id"`
+	Email            string    `db:"email"`
+	PasswordHash     string    `db:"password_hash" json:"-"`
+	EmailVerified    bool      `db:"email_verified"`
+	TwoFactorEnabled bool      `db:"totp_enabled"`
+	CreatedAt        time.Time `db:"created_at"`
 }
 
 type RegisterRequest struct {
@@ -28,18 +30,141 @@ type LogoutRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type ConfirmPasswordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+	RefreshToken    string `json:"refresh_token"` // Session to keep logged in, for clients without the cookie
+}
+
+type ChangeEmailRequest struct {
+	CurrentPassword string `json:"current_password"`
+	Email           string `json:"email"`
+}
+
+// DeleteAccountRequest chooses what happens to the account's links:
+// "delete" (the default) or "anonymize".
+type DeleteAccountRequest struct {
+	CurrentPassword string `json:"current_password"`
+	LinkPolicy      string `json:"link_policy"`
+}
+
 type AuthResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 	User         User   `json:"user"`
+
+	// Set instead of the tokens and user when the user has two-factor
+	// authentication; the login finishes with the challenge and a code.
+	TwoFactor *TwoFactorChallenge `json:"-"`
 }
 
-type RefreshToken struct {
-	ID        uint64    `db:"id"`
-	UserID    uint64    `json:"user_id"`
-	TokenHash string    `json:"token_hash"`
+type TwoFactorChallenge struct {
+	Token     string    `json:"challenge_token"`
 	ExpiresAt time.Time `json:"expires_at"`
-	CreatedAt time.Time `db:"created_at"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"` // From the authenticator app, or a recovery code
+}
+
+// TwoFactor is a user's TOTP setup. The secret is set from enrollment on, but
+// only asked for once Enabled.
+type TwoFactor struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64 // Time step of the last accepted code
+}
+
+type EnrollTwoFactorRequest struct {
+	CurrentPassword string `json:"current_password"`
+}
+
+type EnrollTwoFactorResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI for a QR code
+}
+
+type ActivateTwoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+// ActivateTwoFactorResponse carries the recovery codes, which are only ever
+// shown here.
+type ActivateTwoFactorResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type DisableTwoFactorRequest struct {
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+}
+
+type RefreshToken struct {
+	ID        uint64     `db:"id"`
+	UserID    uint64     `json:"user_id"`
+	TokenHash string     `json:"token_hash"`
+	FamilyID  string     `db:"family_id"` // Shared by every token rotated from the same login
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `db:"rotated_at"` // Set once the token has been exchanged for a new one
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+// SessionClient is the client a refresh token was issued to.
+type SessionClient struct {
+	UserAgent string
+	IPAddress string
+}
+
+// Session is one login, made up of a refresh token family. Its ID is the
+// family ID, and device details come from the most recent refresh.
+type Session struct {
+	ID         string    `json:"id"`
+	DeviceType string    `json:"device_type"`
+	Browser    string    `json:"browser"`
+	OS         string    `json:"os"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // The session making the request
+}
+
+// APIKey is a personal key for scripts, limited to its scopes. The key itself
+// is only ever shown when it is created.
+type APIKey struct {
+	ID         uint64     `json:"id"`
+	UserID     uint64     `json:"-"`
+	Email      string     `json:"-"` // The owner's, for the claims of requests made with it
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
 }
 
 type RefreshTokenRequest struct {
@@ -47,7 +172,8 @@ type RefreshTokenRequest struct {
 }
 
 type RefreshTokenResponse struct {
-	AccessToken string `json:"access_token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"` // Replaces the one presented; cookie clients get it as a cookie instead
 }
 
 // Link Models
@@ -57,6 +183,18 @@ type Link struct {
 	ShortCode string    `db:"short_code" redis:"short_code" json:"short_code"`
 	LongURL   string    `db:"long_url" redis:"long_url" json:"long_url"`
 	CreatedAt time.Time `db:"created_at" redis:"created_at" json:"created_at"`
+
+	ConversionTracking bool `db:"conversion_tracking" redis:"conversion_tracking" json:"conversion_tracking"`
+}
+
+type ConversionTrackingRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// ConversionRequest is reported by the destination site with the click ID
+// that was appended to its URL on redirect.
+type ConversionRequest struct {
+	ClickID string `json:"click_id"`
 }
 
 type CreateLinkRequest struct {
@@ -70,27 +208,77 @@ type CreateLinkResponse struct {
 
 // Analytics Models
 type AnalyticsEvent struct {
-	ID         uint64    `db:"id"`
-	LinkID     uint64    `db:"link_id"`
-	IPAddress  string    `db:"ip_address"`
-	UserAgent  string    `db:"user_agent"`
-	DeviceType string    `db:"device_type"`
-	OS         string    `db:"os"`
-	Browser    string    `db:"browser"`
-	ClickedAt  time.Time `db:"clicked_at"`
+	ID           uint64    `db:"id"`
+	LinkID       uint64    `db:"link_id"`
+	IPAddress    string    `db:"ip_address"`
+	UserAgent    string    `db:"user_agent"`
+	DeviceType   string    `db:"device_type"`
+	OS           string    `db:"os"`
+	Browser      string    `db:"browser"`
+	Country      string    `db:"country"`
+	Region       string    `db:"region"`
+	City         string    `db:"city"`
+	Referrer     string    `db:"referrer"` // Referring host, empty for direct traffic
+	Language     string    `db:"language"` // Primary Accept-Language, e.g. "en-US"
+	VisitorHash  string    `db:"visitor_hash"`
+	Method       string    `db:"-"` // Request method, only used for filtering at ingest
+	RawUserAgent string    `db:"-"` // Request User-Agent, only used for filtering at ingest; UserAgent is empty for opted-out visitors
+	Filtered     bool      `db:"filtered"`
+	FilterReason string    `db:"filter_reason"`
+	ClickID      string    `db:"click_id"` // Only set for links with conversion tracking
+	Converted    bool      `db:"converted"`
+	ClickedAt    time.Time `db:"clicked_at"`
+}
+
+type AnalyticsQuery struct {
+	Period          string
+	Interval        string         // Bucket size for account time series: day, week or month
+	IncludeFiltered bool           // Include bot, link-preview, HEAD and repeat clicks
+	Compare         bool           // Also compute the previous period of the same length
+	Location        *time.Location // Time zone for the heatmap, UTC when nil
+}
+
+// AnalyticsExportFilter selects raw events for export. Exactly one of
+// LinkID or UserID should be set; From is inclusive and To exclusive.
+type AnalyticsExportFilter struct {
+	LinkID *uint64
+	UserID *uint64
+	From   time.Time
+	To     time.Time
 }
 
 type AnalyticsSummary struct {
-	LinkID          uint64            `db:"link_id"`
-	Period          string            `db:"period"`
-	TotalClicks     int               `db:"total_clicks"`
-	UniqueVisitors  int               `db:"unique_visitors"`
-	ClicksByDate    []ClicksByDate    `db:"clicks_by_date"`
-	ClicksByDevice  []ClicksByDevice  `db:"clicks_by_device"`
-	ClicksByBrowser []ClicksByBrowser `db:"clicks_by_browser"`
-	ClicksByOS      []ClicksByOS      `db:"clicks_by_os"`
+	LinkID           uint64               `db:"link_id"`
+	Period           string               `db:"period"`
+	TotalClicks      int                  `db:"total_clicks"`
+	FilteredClicks   int                  `db:"filtered_clicks"`
+	UniqueVisitors   int                  `db:"unique_visitors"`
+	VisitorScope     string               `db:"visitor_scope"` // How UniqueVisitors tells visitors apart, see VisitorScopeDaily
+	Conversions      int                  `db:"conversions"`
+	ConversionRate   float64              `db:"conversion_rate"` // Conversions per click, 0 without clicks
+	ClicksByDate     []ClicksByDate       `db:"clicks_by_date"`
+	ClicksByDevice   []ClicksByDevice     `db:"clicks_by_device"`
+	ClicksByBrowser  []ClicksByBrowser    `db:"clicks_by_browser"`
+	ClicksByOS       []ClicksByOS         `db:"clicks_by_os"`
+	ClicksByCountry  []ClicksByCountry    `db:"clicks_by_country"`
+	ClicksByCity     []ClicksByCity       `db:"clicks_by_city"`
+	ClicksByReferrer []ClicksByReferrer   `db:"clicks_by_referrer"`
+	ClicksByLanguage []ClicksByLanguage   `db:"clicks_by_language"`
+	Heatmap          Heatmap              `db:"heatmap"`
+	TimeZone         string               `db:"time_zone"`  // Time zone the heatmap is in
+	Comparison       *AnalyticsComparison `db:"comparison"` // Only set when AnalyticsQuery.Compare is
 }
 
+// VisitorScopeDaily means visitors are only told apart within a UTC day: the
+// visitor hash is salted per day so it can't link anyone across days. Over a
+// longer period UniqueVisitors is the sum of each day's unique visitors, and
+// a visitor returning on three days counts three times.
+const VisitorScopeDaily = "daily"
+
+// Heatmap counts clicks by day of week and hour of day: Heatmap[time.Sunday][0]
+// is Sunday midnight to 1am in the requested time zone.
+type Heatmap [7][24]int
+
 type ClicksByDate struct {
 	Date   string `db:"date"`
 	Clicks int    `db:"clicks"`
@@ -111,6 +299,173 @@ type ClicksByOS struct {
 	Clicks int    `db:"clicks"`
 }
 
+type ClicksByCountry struct {
+	Country string `db:"country"`
+	Clicks  int    `db:"clicks"`
+}
+
+type ClicksByCity struct {
+	City    string `db:"city"`
+	Country string `db:"country"`
+	Clicks  int    `db:"clicks"`
+}
+
+// AnalyticsComparison holds the change against the previous period of the
+// same length, e.g. the 7 days before a 7d summary. Clicks by date are not
+// compared since the dates of the two periods never overlap.
+type AnalyticsComparison struct {
+	PreviousFrom   time.Time        `db:"previous_from"`
+	PreviousTo     time.Time        `db:"previous_to"`
+	TotalClicks    Delta            `db:"total_clicks"`
+	UniqueVisitors Delta            `db:"unique_visitors"`
+	Conversions    Delta            `db:"conversions"`
+	Devices        []DimensionDelta `db:"devices"`
+	Browsers       []DimensionDelta `db:"browsers"`
+	OS             []DimensionDelta `db:"os"`
+	Countries      []DimensionDelta `db:"countries"`
+	Cities         []DimensionDelta `db:"cities"` // Value is "City, Country"
+	Referrers      []DimensionDelta `db:"referrers"`
+	Languages      []DimensionDelta `db:"languages"`
+}
+
+// Delta compares a count with the previous period. PercentChange is nil
+// when the previous count is zero.
+type Delta struct {
+	Current       int      `db:"current"`
+	Previous      int      `db:"previous"`
+	Change        int      `db:"change"`
+	PercentChange *float64 `db:"percent_change"`
+}
+
+type DimensionDelta struct {
+	Value string `db:"value"`
+	Delta
+}
+
+type ClicksByReferrer struct {
+	Referrer string `db:"referrer"`
+	Clicks   int    `db:"clicks"`
+}
+
+type ClicksByLanguage struct {
+	Language string `db:"language"`
+	Clicks   int    `db:"clicks"`
+}
+
+// AccountAnalytics aggregates clicks across all of a user's links. It is
+// served from the daily rollups, so filtered clicks are never included.
+type AccountAnalytics struct {
+	Period         string           `db:"period"`
+	Interval       string           `db:"interval"`
+	TotalClicks    int              `db:"total_clicks"`
+	ClicksOverTime []ClicksByDate   `db:"clicks_over_time"`
+	TopLinks       []TopLink        `db:"top_links"`
+	TopReferrers   []DimensionCount `db:"top_referrers"`
+	TopCountries   []DimensionCount `db:"top_countries"`
+	TopDevices     []DimensionCount `db:"top_devices"`
+	LinksCreated   []LinksCreated   `db:"links_created"`
+}
+
+type TopLink struct {
+	ShortCode string `db:"short_code"`
+	LongURL   string `db:"long_url"`
+	Clicks    int    `db:"clicks"`
+}
+
+// DimensionCount is a rollup dimension value (referrer host, country code,
+// device type...) with its click count.
+type DimensionCount struct {
+	Value  string `db:"value"`
+	Clicks int    `db:"clicks"`
+}
+
+type LinksCreated struct {
+	Date  string `db:"date"`
+	Links int    `db:"links"`
+}
+
+// LiveClick is what owners see on the live click stream. It leaves out the
+// IP, user agent and visitor hash.
+type LiveClick struct {
+	LinkID       uint64    `json:"link_id"`
+	ShortCode    string    `json:"short_code"`
+	DeviceType   string    `json:"device_type"`
+	Browser      string    `json:"browser"`
+	OS           string    `json:"os"`
+	Country      string    `json:"country,omitempty"`
+	City         string    `json:"city,omitempty"`
+	Filtered     bool      `json:"filtered"`
+	FilterReason string    `json:"filter_reason,omitempty"`
+	ClickedAt    time.Time `json:"clicked_at"`
+}
+
+// ShareToken grants read-only, unauthenticated access to one link's
+// analytics. Only its hash is stored, so the token itself is shown once.
+type ShareToken struct {
+	ID        uint64     `json:"id"`
+	LinkID    uint64     `json:"link_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt *time.Time `json:"expires_at"` // nil never expires
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type CreateShareTokenRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type CreateShareTokenResponse struct {
+	ShareToken
+	Token string `json:"token"`
+}
+
+// LinkTraffic summarizes one link's recent clicks for anomaly detection.
+type LinkTraffic struct {
+	LinkID         uint64
+	ShortCode      string
+	UserID         uint64
+	OwnerEmail     string
+	Clicks         int    // Unfiltered clicks in the window
+	AllClicks      int    // Including filtered traffic
+	BotClicks      int    // Filtered as bots
+	TopNetwork     string // Most common stored IP (a /24 or /48 when truncated)
+	TopNetworkHits int
+	BaselineClicks int // Unfiltered clicks over the baseline period before the window
+}
+
+// Alert kinds
+const (
+	AlertClickSpike    = "click_spike"
+	AlertSingleNetwork = "single_network"
+	AlertBotShare      = "bot_share"
+)
+
+type Alert struct {
+	Kind       string    `json:"kind"`
+	LinkID     uint64    `json:"link_id"`
+	ShortCode  string    `json:"short_code"`
+	UserID     uint64    `json:"user_id"`
+	OwnerEmail string    `json:"-"`
+	Message    string    `json:"message"`
+	Clicks     int       `json:"clicks"`
+	Window     string    `json:"window"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// AnalyticsPartition is one monthly range partition of the analytics table.
+// A zero From or To is an unbounded side (MINVALUE/MAXVALUE).
+type AnalyticsPartition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// RetentionSettings sets how many days of raw click events an account keeps.
+// A null Days reverts to DefaultDays.
+type RetentionSettings struct {
+	Days        *int `json:"days"`
+	DefaultDays int  `json:"default_days"`
+}
+
 // Global Stats Models
 type GlobalStatsResponse struct {
 	TotalLinks    int `json:"total_links"`
@@ -0,0 +1,35 @@
+package notify
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+// MockNotifier records alerts. NotifyFn, when set, is called instead.
+type MockNotifier struct {
+	NotifyFn func(ctx context.Context, alert model.Alert) error
+
+	mu     sync.Mutex
+	Alerts []model.Alert
+}
+
+var _ Notifier = (*MockNotifier)(nil)
+
+func (m *MockNotifier) Notify(ctx context.Context, alert model.Alert) error {
+	if m.NotifyFn != nil {
+		return m.NotifyFn(ctx, alert)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Alerts = append(m.Alerts, alert)
+	return nil
+}
+
+func (m *MockNotifier) Received() []model.Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]model.Alert(nil), m.Alerts...)
+}
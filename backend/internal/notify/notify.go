@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/mail"
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+type Notifier interface {
+	Notify(ctx context.Context, alert model.Alert) error
+}
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body, keyed
+// with the webhook secret, so receivers can verify it came from us.
+const SignatureHeader = "X-Shrinks-Signature"
+
+// WebhookNotifier POSTs each alert as JSON to a fixed URL.
+type WebhookNotifier struct {
+	URL    string
+	Secret []byte // Optional; no signature header when empty
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url string, secret string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:    url,
+		Secret: []byte(secret),
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert model.Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(n.Secret) > 0 {
+		mac := hmac.New(sha256.New, n.Secret)
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// EmailNotifier mails the alert to the link owner.
+type EmailNotifier struct {
+	Mailer mail.Mailer
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, alert model.Alert) error {
+	if alert.OwnerEmail == "" {
+		return nil
+	}
+
+	return n.Mailer.Send(ctx, mail.Message{
+		To:      alert.OwnerEmail,
+		Subject: fmt.Sprintf("Unusual traffic on /%s", alert.ShortCode),
+		Body: fmt.Sprintf("%s\n\nLink: /%s\nClicks in the last %s: %d\nDetected at: %s\n",
+			alert.Message, alert.ShortCode, alert.Window, alert.Clicks, alert.DetectedAt.UTC().Format(time.RFC1123)),
+	})
+}
+
+// Multi fans an alert out to every notifier, so one failing channel doesn't
+// stop the others.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, alert model.Alert) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, alert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
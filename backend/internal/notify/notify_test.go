@@ -0,0 +1,114 @@
+//go:build unit
+
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/mail"
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+func testAlert() model.Alert {
+	return model.Alert{
+		Kind:       model.AlertClickSpike,
+		LinkID:     1,
+		ShortCode:  "abc123",
+		UserID:     7,
+		OwnerEmail: "owner@example.com",
+		Message:    "Clicks are 12x the usual rate",
+		Clicks:     600,
+		Window:     "15m0s",
+		DetectedAt: time.Date(2026, 3, 28, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWebhookNotifier_SignsBody(t *testing.T) {
+	secret := "s3cret"
+	var body []byte
+	var signature string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	if err := NewWebhookNotifier(server.URL, secret).Notify(context.Background(), testAlert()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if want := hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("Signature = %q, want %q", signature, want)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("Body is not JSON: %v", err)
+	}
+	if got["kind"] != model.AlertClickSpike || got["short_code"] != "abc123" {
+		t.Errorf("Body = %v, want click_spike for abc123", got)
+	}
+	if _, ok := got["OwnerEmail"]; ok {
+		t.Error("Owner email should not be sent to the webhook")
+	}
+}
+
+func TestWebhookNotifier_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := NewWebhookNotifier(server.URL, "").Notify(context.Background(), testAlert()); err == nil {
+		t.Error("Expected error for a 500 response")
+	}
+}
+
+func TestEmailNotifier_MailsOwner(t *testing.T) {
+	mailer := &mail.MockMailer{}
+
+	if err := (&EmailNotifier{Mailer: mailer}).Notify(context.Background(), testAlert()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	sent := mailer.Messages()
+	if len(sent) != 1 {
+		t.Fatalf("Sent %d messages, want 1", len(sent))
+	}
+	if sent[0].To != "owner@example.com" {
+		t.Errorf("To = %q, want owner@example.com", sent[0].To)
+	}
+	if !strings.Contains(sent[0].Subject, "/abc123") || !strings.Contains(sent[0].Body, "12x") {
+		t.Errorf("Message = %+v, want subject and body describing the alert", sent[0])
+	}
+}
+
+func TestMulti_ContinuesPastFailures(t *testing.T) {
+	failing := &MockNotifier{NotifyFn: func(ctx context.Context, alert model.Alert) error {
+		return errors.New("boom")
+	}}
+	working := &MockNotifier{}
+
+	err := Multi{failing, working}.Notify(context.Background(), testAlert())
+	if err == nil {
+		t.Error("Expected the failing notifier's error")
+	}
+	if len(working.Received()) != 1 {
+		t.Error("Later notifiers should still receive the alert")
+	}
+}
@@ -0,0 +1,343 @@
+// Package oidc signs users in with an OpenID Connect provider using the
+// authorization code flow with PKCE. It covers what "Sign in with" needs:
+// discovery, the token exchange and ID token verification against the
+// provider's published keys.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrDiscovery      = errors.New("oidc: provider discovery failed")
+	ErrTokenExchange  = errors.New("oidc: token exchange failed")
+	ErrInvalidIDToken = errors.New("oidc: invalid ID token")
+)
+
+// Keys are refetched at most this often when a token names an unknown key,
+// which is how rotated signing keys get picked up.
+const keyRefreshInterval = time.Minute
+
+// Allowed difference between our clock and the provider's.
+const clockSkew = time.Minute
+
+type Config struct {
+	Issuer       string // Must match the issuer the provider reports exactly
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // Our callback, as registered with the provider
+}
+
+// Identity is who the provider says signed in. Subject is the provider's
+// stable user ID; the email may change.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+type Provider struct {
+	Config Config
+	Client *http.Client
+
+	mu          sync.Mutex
+	metadata    *metadata
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// NewProvider doesn't contact the provider; discovery happens on first use,
+// so a provider that is down at startup only breaks its own logins.
+func NewProvider(config Config) *Provider {
+	return &Provider{
+		Config: config,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NewVerifier returns a random PKCE code verifier. It is also suitable as a
+// state or nonce value.
+func NewVerifier() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("oidc: failed to generate verifier: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// Challenge is the S256 PKCE code challenge for a verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL is where to send the user to sign in. The provider redirects
+// back to Config.RedirectURL with the state and a code for Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.Config.ClientID},
+		"redirect_uri":          {p.Config.RedirectURL},
+		"scope":                 {"openid email"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return meta.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange trades the code from the callback for an ID token and returns the
+// identity in it, once the token is verified to be from this provider, for
+// us, and for the login that sent nonce.
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string, nonce string) (*Identity, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.Config.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {p.Config.ClientID},
+	}
+
+	// Basic auth is the default unless the provider only takes the secret in the body
+	useBasic := len(meta.TokenAuthMethods) == 0 || slices.Contains(meta.TokenAuthMethods, "client_secret_basic")
+	if !useBasic {
+		form.Set("client_secret", p.Config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenExchange, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasic {
+		req.SetBasicAuth(url.QueryEscape(p.Config.ClientID), url.QueryEscape(p.Config.ClientSecret))
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenExchange, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%w: status %d", ErrTokenExchange, resp.StatusCode)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s %s", ErrTokenExchange, body.Error, body.ErrorDescription)
+	}
+
+	if body.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token in response", ErrTokenExchange)
+	}
+
+	return p.verify(ctx, meta, body.IDToken, nonce)
+}
+
+type idTokenClaims struct {
+	Nonce           string   `json:"nonce"`
+	AuthorizedParty string   `json:"azp"`
+	Email           string   `json:"email"`
+	EmailVerified   flexBool `json:"email_verified"`
+	jwt.RegisteredClaims
+}
+
+// flexBool accepts true as well as "true"; some providers send the string.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		*b = flexBool(v)
+	case string:
+		*b = flexBool(v == "true")
+	}
+	return nil
+}
+
+func (p *Provider) verify(ctx context.Context, meta *metadata, idToken string, nonce string) (*Identity, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.key(ctx, meta, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.Config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	if claims.AuthorizedParty != "" && claims.AuthorizedParty != p.Config.ClientID {
+		return nil, fmt.Errorf("%w: issued to another client", ErrInvalidIDToken)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+
+	return &Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+	}, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var meta metadata
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.Config.Issuer, "/")+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	if meta.Issuer != p.Config.Issuer {
+		return nil, fmt.Errorf("%w: issuer is %q, want %q", ErrDiscovery, meta.Issuer, p.Config.Issuer)
+	}
+
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: missing endpoints", ErrDiscovery)
+	}
+
+	p.metadata = &meta
+	return p.metadata, nil
+}
+
+// key returns the provider's signing key with the given ID, fetching the key
+// set again if it isn't known yet.
+func (p *Provider) key(ctx context.Context, meta *metadata, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetched) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", target, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,123 @@
+//go:build unit
+
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:3000/api/v1/auth/oidc/test/callback"
+
+func newTestProvider(t *testing.T) (*oidctest.Server, *Provider) {
+	t.Helper()
+
+	server := oidctest.NewServer("shrinks", "client-secret")
+	t.Cleanup(server.Close)
+	server.SetUser(oidctest.User{Subject: "user-1", Email: "user@example.com", EmailVerified: true})
+
+	provider := NewProvider(Config{
+		Issuer:       server.URL,
+		ClientID:     "shrinks",
+		ClientSecret: "client-secret",
+		RedirectURL:  redirectURL,
+	})
+	return server, provider
+}
+
+// login runs the browser side of the flow and returns the callback's code
+// and state.
+func login(t *testing.T, server *oidctest.Server, provider *Provider, state string, nonce string, verifier string) (string, string) {
+	t.Helper()
+
+	authURL, err := provider.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+
+	parsed, _ := url.Parse(authURL)
+	if got := parsed.Query().Get("code_challenge"); got != Challenge(verifier) {
+		t.Errorf("code_challenge = %q, want %q", got, Challenge(verifier))
+	}
+
+	callback, err := server.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize failed: %v", err)
+	}
+	if callback.Scheme+"://"+callback.Host+callback.Path != redirectURL {
+		t.Errorf("Redirected to %s, want %s", callback, redirectURL)
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func TestProvider_Login(t *testing.T) {
+	server, provider := newTestProvider(t)
+
+	verifier, _ := NewVerifier()
+	code, state := login(t, server, provider, "state-1", "nonce-1", verifier)
+	if state != "state-1" {
+		t.Errorf("State = %q, want state-1", state)
+	}
+
+	identity, err := provider.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if identity.Subject != "user-1" || identity.Email != "user@example.com" || !identity.EmailVerified {
+		t.Errorf("Identity = %+v", identity)
+	}
+
+	// Codes only work once
+	if _, err := provider.Exchange(context.Background(), code, verifier, "nonce-1"); !errors.Is(err, ErrTokenExchange) {
+		t.Errorf("Reused code error = %v, want ErrTokenExchange", err)
+	}
+}
+
+func TestProvider_Exchange_Rejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(server *oidctest.Server, provider *Provider)
+		swap    bool // Exchange with a different verifier than the login used
+		nonce   string
+		wantErr error
+	}{
+		{"wrong verifier", nil, true, "nonce-1", ErrTokenExchange},
+		{"wrong nonce", nil, false, "nonce-2", ErrInvalidIDToken},
+		{"replayed nonce", func(server *oidctest.Server, provider *Provider) { server.Nonce = "other" }, false, "nonce-1", ErrInvalidIDToken},
+		{"other audience", func(server *oidctest.Server, provider *Provider) { server.Audience = "someone-else" }, false, "nonce-1", ErrInvalidIDToken},
+		{"wrong secret", func(server *oidctest.Server, provider *Provider) { provider.Config.ClientSecret = "guess" }, false, "nonce-1", ErrTokenExchange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, provider := newTestProvider(t)
+			if tt.setup != nil {
+				tt.setup(server, provider)
+			}
+
+			verifier, _ := NewVerifier()
+			code, _ := login(t, server, provider, "state-1", "nonce-1", verifier)
+
+			if tt.swap {
+				verifier, _ = NewVerifier()
+			}
+
+			if _, err := provider.Exchange(context.Background(), code, verifier, tt.nonce); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Exchange error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProvider_DiscoveryIssuerMismatch(t *testing.T) {
+	server, provider := newTestProvider(t)
+	provider.Config.Issuer = server.URL + "/"
+
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); !errors.Is(err, ErrDiscovery) {
+		t.Errorf("AuthCodeURL error = %v, want ErrDiscovery", err)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/Unhyphenated/shrinks-backend/internal/cache"
 	"github.com/Unhyphenated/shrinks-backend/internal/model"
 	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+	"github.com/Unhyphenated/shrinks-backend/internal/stream"
 )
 
 var (
@@ -30,19 +31,23 @@ type LinkProvider interface {
 	DeleteLink(ctx context.Context, shortCode string, userID uint64) error
 	GetGlobalStats(ctx context.Context) (*model.GlobalStatsResponse, error)
 	RecordEventBackground(shortCode string, link *model.Link, e *model.AnalyticsEvent)
+	SetConversionTracking(ctx context.Context, link *model.Link, enabled bool) error
 }
 
 type LinkService struct {
 	Store     storage.LinkStore // The Store interface is the dependency
 	Cache     cache.Cache
 	Analytics analytics.AnalyticsProvider
+	Live      stream.Publisher         // Optional; feeds the live click stream
+	ClickIDs  *analytics.ClickIDSigner // Optional; required for conversion tracking
 }
 
-func NewLinkService(s storage.LinkStore, c cache.Cache, a analytics.AnalyticsProvider) *LinkService {
+func NewLinkService(s storage.LinkStore, c cache.Cache, a analytics.AnalyticsProvider, l stream.Publisher) *LinkService {
 	return &LinkService{
 		Store:     s,
 		Cache:     c,
 		Analytics: a,
+		Live:      l,
 	}
 }
 
@@ -68,8 +73,9 @@ func (ls *LinkService) Redirect(ctx context.Context, shortCode string, event *mo
 
 	// Cache hit
 	if link != nil {
+		destination := ls.destination(link, event)
 		go ls.RecordEventBackground(shortCode, link, event)
-		return link.LongURL, nil
+		return destination, nil
 	}
 
 	// Check if link is in DB
@@ -82,9 +88,29 @@ func (ls *LinkService) Redirect(ctx context.Context, shortCode string, event *mo
 		return "", ErrLinkNotFound
 	}
 
+	destination := ls.destination(link, event)
 	go ls.RecordEventBackground(shortCode, link, event)
 
-	return link.LongURL, nil
+	return destination, nil
+}
+
+// destination appends a signed click ID for links with conversion tracking
+// and keeps it on the event, so a reported conversion matches the click.
+func (ls *LinkService) destination(link *model.Link, event *model.AnalyticsEvent) string {
+	if !link.ConversionTracking || ls.ClickIDs == nil {
+		return link.LongURL
+	}
+
+	clickID, err := ls.ClickIDs.Sign(link.ID, time.Now())
+	if err != nil {
+		log.Printf("failed to sign click ID: %v", err)
+		return link.LongURL
+	}
+
+	if event != nil {
+		event.ClickID = clickID
+	}
+	return analytics.AppendClickID(link.LongURL, clickID)
 }
 
 func (ls *LinkService) GetLinkByCode(ctx context.Context, shortCode string) (*model.Link, error) {
@@ -114,6 +140,23 @@ func (ls *LinkService) DeleteLink(ctx context.Context, shortCode string, userID
 	return nil
 }
 
+func (ls *LinkService) SetConversionTracking(ctx context.Context, link *model.Link, enabled bool) error {
+	err := ls.Store.SetConversionTracking(ctx, link.ID, enabled)
+	if err != nil {
+		return fmt.Errorf("failed to set conversion tracking: %w", err)
+	}
+
+	if ls.Cache != nil {
+		err = ls.Cache.Delete(ctx, link.ShortCode)
+		if err != nil {
+			return fmt.Errorf("failed to delete link from cache: %w", err)
+		}
+	}
+
+	link.ConversionTracking = enabled
+	return nil
+}
+
 func (ls *LinkService) GetGlobalStats(ctx context.Context) (*model.GlobalStatsResponse, error) {
 	totalLinks, err := ls.Store.GetTotalLinks(ctx)
 	if err != nil {
@@ -146,6 +189,24 @@ func (ls *LinkService) RecordEventBackground(shortCode string, link *model.Link,
 		if err := ls.Analytics.RecordEvent(bgCtx, &eCopy); err != nil {
 			log.Printf("failed to record analytics event: %v", err)
 		}
+
+		if ls.Live != nil {
+			click := model.LiveClick{
+				LinkID:       link.ID,
+				ShortCode:    shortCode,
+				DeviceType:   eCopy.DeviceType,
+				Browser:      eCopy.Browser,
+				OS:           eCopy.OS,
+				Country:      eCopy.Country,
+				City:         eCopy.City,
+				Filtered:     eCopy.Filtered,
+				FilterReason: eCopy.FilterReason,
+				ClickedAt:    eCopy.ClickedAt,
+			}
+			if err := ls.Live.Publish(bgCtx, click); err != nil {
+				log.Printf("failed to publish live click: %v", err)
+			}
+		}
 	}
 }
 
@@ -5,6 +5,7 @@ package service
 import (
 	"context"
 	"errors"
+	"net/url"
 	"testing"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/Unhyphenated/shrinks-backend/internal/cache"
 	"github.com/Unhyphenated/shrinks-backend/internal/model"
 	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+	"github.com/Unhyphenated/shrinks-backend/internal/stream"
 )
 
 // ===== MOCKS =====
@@ -47,7 +49,7 @@ func TestShorten_Success(t *testing.T) {
 		return "abc123", nil
 	}
 
-	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics())
+	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics(), nil)
 
 	code, err := svc.Shorten(context.Background(), "https://example.com", nil)
 	if err != nil {
@@ -69,7 +71,7 @@ func TestShorten_WithUserID(t *testing.T) {
 		return "xyz789", nil
 	}
 
-	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics())
+	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics(), nil)
 
 	userID := uint64(42)
 	_, err := svc.Shorten(context.Background(), "https://example.com", &userID)
@@ -105,7 +107,7 @@ func TestRedirect_CacheHit(t *testing.T) {
 		}, nil
 	}
 
-	svc := NewLinkService(mockStore, mockCache, newMockAnalytics())
+	svc := NewLinkService(mockStore, mockCache, newMockAnalytics(), nil)
 
 	url, err := svc.Redirect(context.Background(), "cached", nil)
 	if err != nil {
@@ -146,7 +148,7 @@ func TestRedirect_CacheMiss_DBHit(t *testing.T) {
 		return nil
 	}
 
-	svc := NewLinkService(mockStore, mockCache, newMockAnalytics())
+	svc := NewLinkService(mockStore, mockCache, newMockAnalytics(), nil)
 
 	url, err := svc.Redirect(context.Background(), "fromdb", nil)
 	if err != nil {
@@ -177,7 +179,7 @@ func TestRedirect_NotFound(t *testing.T) {
 		return nil, nil // Cache miss
 	}
 
-	svc := NewLinkService(mockStore, mockCache, newMockAnalytics())
+	svc := NewLinkService(mockStore, mockCache, newMockAnalytics(), nil)
 
 	_, err := svc.Redirect(context.Background(), "nonexistent", nil)
 
@@ -211,7 +213,7 @@ func TestRedirect_RecordsAnalytics(t *testing.T) {
 		return nil
 	}
 
-	svc := NewLinkService(mockStore, mockCache, mockAnalytics)
+	svc := NewLinkService(mockStore, mockCache, mockAnalytics, nil)
 
 	event := &model.AnalyticsEvent{
 		IPAddress:  "1.2.3.0",
@@ -251,7 +253,7 @@ func TestGetGlobalStats_Success(t *testing.T) {
 		return 56789, nil
 	}
 
-	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics())
+	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics(), nil)
 
 	stats, err := svc.GetGlobalStats(context.Background())
 	if err != nil {
@@ -277,7 +279,7 @@ func TestGetGlobalStats_LinksError(t *testing.T) {
 		return 100, nil
 	}
 
-	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics())
+	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics(), nil)
 
 	_, err := svc.GetGlobalStats(context.Background())
 	if err == nil {
@@ -295,7 +297,7 @@ func TestGetGlobalStats_RequestsError(t *testing.T) {
 		return 0, errors.New("database error")
 	}
 
-	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics())
+	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics(), nil)
 
 	_, err := svc.GetGlobalStats(context.Background())
 	if err == nil {
@@ -305,7 +307,7 @@ func TestGetGlobalStats_RequestsError(t *testing.T) {
 
 func TestShorten_InvalidURL(t *testing.T) {
 	mockStore := newMockStore()
-	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics())
+	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics(), nil)
 	tests := []struct {
 		name    string
 		url     string
@@ -335,7 +337,7 @@ func TestShorten_InvalidURL(t *testing.T) {
 func TestShorten_ValidURLs(t *testing.T) {
 	mockStore := newMockStore()
 	mockStore.SaveLinkFn = func(ctx context.Context, longURL string, userID *uint64) (string, error) { return "abc123", nil }
-	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics())
+	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics(), nil)
 	validURLs := []string{"http://example.com", "https://example.com", "https://example.com/path", "https://example.com/path?query=1", "https://sub.example.com", "http://localhost:8080", "https://example.com:443/path"}
 	for _, url := range validURLs {
 		t.Run(url, func(t *testing.T) {
@@ -349,3 +351,123 @@ func TestShorten_ValidURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestRecordEventBackground_PublishesLiveClick(t *testing.T) {
+	broker := stream.NewBroker(10, 10)
+	sub, _ := broker.Subscribe(1, 99)
+
+	svc := NewLinkService(newMockStore(), newMockCache(), newMockAnalytics(), broker)
+
+	link := &model.Link{ID: 99, ShortCode: "live"}
+	event := &model.AnalyticsEvent{IPAddress: "1.2.3.0", DeviceType: "Mobile", Country: "GB"}
+
+	svc.RecordEventBackground("live", link, event)
+
+	select {
+	case click := <-sub.C:
+		if click.ShortCode != "live" || click.DeviceType != "Mobile" || click.Country != "GB" {
+			t.Errorf("Click = %+v, want live/Mobile/GB", click)
+		}
+		if click.ClickedAt.IsZero() {
+			t.Error("Expected ClickedAt to be set")
+		}
+	default:
+		t.Fatal("Expected a live click to be published")
+	}
+}
+
+func TestRedirect_ConversionTrackingAppendsClickID(t *testing.T) {
+	recorded := make(chan *model.AnalyticsEvent, 1)
+
+	mockStore := newMockStore()
+	mockStore.GetLinkByCodeFn = func(ctx context.Context, code string) (*model.Link, error) {
+		return &model.Link{ID: 42, ShortCode: "conv", LongURL: "https://shop.example.com/p?utm_source=x#top", ConversionTracking: true}, nil
+	}
+
+	mockAnalytics := newMockAnalytics()
+	mockAnalytics.RecordEventFn = func(ctx context.Context, event *model.AnalyticsEvent) error {
+		recorded <- event
+		return nil
+	}
+
+	signer := analytics.NewClickIDSigner("test-secret")
+	svc := NewLinkService(mockStore, newMockCache(), mockAnalytics, nil)
+	svc.ClickIDs = signer
+
+	destination, err := svc.Redirect(context.Background(), "conv", &model.AnalyticsEvent{DeviceType: "Desktop"})
+	if err != nil {
+		t.Fatalf("Redirect failed: %v", err)
+	}
+
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		t.Fatalf("Destination %q does not parse: %v", destination, err)
+	}
+	if parsed.Query().Get("utm_source") != "x" || parsed.Fragment != "top" {
+		t.Errorf("Destination = %s, want existing query and fragment kept", destination)
+	}
+
+	clickID := parsed.Query().Get(analytics.ClickIDParam)
+	linkID, err := signer.Verify(clickID, time.Now())
+	if err != nil || linkID != 42 {
+		t.Errorf("Verify(%q) = %d, %v, want link 42", clickID, linkID, err)
+	}
+
+	select {
+	case event := <-recorded:
+		if event.ClickID != clickID {
+			t.Errorf("Event ClickID = %q, want %q", event.ClickID, clickID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Analytics event was not recorded")
+	}
+}
+
+func TestRedirect_ConversionTrackingDisabled(t *testing.T) {
+	mockStore := newMockStore()
+	mockStore.GetLinkByCodeFn = func(ctx context.Context, code string) (*model.Link, error) {
+		return &model.Link{ID: 42, ShortCode: "plain", LongURL: "https://example.com"}, nil
+	}
+
+	svc := NewLinkService(mockStore, newMockCache(), newMockAnalytics(), nil)
+	svc.ClickIDs = analytics.NewClickIDSigner("test-secret")
+
+	destination, err := svc.Redirect(context.Background(), "plain", nil)
+	if err != nil {
+		t.Fatalf("Redirect failed: %v", err)
+	}
+	if destination != "https://example.com" {
+		t.Errorf("Destination = %s, want the long URL untouched", destination)
+	}
+}
+
+func TestSetConversionTracking_InvalidatesCache(t *testing.T) {
+	var deleted string
+
+	mockStore := newMockStore()
+	mockStore.SetConversionTrackingFn = func(ctx context.Context, linkID uint64, enabled bool) error {
+		if linkID != 7 || !enabled {
+			t.Errorf("SetConversionTracking(%d, %v), want (7, true)", linkID, enabled)
+		}
+		return nil
+	}
+
+	mockCache := newMockCache()
+	mockCache.DeleteFn = func(ctx context.Context, key string) error {
+		deleted = key
+		return nil
+	}
+
+	svc := NewLinkService(mockStore, mockCache, newMockAnalytics(), nil)
+
+	link := &model.Link{ID: 7, ShortCode: "abc"}
+	if err := svc.SetConversionTracking(context.Background(), link, true); err != nil {
+		t.Fatalf("SetConversionTracking failed: %v", err)
+	}
+	if deleted != "abc" {
+		t.Errorf("Deleted cache key %q, want abc", deleted)
+	}
+	if !link.ConversionTracking {
+		t.Error("Link should reflect the new setting")
+	}
+}
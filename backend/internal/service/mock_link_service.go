@@ -14,6 +14,7 @@ type MockLinkService struct {
 	DeleteLinkFn            func(ctx context.Context, shortCode string, userID uint64) error
 	GetGlobalStatsFn        func(ctx context.Context) (*model.GlobalStatsResponse, error)
 	RecordEventBackgroundFn func(shortCode string, link *model.Link, e *model.AnalyticsEvent)
+	SetConversionTrackingFn func(ctx context.Context, link *model.Link, enabled bool) error
 }
 
 func (m *MockLinkService) Shorten(ctx context.Context, longURL string, userID *uint64) (string, error) {
@@ -63,3 +64,10 @@ func (m *MockLinkService) RecordEventBackground(shortCode string, link *model.Li
 		m.RecordEventBackgroundFn(shortCode, link, e)
 	}
 }
+
+func (m *MockLinkService) SetConversionTracking(ctx context.Context, link *model.Link, enabled bool) error {
+	if m.SetConversionTrackingFn != nil {
+		return m.SetConversionTrackingFn(ctx, link, enabled)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+type MockShareService struct {
+	CreateShareTokenFn  func(ctx context.Context, linkID uint64, expiresAt *time.Time) (*model.CreateShareTokenResponse, error)
+	ListShareTokensFn   func(ctx context.Context, linkID uint64) ([]model.ShareToken, error)
+	RevokeShareTokenFn  func(ctx context.Context, linkID uint64, id uint64) error
+	ResolveShareTokenFn func(ctx context.Context, token string) (*model.ShareToken, error)
+}
+
+var _ ShareProvider = (*MockShareService)(nil)
+
+func (m *MockShareService) CreateShareToken(ctx context.Context, linkID uint64, expiresAt *time.Time) (*model.CreateShareTokenResponse, error) {
+	if m.CreateShareTokenFn != nil {
+		return m.CreateShareTokenFn(ctx, linkID, expiresAt)
+	}
+	return &model.CreateShareTokenResponse{}, nil
+}
+
+func (m *MockShareService) ListShareTokens(ctx context.Context, linkID uint64) ([]model.ShareToken, error) {
+	if m.ListShareTokensFn != nil {
+		return m.ListShareTokensFn(ctx, linkID)
+	}
+	return []model.ShareToken{}, nil
+}
+
+func (m *MockShareService) RevokeShareToken(ctx context.Context, linkID uint64, id uint64) error {
+	if m.RevokeShareTokenFn != nil {
+		return m.RevokeShareTokenFn(ctx, linkID, id)
+	}
+	return nil
+}
+
+func (m *MockShareService) ResolveShareToken(ctx context.Context, token string) (*model.ShareToken, error) {
+	if m.ResolveShareTokenFn != nil {
+		return m.ResolveShareTokenFn(ctx, token)
+	}
+	return nil, ErrShareTokenNotFound
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+var (
+	ErrShareTokenNotFound = errors.New("share token not found")
+	ErrShareExpiryInPast  = errors.New("expiry must be in the future")
+)
+
+type ShareProvider interface {
+	CreateShareToken(ctx context.Context, linkID uint64, expiresAt *time.Time) (*model.CreateShareTokenResponse, error)
+	ListShareTokens(ctx context.Context, linkID uint64) ([]model.ShareToken, error)
+	RevokeShareToken(ctx context.Context, linkID uint64, id uint64) error
+	ResolveShareToken(ctx context.Context, token string) (*model.ShareToken, error)
+}
+
+// ShareService manages share tokens. Callers check link ownership before
+// creating, listing or revoking.
+type ShareService struct {
+	Store storage.ShareStore
+}
+
+func NewShareService(s storage.ShareStore) *ShareService {
+	return &ShareService{Store: s}
+}
+
+func (ss *ShareService) CreateShareToken(ctx context.Context, linkID uint64, expiresAt *time.Time) (*model.CreateShareTokenResponse, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrShareExpiryInPast
+	}
+
+	token, err := generateShareToken()
+	if err != nil {
+		return nil, err
+	}
+
+	shareToken, err := ss.Store.CreateShareToken(ctx, linkID, hashShareToken(token), expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.CreateShareTokenResponse{ShareToken: *shareToken, Token: token}, nil
+}
+
+func (ss *ShareService) ListShareTokens(ctx context.Context, linkID uint64) ([]model.ShareToken, error) {
+	return ss.Store.ListShareTokens(ctx, linkID)
+}
+
+func (ss *ShareService) RevokeShareToken(ctx context.Context, linkID uint64, id uint64) error {
+	err := ss.Store.DeleteShareToken(ctx, linkID, id)
+	if errors.Is(err, storage.ErrShareTokenNotFound) {
+		return ErrShareTokenNotFound
+	}
+	return err
+}
+
+// ResolveShareToken returns ErrShareTokenNotFound for unknown, revoked and
+// expired tokens alike, so viewers can't tell them apart.
+func (ss *ShareService) ResolveShareToken(ctx context.Context, token string) (*model.ShareToken, error) {
+	shareToken, err := ss.Store.GetShareToken(ctx, hashShareToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if shareToken == nil {
+		return nil, ErrShareTokenNotFound
+	}
+
+	if shareToken.ExpiresAt != nil && !shareToken.ExpiresAt.After(time.Now()) {
+		return nil, ErrShareTokenNotFound
+	}
+
+	return shareToken, nil
+}
+
+// 32 random bytes, URL-safe so the token can go straight into a path.
+func generateShareToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+func hashShareToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
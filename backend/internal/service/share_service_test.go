@@ -0,0 +1,99 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/Unhyphenated/shrinks-backend/internal/storage"
+)
+
+func TestShareService_CreateStoresOnlyHash(t *testing.T) {
+	var storedHash string
+	store := &storage.MockStore{
+		CreateShareTokenFn: func(ctx context.Context, linkID uint64, tokenHash string, expiresAt *time.Time) (*model.ShareToken, error) {
+			storedHash = tokenHash
+			return &model.ShareToken{ID: 5, LinkID: linkID, TokenHash: tokenHash, ExpiresAt: expiresAt}, nil
+		},
+	}
+
+	svc := NewShareService(store)
+
+	resp, err := svc.CreateShareToken(context.Background(), 100, nil)
+	if err != nil {
+		t.Fatalf("CreateShareToken failed: %v", err)
+	}
+
+	if len(resp.Token) < 40 {
+		t.Errorf("Token %q is too short to be unguessable", resp.Token)
+	}
+	if storedHash == resp.Token || storedHash != hashShareToken(resp.Token) {
+		t.Error("Store should get the token hash, not the token")
+	}
+	if resp.ID != 5 || resp.LinkID != 100 {
+		t.Errorf("Response = %+v, want ID 5 for link 100", resp)
+	}
+
+	other, _ := svc.CreateShareToken(context.Background(), 100, nil)
+	if other.Token == resp.Token {
+		t.Error("Tokens should be unique")
+	}
+}
+
+func TestShareService_CreateRejectsPastExpiry(t *testing.T) {
+	svc := NewShareService(&storage.MockStore{})
+
+	past := time.Now().Add(-time.Minute)
+	_, err := svc.CreateShareToken(context.Background(), 100, &past)
+	if !errors.Is(err, ErrShareExpiryInPast) {
+		t.Errorf("err = %v, want ErrShareExpiryInPast", err)
+	}
+}
+
+func TestShareService_Resolve(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tokens := map[string]*model.ShareToken{
+		hashShareToken("valid"):   {ID: 1, LinkID: 100, ExpiresAt: &future},
+		hashShareToken("forever"): {ID: 2, LinkID: 100},
+		hashShareToken("expired"): {ID: 3, LinkID: 100, ExpiresAt: &past},
+	}
+	store := &storage.MockStore{
+		GetShareTokenFn: func(ctx context.Context, tokenHash string) (*model.ShareToken, error) {
+			return tokens[tokenHash], nil
+		},
+	}
+
+	svc := NewShareService(store)
+
+	for _, token := range []string{"valid", "forever"} {
+		shareToken, err := svc.ResolveShareToken(context.Background(), token)
+		if err != nil || shareToken.LinkID != 100 {
+			t.Errorf("Resolve(%q) = %+v, %v, want link 100", token, shareToken, err)
+		}
+	}
+
+	for _, token := range []string{"expired", "unknown"} {
+		if _, err := svc.ResolveShareToken(context.Background(), token); !errors.Is(err, ErrShareTokenNotFound) {
+			t.Errorf("Resolve(%q) err = %v, want ErrShareTokenNotFound", token, err)
+		}
+	}
+}
+
+func TestShareService_RevokeNotFound(t *testing.T) {
+	store := &storage.MockStore{
+		DeleteShareTokenFn: func(ctx context.Context, linkID uint64, id uint64) error {
+			return storage.ErrShareTokenNotFound
+		},
+	}
+
+	err := NewShareService(store).RevokeShareToken(context.Background(), 100, 9)
+	if !errors.Is(err, ErrShareTokenNotFound) {
+		t.Errorf("err = %v, want ErrShareTokenNotFound", err)
+	}
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// UpdatePassword sets a user's password hash and revokes their pending reset
+// links and every session except keepFamilyID, which may be empty to revoke
+// them all.
+func (s *PostgresStore) UpdatePassword(ctx context.Context, userID uint64, passwordHash string, keepFamilyID string) error {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	_, err = tx.Exec(ctx, `UPDATE users SET password_hash = $2 WHERE id = $1`, userID, passwordHash)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke password reset tokens: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM refresh_tokens WHERE user_id = $1 AND family_id::text <> $2`, userID, keepFamilyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateUserEmail changes a user's address and marks it unverified. It
+// returns ErrUniqueViolation when another account already has the address.
+func (s *PostgresStore) UpdateUserEmail(ctx context.Context, userID uint64, email string) error {
+	query := `UPDATE users SET email = $2, email_verified = FALSE WHERE id = $1`
+
+	_, err := s.Pool.Exec(ctx, query, userID, email)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrUniqueViolation
+		}
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUser removes a user along with their sessions and tokens, and
+// returns the short codes of the links they owned so callers can evict them
+// from the cache. The links and their analytics are deleted, unless
+// anonymizeLinks is set: then the links keep redirecting without an owner and
+// their clicks are stripped of anything that identifies a visitor.
+func (s *PostgresStore) DeleteUser(ctx context.Context, userID uint64, anonymizeLinks bool) ([]string, error) {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	rows, err := tx.Query(ctx, `SELECT short_code FROM links WHERE user_id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user links: %w", err)
+	}
+
+	shortCodes := []string{}
+	for rows.Next() {
+		var shortCode string
+		if err := rows.Scan(&shortCode); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan short code: %w", err)
+		}
+		shortCodes = append(shortCodes, shortCode)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get user links: %w", err)
+	}
+
+	if anonymizeLinks {
+		_, err = tx.Exec(ctx, `
+			UPDATE analytics
+			SET ip_address = NULL, user_agent = NULL, visitor_hash = NULL, click_id = NULL,
+				region = NULL, city = NULL
+			WHERE link_id IN (SELECT id FROM links WHERE user_id = $1)
+		`, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to anonymize analytics: %w", err)
+		}
+
+		// Nobody is left to revoke share links or receive conversions
+		_, err = tx.Exec(ctx, `DELETE FROM share_tokens WHERE link_id IN (SELECT id FROM links WHERE user_id = $1)`, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete share tokens: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE links SET user_id = NULL, conversion_tracking = FALSE WHERE user_id = $1`, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detach links: %w", err)
+		}
+	} else {
+		_, err = tx.Exec(ctx, `DELETE FROM analytics WHERE link_id IN (SELECT id FROM links WHERE user_id = $1)`, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete analytics: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM links WHERE user_id = $1`, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete links: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return shortCodes, nil
+}
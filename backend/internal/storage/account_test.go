@@ -0,0 +1,124 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+func TestDeleteUser_DeletesLinks(t *testing.T) {
+	ctx := context.Background()
+	email := "delete-user-test@example.com"
+	defer cleanupUser(email)
+
+	userID := createTestUser(t, email)
+	link := createTestLink(t, &userID)
+	if err := testStore.SaveAnalyticsEvent(ctx, &model.AnalyticsEvent{LinkID: link.ID, ClickedAt: time.Now()}); err != nil {
+		t.Fatalf("SaveAnalyticsEvent failed: %v", err)
+	}
+	if err := testStore.CreateRefreshToken(ctx, userID, "delete-user-test-token", time.Now().Add(time.Hour), model.SessionClient{}); err != nil {
+		t.Fatalf("CreateRefreshToken failed: %v", err)
+	}
+
+	shortCodes, err := testStore.DeleteUser(ctx, userID, false)
+	if err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if len(shortCodes) != 1 || shortCodes[0] != link.ShortCode {
+		t.Errorf("Short codes = %v, want [%s]", shortCodes, link.ShortCode)
+	}
+
+	user, err := testStore.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetUserByID failed: %v", err)
+	}
+	if user != nil {
+		t.Error("User should be deleted")
+	}
+
+	deleted, err := testStore.GetLinkByCode(ctx, link.ShortCode)
+	if err != nil {
+		t.Fatalf("GetLinkByCode failed: %v", err)
+	}
+	if deleted != nil {
+		t.Error("Link should be deleted")
+	}
+
+	token, err := testStore.GetRefreshToken(ctx, "delete-user-test-token")
+	if err != nil {
+		t.Fatalf("GetRefreshToken failed: %v", err)
+	}
+	if token != nil {
+		t.Error("Refresh token should be deleted")
+	}
+}
+
+func TestDeleteUser_AnonymizesLinks(t *testing.T) {
+	ctx := context.Background()
+	email := "anonymize-user-test@example.com"
+	defer cleanupUser(email)
+
+	userID := createTestUser(t, email)
+	link := createTestLink(t, &userID)
+	defer func() {
+		_, _ = testStore.Pool.Exec(ctx, "DELETE FROM links WHERE id = $1", link.ID)
+	}()
+
+	event := &model.AnalyticsEvent{
+		LinkID:      link.ID,
+		IPAddress:   "203.0.113.7",
+		UserAgent:   "Mozilla/5.0",
+		Country:     "NZ",
+		City:        "Wellington",
+		VisitorHash: "visitor",
+		ClickedAt:   time.Now(),
+	}
+	if err := testStore.SaveAnalyticsEvent(ctx, event); err != nil {
+		t.Fatalf("SaveAnalyticsEvent failed: %v", err)
+	}
+	if _, err := testStore.CreateShareToken(ctx, link.ID, "anonymize-user-test-share", nil); err != nil {
+		t.Fatalf("CreateShareToken failed: %v", err)
+	}
+
+	if _, err := testStore.DeleteUser(ctx, userID, true); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+
+	kept, err := testStore.GetLinkByCode(ctx, link.ShortCode)
+	if err != nil {
+		t.Fatalf("GetLinkByCode failed: %v", err)
+	}
+	if kept == nil {
+		t.Fatal("Link should still redirect")
+	}
+	if kept.UserID != nil {
+		t.Errorf("UserID = %d, want no owner", *kept.UserID)
+	}
+
+	events, err := testStore.GetAnalyticsEvents(ctx, link.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("GetAnalyticsEvents failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Events = %d, want 1", len(events))
+	}
+	got := events[0]
+	if got.IPAddress != "" || got.UserAgent != "" || got.VisitorHash != "" || got.City != "" {
+		t.Errorf("Event still identifies the visitor: %+v", got)
+	}
+	if got.Country != "NZ" {
+		t.Errorf("Country = %q, want it kept", got.Country)
+	}
+
+	share, err := testStore.GetShareToken(ctx, "anonymize-user-test-share")
+	if err != nil {
+		t.Fatalf("GetShareToken failed: %v", err)
+	}
+	if share != nil {
+		t.Error("Share token should be deleted")
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateAPIKey stores a new key unless the user already has maxKeys of them.
+// It returns nil when the limit is reached.
+func (s *PostgresStore) CreateAPIKey(ctx context.Context, userID uint64, name string, prefix string, keyHash string, scopes []string, maxKeys int) (*model.APIKey, error) {
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes)
+		SELECT $1, $2, $3, $4, $5
+		WHERE (SELECT COUNT(*) FROM api_keys WHERE user_id = $1) < $6
+		RETURNING id, created_at
+	`
+
+	key := &model.APIKey{UserID: userID, Name: name, Prefix: prefix, Scopes: scopes}
+	err := s.Pool.QueryRow(ctx, query, userID, name, prefix, keyHash, scopes, maxKeys).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// UseAPIKey looks a key up by its hash and records that it was used. The
+// last use is only written once a minute, so busy scripts don't turn every
+// request into a write.
+func (s *PostgresStore) UseAPIKey(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	query := `
+		WITH touched AS (
+			UPDATE api_keys SET last_used_at = NOW()
+			WHERE key_hash = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+		)
+		SELECT k.id, k.user_id, u.email, k.name, k.prefix, k.scopes, k.created_at, k.last_used_at
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1
+	`
+
+	var key model.APIKey
+	err := s.Pool.QueryRow(ctx, query, keyHash).Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Email,
+		&key.Name,
+		&key.Prefix,
+		&key.Scopes,
+		&key.CreatedAt,
+		&key.LastUsedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// ListAPIKeys returns the user's keys, newest first.
+func (s *PostgresStore) ListAPIKeys(ctx context.Context, userID uint64) ([]model.APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, scopes, created_at, last_used_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := s.Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		var key model.APIKey
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			&key.Scopes,
+			&key.CreatedAt,
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey revokes one of the user's keys and reports whether it existed.
+func (s *PostgresStore) DeleteAPIKey(ctx context.Context, userID uint64, id uint64) (bool, error) {
+	tag, err := s.Pool.Exec(ctx, `DELETE FROM api_keys WHERE user_id = $1 AND id = $2`, userID, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete API key: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
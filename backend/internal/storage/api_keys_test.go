@@ -0,0 +1,88 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	email := "api-keys-test@example.com"
+	otherEmail := "api-keys-other-test@example.com"
+	defer cleanupUser(email)
+	defer cleanupUser(otherEmail)
+
+	userID := createTestUser(t, email)
+	otherID := createTestUser(t, otherEmail)
+
+	key, err := testStore.CreateAPIKey(ctx, userID, "ci", "shk_abcdefgh", "api-keys-test-hash", []string{"links:write"}, 2)
+	if err != nil || key == nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if _, err := testStore.CreateAPIKey(ctx, userID, "backup", "shk_ijklmnop", "api-keys-test-hash-2", []string{"links:read"}, 2); err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+
+	// The limit is per user
+	limited, err := testStore.CreateAPIKey(ctx, userID, "third", "shk_qrstuvwx", "api-keys-test-hash-3", []string{"links:read"}, 2)
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if limited != nil {
+		t.Error("Key over the limit should not be created")
+	}
+	if other, err := testStore.CreateAPIKey(ctx, otherID, "other", "shk_otherkey", "api-keys-test-hash-other", []string{"links:read"}, 2); err != nil || other == nil {
+		t.Fatalf("CreateAPIKey for another user failed: %v", err)
+	}
+
+	used, err := testStore.UseAPIKey(ctx, "api-keys-test-hash")
+	if err != nil || used == nil {
+		t.Fatalf("UseAPIKey failed: %v", err)
+	}
+	if used.UserID != userID || used.Email != email || len(used.Scopes) != 1 || used.Scopes[0] != "links:write" {
+		t.Errorf("Used key = %+v", used)
+	}
+
+	keys, err := testStore.ListAPIKeys(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListAPIKeys failed: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("Keys = %d, want 2", len(keys))
+	}
+	for _, k := range keys {
+		if k.ID == key.ID && k.LastUsedAt == nil {
+			t.Error("LastUsedAt should be set once the key is used")
+		}
+	}
+
+	unknown, err := testStore.UseAPIKey(ctx, "api-keys-test-unknown")
+	if err != nil {
+		t.Fatalf("UseAPIKey failed: %v", err)
+	}
+	if unknown != nil {
+		t.Error("Unknown key should not be found")
+	}
+
+	deleted, err := testStore.DeleteAPIKey(ctx, otherID, key.ID)
+	if err != nil {
+		t.Fatalf("DeleteAPIKey failed: %v", err)
+	}
+	if deleted {
+		t.Error("Deleted another user's key")
+	}
+
+	deleted, err = testStore.DeleteAPIKey(ctx, userID, key.ID)
+	if err != nil {
+		t.Fatalf("DeleteAPIKey failed: %v", err)
+	}
+	if !deleted {
+		t.Error("Key should be deleted")
+	}
+
+	if revoked, err := testStore.UseAPIKey(ctx, "api-keys-test-hash"); err != nil || revoked != nil {
+		t.Errorf("Revoked key = %+v, %v, want it gone", revoked, err)
+	}
+}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+func (s *PostgresStore) SetConversionTracking(ctx context.Context, linkID uint64, enabled bool) error {
+	query := `UPDATE links SET conversion_tracking = $2 WHERE id = $1`
+
+	_, err := s.Pool.Exec(ctx, query, linkID, enabled)
+	if err != nil {
+		return fmt.Errorf("failed to set conversion tracking: %w", err)
+	}
+	return nil
+}
+
+// SaveConversion records a conversion for a click and reports whether it was
+// new. Repeated reports for the same click, or for a deleted link, are ignored.
+func (s *PostgresStore) SaveConversion(ctx context.Context, linkID uint64, clickID string) (bool, error) {
+	query := `
+		INSERT INTO conversions (click_id, link_id)
+		SELECT $2, id FROM links WHERE id = $1
+		ON CONFLICT (click_id) DO NOTHING
+	`
+
+	tag, err := s.Pool.Exec(ctx, query, linkID, clickID)
+	if err != nil {
+		return false, fmt.Errorf("failed to save conversion: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
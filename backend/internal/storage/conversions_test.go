@@ -0,0 +1,68 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+func TestConversions_MatchedToClicks(t *testing.T) {
+	ctx := context.Background()
+	email := "conversions-test@example.com"
+	defer cleanupUser(email)
+
+	userID := createTestUser(t, email)
+	link := createTestLink(t, &userID)
+
+	if err := testStore.SetConversionTracking(ctx, link.ID, true); err != nil {
+		t.Fatalf("SetConversionTracking failed: %v", err)
+	}
+
+	stored, err := testStore.GetLinkByCode(ctx, link.ShortCode)
+	if err != nil {
+		t.Fatalf("GetLinkByCode failed: %v", err)
+	}
+	if !stored.ConversionTracking {
+		t.Error("Conversion tracking should be enabled")
+	}
+
+	for _, clickID := range []string{"conv-test-a", "conv-test-b"} {
+		event := &model.AnalyticsEvent{LinkID: link.ID, ClickID: clickID, ClickedAt: time.Now()}
+		if err := testStore.SaveAnalyticsEvent(ctx, event); err != nil {
+			t.Fatalf("SaveAnalyticsEvent failed: %v", err)
+		}
+	}
+
+	created, err := testStore.SaveConversion(ctx, link.ID, "conv-test-a")
+	if err != nil {
+		t.Fatalf("SaveConversion failed: %v", err)
+	}
+	if !created {
+		t.Error("First conversion should be recorded")
+	}
+
+	created, err = testStore.SaveConversion(ctx, link.ID, "conv-test-a")
+	if err != nil {
+		t.Fatalf("SaveConversion failed: %v", err)
+	}
+	if created {
+		t.Error("Repeated conversion should be ignored")
+	}
+
+	events, err := testStore.GetAnalyticsEvents(ctx, link.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("GetAnalyticsEvents failed: %v", err)
+	}
+
+	converted := map[string]bool{}
+	for _, event := range events {
+		converted[event.ClickID] = event.Converted
+	}
+	if !converted["conv-test-a"] || converted["conv-test-b"] {
+		t.Errorf("Converted = %v, want only conv-test-a", converted)
+	}
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateEmailVerificationToken stores a token for verifying email unless the
+// user already got one after notSince. A zero notSince never throttles. It
+// reports whether the token was created.
+func (s *PostgresStore) CreateEmailVerificationToken(ctx context.Context, userID uint64, email string, tokenHash string, expiresAt time.Time, notSince time.Time) (bool, error) {
+	query := `
+		INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (
+			SELECT 1 FROM email_verification_tokens
+			WHERE user_id = $1 AND created_at > $5
+		)
+	`
+
+	tag, err := s.Pool.Exec(ctx, query, userID, email, tokenHash, expiresAt, notSince)
+	if err != nil {
+		return false, fmt.Errorf("failed to create email verification token: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// VerifyEmail uses up an unexpired verification token and marks its user's
+// email verified, as long as the account still has the address the token
+// was mailed to. It reports false otherwise.
+func (s *PostgresStore) VerifyEmail(ctx context.Context, tokenHash string) (bool, error) {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var userID uint64
+	var email string
+	err = tx.QueryRow(ctx, `
+		UPDATE email_verification_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, email
+	`, tokenHash).Scan(&userID, &email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to use email verification token: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `UPDATE users SET email_verified = TRUE WHERE id = $1 AND email = $2`, userID, email)
+	if err != nil {
+		return false, fmt.Errorf("failed to verify email: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		// The address changed since the link was sent; the used_at update is rolled back too
+		return false, nil
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM email_verification_tokens WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke email verification tokens: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// GetUserByIdentity returns the user an external provider's account signs
+// in as, or nil if it isn't linked to anyone.
+func (s *PostgresStore) GetUserByIdentity(ctx context.Context, provider string, subject string) (*model.User, error) {
+	query := `
+		SELECT u.id, u.email, u.password_hash, u.email_verified, u.totp_enabled, u.created_at
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.subject = $2
+	`
+
+	user := &model.User{}
+	err := s.Pool.QueryRow(ctx, query, provider, subject).Scan(
+		&user.ID,
+		&user.Email,
+		&user.PasswordHash,
+		&user.EmailVerified,
+		&user.TwoFactorEnabled,
+		&user.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user by identity: %w", err)
+	}
+
+	return user, nil
+}
+
+// CreateIdentity links a provider's account to an existing user. It returns
+// ErrUniqueViolation when the account is already linked.
+func (s *PostgresStore) CreateIdentity(ctx context.Context, userID uint64, provider string, subject string) error {
+	query := `INSERT INTO user_identities (user_id, provider, subject) VALUES ($1, $2, $3)`
+
+	_, err := s.Pool.Exec(ctx, query, userID, provider, subject)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrUniqueViolation
+		}
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+
+	return nil
+}
+
+// CreateIdentityUser creates a user that signs in through a provider. The
+// provider vouched for the email, so it starts verified, and there is no
+// password until the user sets one through a reset. It returns
+// ErrUniqueViolation when the email or the identity is taken.
+func (s *PostgresStore) CreateIdentityUser(ctx context.Context, email string, provider string, subject string) (uint64, error) {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var userID uint64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (email, password_hash, email_verified)
+		VALUES ($1, '', TRUE)
+		ON CONFLICT (email) DO NOTHING
+		RETURNING id
+	`, email).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrUniqueViolation
+		}
+		return 0, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO user_identities (user_id, provider, subject) VALUES ($1, $2, $3)`, userID, provider, subject)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, ErrUniqueViolation
+		}
+		return 0, fmt.Errorf("failed to create identity: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return userID, nil
+}
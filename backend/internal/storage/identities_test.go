@@ -0,0 +1,67 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestIdentities(t *testing.T) {
+	ctx := context.Background()
+	email := "identities-test@example.com"
+	newEmail := "identities-new-test@example.com"
+	defer cleanupUser(email)
+	defer cleanupUser(newEmail)
+
+	userID := createTestUser(t, email)
+
+	user, err := testStore.GetUserByIdentity(ctx, "keycloak", "identities-subject")
+	if err != nil {
+		t.Fatalf("GetUserByIdentity failed: %v", err)
+	}
+	if user != nil {
+		t.Fatal("Unlinked identity should have no user")
+	}
+
+	if err := testStore.CreateIdentity(ctx, userID, "keycloak", "identities-subject"); err != nil {
+		t.Fatalf("CreateIdentity failed: %v", err)
+	}
+	if err := testStore.CreateIdentity(ctx, userID, "keycloak", "identities-subject"); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Duplicate identity error = %v, want ErrUniqueViolation", err)
+	}
+
+	user, err = testStore.GetUserByIdentity(ctx, "keycloak", "identities-subject")
+	if err != nil {
+		t.Fatalf("GetUserByIdentity failed: %v", err)
+	}
+	if user == nil || user.ID != userID {
+		t.Fatalf("User = %+v, want ID %d", user, userID)
+	}
+
+	// Subjects are only unique per provider
+	other, err := testStore.GetUserByIdentity(ctx, "google", "identities-subject")
+	if err != nil {
+		t.Fatalf("GetUserByIdentity failed: %v", err)
+	}
+	if other != nil {
+		t.Error("Identity should not match another provider")
+	}
+
+	if _, err := testStore.CreateIdentityUser(ctx, email, "google", "identities-taken"); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Taken email error = %v, want ErrUniqueViolation", err)
+	}
+
+	newID, err := testStore.CreateIdentityUser(ctx, newEmail, "google", "identities-new-subject")
+	if err != nil {
+		t.Fatalf("CreateIdentityUser failed: %v", err)
+	}
+	created, err := testStore.GetUserByIdentity(ctx, "google", "identities-new-subject")
+	if err != nil {
+		t.Fatalf("GetUserByIdentity failed: %v", err)
+	}
+	if created == nil || created.ID != newID || created.Email != newEmail || !created.EmailVerified {
+		t.Errorf("Created user = %+v, want verified %s", created, newEmail)
+	}
+}
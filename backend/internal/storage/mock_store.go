@@ -7,17 +7,37 @@ import (
 )
 
 type MockStore struct {
-	SaveLinkFn           func(ctx context.Context, longURL string, userID *uint64) (string, error)
-	GetLinkByCodeFn      func(ctx context.Context, shortURL string) (*model.Link, error)
-	GetUserLinksFn       func(ctx context.Context, userID uint64, limit int, offset int) ([]model.Link, int, error)
-	DeleteLinkFn         func(ctx context.Context, shortCode string, userID uint64) error
-	GetTotalLinksFn      func(ctx context.Context) (int, error)
-	GetTotalRequestsFn   func(ctx context.Context) (int, error)
-	GetAnalyticsEventsFn func(ctx context.Context, linkID uint64, startDate, endDate time.Time) ([]*model.AnalyticsEvent, error)
-	CloseFn              func()
+	SaveLinkFn                  func(ctx context.Context, longURL string, userID *uint64) (string, error)
+	GetLinkByCodeFn             func(ctx context.Context, shortURL string) (*model.Link, error)
+	GetUserLinksFn              func(ctx context.Context, userID uint64, limit int, offset int) ([]model.Link, int, error)
+	DeleteLinkFn                func(ctx context.Context, shortCode string, userID uint64) error
+	GetTotalLinksFn             func(ctx context.Context) (int, error)
+	GetTotalRequestsFn          func(ctx context.Context) (int, error)
+	SetConversionTrackingFn     func(ctx context.Context, linkID uint64, enabled bool) error
+	SaveConversionFn            func(ctx context.Context, linkID uint64, clickID string) (bool, error)
+	SaveAnalyticsEventFn        func(ctx context.Context, event *model.AnalyticsEvent) error
+	GetAnalyticsEventsFn        func(ctx context.Context, linkID uint64, period time.Time) ([]*model.AnalyticsEvent, error)
+	StreamAnalyticsEventsFn     func(ctx context.Context, filter model.AnalyticsExportFilter, fn func(event *model.AnalyticsEvent) error) error
+	GetUserClicksOverTimeFn     func(ctx context.Context, userID uint64, since time.Time, interval string) ([]model.ClicksByDate, error)
+	GetUserTopLinksFn           func(ctx context.Context, userID uint64, since time.Time, limit int) ([]model.TopLink, error)
+	GetUserTopValuesFn          func(ctx context.Context, userID uint64, dimension string, since time.Time, limit int) ([]model.DimensionCount, error)
+	GetUserLinksCreatedFn       func(ctx context.Context, userID uint64, since time.Time, interval string) ([]model.LinksCreated, error)
+	PurgeAnalyticsEventsFn      func(ctx context.Context, defaultDays int, batchSize int) (int64, error)
+	SetAnalyticsRetentionFn     func(ctx context.Context, userID uint64, days *int) error
+	ListAnalyticsPartitionsFn   func(ctx context.Context) ([]model.AnalyticsPartition, error)
+	EnsureAnalyticsPartitionsFn func(ctx context.Context, through time.Time) ([]string, error)
+	DropAnalyticsPartitionFn    func(ctx context.Context, name string) error
+	GetLinkTrafficFn            func(ctx context.Context, since time.Time, baselineSince time.Time, minClicks int) ([]model.LinkTraffic, error)
+	CreateShareTokenFn          func(ctx context.Context, linkID uint64, tokenHash string, expiresAt *time.Time) (*model.ShareToken, error)
+	GetShareTokenFn             func(ctx context.Context, tokenHash string) (*model.ShareToken, error)
+	ListShareTokensFn           func(ctx context.Context, linkID uint64) ([]model.ShareToken, error)
+	DeleteShareTokenFn          func(ctx context.Context, linkID uint64, id uint64) error
+	CloseFn                     func()
 }
 
 var _ LinkStore = (*MockStore)(nil)
+var _ AnalyticsStore = (*MockStore)(nil)
+var _ ShareStore = (*MockStore)(nil)
 
 func (m *MockStore) SaveLink(ctx context.Context, longURL string, userID *uint64) (string, error) {
 	return m.SaveLinkFn(ctx, longURL, userID)
@@ -43,8 +63,80 @@ func (m *MockStore) GetTotalRequests(ctx context.Context) (int, error) {
 	return m.GetTotalRequestsFn(ctx)
 }
 
-func (m *MockStore) GetAnalyticsEvents(ctx context.Context, linkID uint64, startDate, endDate time.Time) ([]*model.AnalyticsEvent, error) {
-	return m.GetAnalyticsEventsFn(ctx, linkID, startDate, endDate)
+func (m *MockStore) SetConversionTracking(ctx context.Context, linkID uint64, enabled bool) error {
+	return m.SetConversionTrackingFn(ctx, linkID, enabled)
+}
+
+func (m *MockStore) SaveConversion(ctx context.Context, linkID uint64, clickID string) (bool, error) {
+	return m.SaveConversionFn(ctx, linkID, clickID)
+}
+
+func (m *MockStore) SaveAnalyticsEvent(ctx context.Context, event *model.AnalyticsEvent) error {
+	return m.SaveAnalyticsEventFn(ctx, event)
+}
+
+func (m *MockStore) GetAnalyticsEvents(ctx context.Context, linkID uint64, period time.Time) ([]*model.AnalyticsEvent, error) {
+	return m.GetAnalyticsEventsFn(ctx, linkID, period)
+}
+
+func (m *MockStore) StreamAnalyticsEvents(ctx context.Context, filter model.AnalyticsExportFilter, fn func(event *model.AnalyticsEvent) error) error {
+	return m.StreamAnalyticsEventsFn(ctx, filter, fn)
+}
+
+func (m *MockStore) GetUserClicksOverTime(ctx context.Context, userID uint64, since time.Time, interval string) ([]model.ClicksByDate, error) {
+	return m.GetUserClicksOverTimeFn(ctx, userID, since, interval)
+}
+
+func (m *MockStore) GetUserTopLinks(ctx context.Context, userID uint64, since time.Time, limit int) ([]model.TopLink, error) {
+	return m.GetUserTopLinksFn(ctx, userID, since, limit)
+}
+
+func (m *MockStore) GetUserTopValues(ctx context.Context, userID uint64, dimension string, since time.Time, limit int) ([]model.DimensionCount, error) {
+	return m.GetUserTopValuesFn(ctx, userID, dimension, since, limit)
+}
+
+func (m *MockStore) GetUserLinksCreated(ctx context.Context, userID uint64, since time.Time, interval string) ([]model.LinksCreated, error) {
+	return m.GetUserLinksCreatedFn(ctx, userID, since, interval)
+}
+
+func (m *MockStore) PurgeAnalyticsEvents(ctx context.Context, defaultDays int, batchSize int) (int64, error) {
+	return m.PurgeAnalyticsEventsFn(ctx, defaultDays, batchSize)
+}
+
+func (m *MockStore) SetAnalyticsRetention(ctx context.Context, userID uint64, days *int) error {
+	return m.SetAnalyticsRetentionFn(ctx, userID, days)
+}
+
+func (m *MockStore) ListAnalyticsPartitions(ctx context.Context) ([]model.AnalyticsPartition, error) {
+	return m.ListAnalyticsPartitionsFn(ctx)
+}
+
+func (m *MockStore) EnsureAnalyticsPartitions(ctx context.Context, through time.Time) ([]string, error) {
+	return m.EnsureAnalyticsPartitionsFn(ctx, through)
+}
+
+func (m *MockStore) DropAnalyticsPartition(ctx context.Context, name string) error {
+	return m.DropAnalyticsPartitionFn(ctx, name)
+}
+
+func (m *MockStore) GetLinkTraffic(ctx context.Context, since time.Time, baselineSince time.Time, minClicks int) ([]model.LinkTraffic, error) {
+	return m.GetLinkTrafficFn(ctx, since, baselineSince, minClicks)
+}
+
+func (m *MockStore) CreateShareToken(ctx context.Context, linkID uint64, tokenHash string, expiresAt *time.Time) (*model.ShareToken, error) {
+	return m.CreateShareTokenFn(ctx, linkID, tokenHash, expiresAt)
+}
+
+func (m *MockStore) GetShareToken(ctx context.Context, tokenHash string) (*model.ShareToken, error) {
+	return m.GetShareTokenFn(ctx, tokenHash)
+}
+
+func (m *MockStore) ListShareTokens(ctx context.Context, linkID uint64) ([]model.ShareToken, error) {
+	return m.ListShareTokensFn(ctx, linkID)
+}
+
+func (m *MockStore) DeleteShareToken(ctx context.Context, linkID uint64, id uint64) error {
+	return m.DeleteShareTokenFn(ctx, linkID, id)
 }
 
 func (m *MockStore) Close() {
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// Bounds as printed by pg_get_expr with the session time zone set to UTC.
+var partitionBoundPattern = regexp.MustCompile(`^FOR VALUES FROM \((.+)\) TO \((.+)\)$`)
+
+const partitionBoundLayout = "2006-01-02 15:04:05-07"
+
+// ListAnalyticsPartitions returns the partitions of the analytics table
+// ordered by their lower bound.
+func (s *PostgresStore) ListAnalyticsPartitions(ctx context.Context) ([]model.AnalyticsPartition, error) {
+	tx, err := s.Pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, "SET LOCAL TimeZone = 'UTC'"); err != nil {
+		return nil, fmt.Errorf("failed to set time zone: %w", err)
+	}
+
+	query := `
+		SELECT c.relname, pg_get_expr(c.relpartbound, c.oid)
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'analytics'::regclass
+	`
+
+	rows, err := tx.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list analytics partitions: %w", err)
+	}
+	defer rows.Close()
+
+	partitions := []model.AnalyticsPartition{}
+	for rows.Next() {
+		var name, bound string
+		if err := rows.Scan(&name, &bound); err != nil {
+			return nil, fmt.Errorf("failed to scan analytics partition: %w", err)
+		}
+
+		partition, err := parsePartitionBound(name, bound)
+		if err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, partition)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list analytics partitions: %w", err)
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].From.Before(partitions[j].From)
+	})
+
+	return partitions, nil
+}
+
+func parsePartitionBound(name string, bound string) (model.AnalyticsPartition, error) {
+	partition := model.AnalyticsPartition{Name: name}
+
+	match := partitionBoundPattern.FindStringSubmatch(bound)
+	if match == nil {
+		return partition, fmt.Errorf("unexpected bound for partition %s: %q", name, bound)
+	}
+
+	var err error
+	if partition.From, err = parseBoundValue(match[1]); err != nil {
+		return partition, fmt.Errorf("invalid lower bound for partition %s: %w", name, err)
+	}
+	if partition.To, err = parseBoundValue(match[2]); err != nil {
+		return partition, fmt.Errorf("invalid upper bound for partition %s: %w", name, err)
+	}
+
+	return partition, nil
+}
+
+func parseBoundValue(value string) (time.Time, error) {
+	if value == "MINVALUE" || value == "MAXVALUE" {
+		return time.Time{}, nil
+	}
+	return time.Parse(partitionBoundLayout, strings.Trim(value, "'"))
+}
+
+// EnsureAnalyticsPartitions creates monthly partitions after the last one
+// until the given time is covered, and returns the names it created.
+func (s *PostgresStore) EnsureAnalyticsPartitions(ctx context.Context, through time.Time) ([]string, error) {
+	partitions, err := s.ListAnalyticsPartitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var last time.Time
+	for _, partition := range partitions {
+		if partition.To.IsZero() && !partition.From.IsZero() {
+			// A MAXVALUE partition already covers the future
+			return nil, nil
+		}
+		if partition.To.After(last) {
+			last = partition.To
+		}
+	}
+	if last.IsZero() {
+		return nil, fmt.Errorf("analytics table has no bounded partitions to extend")
+	}
+
+	created := []string{}
+	for !last.After(through) {
+		next := last.AddDate(0, 1, 0)
+		name, err := s.createAnalyticsPartition(ctx, last, next)
+		if err != nil {
+			return created, err
+		}
+		created = append(created, name)
+		last = next
+	}
+
+	return created, nil
+}
+
+func (s *PostgresStore) createAnalyticsPartition(ctx context.Context, from time.Time, to time.Time) (string, error) {
+	from, to = from.UTC(), to.UTC()
+	name := fmt.Sprintf("analytics_y%04dm%02d", from.Year(), from.Month())
+
+	// DDL takes no bind parameters; both bounds are formatted from time.Time
+	query := fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s PARTITION OF analytics (PRIMARY KEY (id)) FOR VALUES FROM ('%s') TO ('%s')",
+		pgx.Identifier{name}.Sanitize(),
+		from.Format(time.RFC3339),
+		to.Format(time.RFC3339),
+	)
+
+	if _, err := s.Pool.Exec(ctx, query); err != nil {
+		return "", fmt.Errorf("failed to create partition %s: %w", name, err)
+	}
+
+	return name, nil
+}
+
+// DropAnalyticsPartition detaches and drops a partition along with its rows.
+func (s *PostgresStore) DropAnalyticsPartition(ctx context.Context, name string) error {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	identifier := pgx.Identifier{name}.Sanitize()
+
+	if _, err := tx.Exec(ctx, "ALTER TABLE analytics DETACH PARTITION "+identifier); err != nil {
+		return fmt.Errorf("failed to detach partition %s: %w", name, err)
+	}
+	if _, err := tx.Exec(ctx, "DROP TABLE "+identifier); err != nil {
+		return fmt.Errorf("failed to drop partition %s: %w", name, err)
+	}
+
+	return tx.Commit(ctx)
+}
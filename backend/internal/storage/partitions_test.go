@@ -0,0 +1,92 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+func TestParsePartitionBound(t *testing.T) {
+	partition, err := parsePartitionBound("analytics_legacy", "FOR VALUES FROM (MINVALUE) TO ('2026-05-01 00:00:00+00')")
+	if err != nil {
+		t.Fatalf("parsePartitionBound failed: %v", err)
+	}
+	if !partition.From.IsZero() || !partition.To.Equal(time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Partition = %+v, want unbounded to 2026-05-01", partition)
+	}
+
+	if _, err := parsePartitionBound("analytics_default", "DEFAULT"); err == nil {
+		t.Error("Expected error for a default partition")
+	}
+}
+
+func TestEnsureAnalyticsPartitions_CoversFuture(t *testing.T) {
+	ctx := context.Background()
+	through := time.Now().UTC().AddDate(0, 6, 0)
+
+	if _, err := testStore.EnsureAnalyticsPartitions(ctx, through); err != nil {
+		t.Fatalf("EnsureAnalyticsPartitions failed: %v", err)
+	}
+
+	// Running again is a no-op
+	created, err := testStore.EnsureAnalyticsPartitions(ctx, through)
+	if err != nil {
+		t.Fatalf("EnsureAnalyticsPartitions failed: %v", err)
+	}
+	if len(created) != 0 {
+		t.Errorf("Second run created %v, want nothing", created)
+	}
+
+	partitions, err := testStore.ListAnalyticsPartitions(ctx)
+	if err != nil {
+		t.Fatalf("ListAnalyticsPartitions failed: %v", err)
+	}
+	if len(partitions) < 2 || !partitions[0].From.IsZero() {
+		t.Fatalf("Partitions = %+v, want the legacy partition first", partitions)
+	}
+
+	// Contiguous, with no gaps, up to the requested time
+	for i := 1; i < len(partitions); i++ {
+		if !partitions[i].From.Equal(partitions[i-1].To) {
+			t.Errorf("Gap between %s and %s", partitions[i-1].Name, partitions[i].Name)
+		}
+	}
+	if last := partitions[len(partitions)-1]; !last.To.After(through) {
+		t.Errorf("Last partition ends %v, want after %v", last.To, through)
+	}
+}
+
+func TestSaveAnalyticsEvent_RoutesToMonthlyPartition(t *testing.T) {
+	ctx := context.Background()
+	email := "partition-route-test@example.com"
+	defer func() {
+		cleanupUser(email)
+	}()
+
+	userID := createTestUser(t, email)
+	link := createTestLink(t, &userID)
+
+	future := time.Now().UTC().AddDate(0, 3, 0)
+	if _, err := testStore.EnsureAnalyticsPartitions(ctx, future); err != nil {
+		t.Fatalf("EnsureAnalyticsPartitions failed: %v", err)
+	}
+
+	event := &model.AnalyticsEvent{LinkID: link.ID, ClickedAt: future}
+	if err := testStore.SaveAnalyticsEvent(ctx, event); err != nil {
+		t.Fatalf("SaveAnalyticsEvent failed: %v", err)
+	}
+
+	var partition string
+	err := testStore.Pool.QueryRow(ctx, "SELECT tableoid::regclass::text FROM analytics WHERE link_id = $1", link.ID).Scan(&partition)
+	if err != nil {
+		t.Fatalf("Failed to look up partition: %v", err)
+	}
+	if want := fmt.Sprintf("analytics_y%04dm%02d", future.Year(), future.Month()); partition != want {
+		t.Errorf("Event stored in %s, want %s", partition, want)
+	}
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreatePasswordResetToken stores a reset token unless the user already got
+// one after notSince, which keeps repeated requests from flooding their inbox.
+// It reports whether the token was created.
+func (s *PostgresStore) CreatePasswordResetToken(ctx context.Context, userID uint64, tokenHash string, expiresAt time.Time, notSince time.Time) (bool, error) {
+	query := `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		SELECT $1, $2, $3
+		WHERE NOT EXISTS (
+			SELECT 1 FROM password_reset_tokens
+			WHERE user_id = $1 AND created_at > $4
+		)
+	`
+
+	tag, err := s.Pool.Exec(ctx, query, userID, tokenHash, expiresAt, notSince)
+	if err != nil {
+		return false, fmt.Errorf("failed to create password reset token: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ResetPassword uses up an unexpired reset token and sets the password of its
+// user. The user's other reset tokens and all their refresh tokens are
+// revoked with it. It reports false when the token is unknown, used or
+// expired.
+func (s *PostgresStore) ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (bool, error) {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var userID uint64
+	err = tx.QueryRow(ctx, `
+		UPDATE password_reset_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, tokenHash).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to use password reset token: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET password_hash = $2 WHERE id = $1`, userID, passwordHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to update password: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke password reset tokens: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM refresh_tokens WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
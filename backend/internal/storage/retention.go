@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// PurgeAnalyticsEvents deletes at most batchSize raw events that are past
+// their account's retention (defaultDays for accounts without an override
+// and for anonymous links). Overrides longer than defaultDays are capped, as
+// partitions past it are dropped anyway. Callers loop until fewer than batchSize rows are
+// deleted, so no single statement holds locks for long. Rollups are untouched.
+func (s *PostgresStore) PurgeAnalyticsEvents(ctx context.Context, defaultDays int, batchSize int) (int64, error) {
+	// The first clicked_at bound uses the shortest retention of any account so
+	// the clicked_at index can narrow the scan before the per-account check
+	query := `
+		WITH expired AS (
+			SELECT a.id
+			FROM analytics a
+			JOIN links l ON l.id = a.link_id
+			LEFT JOIN users u ON u.id = l.user_id
+			WHERE a.clicked_at < NOW() - make_interval(days => (
+					SELECT LEAST($1, COALESCE(MIN(analytics_retention_days), $1)) FROM users
+				))
+				AND a.clicked_at < NOW() - make_interval(days => LEAST(COALESCE(u.analytics_retention_days, $1), $1))
+			LIMIT $2
+		)
+		DELETE FROM analytics
+		WHERE id IN (SELECT id FROM expired)
+	`
+
+	tag, err := s.Pool.Exec(ctx, query, defaultDays, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge analytics events: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// SetAnalyticsRetention overrides how many days of raw events the user keeps.
+// A nil days reverts to the deployment default.
+func (s *PostgresStore) SetAnalyticsRetention(ctx context.Context, userID uint64, days *int) error {
+	query := `UPDATE users SET analytics_retention_days = $2 WHERE id = $1`
+
+	_, err := s.Pool.Exec(ctx, query, userID, days)
+	if err != nil {
+		return fmt.Errorf("failed to set analytics retention: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+func TestPurgeAnalyticsEvents_RespectsAccountOverride(t *testing.T) {
+	ctx := context.Background()
+	defaultEmail := "purge-default-test@example.com"
+	shortEmail := "purge-override-test@example.com"
+	longEmail := "purge-long-override-test@example.com"
+	defer func() {
+		cleanupUser(defaultEmail)
+		cleanupUser(shortEmail)
+		cleanupUser(longEmail)
+	}()
+
+	defaultUser := createTestUser(t, defaultEmail)
+	shortUser := createTestUser(t, shortEmail)
+	longUser := createTestUser(t, longEmail)
+	defaultLink := createTestLink(t, &defaultUser)
+	shortLink := createTestLink(t, &shortUser)
+	longLink := createTestLink(t, &longUser)
+
+	shortDays := 30
+	if err := testStore.SetAnalyticsRetention(ctx, shortUser, &shortDays); err != nil {
+		t.Fatalf("SetAnalyticsRetention failed: %v", err)
+	}
+	// Set before overrides were capped at the default
+	longDays := 365
+	if err := testStore.SetAnalyticsRetention(ctx, longUser, &longDays); err != nil {
+		t.Fatalf("SetAnalyticsRetention failed: %v", err)
+	}
+
+	old := time.Now().AddDate(0, 0, -100)
+	recent := time.Now().AddDate(0, 0, -60)
+	for _, event := range []*model.AnalyticsEvent{
+		{LinkID: defaultLink.ID, ClickedAt: old},
+		{LinkID: defaultLink.ID, ClickedAt: old},
+		{LinkID: defaultLink.ID, ClickedAt: recent},
+		{LinkID: shortLink.ID, ClickedAt: recent},
+		{LinkID: shortLink.ID, ClickedAt: time.Now()},
+		{LinkID: longLink.ID, ClickedAt: old},
+	} {
+		if err := testStore.SaveAnalyticsEvent(ctx, event); err != nil {
+			t.Fatalf("SaveAnalyticsEvent failed: %v", err)
+		}
+	}
+
+	// Batch size 1 exercises the bounded delete; other tests' data may also be purged
+	for {
+		deleted, err := testStore.PurgeAnalyticsEvents(ctx, 90, 1)
+		if err != nil {
+			t.Fatalf("PurgeAnalyticsEvents failed: %v", err)
+		}
+		if deleted > 1 {
+			t.Fatalf("Deleted %d rows in one batch, want at most 1", deleted)
+		}
+		if deleted == 0 {
+			break
+		}
+	}
+
+	since := time.Now().AddDate(-1, 0, 0)
+
+	events, err := testStore.GetAnalyticsEvents(ctx, defaultLink.ID, since)
+	if err != nil {
+		t.Fatalf("GetAnalyticsEvents failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("Default account kept %d events, want 1", len(events))
+	}
+
+	events, err = testStore.GetAnalyticsEvents(ctx, shortLink.ID, since)
+	if err != nil {
+		t.Fatalf("GetAnalyticsEvents failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("Shorter override account kept %d events, want 1", len(events))
+	}
+
+	events, err = testStore.GetAnalyticsEvents(ctx, longLink.ID, since)
+	if err != nil {
+		t.Fatalf("GetAnalyticsEvents failed: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Longer override account kept %d events, want 0", len(events))
+	}
+
+	// Rollups are kept forever
+	clicks, err := testStore.GetUserClicksOverTime(ctx, defaultUser, since, "month")
+	if err != nil {
+		t.Fatalf("GetUserClicksOverTime failed: %v", err)
+	}
+	total := 0
+	for _, bucket := range clicks {
+		total += bucket.Clicks
+	}
+	if total != 3 {
+		t.Errorf("Rollups hold %d clicks after purge, want 3", total)
+	}
+}
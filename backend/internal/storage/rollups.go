@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// Rollup dimensions. Rollups hold daily (UTC) click counts per link for each
+// dimension value and only count unfiltered clicks.
+const (
+	DimensionTotal    = "total"
+	DimensionReferrer = "referrer"
+	DimensionCountry  = "country"
+	DimensionDevice   = "device"
+	DimensionBrowser  = "browser"
+	DimensionOS       = "os"
+)
+
+// Buckets for time series, passed to date_trunc.
+var validIntervals = map[string]bool{"day": true, "week": true, "month": true}
+
+func incrementRollups(ctx context.Context, tx pgx.Tx, event *model.AnalyticsEvent) error {
+	query := `
+		INSERT INTO analytics_rollups (link_id, bucket, dimension, value, clicks)
+		VALUES
+			($1, ($2::timestamptz AT TIME ZONE 'UTC')::date, 'total', '', 1),
+			($1, ($2::timestamptz AT TIME ZONE 'UTC')::date, 'referrer', $3, 1),
+			($1, ($2::timestamptz AT TIME ZONE 'UTC')::date, 'country', $4, 1),
+			($1, ($2::timestamptz AT TIME ZONE 'UTC')::date, 'device', $5, 1),
+			($1, ($2::timestamptz AT TIME ZONE 'UTC')::date, 'browser', $6, 1),
+			($1, ($2::timestamptz AT TIME ZONE 'UTC')::date, 'os', $7, 1)
+		ON CONFLICT (link_id, bucket, dimension, value)
+		DO UPDATE SET clicks = analytics_rollups.clicks + 1
+	`
+
+	_, err := tx.Exec(ctx, query,
+		event.LinkID,
+		event.ClickedAt,
+		event.Referrer,
+		event.Country,
+		event.DeviceType,
+		event.Browser,
+		event.OS,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update analytics rollups: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserClicksOverTime returns total clicks across all of the user's links
+// per interval bucket since the given day.
+func (s *PostgresStore) GetUserClicksOverTime(ctx context.Context, userID uint64, since time.Time, interval string) ([]model.ClicksByDate, error) {
+	if !validIntervals[interval] {
+		return nil, fmt.Errorf("invalid interval %q", interval)
+	}
+
+	query := `
+		SELECT to_char(date_trunc($3, r.bucket), 'YYYY-MM-DD') AS period, SUM(r.clicks)
+		FROM analytics_rollups r
+		JOIN links l ON l.id = r.link_id
+		WHERE l.user_id = $1 AND r.dimension = 'total' AND r.bucket >= $2::date
+		GROUP BY period
+		ORDER BY period
+	`
+
+	rows, err := s.Pool.Query(ctx, query, userID, since, interval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get clicks over time: %w", err)
+	}
+	defer rows.Close()
+
+	clicks := []model.ClicksByDate{}
+	for rows.Next() {
+		var c model.ClicksByDate
+		if err := rows.Scan(&c.Date, &c.Clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan clicks over time: %w", err)
+		}
+		clicks = append(clicks, c)
+	}
+
+	return clicks, rows.Err()
+}
+
+// GetUserTopLinks returns the user's most clicked links since the given day.
+func (s *PostgresStore) GetUserTopLinks(ctx context.Context, userID uint64, since time.Time, limit int) ([]model.TopLink, error) {
+	query := `
+		SELECT l.short_code, l.long_url, SUM(r.clicks) AS clicks
+		FROM analytics_rollups r
+		JOIN links l ON l.id = r.link_id
+		WHERE l.user_id = $1 AND r.dimension = 'total' AND r.bucket >= $2::date
+		GROUP BY l.id
+		ORDER BY clicks DESC, l.short_code
+		LIMIT $3
+	`
+
+	rows, err := s.Pool.Query(ctx, query, userID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []model.TopLink{}
+	for rows.Next() {
+		var link model.TopLink
+		if err := rows.Scan(&link.ShortCode, &link.LongURL, &link.Clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan top link: %w", err)
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+// GetUserTopValues returns the most common values of a rollup dimension
+// across all of the user's links since the given day.
+func (s *PostgresStore) GetUserTopValues(ctx context.Context, userID uint64, dimension string, since time.Time, limit int) ([]model.DimensionCount, error) {
+	query := `
+		SELECT r.value, SUM(r.clicks) AS clicks
+		FROM analytics_rollups r
+		JOIN links l ON l.id = r.link_id
+		WHERE l.user_id = $1 AND r.dimension = $2 AND r.bucket >= $3::date
+		GROUP BY r.value
+		ORDER BY clicks DESC, r.value
+		LIMIT $4
+	`
+
+	rows, err := s.Pool.Query(ctx, query, userID, dimension, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top %s values: %w", dimension, err)
+	}
+	defer rows.Close()
+
+	values := []model.DimensionCount{}
+	for rows.Next() {
+		var v model.DimensionCount
+		if err := rows.Scan(&v.Value, &v.Clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan top %s value: %w", dimension, err)
+		}
+		values = append(values, v)
+	}
+
+	return values, rows.Err()
+}
+
+// GetUserLinksCreated returns how many links the user created per interval
+// bucket since the given time.
+func (s *PostgresStore) GetUserLinksCreated(ctx context.Context, userID uint64, since time.Time, interval string) ([]model.LinksCreated, error) {
+	if !validIntervals[interval] {
+		return nil, fmt.Errorf("invalid interval %q", interval)
+	}
+
+	query := `
+		SELECT to_char(date_trunc($3, created_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD') AS period, COUNT(*)
+		FROM links
+		WHERE user_id = $1 AND created_at >= $2
+		GROUP BY period
+		ORDER BY period
+	`
+
+	rows, err := s.Pool.Query(ctx, query, userID, since, interval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get links created: %w", err)
+	}
+	defer rows.Close()
+
+	created := []model.LinksCreated{}
+	for rows.Next() {
+		var c model.LinksCreated
+		if err := rows.Scan(&c.Date, &c.Links); err != nil {
+			return nil, fmt.Errorf("failed to scan links created: %w", err)
+		}
+		created = append(created, c)
+	}
+
+	return created, rows.Err()
+}
@@ -0,0 +1,84 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+func TestRollups_AccountAggregates(t *testing.T) {
+	ctx := context.Background()
+	email := "rollups-test@example.com"
+	defer func() {
+		cleanupUser(email)
+	}()
+
+	userID := createTestUser(t, email)
+	busy := createTestLink(t, &userID)
+	quiet := createTestLink(t, &userID)
+
+	now := time.Now().UTC()
+	events := []*model.AnalyticsEvent{
+		{LinkID: busy.ID, DeviceType: "Desktop", Country: "GB", Referrer: "google.com", ClickedAt: now},
+		{LinkID: busy.ID, DeviceType: "Mobile", Country: "GB", Referrer: "google.com", ClickedAt: now},
+		{LinkID: busy.ID, DeviceType: "Desktop", Country: "US", ClickedAt: now.Add(-48 * time.Hour)},
+		{LinkID: quiet.ID, DeviceType: "Desktop", Country: "US", ClickedAt: now},
+		// Filtered traffic never reaches the rollups
+		{LinkID: quiet.ID, DeviceType: "Bot", Filtered: true, FilterReason: "bot", ClickedAt: now},
+	}
+	for _, event := range events {
+		if err := testStore.SaveAnalyticsEvent(ctx, event); err != nil {
+			t.Fatalf("SaveAnalyticsEvent failed: %v", err)
+		}
+	}
+
+	since := now.AddDate(0, 0, -7)
+
+	overTime, err := testStore.GetUserClicksOverTime(ctx, userID, since, "day")
+	if err != nil {
+		t.Fatalf("GetUserClicksOverTime failed: %v", err)
+	}
+	total := 0
+	for _, bucket := range overTime {
+		total += bucket.Clicks
+	}
+	if len(overTime) != 2 || total != 4 {
+		t.Errorf("Clicks over time = %+v, want 4 clicks over 2 days", overTime)
+	}
+
+	topLinks, err := testStore.GetUserTopLinks(ctx, userID, since, 10)
+	if err != nil {
+		t.Fatalf("GetUserTopLinks failed: %v", err)
+	}
+	if len(topLinks) != 2 || topLinks[0].ShortCode != busy.ShortCode || topLinks[0].Clicks != 3 {
+		t.Errorf("Top links = %+v, want %s first with 3 clicks", topLinks, busy.ShortCode)
+	}
+
+	referrers, err := testStore.GetUserTopValues(ctx, userID, DimensionReferrer, since, 10)
+	if err != nil {
+		t.Fatalf("GetUserTopValues failed: %v", err)
+	}
+	if len(referrers) != 2 || referrers[0].Value != "google.com" || referrers[0].Clicks != 2 {
+		t.Errorf("Top referrers = %+v, want google.com:2 then direct", referrers)
+	}
+
+	devices, err := testStore.GetUserTopValues(ctx, userID, DimensionDevice, since, 1)
+	if err != nil {
+		t.Fatalf("GetUserTopValues failed: %v", err)
+	}
+	if len(devices) != 1 || devices[0].Value != "Desktop" || devices[0].Clicks != 3 {
+		t.Errorf("Top devices = %+v, want Desktop:3", devices)
+	}
+
+	created, err := testStore.GetUserLinksCreated(ctx, userID, since, "month")
+	if err != nil {
+		t.Fatalf("GetUserLinksCreated failed: %v", err)
+	}
+	if len(created) != 1 || created[0].Links != 2 {
+		t.Errorf("Links created = %+v, want 2 in one month", created)
+	}
+}
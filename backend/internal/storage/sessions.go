@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+// ListUserSessions returns the user's live sessions, most recently used
+// first. Each is described by the family's current token, with the family's
+// first token giving the login time.
+func (s *PostgresStore) ListUserSessions(ctx context.Context, userID uint64) ([]model.Session, error) {
+	query := `
+		WITH families AS (
+			SELECT family_id, MIN(created_at) AS created_at
+			FROM refresh_tokens
+			WHERE user_id = $1
+			GROUP BY family_id
+		)
+		SELECT t.family_id::text, t.user_agent, COALESCE(host(t.ip_address), ''),
+			f.created_at, t.last_used_at, t.expires_at
+		FROM refresh_tokens t
+		JOIN families f ON f.family_id = t.family_id
+		WHERE t.user_id = $1 AND t.rotated_at IS NULL AND t.expires_at > NOW()
+		ORDER BY t.last_used_at DESC
+	`
+
+	rows, err := s.Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []model.Session{}
+	for rows.Next() {
+		var session model.Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserAgent,
+			&session.IPAddress,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// DeleteUserSession revokes every token in one of the user's sessions and
+// reports whether there was anything to revoke. Sessions of other users are
+// left alone, so a guessed ID is indistinguishable from an unknown one.
+func (s *PostgresStore) DeleteUserSession(ctx context.Context, userID uint64, familyID string) (bool, error) {
+	query := `
+		DELETE FROM refresh_tokens
+		WHERE user_id = $1 AND family_id::text = $2
+	`
+
+	tag, err := s.Pool.Exec(ctx, query, userID, familyID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete session: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// PruneRefreshTokens deletes refresh tokens nothing can use any more: whole
+// families whose newest token has expired, and rotated tokens older than
+// rotatedBefore. Rotated tokens are kept until then so that replaying one
+// still revokes its family. It returns how many tokens were deleted.
+func (s *PostgresStore) PruneRefreshTokens(ctx context.Context, rotatedBefore time.Time) (int64, error) {
+	query := `
+		DELETE FROM refresh_tokens t
+		WHERE (t.rotated_at IS NOT NULL AND t.rotated_at < $1)
+			OR NOT EXISTS (
+				SELECT 1 FROM refresh_tokens n
+				WHERE n.family_id = t.family_id AND n.expires_at > NOW()
+			)
+	`
+
+	tag, err := s.Pool.Exec(ctx, query, rotatedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune refresh tokens: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
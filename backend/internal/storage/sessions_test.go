@@ -0,0 +1,158 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+func TestSessions_ListAndDelete(t *testing.T) {
+	ctx := context.Background()
+	email := "sessions-test@example.com"
+	otherEmail := "sessions-other-test@example.com"
+	defer cleanupUser(email)
+	defer cleanupUser(otherEmail)
+
+	userID := createTestUser(t, email)
+	otherID := createTestUser(t, otherEmail)
+	expiresAt := time.Now().Add(time.Hour)
+
+	laptop := model.SessionClient{UserAgent: "laptop", IPAddress: "203.0.113.7"}
+	if err := testStore.CreateRefreshToken(ctx, userID, "sessions-test-laptop", expiresAt, laptop); err != nil {
+		t.Fatalf("CreateRefreshToken failed: %v", err)
+	}
+	if err := testStore.CreateRefreshToken(ctx, userID, "sessions-test-phone", expiresAt, model.SessionClient{UserAgent: "phone"}); err != nil {
+		t.Fatalf("CreateRefreshToken failed: %v", err)
+	}
+	if err := testStore.CreateRefreshToken(ctx, otherID, "sessions-test-other", expiresAt, model.SessionClient{}); err != nil {
+		t.Fatalf("CreateRefreshToken failed: %v", err)
+	}
+
+	// Rotating keeps the session but moves it to the new client details
+	old, err := testStore.GetRefreshToken(ctx, "sessions-test-laptop")
+	if err != nil || old == nil {
+		t.Fatalf("GetRefreshToken failed: %v", err)
+	}
+	moved := model.SessionClient{UserAgent: "laptop updated", IPAddress: "198.51.100.1"}
+	if err := testStore.RotateRefreshToken(ctx, old, "sessions-test-laptop-2", expiresAt, moved); err != nil {
+		t.Fatalf("RotateRefreshToken failed: %v", err)
+	}
+
+	sessions, err := testStore.ListUserSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListUserSessions failed: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Sessions = %d, want 2", len(sessions))
+	}
+
+	var laptopSession *model.Session
+	for i := range sessions {
+		if sessions[i].ID == old.FamilyID {
+			laptopSession = &sessions[i]
+		}
+	}
+	if laptopSession == nil {
+		t.Fatal("Rotated session missing")
+	}
+	if laptopSession.UserAgent != moved.UserAgent || laptopSession.IPAddress != moved.IPAddress {
+		t.Errorf("Session client = %q %q, want the latest refresh", laptopSession.UserAgent, laptopSession.IPAddress)
+	}
+	if !laptopSession.CreatedAt.Equal(old.CreatedAt) {
+		t.Errorf("CreatedAt = %v, want the login time %v", laptopSession.CreatedAt, old.CreatedAt)
+	}
+
+	// Another user's session can't be deleted by ID
+	other, err := testStore.GetRefreshToken(ctx, "sessions-test-other")
+	if err != nil || other == nil {
+		t.Fatalf("GetRefreshToken failed: %v", err)
+	}
+	deleted, err := testStore.DeleteUserSession(ctx, userID, other.FamilyID)
+	if err != nil {
+		t.Fatalf("DeleteUserSession failed: %v", err)
+	}
+	if deleted {
+		t.Error("Deleted another user's session")
+	}
+
+	deleted, err = testStore.DeleteUserSession(ctx, userID, old.FamilyID)
+	if err != nil {
+		t.Fatalf("DeleteUserSession failed: %v", err)
+	}
+	if !deleted {
+		t.Error("Session should be deleted")
+	}
+
+	sessions, err = testStore.ListUserSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListUserSessions failed: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].UserAgent != "phone" {
+		t.Errorf("Sessions = %+v, want only the phone", sessions)
+	}
+}
+
+func TestPruneRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	email := "prune-tokens-test@example.com"
+	defer cleanupUser(email)
+
+	userID := createTestUser(t, email)
+	live := time.Now().Add(time.Hour)
+
+	if err := testStore.CreateRefreshToken(ctx, userID, "prune-test-expired", time.Now().Add(-time.Minute), model.SessionClient{}); err != nil {
+		t.Fatalf("CreateRefreshToken failed: %v", err)
+	}
+	for _, hash := range []string{"prune-test-old", "prune-test-recent"} {
+		if err := testStore.CreateRefreshToken(ctx, userID, hash, live, model.SessionClient{}); err != nil {
+			t.Fatalf("CreateRefreshToken failed: %v", err)
+		}
+	}
+
+	for _, hash := range []string{"prune-test-old", "prune-test-recent"} {
+		token, err := testStore.GetRefreshToken(ctx, hash)
+		if err != nil || token == nil {
+			t.Fatalf("GetRefreshToken failed: %v", err)
+		}
+		if err := testStore.RotateRefreshToken(ctx, token, hash+"-2", live, model.SessionClient{}); err != nil {
+			t.Fatalf("RotateRefreshToken failed: %v", err)
+		}
+	}
+
+	// Rotated long enough ago that replaying it is no longer possible
+	if _, err := testStore.Pool.Exec(ctx, `UPDATE refresh_tokens SET rotated_at = NOW() - INTERVAL '8 days' WHERE token_hash = $1`, "prune-test-old"); err != nil {
+		t.Fatalf("Failed to age rotated token: %v", err)
+	}
+
+	if _, err := testStore.PruneRefreshTokens(ctx, time.Now().Add(-7*24*time.Hour)); err != nil {
+		t.Fatalf("PruneRefreshTokens failed: %v", err)
+	}
+
+	for hash, want := range map[string]bool{
+		"prune-test-expired":  false,
+		"prune-test-old":      false,
+		"prune-test-old-2":    true,
+		"prune-test-recent":   true, // Still needed to detect reuse
+		"prune-test-recent-2": true,
+	} {
+		token, err := testStore.GetRefreshToken(ctx, hash)
+		if err != nil {
+			t.Fatalf("GetRefreshToken failed: %v", err)
+		}
+		if (token != nil) != want {
+			t.Errorf("Token %s kept = %v, want %v", hash, token != nil, want)
+		}
+	}
+
+	sessions, err := testStore.ListUserSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListUserSessions failed: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("Sessions = %d, want the 2 live ones", len(sessions))
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *PostgresStore) CreateShareToken(ctx context.Context, linkID uint64, tokenHash string, expiresAt *time.Time) (*model.ShareToken, error) {
+	query := `
+		INSERT INTO share_tokens (link_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	token := &model.ShareToken{LinkID: linkID, TokenHash: tokenHash, ExpiresAt: expiresAt}
+
+	err := s.Pool.QueryRow(ctx, query, linkID, tokenHash, expiresAt).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create share token: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetShareToken returns nil, nil when no token has the hash. Expiry is left
+// to the caller.
+func (s *PostgresStore) GetShareToken(ctx context.Context, tokenHash string) (*model.ShareToken, error) {
+	query := `
+		SELECT id, link_id, token_hash, expires_at, created_at
+		FROM share_tokens
+		WHERE token_hash = $1
+	`
+
+	token := &model.ShareToken{}
+	err := s.Pool.QueryRow(ctx, query, tokenHash).Scan(
+		&token.ID,
+		&token.LinkID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Not found
+		}
+		return nil, fmt.Errorf("error querying share token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (s *PostgresStore) ListShareTokens(ctx context.Context, linkID uint64) ([]model.ShareToken, error) {
+	query := `
+		SELECT id, link_id, token_hash, expires_at, created_at
+		FROM share_tokens
+		WHERE link_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := s.Pool.Query(ctx, query, linkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list share tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []model.ShareToken{}
+	for rows.Next() {
+		var token model.ShareToken
+		if err := rows.Scan(&token.ID, &token.LinkID, &token.TokenHash, &token.ExpiresAt, &token.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan share token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// DeleteShareToken revokes a token. The link ID keeps owners of one link
+// from revoking tokens of another.
+func (s *PostgresStore) DeleteShareToken(ctx context.Context, linkID uint64, id uint64) error {
+	query := `
+		DELETE FROM share_tokens
+		WHERE id = $1 AND link_id = $2
+	`
+
+	tag, err := s.Pool.Exec(ctx, query, id, linkID)
+	if err != nil {
+		return fmt.Errorf("failed to delete share token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrShareTokenNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShareTokens_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	email := "share-token-test@example.com"
+	defer func() {
+		cleanupUser(email)
+	}()
+
+	userID := createTestUser(t, email)
+	link := createTestLink(t, &userID)
+	otherLink := createTestLink(t, &userID)
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+	created, err := testStore.CreateShareToken(ctx, link.ID, "hash-expiring", &expiresAt)
+	if err != nil {
+		t.Fatalf("CreateShareToken failed: %v", err)
+	}
+	if _, err := testStore.CreateShareToken(ctx, link.ID, "hash-forever", nil); err != nil {
+		t.Fatalf("CreateShareToken failed: %v", err)
+	}
+
+	token, err := testStore.GetShareToken(ctx, "hash-expiring")
+	if err != nil {
+		t.Fatalf("GetShareToken failed: %v", err)
+	}
+	if token == nil || token.ID != created.ID || token.LinkID != link.ID || token.ExpiresAt == nil {
+		t.Fatalf("GetShareToken = %+v, want token %d with expiry", token, created.ID)
+	}
+
+	missing, err := testStore.GetShareToken(ctx, "hash-unknown")
+	if err != nil || missing != nil {
+		t.Errorf("GetShareToken(unknown) = %+v, %v, want nil, nil", missing, err)
+	}
+
+	tokens, err := testStore.ListShareTokens(ctx, link.ID)
+	if err != nil {
+		t.Fatalf("ListShareTokens failed: %v", err)
+	}
+	if len(tokens) != 2 {
+		t.Errorf("Listed %d tokens, want 2", len(tokens))
+	}
+
+	// Tokens can only be revoked through their own link
+	if err := testStore.DeleteShareToken(ctx, otherLink.ID, created.ID); !errors.Is(err, ErrShareTokenNotFound) {
+		t.Errorf("Delete via other link err = %v, want ErrShareTokenNotFound", err)
+	}
+	if err := testStore.DeleteShareToken(ctx, link.ID, created.ID); err != nil {
+		t.Fatalf("DeleteShareToken failed: %v", err)
+	}
+
+	token, _ = testStore.GetShareToken(ctx, "hash-expiring")
+	if token != nil {
+		t.Error("Revoked token still resolves")
+	}
+}
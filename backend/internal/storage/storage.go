@@ -17,6 +17,10 @@ var (
 	ErrUniqueViolation = errors.New("unique violation")
 	ErrLinkNotFound    = errors.New("link not found")
 	ErrNotOwner        = errors.New("not owner")
+
+	ErrShareTokenNotFound = errors.New("share token not found")
+
+	ErrRefreshTokenRotated = errors.New("refresh token already rotated")
 )
 
 type Closer interface {
@@ -31,6 +35,7 @@ type LinkStore interface {
 	DeleteLink(ctx context.Context, shortCode string, userID uint64) error
 	GetTotalLinks(ctx context.Context) (int, error)
 	GetTotalRequests(ctx context.Context) (int, error)
+	SetConversionTracking(ctx context.Context, linkID uint64, enabled bool) error
 }
 
 type AuthStore interface {
@@ -38,20 +43,93 @@ type AuthStore interface {
 	CreateUser(ctx context.Context, email string, passwordHash string) (uint64, error)
 	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
 	GetUserByID(ctx context.Context, id uint64) (*model.User, error)
+	UpdatePassword(ctx context.Context, userID uint64, passwordHash string, keepFamilyID string) error
+	UpdateUserEmail(ctx context.Context, userID uint64, email string) error
+	DeleteUser(ctx context.Context, userID uint64, anonymizeLinks bool) ([]string, error)
 
 	// Refresh token methods
-	CreateRefreshToken(ctx context.Context, userID uint64, tokenHash string, expiresAt time.Time) error
+	CreateRefreshToken(ctx context.Context, userID uint64, tokenHash string, expiresAt time.Time, client model.SessionClient) error
 	GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error)
 	DeleteRefreshToken(ctx context.Context, tokenHash string) error
 	DeleteUserRefreshTokens(ctx context.Context, userID uint64) error
+	RotateRefreshToken(ctx context.Context, old *model.RefreshToken, tokenHash string, expiresAt time.Time, client model.SessionClient) error
+	DeleteRefreshTokenFamily(ctx context.Context, familyID string) error
+
+	// Sessions are refresh token families
+	ListUserSessions(ctx context.Context, userID uint64) ([]model.Session, error)
+	DeleteUserSession(ctx context.Context, userID uint64, familyID string) (bool, error)
+	PruneRefreshTokens(ctx context.Context, rotatedBefore time.Time) (int64, error)
+
+	// Password reset
+	CreatePasswordResetToken(ctx context.Context, userID uint64, tokenHash string, expiresAt time.Time, notSince time.Time) (bool, error)
+	ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (bool, error)
+
+	// Email verification
+	CreateEmailVerificationToken(ctx context.Context, userID uint64, email string, tokenHash string, expiresAt time.Time, notSince time.Time) (bool, error)
+	VerifyEmail(ctx context.Context, tokenHash string) (bool, error)
+
+	// Personal API keys
+	CreateAPIKey(ctx context.Context, userID uint64, name string, prefix string, keyHash string, scopes []string, maxKeys int) (*model.APIKey, error)
+	UseAPIKey(ctx context.Context, keyHash string) (*model.APIKey, error)
+	ListAPIKeys(ctx context.Context, userID uint64) ([]model.APIKey, error)
+	DeleteAPIKey(ctx context.Context, userID uint64, id uint64) (bool, error)
+
+	// Sign in with external OpenID Connect providers
+	GetUserByIdentity(ctx context.Context, provider string, subject string) (*model.User, error)
+	CreateIdentity(ctx context.Context, userID uint64, provider string, subject string) error
+	CreateIdentityUser(ctx context.Context, email string, provider string, subject string) (uint64, error)
+
+	// Two-factor authentication with TOTP
+	GetTwoFactor(ctx context.Context, userID uint64) (*model.TwoFactor, error)
+	SetTOTPSecret(ctx context.Context, userID uint64, secret string) (bool, error)
+	EnableTwoFactor(ctx context.Context, userID uint64, secret string, step int64, recoveryCodeHashes []string) (bool, error)
+	DisableTwoFactor(ctx context.Context, userID uint64) error
+	UseTOTPStep(ctx context.Context, userID uint64, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID uint64, codeHash string) (bool, error)
+	CreateTwoFactorChallenge(ctx context.Context, userID uint64, tokenHash string, expiresAt time.Time) error
+	AttemptTwoFactorChallenge(ctx context.Context, tokenHash string, maxAttempts int) (uint64, error)
+	DeleteTwoFactorChallenge(ctx context.Context, tokenHash string) (bool, error)
 }
 
 type AnalyticsStore interface {
 	Closer
 	SaveAnalyticsEvent(ctx context.Context, event *model.AnalyticsEvent) error
 	GetAnalyticsEvents(ctx context.Context, linkID uint64, period time.Time) ([]*model.AnalyticsEvent, error)
+	StreamAnalyticsEvents(ctx context.Context, filter model.AnalyticsExportFilter, fn func(event *model.AnalyticsEvent) error) error
+
+	// Account-wide aggregates, served from the daily rollups
+	GetUserClicksOverTime(ctx context.Context, userID uint64, since time.Time, interval string) ([]model.ClicksByDate, error)
+	GetUserTopLinks(ctx context.Context, userID uint64, since time.Time, limit int) ([]model.TopLink, error)
+	GetUserTopValues(ctx context.Context, userID uint64, dimension string, since time.Time, limit int) ([]model.DimensionCount, error)
+	GetUserLinksCreated(ctx context.Context, userID uint64, since time.Time, interval string) ([]model.LinksCreated, error)
+
+	// Retention
+	PurgeAnalyticsEvents(ctx context.Context, defaultDays int, batchSize int) (int64, error)
+	SetAnalyticsRetention(ctx context.Context, userID uint64, days *int) error
+
+	// Monthly partitions of the analytics table
+	ListAnalyticsPartitions(ctx context.Context) ([]model.AnalyticsPartition, error)
+	EnsureAnalyticsPartitions(ctx context.Context, through time.Time) ([]string, error)
+	DropAnalyticsPartition(ctx context.Context, name string) error
+
+	// Recent per-link traffic for anomaly detection
+	GetLinkTraffic(ctx context.Context, since time.Time, baselineSince time.Time, minClicks int) ([]model.LinkTraffic, error)
+
+	// Conversions reported for tracked clicks
+	SaveConversion(ctx context.Context, linkID uint64, clickID string) (bool, error)
 }
 
+type ShareStore interface {
+	Closer
+	CreateShareToken(ctx context.Context, linkID uint64, tokenHash string, expiresAt *time.Time) (*model.ShareToken, error)
+	GetShareToken(ctx context.Context, tokenHash string) (*model.ShareToken, error)
+	ListShareTokens(ctx context.Context, linkID uint64) ([]model.ShareToken, error)
+	DeleteShareToken(ctx context.Context, linkID uint64, id uint64) error
+}
+
+// Rows fetched per round trip when streaming events through a cursor.
+const streamBatchSize = 1000
+
 type PostgresStore struct {
 	Pool *pgxpool.Pool // We use the Pool directly from pgxpool
 }
@@ -118,7 +196,7 @@ func (s *PostgresStore) SaveLink(ctx context.Context, longURL string, userID *ui
 
 func (s *PostgresStore) GetLinkByCode(ctx context.Context, shortCode string) (*model.Link, error) {
 	query := `
-		SELECT id, user_id, long_url, short_code, created_at
+		SELECT id, user_id, long_url, short_code, created_at, conversion_tracking
 		FROM links 
 		WHERE short_code = $1;
 	`
@@ -129,6 +207,7 @@ func (s *PostgresStore) GetLinkByCode(ctx context.Context, shortCode string) (*m
 		&link.LongURL,
 		&link.ShortCode,
 		&link.CreatedAt,
+		&link.ConversionTracking,
 	)
 
 	if err != nil {
@@ -171,7 +250,7 @@ func (s *PostgresStore) CreateUser(ctx context.Context, email string, passwordHa
 
 func (s *PostgresStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	query := `
-		SELECT id, email, password_hash, created_at
+		SELECT id, email, password_hash, email_verified, totp_enabled, created_at
 		FROM users
 		WHERE email = $1;
 	`
@@ -181,6 +260,8 @@ func (s *PostgresStore) GetUserByEmail(ctx context.Context, email string) (*mode
 		&user.ID,
 		&user.Email,
 		&user.PasswordHash,
+		&user.EmailVerified,
+		&user.TwoFactorEnabled,
 		&user.CreatedAt,
 	)
 
@@ -196,7 +277,7 @@ func (s *PostgresStore) GetUserByEmail(ctx context.Context, email string) (*mode
 
 func (s *PostgresStore) GetUserByID(ctx context.Context, id uint64) (*model.User, error) {
 	query := `
-		SELECT id, email, password_hash, created_at
+		SELECT id, email, password_hash, email_verified, totp_enabled, created_at
 		FROM users
 		WHERE id = $1;
 	`
@@ -206,6 +287,8 @@ func (s *PostgresStore) GetUserByID(ctx context.Context, id uint64) (*model.User
 		&user.ID,
 		&user.Email,
 		&user.PasswordHash,
+		&user.EmailVerified,
+		&user.TwoFactorEnabled,
 		&user.CreatedAt,
 	)
 
@@ -219,13 +302,13 @@ func (s *PostgresStore) GetUserByID(ctx context.Context, id uint64) (*model.User
 	return user, nil
 }
 
-func (s *PostgresStore) CreateRefreshToken(ctx context.Context, userID uint64, tokenHash string, expiresAt time.Time) error {
+func (s *PostgresStore) CreateRefreshToken(ctx context.Context, userID uint64, tokenHash string, expiresAt time.Time, client model.SessionClient) error {
 	query := `
-		INSERT INTO refresh_tokens (user_id, token_hash, expires_at)
-		VALUES ($1, $2, $3)
+		INSERT INTO refresh_tokens (user_id, token_hash, expires_at, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
 	`
 
-	_, err := s.Pool.Exec(ctx, query, userID, tokenHash, expiresAt)
+	_, err := s.Pool.Exec(ctx, query, userID, tokenHash, expiresAt, client.UserAgent, client.IPAddress)
 	if err != nil {
 		return fmt.Errorf("failed to create refresh token: %w", err)
 	}
@@ -235,7 +318,7 @@ func (s *PostgresStore) CreateRefreshToken(ctx context.Context, userID uint64, t
 
 func (s *PostgresStore) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
 	query := `
-		SELECT id, user_id, token_hash, expires_at, created_at
+		SELECT id, user_id, token_hash, family_id::text, expires_at, rotated_at, created_at
 		FROM refresh_tokens
 		WHERE token_hash = $1
 	`
@@ -245,7 +328,9 @@ func (s *PostgresStore) GetRefreshToken(ctx context.Context, tokenHash string) (
 		&token.ID,
 		&token.UserID,
 		&token.TokenHash,
+		&token.FamilyID,
 		&token.ExpiresAt,
+		&token.RotatedAt,
 		&token.CreatedAt,
 	)
 
@@ -286,31 +371,119 @@ func (s *PostgresStore) DeleteUserRefreshTokens(ctx context.Context, userID uint
 	return nil
 }
 
+// RotateRefreshToken marks the old token as rotated and issues its successor
+// in the same family. If another request rotated it first, it returns
+// ErrRefreshTokenRotated and no new token is created.
+func (s *PostgresStore) RotateRefreshToken(ctx context.Context, old *model.RefreshToken, tokenHash string, expiresAt time.Time, client model.SessionClient) error {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE refresh_tokens SET rotated_at = NOW()
+		WHERE id = $1 AND rotated_at IS NULL
+	`, old.ID)
+	if err != nil {
+		return fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRefreshTokenRotated
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, user_agent, ip_address)
+		VALUES ($1, $2, $3::uuid, $4, $5, NULLIF($6, ''))
+	`, old.UserID, tokenHash, old.FamilyID, expiresAt, client.UserAgent, client.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to create rotated refresh token: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) DeleteRefreshTokenFamily(ctx context.Context, familyID string) error {
+	query := `
+		DELETE FROM refresh_tokens
+		WHERE family_id = $1::uuid
+	`
+
+	_, err := s.Pool.Exec(ctx, query, familyID)
+	if err != nil {
+		return fmt.Errorf("failed to delete refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+// SaveAnalyticsEvent stores the raw event and, for unfiltered clicks, bumps
+// the daily rollups in the same transaction so the two never disagree.
 func (s *PostgresStore) SaveAnalyticsEvent(ctx context.Context, event *model.AnalyticsEvent) error {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
 	query := `
-		INSERT INTO analytics (link_id, ip_address, user_agent, device_type, browser, os, clicked_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO analytics (link_id, ip_address, user_agent, device_type, browser, os, country, region, city, referrer, language, visitor_hash, filtered, filter_reason, click_id, clicked_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''), NULLIF($11, ''), NULLIF($12, ''), $13, NULLIF($14, ''), NULLIF($15, ''), $16)
 	`
 
-	_, err := s.Pool.Exec(ctx, query,
+	_, err = tx.Exec(ctx, query,
 		event.LinkID,
 		event.IPAddress,
 		event.UserAgent,
 		event.DeviceType,
 		event.Browser,
 		event.OS,
+		event.Country,
+		event.Region,
+		event.City,
+		event.Referrer,
+		event.Language,
+		event.VisitorHash,
+		event.Filtered,
+		event.FilterReason,
+		event.ClickID,
 		event.ClickedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to save analytics event: %w", err)
 	}
 
+	if !event.Filtered {
+		if err := incrementRollups(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return nil
 }
 
 func (s *PostgresStore) GetAnalyticsEvents(ctx context.Context, linkID uint64, period time.Time) ([]*model.AnalyticsEvent, error) {
 	query := `
-		SELECT id, link_id, ip_address::text, user_agent, device_type, browser, os, clicked_at
+		SELECT id, link_id, COALESCE(ip_address, ''), COALESCE(user_agent, ''), device_type, browser, os,
+			COALESCE(country, ''), COALESCE(region, ''), COALESCE(city, ''), COALESCE(referrer, ''), COALESCE(language, ''),
+			COALESCE(visitor_hash, ''), filtered, COALESCE(filter_reason, ''), COALESCE(click_id, ''),
+			EXISTS (SELECT 1 FROM conversions c WHERE c.click_id = analytics.click_id), clicked_at
 		FROM analytics
 		WHERE link_id = $1 AND clicked_at > $2
 	`
@@ -332,6 +505,16 @@ func (s *PostgresStore) GetAnalyticsEvents(ctx context.Context, linkID uint64, p
 			&event.DeviceType,
 			&event.Browser,
 			&event.OS,
+			&event.Country,
+			&event.Region,
+			&event.City,
+			&event.Referrer,
+			&event.Language,
+			&event.VisitorHash,
+			&event.Filtered,
+			&event.FilterReason,
+			&event.ClickID,
+			&event.Converted,
 			&event.ClickedAt,
 		)
 		if err != nil {
@@ -342,6 +525,88 @@ func (s *PostgresStore) GetAnalyticsEvents(ctx context.Context, linkID uint64, p
 	return events, nil
 }
 
+// StreamAnalyticsEvents pages through matching events with a server-side
+// cursor and calls fn for each one, so memory stays flat regardless of how
+// many events match. Returning an error from fn stops the stream.
+func (s *PostgresStore) StreamAnalyticsEvents(ctx context.Context, filter model.AnalyticsExportFilter, fn func(event *model.AnalyticsEvent) error) error {
+	tx, err := s.Pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	// Read-only, so there is nothing to lose by always rolling back
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	query := `
+		DECLARE export_cursor NO SCROLL CURSOR FOR
+		SELECT a.id, a.link_id, COALESCE(a.ip_address, ''), COALESCE(a.user_agent, ''), a.device_type, a.browser, a.os,
+			COALESCE(a.country, ''), COALESCE(a.region, ''), COALESCE(a.city, ''), COALESCE(a.referrer, ''), COALESCE(a.language, ''),
+			COALESCE(a.visitor_hash, ''),
+			a.filtered, COALESCE(a.filter_reason, ''), a.clicked_at
+		FROM analytics a
+		JOIN links l ON l.id = a.link_id
+		WHERE ($1::bigint IS NULL OR a.link_id = $1)
+			AND ($2::bigint IS NULL OR l.user_id = $2)
+			AND a.clicked_at >= $3 AND a.clicked_at < $4
+		ORDER BY a.clicked_at, a.id
+	`
+	_, err = tx.Exec(ctx, query, filter.LinkID, filter.UserID, filter.From, filter.To)
+	if err != nil {
+		return fmt.Errorf("failed to declare export cursor: %w", err)
+	}
+
+	for {
+		rows, err := tx.Query(ctx, fmt.Sprintf("FETCH %d FROM export_cursor", streamBatchSize))
+		if err != nil {
+			return fmt.Errorf("failed to fetch analytics events: %w", err)
+		}
+
+		fetched := 0
+		for rows.Next() {
+			var event model.AnalyticsEvent
+			err := rows.Scan(
+				&event.ID,
+				&event.LinkID,
+				&event.IPAddress,
+				&event.UserAgent,
+				&event.DeviceType,
+				&event.Browser,
+				&event.OS,
+				&event.Country,
+				&event.Region,
+				&event.City,
+				&event.Referrer,
+				&event.Language,
+				&event.VisitorHash,
+				&event.Filtered,
+				&event.FilterReason,
+				&event.ClickedAt,
+			)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan analytics event: %w", err)
+			}
+			fetched++
+
+			if err := fn(&event); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read analytics events: %w", err)
+		}
+
+		if fetched < streamBatchSize {
+			return nil
+		}
+	}
+}
+
 func (s *PostgresStore) DeleteLink(ctx context.Context, shortCode string, userID uint64) error {
 	link, err := s.GetLinkByCode(ctx, shortCode)
 	if err != nil {
@@ -398,7 +663,7 @@ func (s *PostgresStore) GetUserLinks(ctx context.Context, userID uint64, limit i
 		WITH total AS (
 		SELECT count(*) as amount FROM links WHERE user_id = $1
 		)
-		SELECT id, user_id, long_url, short_code, created_at, total.amount
+		SELECT id, user_id, long_url, short_code, created_at, conversion_tracking, total.amount
 		FROM links, total
 		WHERE user_id = $1
 		ORDER BY created_at desc
@@ -423,6 +688,7 @@ func (s *PostgresStore) GetUserLinks(ctx context.Context, userID uint64, limit i
 			&link.LongURL,
 			&link.ShortCode,
 			&link.CreatedAt,
+			&link.ConversionTracking,
 			&total,
 		)
 		if err != nil {
@@ -445,7 +711,7 @@ func (s *PostgresStore) GetTotalLinks(ctx context.Context) (int, error) {
 }
 
 func (s *PostgresStore) GetTotalRequests(ctx context.Context) (int, error) {
-	query := `SELECT COUNT(*) FROM analytics`
+	query := `SELECT COUNT(*) FROM analytics WHERE NOT filtered`
 	var total int
 	err := s.Pool.QueryRow(ctx, query).Scan(&total)
 	if err != nil {
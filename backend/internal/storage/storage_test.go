@@ -31,6 +31,11 @@ func TestMain(m *testing.M) {
 		log.Fatalf("Failed to initialize test store: %v", err)
 	}
 
+	// The server normally keeps these created ahead
+	if _, err := testStore.EnsureAnalyticsPartitions(context.Background(), time.Now().AddDate(0, 1, 0)); err != nil {
+		log.Fatalf("Failed to create analytics partitions: %v", err)
+	}
+
 	exitCode := m.Run()
 
 	testStore.Close()
@@ -390,6 +395,119 @@ func TestSaveAnalyticsEvent_Success(t *testing.T) {
 	}
 }
 
+func TestSaveAnalyticsEvent_GeoRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	email := "save-event-geo-test@example.com"
+	defer func() {
+		cleanupUser(email)
+	}()
+
+	userID := createTestUser(t, email)
+	link := createTestLink(t, &userID)
+
+	enriched := &model.AnalyticsEvent{
+		LinkID:    link.ID,
+		IPAddress: "81.2.69.0",
+		Country:   "GB",
+		Region:    "England",
+		City:      "London",
+		Language:  "en-GB",
+		ClickedAt: time.Now(),
+	}
+	// Deployments without a GeoIP database save events with no location
+	plain := &model.AnalyticsEvent{
+		LinkID:    link.ID,
+		IPAddress: "192.168.1.0",
+		ClickedAt: time.Now(),
+	}
+
+	for _, event := range []*model.AnalyticsEvent{enriched, plain} {
+		if err := testStore.SaveAnalyticsEvent(ctx, event); err != nil {
+			t.Fatalf("SaveAnalyticsEvent failed: %v", err)
+		}
+	}
+
+	events, err := testStore.GetAnalyticsEvents(ctx, link.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("GetAnalyticsEvents failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Got %d events, want 2", len(events))
+	}
+
+	found := false
+	for _, event := range events {
+		if event.Country == "GB" {
+			found = true
+			if event.Region != "England" || event.City != "London" {
+				t.Errorf("Region/City = %s/%s, want England/London", event.Region, event.City)
+			}
+			if event.Language != "en-GB" {
+				t.Errorf("Language = %q, want en-GB", event.Language)
+			}
+		} else if event.Country != "" || event.City != "" || event.Language != "" {
+			t.Errorf("Expected empty location and language, got %s/%s/%s", event.Country, event.City, event.Language)
+		}
+	}
+	if !found {
+		t.Error("Enriched event not returned")
+	}
+}
+
+func TestStreamAnalyticsEvents_PagesThroughCursor(t *testing.T) {
+	ctx := context.Background()
+	email := "stream-events-test@example.com"
+	defer func() {
+		cleanupUser(email)
+	}()
+
+	userID := createTestUser(t, email)
+	link := createTestLink(t, &userID)
+	otherLink := createTestLink(t, &userID)
+
+	// More than one batch, plus an event outside the range
+	start := time.Now().Add(-time.Hour)
+	total := streamBatchSize + 5
+	for i := 0; i < total; i++ {
+		event := &model.AnalyticsEvent{LinkID: link.ID, IPAddress: "1.1.1.0", ClickedAt: start.Add(time.Duration(i) * time.Millisecond)}
+		if err := testStore.SaveAnalyticsEvent(ctx, event); err != nil {
+			t.Fatalf("SaveAnalyticsEvent failed: %v", err)
+		}
+	}
+	_ = testStore.SaveAnalyticsEvent(ctx, &model.AnalyticsEvent{LinkID: link.ID, ClickedAt: start.Add(-time.Hour)})
+	_ = testStore.SaveAnalyticsEvent(ctx, &model.AnalyticsEvent{LinkID: otherLink.ID, ClickedAt: start})
+
+	filter := model.AnalyticsExportFilter{LinkID: &link.ID, From: start, To: time.Now()}
+
+	count := 0
+	var last time.Time
+	err := testStore.StreamAnalyticsEvents(ctx, filter, func(event *model.AnalyticsEvent) error {
+		if event.ClickedAt.Before(last) {
+			t.Fatal("Events are not ordered by clicked_at")
+		}
+		last = event.ClickedAt
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamAnalyticsEvents failed: %v", err)
+	}
+	if count != total {
+		t.Errorf("Streamed %d events, want %d", count, total)
+	}
+
+	// Account-wide export covers every link the user owns
+	accountFilter := model.AnalyticsExportFilter{UserID: &userID, From: start, To: time.Now()}
+	count = 0
+	_ = testStore.StreamAnalyticsEvents(ctx, accountFilter, func(event *model.AnalyticsEvent) error {
+		count++
+		return nil
+	})
+	if count != total+1 {
+		t.Errorf("Streamed %d account events, want %d", count, total+1)
+	}
+}
+
 // Test #35: GetTotalLinks returns correct count
 func TestGetTotalLinks_Success(t *testing.T) {
 	ctx := context.Background()
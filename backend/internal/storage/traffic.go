@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+// GetLinkTraffic summarizes clicks since the given time for every owned link
+// with at least minClicks of them (filtered included), along with each
+// link's unfiltered clicks between baselineSince and since.
+func (s *PostgresStore) GetLinkTraffic(ctx context.Context, since time.Time, baselineSince time.Time, minClicks int) ([]model.LinkTraffic, error) {
+	query := `
+		WITH recent AS (
+			SELECT link_id,
+				COUNT(*) FILTER (WHERE NOT filtered) AS clicks,
+				COUNT(*) AS all_clicks,
+				COUNT(*) FILTER (WHERE filter_reason = 'bot') AS bot_clicks
+			FROM analytics
+			WHERE clicked_at >= $1
+			GROUP BY link_id
+			HAVING COUNT(*) >= $3
+		),
+		-- ip_address is TEXT holding the already truncated or hashed value
+		top_network AS (
+			SELECT DISTINCT ON (link_id) link_id, ip_address AS network, COUNT(*) AS hits
+			FROM analytics
+			WHERE clicked_at >= $1
+				AND ip_address IS NOT NULL
+				AND link_id IN (SELECT link_id FROM recent)
+			GROUP BY link_id, ip_address
+			ORDER BY link_id, hits DESC
+		),
+		baseline AS (
+			SELECT link_id, COUNT(*) AS clicks
+			FROM analytics
+			WHERE clicked_at >= $2 AND clicked_at < $1
+				AND NOT filtered
+				AND link_id IN (SELECT link_id FROM recent)
+			GROUP BY link_id
+		)
+		SELECT r.link_id, l.short_code, u.id, u.email,
+			r.clicks, r.all_clicks, r.bot_clicks,
+			COALESCE(t.network, ''), COALESCE(t.hits, 0),
+			COALESCE(b.clicks, 0)
+		FROM recent r
+		JOIN links l ON l.id = r.link_id
+		JOIN users u ON u.id = l.user_id
+		LEFT JOIN top_network t ON t.link_id = r.link_id
+		LEFT JOIN baseline b ON b.link_id = r.link_id
+	`
+
+	rows, err := s.Pool.Query(ctx, query, since, baselineSince, minClicks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link traffic: %w", err)
+	}
+	defer rows.Close()
+
+	traffic := []model.LinkTraffic{}
+	for rows.Next() {
+		var t model.LinkTraffic
+		err := rows.Scan(
+			&t.LinkID,
+			&t.ShortCode,
+			&t.UserID,
+			&t.OwnerEmail,
+			&t.Clicks,
+			&t.AllClicks,
+			&t.BotClicks,
+			&t.TopNetwork,
+			&t.TopNetworkHits,
+			&t.BaselineClicks,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan link traffic: %w", err)
+		}
+		traffic = append(traffic, t)
+	}
+
+	return traffic, rows.Err()
+}
@@ -0,0 +1,71 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+func TestGetLinkTraffic_SummarizesWindow(t *testing.T) {
+	ctx := context.Background()
+	email := "traffic-test@example.com"
+	defer cleanupUser(email)
+
+	userID := createTestUser(t, email)
+	link := createTestLink(t, &userID)
+	quiet := createTestLink(t, &userID)
+
+	now := time.Now()
+	events := []*model.AnalyticsEvent{
+		{LinkID: link.ID, IPAddress: "203.0.113.0", ClickedAt: now},
+		{LinkID: link.ID, IPAddress: "203.0.113.0", ClickedAt: now},
+		{LinkID: link.ID, IPAddress: "198.51.100.0", ClickedAt: now},
+		{LinkID: link.ID, IPAddress: "203.0.113.0", ClickedAt: now, Filtered: true, FilterReason: "bot"},
+		// Hashed and dropped IPs, as stored by the other IP privacy modes
+		{LinkID: link.ID, IPAddress: "a3f1c2d4e5b6a7f8", ClickedAt: now},
+		{LinkID: link.ID, ClickedAt: now},
+		{LinkID: link.ID, IPAddress: "192.0.2.0", ClickedAt: now.Add(-2 * time.Hour)},
+		{LinkID: quiet.ID, IPAddress: "192.0.2.0", ClickedAt: now},
+	}
+	for _, event := range events {
+		if err := testStore.SaveAnalyticsEvent(ctx, event); err != nil {
+			t.Fatalf("SaveAnalyticsEvent failed: %v", err)
+		}
+	}
+
+	since := now.Add(-time.Hour)
+	traffic, err := testStore.GetLinkTraffic(ctx, since, since.Add(-24*time.Hour), 2)
+	if err != nil {
+		t.Fatalf("GetLinkTraffic failed: %v", err)
+	}
+
+	var got *model.LinkTraffic
+	for i := range traffic {
+		if traffic[i].LinkID == quiet.ID {
+			t.Error("Link below the click minimum should be skipped")
+		}
+		if traffic[i].LinkID == link.ID {
+			got = &traffic[i]
+		}
+	}
+	if got == nil {
+		t.Fatal("Busy link missing from traffic")
+	}
+
+	if got.ShortCode != link.ShortCode || got.UserID != userID || got.OwnerEmail != email {
+		t.Errorf("Owner = %s/%d/%s, want %s/%d/%s", got.ShortCode, got.UserID, got.OwnerEmail, link.ShortCode, userID, email)
+	}
+	if got.Clicks != 5 || got.AllClicks != 6 || got.BotClicks != 1 {
+		t.Errorf("Clicks = %d/%d/%d, want 5/6/1", got.Clicks, got.AllClicks, got.BotClicks)
+	}
+	if got.TopNetwork != "203.0.113.0" || got.TopNetworkHits != 3 {
+		t.Errorf("Top network = %s (%d), want 203.0.113.0 (3)", got.TopNetwork, got.TopNetworkHits)
+	}
+	if got.BaselineClicks != 1 {
+		t.Errorf("BaselineClicks = %d, want 1", got.BaselineClicks)
+	}
+}
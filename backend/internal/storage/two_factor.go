@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetTwoFactor returns a user's TOTP setup, or nil if the user doesn't exist.
+func (s *PostgresStore) GetTwoFactor(ctx context.Context, userID uint64) (*model.TwoFactor, error) {
+	query := `SELECT COALESCE(totp_secret, ''), totp_enabled, totp_last_step FROM users WHERE id = $1`
+
+	twoFactor := &model.TwoFactor{}
+	err := s.Pool.QueryRow(ctx, query, userID).Scan(&twoFactor.Secret, &twoFactor.Enabled, &twoFactor.LastStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get two-factor settings: %w", err)
+	}
+
+	return twoFactor, nil
+}
+
+// SetTOTPSecret stores the secret of a new enrollment, replacing any earlier
+// one that was never activated. It reports false when two-factor
+// authentication is already enabled.
+func (s *PostgresStore) SetTOTPSecret(ctx context.Context, userID uint64, secret string) (bool, error) {
+	query := `
+		UPDATE users SET totp_secret = $2, totp_last_step = 0
+		WHERE id = $1 AND NOT totp_enabled
+	`
+
+	tag, err := s.Pool.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return false, fmt.Errorf("failed to set TOTP secret: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// EnableTwoFactor turns on two-factor authentication with the enrolled
+// secret, recording step as used and replacing the recovery codes. It reports
+// false when the secret was replaced or two-factor authentication was enabled
+// in the meantime.
+func (s *PostgresStore) EnableTwoFactor(ctx context.Context, userID uint64, secret string, step int64, recoveryCodeHashes []string) (bool, error) {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE users SET totp_enabled = TRUE, totp_last_step = $3
+		WHERE id = $1 AND totp_secret = $2 AND NOT totp_enabled
+	`, userID, secret, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO two_factor_recovery_codes (user_id, code_hash)
+		SELECT $1, UNNEST($2::text[])
+	`, userID, recoveryCodeHashes)
+	if err != nil {
+		return false, fmt.Errorf("failed to create recovery codes: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// DisableTwoFactor turns off two-factor authentication and forgets the
+// secret, the recovery codes and any pending login challenges.
+func (s *PostgresStore) DisableTwoFactor(ctx context.Context, userID uint64) error {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = 0
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM two_factor_challenges WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete login challenges: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep records that a code from step was accepted. It reports false
+// when a code from that step or a later one was accepted before, which is
+// how a code is kept from being used twice.
+func (s *PostgresStore) UseTOTPStep(ctx context.Context, userID uint64, step int64) (bool, error) {
+	query := `UPDATE users SET totp_last_step = $2 WHERE id = $1 AND totp_last_step < $2`
+
+	tag, err := s.Pool.Exec(ctx, query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to use TOTP step: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode uses up one of the user's recovery codes. It reports false
+// when the code is unknown or already used.
+func (s *PostgresStore) UseRecoveryCode(ctx context.Context, userID uint64, codeHash string) (bool, error) {
+	query := `
+		UPDATE two_factor_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	tag, err := s.Pool.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// CreateTwoFactorChallenge stores a login challenge and drops the user's
+// expired ones.
+func (s *PostgresStore) CreateTwoFactorChallenge(ctx context.Context, userID uint64, tokenHash string, expiresAt time.Time) error {
+	query := `
+		WITH expired AS (
+			DELETE FROM two_factor_challenges WHERE user_id = $1 AND expires_at < NOW()
+		)
+		INSERT INTO two_factor_challenges (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`
+
+	_, err := s.Pool.Exec(ctx, query, userID, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create login challenge: %w", err)
+	}
+	return nil
+}
+
+// AttemptTwoFactorChallenge counts an attempt at an unexpired challenge and
+// returns its user. It returns 0 when the challenge is unknown or expired, or
+// when the user's unexpired challenges had maxAttempts between them, so that
+// logging in again doesn't give more guesses.
+func (s *PostgresStore) AttemptTwoFactorChallenge(ctx context.Context, tokenHash string, maxAttempts int) (uint64, error) {
+	query := `
+		UPDATE two_factor_challenges c SET attempts = c.attempts + 1
+		WHERE c.token_hash = $1 AND c.expires_at > NOW()
+		  AND (
+			SELECT COALESCE(SUM(attempts), 0) FROM two_factor_challenges
+			WHERE user_id = c.user_id AND expires_at > NOW()
+		  ) < $2
+		RETURNING c.user_id
+	`
+
+	var userID uint64
+	err := s.Pool.QueryRow(ctx, query, tokenHash, maxAttempts).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to attempt login challenge: %w", err)
+	}
+
+	return userID, nil
+}
+
+// DeleteTwoFactorChallenge uses up a challenge once it was answered. It
+// reports false when it was already used.
+func (s *PostgresStore) DeleteTwoFactorChallenge(ctx context.Context, tokenHash string) (bool, error) {
+	query := `DELETE FROM two_factor_challenges WHERE token_hash = $1`
+
+	tag, err := s.Pool.Exec(ctx, query, tokenHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete login challenge: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
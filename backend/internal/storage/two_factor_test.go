@@ -0,0 +1,103 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTwoFactor(t *testing.T) {
+	ctx := context.Background()
+	email := "two-factor-storage-test@example.com"
+	defer cleanupUser(email)
+
+	userID := createTestUser(t, email)
+
+	twoFactor, err := testStore.GetTwoFactor(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetTwoFactor failed: %v", err)
+	}
+	if twoFactor == nil || twoFactor.Secret != "" || twoFactor.Enabled {
+		t.Fatalf("TwoFactor = %+v, want nothing set up", twoFactor)
+	}
+
+	if set, err := testStore.SetTOTPSecret(ctx, userID, "OLDSECRET"); err != nil || !set {
+		t.Fatalf("SetTOTPSecret = %v, %v", set, err)
+	}
+	if set, err := testStore.SetTOTPSecret(ctx, userID, "NEWSECRET"); err != nil || !set {
+		t.Fatalf("SetTOTPSecret = %v, %v", set, err)
+	}
+
+	// Only the latest enrollment can be activated
+	if enabled, err := testStore.EnableTwoFactor(ctx, userID, "OLDSECRET", 100, []string{"old-hash"}); err != nil || enabled {
+		t.Errorf("EnableTwoFactor with replaced secret = %v, %v; want false", enabled, err)
+	}
+	if enabled, err := testStore.EnableTwoFactor(ctx, userID, "NEWSECRET", 100, []string{"hash-1", "hash-2"}); err != nil || !enabled {
+		t.Fatalf("EnableTwoFactor = %v, %v", enabled, err)
+	}
+	if set, err := testStore.SetTOTPSecret(ctx, userID, "OTHERSECRET"); err != nil || set {
+		t.Errorf("SetTOTPSecret once enabled = %v, %v; want false", set, err)
+	}
+
+	user, err := testStore.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetUserByID failed: %v", err)
+	}
+	if !user.TwoFactorEnabled {
+		t.Error("User should have two-factor authentication enabled")
+	}
+
+	// Steps only move forward
+	if used, err := testStore.UseTOTPStep(ctx, userID, 100); err != nil || used {
+		t.Errorf("UseTOTPStep with the activation step = %v, %v; want false", used, err)
+	}
+	if used, err := testStore.UseTOTPStep(ctx, userID, 101); err != nil || !used {
+		t.Errorf("UseTOTPStep with a later step = %v, %v; want true", used, err)
+	}
+
+	if used, err := testStore.UseRecoveryCode(ctx, userID, "hash-1"); err != nil || !used {
+		t.Errorf("UseRecoveryCode = %v, %v; want true", used, err)
+	}
+	if used, err := testStore.UseRecoveryCode(ctx, userID, "hash-1"); err != nil || used {
+		t.Errorf("UseRecoveryCode again = %v, %v; want false", used, err)
+	}
+	if used, err := testStore.UseRecoveryCode(ctx, userID, "old-hash"); err != nil || used {
+		t.Errorf("UseRecoveryCode with unknown code = %v, %v; want false", used, err)
+	}
+
+	if err := testStore.CreateTwoFactorChallenge(ctx, userID, "two-factor-challenge", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("CreateTwoFactorChallenge failed: %v", err)
+	}
+	for i := range 2 {
+		got, err := testStore.AttemptTwoFactorChallenge(ctx, "two-factor-challenge", 2)
+		if err != nil {
+			t.Fatalf("AttemptTwoFactorChallenge failed: %v", err)
+		}
+		if got != userID {
+			t.Errorf("Attempt %d user = %d, want %d", i+1, got, userID)
+		}
+	}
+	if got, err := testStore.AttemptTwoFactorChallenge(ctx, "two-factor-challenge", 2); err != nil || got != 0 {
+		t.Errorf("Attempt past the limit = %d, %v; want 0", got, err)
+	}
+
+	if deleted, err := testStore.DeleteTwoFactorChallenge(ctx, "two-factor-challenge"); err != nil || !deleted {
+		t.Errorf("DeleteTwoFactorChallenge = %v, %v; want true", deleted, err)
+	}
+
+	if err := testStore.DisableTwoFactor(ctx, userID); err != nil {
+		t.Fatalf("DisableTwoFactor failed: %v", err)
+	}
+	twoFactor, err = testStore.GetTwoFactor(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetTwoFactor failed: %v", err)
+	}
+	if twoFactor.Enabled || twoFactor.Secret != "" {
+		t.Errorf("TwoFactor = %+v, want it turned off and forgotten", twoFactor)
+	}
+	if used, err := testStore.UseRecoveryCode(ctx, userID, "hash-2"); err != nil || used {
+		t.Errorf("Recovery code after disabling = %v, %v; want false", used, err)
+	}
+}
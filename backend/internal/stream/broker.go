@@ -0,0 +1,113 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+var (
+	ErrTooManyConnections     = errors.New("too many live connections")
+	ErrTooManyUserConnections = errors.New("too many live connections for user")
+)
+
+// Clicks buffered per subscriber; a subscriber that falls further behind
+// than this misses clicks rather than slowing down the redirect path.
+const subscriberBuffer = 64
+
+type Publisher interface {
+	Publish(ctx context.Context, click model.LiveClick) error
+}
+
+type Subscription struct {
+	C      <-chan model.LiveClick
+	ch     chan model.LiveClick
+	linkID uint64
+	userID uint64
+}
+
+// Broker fans clicks out to the live connections of this process.
+type Broker struct {
+	MaxConnections        int
+	MaxConnectionsPerUser int
+
+	mu          sync.Mutex
+	subscribers map[uint64]map[*Subscription]struct{}
+	perUser     map[uint64]int
+	total       int
+}
+
+func NewBroker(maxConnections int, maxConnectionsPerUser int) *Broker {
+	return &Broker{
+		MaxConnections:        maxConnections,
+		MaxConnectionsPerUser: maxConnectionsPerUser,
+		subscribers:           make(map[uint64]map[*Subscription]struct{}),
+		perUser:               make(map[uint64]int),
+	}
+}
+
+func (b *Broker) Subscribe(userID uint64, linkID uint64) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.total >= b.MaxConnections {
+		return nil, ErrTooManyConnections
+	}
+	if b.perUser[userID] >= b.MaxConnectionsPerUser {
+		return nil, ErrTooManyUserConnections
+	}
+
+	ch := make(chan model.LiveClick, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, linkID: linkID, userID: userID}
+
+	if b.subscribers[linkID] == nil {
+		b.subscribers[linkID] = make(map[*Subscription]struct{})
+	}
+	b.subscribers[linkID][sub] = struct{}{}
+	b.perUser[userID]++
+	b.total++
+
+	return sub, nil
+}
+
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs, ok := b.subscribers[sub.linkID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subscribers, sub.linkID)
+	}
+
+	b.perUser[sub.userID]--
+	if b.perUser[sub.userID] == 0 {
+		delete(b.perUser, sub.userID)
+	}
+	b.total--
+
+	close(sub.ch)
+}
+
+// Publish delivers the click to local subscribers without blocking.
+func (b *Broker) Publish(ctx context.Context, click model.LiveClick) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers[click.LinkID] {
+		select {
+		case sub.ch <- click:
+		default:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+//go:build unit
+
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+)
+
+func TestBroker_DeliversToLinkSubscribers(t *testing.T) {
+	broker := NewBroker(10, 10)
+
+	sub, err := broker.Subscribe(1, 100)
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	other, _ := broker.Subscribe(1, 200)
+
+	_ = broker.Publish(context.Background(), model.LiveClick{LinkID: 100, DeviceType: "Mobile"})
+
+	select {
+	case click := <-sub.C:
+		if click.DeviceType != "Mobile" {
+			t.Errorf("DeviceType = %s, want Mobile", click.DeviceType)
+		}
+	default:
+		t.Fatal("Expected click on link 100 subscription")
+	}
+
+	select {
+	case <-other.C:
+		t.Error("Subscription for link 200 should not get link 100 clicks")
+	default:
+	}
+}
+
+func TestBroker_ConnectionLimits(t *testing.T) {
+	broker := NewBroker(3, 2)
+
+	first, _ := broker.Subscribe(1, 100)
+	_, _ = broker.Subscribe(1, 100)
+
+	if _, err := broker.Subscribe(1, 100); !errors.Is(err, ErrTooManyUserConnections) {
+		t.Errorf("Error = %v, want ErrTooManyUserConnections", err)
+	}
+
+	_, _ = broker.Subscribe(2, 100)
+	if _, err := broker.Subscribe(3, 100); !errors.Is(err, ErrTooManyConnections) {
+		t.Errorf("Error = %v, want ErrTooManyConnections", err)
+	}
+
+	// Closing a connection frees its slot
+	broker.Unsubscribe(first)
+	if _, err := broker.Subscribe(1, 100); err != nil {
+		t.Errorf("Subscribe after unsubscribe failed: %v", err)
+	}
+}
+
+func TestBroker_UnsubscribeClosesChannel(t *testing.T) {
+	broker := NewBroker(10, 10)
+
+	sub, _ := broker.Subscribe(1, 100)
+	broker.Unsubscribe(sub)
+	broker.Unsubscribe(sub) // Second call is a no-op
+
+	if _, ok := <-sub.C; ok {
+		t.Error("Expected channel to be closed")
+	}
+}
+
+// A stalled viewer must never block the redirect path
+func TestBroker_SlowSubscriberDoesNotBlock(t *testing.T) {
+	broker := NewBroker(10, 10)
+	sub, _ := broker.Subscribe(1, 100)
+
+	for i := 0; i < subscriberBuffer*2; i++ {
+		_ = broker.Publish(context.Background(), model.LiveClick{LinkID: 100})
+	}
+
+	if len(sub.C) != subscriberBuffer {
+		t.Errorf("Buffered %d clicks, want %d", len(sub.C), subscriberBuffer)
+	}
+}
@@ -0,0 +1,65 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/Unhyphenated/shrinks-backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+const clicksChannel = "live:clicks"
+
+// RedisRelay fans clicks out across replicas: every replica publishes to one
+// Redis channel and relays what it receives to its local Broker, so a viewer
+// sees clicks no matter which replica served the redirect.
+type RedisRelay struct {
+	Client *redis.Client
+	Broker *Broker
+}
+
+func NewRedisRelay(client *redis.Client, broker *Broker) *RedisRelay {
+	return &RedisRelay{Client: client, Broker: broker}
+}
+
+func (r *RedisRelay) Publish(ctx context.Context, click model.LiveClick) error {
+	payload, err := json.Marshal(click)
+	if err != nil {
+		return fmt.Errorf("failed to encode live click: %w", err)
+	}
+
+	if err := r.Client.Publish(ctx, clicksChannel, payload).Err(); err != nil {
+		// Local viewers still get it even if other replicas don't
+		_ = r.Broker.Publish(ctx, click)
+		return fmt.Errorf("failed to publish live click: %w", err)
+	}
+	return nil
+}
+
+// Run relays clicks from Redis to the local Broker until ctx is cancelled.
+// go-redis resubscribes on its own after connection errors.
+func (r *RedisRelay) Run(ctx context.Context) {
+	pubsub := r.Client.Subscribe(ctx, clicksChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			var click model.LiveClick
+			if err := json.Unmarshal([]byte(msg.Payload), &click); err != nil {
+				log.Printf("failed to decode live click: %v", err)
+				continue
+			}
+			_ = r.Broker.Publish(ctx, click)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+//go:build unit
+
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// The SHA-1 seed from the RFC 6238 test vectors, base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode_RFC6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B lists eight digit codes; ours are their last six
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code failed: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret failed: %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	step := Step(now)
+
+	for _, offset := range []int64{-1, 0, 1} {
+		code, _ := Code(secret, step+offset)
+		matched, ok := Validate(secret, code, now)
+		if !ok || matched != step+offset {
+			t.Errorf("Code from step %+d: matched %d, %v; want %d", offset, matched, ok, step+offset)
+		}
+	}
+
+	for _, offset := range []int64{-2, 2} {
+		code, _ := Code(secret, step+offset)
+		if _, ok := Validate(secret, code, now); ok {
+			t.Errorf("Code from step %+d should be refused", offset)
+		}
+	}
+
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Error("Short code should be refused")
+	}
+	if _, ok := Validate("not base32!", "123456", now); ok {
+		t.Error("Invalid secret should refuse every code")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(ProvisioningURI("Shrinks", "user@example.com", rfcSecret))
+	if err != nil {
+		t.Fatalf("Invalid URI: %v", err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Shrinks:user@example.com" {
+		t.Errorf("URI = %s, want otpauth://totp/Shrinks:user@example.com", uri)
+	}
+
+	query := uri.Query()
+	if query.Get("secret") != rfcSecret || query.Get("issuer") != "Shrinks" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("Query = %v", query)
+	}
+}
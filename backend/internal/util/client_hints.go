@@ -0,0 +1,128 @@
+package util
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Platforms as reported by Sec-CH-UA-Platform, mapped to the names the
+// user-agent parser uses so both sources group together.
+var clientHintPlatforms = map[string]string{
+	"Android":     "Android",
+	"Chrome OS":   "ChromeOS",
+	"Chromium OS": "ChromeOS",
+	"iOS":         "iOS",
+	"Linux":       "Linux",
+	"macOS":       "macOS",
+	"Windows":     "Windows",
+}
+
+// ParseClientInfo parses the User-Agent and then applies the Sec-CH-UA-Platform
+// and Sec-CH-UA-Mobile client hints where sent. Chromium freezes most of its
+// UA string, so the hints are the more reliable source when both are present.
+func ParseClientInfo(header http.Header) UserAgentInfo {
+	info := ParseUserAgent(header.Get("User-Agent"))
+
+	// Bot detection only comes from the UA string; don't let hints hide it
+	if info.DeviceType == "Bot" {
+		return info
+	}
+
+	platform := unquoteHint(header.Get("Sec-CH-UA-Platform"))
+	if os, ok := clientHintPlatforms[platform]; ok {
+		info.OS = os
+	}
+
+	switch header.Get("Sec-CH-UA-Mobile") {
+	case "?1":
+		info.DeviceType = "Mobile"
+	case "?0":
+		// Android tablets report themselves as not mobile
+		if platform == "Android" {
+			info.DeviceType = "Tablet"
+		} else {
+			info.DeviceType = "Desktop"
+		}
+	}
+
+	return info
+}
+
+// unquoteHint strips the quotes from a structured-header string such as
+// "Windows". Malformed values come back empty.
+func unquoteHint(value string) string {
+	unquoted, err := strconv.Unquote(strings.TrimSpace(value))
+	if err != nil {
+		return ""
+	}
+	return unquoted
+}
+
+// PrimaryLanguage returns the most preferred language tag in an
+// Accept-Language header, normalized like "en-US", or "" when there is none.
+func PrimaryLanguage(acceptLanguage string) string {
+	type preference struct {
+		tag     string
+		quality float64
+	}
+
+	preferences := []preference{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		preferences = append(preferences, preference{tag: tag, quality: quality})
+	}
+
+	if len(preferences) == 0 {
+		return ""
+	}
+
+	// Stable, so equal weights keep the order the browser listed them in
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+
+	return normalizeLanguageTag(preferences[0].tag)
+}
+
+// normalizeLanguageTag applies the usual BCP 47 casing, so "EN-us" and
+// "en-US" are counted together: lowercase language, titlecase script and
+// uppercase region.
+func normalizeLanguageTag(tag string) string {
+	subtags := strings.Split(tag, "-")
+	for i, subtag := range subtags {
+		switch {
+		case i > 0 && len(subtag) == 2:
+			subtags[i] = strings.ToUpper(subtag)
+		case i > 0 && len(subtag) == 4:
+			subtags[i] = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		default:
+			subtags[i] = strings.ToLower(subtag)
+		}
+	}
+
+	normalized := strings.Join(subtags, "-")
+	// Matches the analytics column size
+	if len(normalized) > 35 {
+		return ""
+	}
+	return normalized
+}
@@ -0,0 +1,101 @@
+//go:build unit
+
+package util
+
+import (
+	"net/http"
+	"testing"
+)
+
+const reducedChromeUA = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+
+func TestParseClientInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     map[string]string
+		wantOS     string
+		wantDevice string
+	}{
+		{
+			name:       "No hints falls back to the UA",
+			header:     map[string]string{"User-Agent": reducedChromeUA},
+			wantOS:     "macOS",
+			wantDevice: "Desktop",
+		},
+		{
+			// Chrome on Windows 11 with a frozen macOS-looking UA would be misreported without hints
+			name:       "Platform hint overrides the UA",
+			header:     map[string]string{"User-Agent": reducedChromeUA, "Sec-CH-UA-Platform": `"Windows"`, "Sec-CH-UA-Mobile": "?0"},
+			wantOS:     "Windows",
+			wantDevice: "Desktop",
+		},
+		{
+			name:       "Mobile hint",
+			header:     map[string]string{"User-Agent": reducedChromeUA, "Sec-CH-UA-Platform": `"Android"`, "Sec-CH-UA-Mobile": "?1"},
+			wantOS:     "Android",
+			wantDevice: "Mobile",
+		},
+		{
+			name:       "Android tablet",
+			header:     map[string]string{"User-Agent": reducedChromeUA, "Sec-CH-UA-Platform": `"Android"`, "Sec-CH-UA-Mobile": "?0"},
+			wantOS:     "Android",
+			wantDevice: "Tablet",
+		},
+		{
+			name:       "Chrome OS is named like the UA parser does",
+			header:     map[string]string{"User-Agent": reducedChromeUA, "Sec-CH-UA-Platform": `"Chrome OS"`},
+			wantOS:     "ChromeOS",
+			wantDevice: "Desktop",
+		},
+		{
+			name:       "Unknown and malformed platforms are ignored",
+			header:     map[string]string{"User-Agent": reducedChromeUA, "Sec-CH-UA-Platform": `Windows`},
+			wantOS:     "macOS",
+			wantDevice: "Desktop",
+		},
+		{
+			name:       "Hints don't hide bots",
+			header:     map[string]string{"User-Agent": "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "Sec-CH-UA-Mobile": "?0"},
+			wantDevice: "Bot",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for key, value := range tt.header {
+				header.Set(key, value)
+			}
+
+			info := ParseClientInfo(header)
+			if tt.wantOS != "" && info.OS != tt.wantOS {
+				t.Errorf("OS = %q, want %q", info.OS, tt.wantOS)
+			}
+			if info.DeviceType != tt.wantDevice {
+				t.Errorf("DeviceType = %q, want %q", info.DeviceType, tt.wantDevice)
+			}
+		})
+	}
+}
+
+func TestPrimaryLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"en-US,en;q=0.9", "en-US"},
+		{"fr;q=0.8, de-at", "de-AT"},
+		{"da, en-gb;q=0.8, en;q=0.7", "da"},
+		{"zh-hant-tw", "zh-Hant-TW"},
+		{"*", ""},
+		{"en;q=0", ""},
+		{"en;q=abc, pt-BR;q=0.5", "pt-BR"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := PrimaryLanguage(tt.header); got != tt.want {
+			t.Errorf("PrimaryLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type IPPrivacyMode string
+
+// IP_PRIVACY_MODE picks what is stored of each visitor's IP. Only truncate
+// keeps networks, so the single-network traffic alert is off in the others.
+const (
+	IPPrivacyTruncate IPPrivacyMode = "truncate" // Store the anonymized network prefix
+	IPPrivacyHash     IPPrivacyMode = "hash"     // Store a keyed hash of the full IP
+	IPPrivacyDrop     IPPrivacyMode = "drop"     // Store no IP at all
+)
+
+type PrivacyConfig struct {
+	Mode    IPPrivacyMode
+	HashKey []byte
+}
+
+func ParseIPPrivacyMode(mode string) (IPPrivacyMode, error) {
+	switch IPPrivacyMode(strings.ToLower(strings.TrimSpace(mode))) {
+	case "", IPPrivacyTruncate:
+		return IPPrivacyTruncate, nil
+	case IPPrivacyHash:
+		return IPPrivacyHash, nil
+	case IPPrivacyDrop:
+		return IPPrivacyDrop, nil
+	}
+	return "", fmt.Errorf("unknown IP privacy mode %q", mode)
+}
+
+// DeriveSecret derives a key for one purpose from a shared secret, so that
+// a value keyed for one purpose never reveals the key of another.
+func DeriveSecret(secret string, purpose string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ProtectIP returns the value to store for the raw client IP, or "" when no
+// IP should be stored. The IP comes from X-Forwarded-For, so anything that
+// isn't an address is dropped rather than stored or hashed.
+func (c PrivacyConfig) ProtectIP(ip string) string {
+	parsedIP := net.ParseIP(strings.TrimSpace(ip))
+	if parsedIP == nil {
+		return ""
+	}
+
+	switch c.Mode {
+	case IPPrivacyDrop:
+		return ""
+	case IPPrivacyHash:
+		// IPv4-mapped IPv6 addresses hash the same as their IPv4 form
+		mac := hmac.New(sha256.New, c.HashKey)
+		mac.Write([]byte(parsedIP.String()))
+		return hex.EncodeToString(mac.Sum(nil))
+	default:
+		return AnonymizeIP(parsedIP.String())
+	}
+}
+
+// OptedOut reports whether the visitor asked not to be tracked via the
+// Do Not Track or Global Privacy Control headers.
+func OptedOut(header http.Header) bool {
+	return header.Get("DNT") == "1" || header.Get("Sec-GPC") == "1"
+}
@@ -0,0 +1,116 @@
+//go:build unit
+
+package util
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseIPPrivacyMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    IPPrivacyMode
+		wantErr bool
+	}{
+		{"", IPPrivacyTruncate, false},
+		{"truncate", IPPrivacyTruncate, false},
+		{"HASH", IPPrivacyHash, false},
+		{" drop ", IPPrivacyDrop, false},
+		{"encrypt", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseIPPrivacyMode(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseIPPrivacyMode(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseIPPrivacyMode(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestProtectIP_Truncate(t *testing.T) {
+	config := PrivacyConfig{Mode: IPPrivacyTruncate}
+
+	if got := config.ProtectIP("192.168.1.100"); got != "192.168.1.0" {
+		t.Errorf("ProtectIP = %s, want 192.168.1.0", got)
+	}
+	if got := config.ProtectIP("2001:db8:85a3::8a2e:370:7334"); got != "2001:db8:85a3::" {
+		t.Errorf("ProtectIP = %s, want 2001:db8:85a3::", got)
+	}
+}
+
+func TestProtectIP_Hash(t *testing.T) {
+	config := PrivacyConfig{Mode: IPPrivacyHash, HashKey: []byte("key-1")}
+
+	first := config.ProtectIP("192.168.1.100")
+	if first == "192.168.1.100" || len(first) != 64 {
+		t.Errorf("ProtectIP = %s, want 64 character hash", first)
+	}
+	if config.ProtectIP("192.168.1.100") != first {
+		t.Error("Expected hash to be stable for the same key")
+	}
+
+	otherKey := PrivacyConfig{Mode: IPPrivacyHash, HashKey: []byte("key-2")}
+	if otherKey.ProtectIP("192.168.1.100") == first {
+		t.Error("Expected hash to depend on the key")
+	}
+
+	if config.ProtectIP(" ::ffff:192.168.1.100") != first {
+		t.Error("Expected the address to be normalized before hashing")
+	}
+}
+
+func TestProtectIP_NotAnAddress(t *testing.T) {
+	for _, mode := range []IPPrivacyMode{IPPrivacyTruncate, IPPrivacyHash} {
+		config := PrivacyConfig{Mode: mode, HashKey: []byte("key-1")}
+		if got := config.ProtectIP("2026-02-01"); got != "" {
+			t.Errorf("ProtectIP in %s mode = %s, want empty", mode, got)
+		}
+	}
+}
+
+func TestDeriveSecret(t *testing.T) {
+	ipKey := DeriveSecret("secret", "ip-hash")
+	if ipKey == DeriveSecret("secret", "visitor-salt") {
+		t.Error("Expected a different key for each purpose")
+	}
+	if ipKey != DeriveSecret("secret", "ip-hash") || ipKey == DeriveSecret("other", "ip-hash") {
+		t.Error("Expected the key to depend only on the secret and purpose")
+	}
+}
+
+func TestProtectIP_Drop(t *testing.T) {
+	config := PrivacyConfig{Mode: IPPrivacyDrop}
+
+	if got := config.ProtectIP("192.168.1.100"); got != "" {
+		t.Errorf("ProtectIP = %s, want empty", got)
+	}
+}
+
+func TestOptedOut(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   bool
+	}{
+		{"No headers", map[string]string{}, false},
+		{"DNT", map[string]string{"DNT": "1"}, true},
+		{"DNT disabled", map[string]string{"DNT": "0"}, false},
+		{"Global Privacy Control", map[string]string{"Sec-GPC": "1"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			if got := OptedOut(header); got != tt.want {
+				t.Errorf("OptedOut = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
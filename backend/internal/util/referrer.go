@@ -0,0 +1,31 @@
+package util
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ReferrerHost reduces a Referer header to its host, e.g.
+// "https://www.google.com/search?q=x" becomes "google.com". Paths and
+// queries are dropped since they can carry personal data. Returns "" for
+// direct traffic or anything that isn't an http(s) URL.
+func ReferrerHost(referer string) string {
+	if referer == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(referer)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return ""
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+
+	// Matches the analytics.referrer column width
+	if len(host) > 255 {
+		return ""
+	}
+
+	return host
+}
@@ -0,0 +1,29 @@
+//go:build unit
+
+package util
+
+import "testing"
+
+func TestReferrerHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		referer string
+		want    string
+	}{
+		{"Empty", "", ""},
+		{"Strips path and query", "https://news.ycombinator.com/item?id=1", "news.ycombinator.com"},
+		{"Strips www", "https://www.google.com/search?q=shrinks", "google.com"},
+		{"Lowercases", "http://Example.COM/", "example.com"},
+		{"Strips port", "http://localhost:3000/page", "localhost"},
+		{"Non-http scheme", "android-app://com.google.android.gm", ""},
+		{"Garbage", "not a url", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReferrerHost(tt.referer); got != tt.want {
+				t.Errorf("ReferrerHost(%q) = %q, want %q", tt.referer, got, tt.want)
+			}
+		})
+	}
+}
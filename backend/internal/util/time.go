@@ -29,3 +29,38 @@ func ParsePeriodToTime(period string) (time.Time, error) {
 	// Always use UTC for database consistency
 	return time.Now().UTC().Add(-duration), nil
 }
+
+// ParseTimeParam accepts either a date ("2006-01-02", midnight UTC) or a full
+// RFC 3339 timestamp.
+func ParseTimeParam(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time format")
+	}
+	return t.UTC(), nil
+}
+
+// ParseTimeZone loads an IANA time zone name such as "Europe/Berlin". An
+// empty name is UTC; "Local" is rejected since it would leak the server's zone.
+func ParseTimeZone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	if name == "Local" {
+		return nil, fmt.Errorf("invalid time zone")
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone")
+	}
+	return location, nil
+}
@@ -0,0 +1,29 @@
+//go:build unit
+
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeZone(t *testing.T) {
+	location, err := ParseTimeZone("")
+	if err != nil || location != time.UTC {
+		t.Errorf("Empty zone = %v, %v, want UTC", location, err)
+	}
+
+	location, err = ParseTimeZone("America/New_York")
+	if err != nil {
+		t.Fatalf("ParseTimeZone failed: %v", err)
+	}
+	if location.String() != "America/New_York" {
+		t.Errorf("Location = %s, want America/New_York", location)
+	}
+
+	for _, name := range []string{"Local", "Mars/Olympus_Mons", "../etc/passwd"} {
+		if _, err := ParseTimeZone(name); err == nil {
+			t.Errorf("ParseTimeZone(%q) should fail", name)
+		}
+	}
+}
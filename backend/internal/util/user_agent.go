@@ -50,6 +50,9 @@ func GetIP(ip string, remoteAddr string) string {
 	return strings.Split(ip, ",")[0]
 }
 
+// AnonymizeIP zeroes the last octet of IPv4 addresses and truncates IPv6
+// addresses to their /48 prefix, which typically identifies a site rather
+// than a single subscriber.
 func AnonymizeIP(ip string) string {
 	parsedIP := net.ParseIP(ip)
 	if parsedIP == nil {
@@ -61,5 +64,5 @@ func AnonymizeIP(ip string) string {
 		return ipv4.String()
 	}
 
-	return ip
+	return parsedIP.Mask(net.CIDRMask(48, 128)).String()
 }
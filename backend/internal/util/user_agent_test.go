@@ -124,6 +124,22 @@ func TestAnonymizeIP_IPv6(t *testing.T) {
 	}
 }
 
+func TestAnonymizeIP_IPv6TruncatesTo48(t *testing.T) {
+	result := AnonymizeIP("2001:0db8:85a3:0000:0000:8a2e:0370:7334")
+
+	if result != "2001:db8:85a3::" {
+		t.Errorf("AnonymizeIP = %s, want 2001:db8:85a3::", result)
+	}
+}
+
+func TestAnonymizeIP_IPv4MappedIPv6(t *testing.T) {
+	result := AnonymizeIP("::ffff:192.168.1.100")
+
+	if result != "192.168.1.0" {
+		t.Errorf("AnonymizeIP = %s, want 192.168.1.0", result)
+	}
+}
+
 // Test #19: Invalid IP returns fallback
 func TestAnonymizeIP_Invalid(t *testing.T) {
 	result := AnonymizeIP("not-an-ip")
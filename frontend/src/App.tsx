@@ -7,11 +7,25 @@ import { AnalyticsView } from "./views/AnalyticsView";
 import { LinksView } from "./views/LinksView";
 import { LoginView } from "./views/LoginView";
 import { ForgotPasswordView } from "./views/ForgotPasswordView";
+import { ResetPasswordView } from "./views/ResetPasswordView";
+import { VerifyEmailView } from "./views/VerifyEmailView";
 import { EmailTemplateView } from "./views/EmailTemplateView";
 import type { ViewState } from "./types";
 
+// Emailed links land on a path carrying a one-time token
+const initialPath = window.location.pathname;
+const initialToken = new URLSearchParams(window.location.search).get("token");
+const tokenViews: Record<string, ViewState> = {
+  "/reset-password": "reset-password",
+  "/verify-email": "verify-email",
+  // Provider sign ins that fail come back here with ?error=
+  "/login": "login",
+};
+
 function AppContent() {
-  const [view, setView] = useState<ViewState>("home");
+  const [view, setView] = useState<ViewState>(
+    tokenViews[initialPath] ?? "home",
+  );
   const [selectedLinkCode, setSelectedLinkCode] = useState<string | null>(null);
 
   // Reset selected link when navigating away from analytics
@@ -19,6 +33,10 @@ function AppContent() {
     if (newView !== "analytics") {
       setSelectedLinkCode(null);
     }
+    // Drop the token from the address bar once we move on
+    if (window.location.pathname !== "/") {
+      window.history.replaceState(null, "", "/");
+    }
     setView(newView);
   };
 
@@ -53,6 +71,12 @@ function AppContent() {
         {view === "forgot-password" && (
           <ForgotPasswordView setView={handleSetView} />
         )}
+        {view === "reset-password" && (
+          <ResetPasswordView token={initialToken} setView={handleSetView} />
+        )}
+        {view === "verify-email" && (
+          <VerifyEmailView token={initialToken} setView={handleSetView} />
+        )}
         {view === "email-preview" && <EmailTemplateView />}
         {view === "links" && (
           <LinksView
@@ -1,8 +1,14 @@
 import type {
   User,
   AuthResponse,
+  TwoFactorChallenge,
+  TwoFactorEnrollment,
   RegisterResponse,
   RefreshTokenResponse,
+  Session,
+  APIKey,
+  APIKeyScope,
+  CreatedAPIKey,
   CreateLinkResponse,
   LinksResponse,
   AnalyticsSummary,
@@ -14,28 +20,42 @@ const API_BASE_URL = import.meta.env.VITE_API_URL || "";
 
 // Token storage keys
 const ACCESS_TOKEN_KEY = "access_token";
-const REFRESH_TOKEN_KEY = "refresh_token";
+const LEGACY_REFRESH_TOKEN_KEY = "refresh_token";
+const CSRF_COOKIE = "csrf_token";
+const CSRF_HEADER = "X-CSRF-Token";
 
-// Token storage with localStorage for persistence
+// The refresh token lives in an HttpOnly cookie the server sets at login,
+// so only the access token is kept in localStorage
 let accessToken: string | null = localStorage.getItem(ACCESS_TOKEN_KEY);
-let refreshToken: string | null = localStorage.getItem(REFRESH_TOKEN_KEY);
 let onUnauthorized: (() => void) | null = null;
 
-export const setTokens = (access: string, refresh: string) => {
+localStorage.removeItem(LEGACY_REFRESH_TOKEN_KEY);
+
+// The CSRF cookie is readable on purpose: echoing it in a header proves the
+// request came from this page and not from another site riding the cookie
+const getCSRFToken = (): string | null => {
+  const match = document.cookie
+    .split("; ")
+    .find((c) => c.startsWith(`${CSRF_COOKIE}=`));
+  return match ? decodeURIComponent(match.slice(CSRF_COOKIE.length + 1)) : null;
+};
+
+const csrfHeaders = (): Record<string, string> => {
+  const token = getCSRFToken();
+  return token ? { [CSRF_HEADER]: token } : {};
+};
+
+export const setTokens = (access: string) => {
   accessToken = access;
-  refreshToken = refresh;
   localStorage.setItem(ACCESS_TOKEN_KEY, access);
-  localStorage.setItem(REFRESH_TOKEN_KEY, refresh);
 };
 
 export const getAccessToken = () => accessToken;
-export const getRefreshToken = () => refreshToken;
+export const hasSession = () => getCSRFToken() !== null;
 
 export const clearTokens = () => {
   accessToken = null;
-  refreshToken = null;
   localStorage.removeItem(ACCESS_TOKEN_KEY);
-  localStorage.removeItem(REFRESH_TOKEN_KEY);
 };
 
 export const setOnUnauthorized = (callback: () => void) => {
@@ -74,10 +94,11 @@ class ApiClient {
     const response = await fetch(`${this.baseUrl}${endpoint}`, {
       ...options,
       headers,
+      credentials: "include",
     });
 
     // Handle 401 Unauthorized
-    if (response.status === 401 && retry && refreshToken) {
+    if (response.status === 401 && retry && hasSession()) {
       const refreshed = await this.attemptRefresh();
       if (refreshed) {
         return this.request<T>(endpoint, options, requiresAuth, false);
@@ -123,13 +144,13 @@ class ApiClient {
   }
 
   private async doRefresh(): Promise<boolean> {
-    if (!refreshToken) return false;
+    if (!hasSession()) return false;
 
     try {
       const response = await fetch(`${this.baseUrl}/api/v1/auth/refresh`, {
         method: "POST",
-        headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ refresh_token: refreshToken }),
+        headers: { "Content-Type": "application/json", ...csrfHeaders() },
+        credentials: "include",
       });
 
       if (!response.ok) {
@@ -137,8 +158,9 @@ class ApiClient {
         return false;
       }
 
+      // The server rotates the refresh cookie on every use
       const data: RefreshTokenResponse = await response.json();
-      accessToken = data.access_token;
+      setTokens(data.access_token);
       return true;
     } catch {
       clearTokens();
@@ -154,21 +176,47 @@ class ApiClient {
     });
   }
 
-  async login(email: string, password: string): Promise<AuthResponse> {
-    const response = await this.request<AuthResponse>("/api/v1/auth/login", {
-      method: "POST",
-      body: JSON.stringify({ email, password }),
-    });
-    setTokens(response.access_token, response.refresh_token);
+  async login(
+    email: string,
+    password: string,
+  ): Promise<AuthResponse | TwoFactorChallenge> {
+    const response = await this.request<AuthResponse | TwoFactorChallenge>(
+      "/api/v1/auth/login",
+      {
+        method: "POST",
+        body: JSON.stringify({ email, password }),
+      },
+    );
+    if ("challenge_token" in response) {
+      return response;
+    }
+    setTokens(response.access_token);
+    return response;
+  }
+
+  // Second step of a login that returned a challenge. The code is from the
+  // authenticator app, or one of the recovery codes.
+  async verifyTwoFactorLogin(
+    challengeToken: string,
+    code: string,
+  ): Promise<AuthResponse> {
+    const response = await this.request<AuthResponse>(
+      "/api/v1/auth/login/2fa",
+      {
+        method: "POST",
+        body: JSON.stringify({ challenge_token: challengeToken, code }),
+      },
+    );
+    setTokens(response.access_token);
     return response;
   }
 
   async logout(): Promise<void> {
-    if (refreshToken) {
+    if (hasSession()) {
       try {
         await this.request("/api/v1/auth/logout", {
           method: "POST",
-          body: JSON.stringify({ refresh_token: refreshToken }),
+          headers: csrfHeaders(),
         });
       } catch {
         // Ignore logout errors
@@ -178,17 +226,17 @@ class ApiClient {
   }
 
   async refreshAccessToken(): Promise<RefreshTokenResponse> {
-    if (!refreshToken) {
+    if (!hasSession()) {
       throw new Error("No refresh token available");
     }
     const response = await this.request<RefreshTokenResponse>(
       "/api/v1/auth/refresh",
       {
         method: "POST",
-        body: JSON.stringify({ refresh_token: refreshToken }),
+        headers: csrfHeaders(),
       },
     );
-    accessToken = response.access_token;
+    setTokens(response.access_token);
     return response;
   }
 
@@ -235,6 +283,222 @@ class ApiClient {
     });
   }
 
+  // Password reset endpoints; the response is the same whether or not the
+  // account exists
+  async requestPasswordReset(email: string): Promise<void> {
+    await this.request("/api/v1/auth/password-reset", {
+      method: "POST",
+      body: JSON.stringify({ email }),
+    });
+  }
+
+  async confirmPasswordReset(token: string, password: string): Promise<void> {
+    await this.request("/api/v1/auth/password-reset/confirm", {
+      method: "POST",
+      body: JSON.stringify({ token, password }),
+    });
+  }
+
+  // Email verification endpoints
+  async verifyEmail(token: string): Promise<void> {
+    await this.request("/api/v1/auth/verify-email", {
+      method: "POST",
+      body: JSON.stringify({ token }),
+    });
+  }
+
+  async resendVerification(): Promise<void> {
+    await this.request(
+      "/api/v1/auth/verify-email/resend",
+      { method: "POST" },
+      true,
+    );
+  }
+
+  // Account endpoints; both need the current password
+  async changePassword(
+    currentPassword: string,
+    newPassword: string,
+  ): Promise<void> {
+    await this.request(
+      "/api/v1/auth/password",
+      {
+        method: "PUT",
+        body: JSON.stringify({
+          current_password: currentPassword,
+          new_password: newPassword,
+        }),
+      },
+      true,
+    );
+  }
+
+  // The new address has to be verified again
+  async changeEmail(currentPassword: string, email: string): Promise<void> {
+    await this.request(
+      "/api/v1/auth/email",
+      {
+        method: "PUT",
+        body: JSON.stringify({ current_password: currentPassword, email }),
+      },
+      true,
+    );
+  }
+
+  // Session endpoints
+  async getSessions(): Promise<Session[]> {
+    return this.request<Session[]>(
+      "/api/v1/auth/sessions",
+      { method: "GET" },
+      true,
+    );
+  }
+
+  async revokeSession(id: string): Promise<void> {
+    return this.request<void>(
+      `/api/v1/auth/sessions/${encodeURIComponent(id)}`,
+      { method: "DELETE" },
+      true,
+    );
+  }
+
+  // API key endpoints
+  async getAPIKeys(): Promise<APIKey[]> {
+    return this.request<APIKey[]>(
+      "/api/v1/auth/api-keys",
+      { method: "GET" },
+      true,
+    );
+  }
+
+  async createAPIKey(
+    name: string,
+    scopes: APIKeyScope[],
+  ): Promise<CreatedAPIKey> {
+    return this.request<CreatedAPIKey>(
+      "/api/v1/auth/api-keys",
+      {
+        method: "POST",
+        body: JSON.stringify({ name, scopes }),
+      },
+      true,
+    );
+  }
+
+  async revokeAPIKey(id: number): Promise<void> {
+    return this.request<void>(
+      `/api/v1/auth/api-keys/${id}`,
+      { method: "DELETE" },
+      true,
+    );
+  }
+
+  async logoutEverywhere(): Promise<void> {
+    try {
+      await this.request(
+        "/api/v1/auth/logout-everywhere",
+        { method: "POST" },
+        true,
+      );
+    } finally {
+      clearTokens();
+    }
+  }
+
+  async deleteAccount(
+    currentPassword: string,
+    linkPolicy: "delete" | "anonymize" = "delete",
+  ): Promise<void> {
+    await this.request(
+      "/api/v1/auth/me",
+      {
+        method: "DELETE",
+        body: JSON.stringify({
+          current_password: currentPassword,
+          link_policy: linkPolicy,
+        }),
+      },
+      true,
+    );
+    clearTokens();
+  }
+
+  // ZIP of the profile, links and every click, for the user to keep
+  async exportAccount(retry = true): Promise<Blob> {
+    const headers: Record<string, string> = {};
+    if (accessToken) {
+      headers["Authorization"] = `Bearer ${accessToken}`;
+    }
+
+    const response = await fetch(`${this.baseUrl}/api/v1/auth/me/export`, {
+      headers,
+      credentials: "include",
+    });
+
+    if (response.status === 401 && retry && hasSession()) {
+      if (await this.attemptRefresh()) {
+        return this.exportAccount(false);
+      }
+      onUnauthorized?.();
+      throw new Error("Session expired. Please log in again.");
+    }
+
+    if (!response.ok) {
+      throw new Error(`HTTP error ${response.status}`);
+    }
+
+    return response.blob();
+  }
+
+  // Starts two-factor setup; nothing changes at login until it is activated
+  async enrollTwoFactor(currentPassword: string): Promise<TwoFactorEnrollment> {
+    return this.request<TwoFactorEnrollment>(
+      "/api/v1/auth/2fa/enroll",
+      {
+        method: "POST",
+        body: JSON.stringify({ current_password: currentPassword }),
+      },
+      true,
+    );
+  }
+
+  // Returns the recovery codes, which can't be shown again
+  async activateTwoFactor(code: string): Promise<string[]> {
+    const response = await this.request<{ recovery_codes: string[] }>(
+      "/api/v1/auth/2fa/activate",
+      {
+        method: "POST",
+        body: JSON.stringify({ code }),
+      },
+      true,
+    );
+    return response.recovery_codes;
+  }
+
+  async disableTwoFactor(currentPassword: string, code: string): Promise<void> {
+    await this.request(
+      "/api/v1/auth/2fa",
+      {
+        method: "DELETE",
+        body: JSON.stringify({ current_password: currentPassword, code }),
+      },
+      true,
+    );
+  }
+
+  // Names of the "Sign in with" providers the server has configured
+  async getOIDCProviders(): Promise<string[]> {
+    return this.request<string[]>("/api/v1/auth/oidc/providers", {
+      method: "GET",
+    });
+  }
+
+  // Provider sign in is a full page navigation: the provider sends the
+  // browser back to the server, which sets the session cookie
+  oidcLoginURL(provider: string): string {
+    return `${this.baseUrl}/api/v1/auth/oidc/${encodeURIComponent(provider)}/login`;
+  }
+
   async getCurrentUser(): Promise<User> {
     return this.request<User>(
       "/api/v1/auth/me",
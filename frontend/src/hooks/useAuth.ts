@@ -12,15 +12,21 @@ import {
   clearTokens,
   setTokens,
   getAccessToken,
+  hasSession,
 } from "../api/client";
-import type { User } from "../types";
+import type { TwoFactorChallenge, User } from "../types";
 
 interface AuthContextType {
   user: User | null;
   isAuthenticated: boolean;
   isLoading: boolean;
   error: string | null;
-  login: (email: string, password: string) => Promise<void>;
+  // Resolves with a challenge when the account needs a second factor
+  login: (
+    email: string,
+    password: string,
+  ) => Promise<TwoFactorChallenge | null>;
+  verifyTwoFactor: (challengeToken: string, code: string) => Promise<void>;
   register: (email: string, password: string) => Promise<void>;
   logout: () => Promise<void>;
   clearError: () => void;
@@ -41,8 +47,9 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     async function initAuth() {
       const token = getAccessToken();
 
-      // If no token, we aren't logged in, just stop loading
-      if (!token) {
+      // Without a token or a session cookie (set by a provider sign in or
+      // an earlier visit) we aren't logged in, just stop loading
+      if (!token && !hasSession()) {
         setIsLoading(false);
         return;
       }
@@ -69,7 +76,11 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     setError(null);
     try {
       const response = await apiClient.login(email, password);
+      if ("challenge_token" in response) {
+        return response;
+      }
       setUser(response.user);
+      return null;
     } catch (err) {
       const message = err instanceof Error ? err.message : "Login failed";
       setError(message);
@@ -79,6 +90,27 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     }
   }, []);
 
+  const verifyTwoFactor = useCallback(
+    async (challengeToken: string, code: string) => {
+      setIsLoading(true);
+      setError(null);
+      try {
+        const response = await apiClient.verifyTwoFactorLogin(
+          challengeToken,
+          code,
+        );
+        setUser(response.user);
+      } catch (err) {
+        const message = err instanceof Error ? err.message : "Login failed";
+        setError(message);
+        throw err;
+      } finally {
+        setIsLoading(false);
+      }
+    },
+    [],
+  );
+
   const register = useCallback(
     async (email: string, password: string) => {
       setIsLoading(true);
@@ -120,6 +152,7 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     isLoading,
     error,
     login,
+    verifyTwoFactor,
     register,
     logout,
     clearError,
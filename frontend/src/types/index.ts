@@ -2,6 +2,7 @@
 export interface User {
   id: number;
   email: string;
+  email_verified?: boolean;
   created_at?: string;
 }
 
@@ -26,18 +27,61 @@ export interface AuthResponse {
   user: User;
 }
 
+// What login answers instead when the account has two-factor authentication;
+// the login finishes with the token and a code
+export interface TwoFactorChallenge {
+  challenge_token: string;
+  expires_at: string;
+}
+
+export interface TwoFactorEnrollment {
+  secret: string;
+  provisioning_uri: string; // otpauth:// URI to show as a QR code
+}
+
 export interface RefreshTokenRequest {
   refresh_token: string;
 }
 
 export interface RefreshTokenResponse {
   access_token: string;
+  refresh_token?: string; // Omitted when the token was rotated in the cookie
 }
 
 export interface LogoutRequest {
   refresh_token: string;
 }
 
+// A login on one device; revoking it logs that device out
+export interface Session {
+  id: string;
+  device_type: string;
+  browser: string;
+  os: string;
+  user_agent: string;
+  ip_address: string;
+  created_at: string;
+  last_used_at: string;
+  expires_at: string;
+  current: boolean;
+}
+
+export type APIKeyScope = "links:read" | "links:write" | "analytics:read";
+
+export interface APIKey {
+  id: number;
+  name: string;
+  prefix: string;
+  scopes: APIKeyScope[];
+  created_at: string;
+  last_used_at: string | null;
+}
+
+// The full key is only returned once, when it is created
+export interface CreatedAPIKey extends APIKey {
+  key: string;
+}
+
 // Link types
 export interface Link {
   id: number;
@@ -86,7 +130,9 @@ export interface AnalyticsSummary {
   link_id: number;
   period: string;
   total_clicks: number;
+  // Visitors are told apart per UTC day, so longer periods sum daily uniques
   unique_visitors: number;
+  visitor_scope?: "daily";
   clicks_by_date: ClicksByDate[];
   clicks_by_device: ClicksByDevice[];
   clicks_by_browser: ClicksByBrowser[];
@@ -111,5 +157,7 @@ export type ViewState =
   | "analytics"
   | "login"
   | "forgot-password"
+  | "reset-password"
+  | "verify-email"
   | "email-preview"
   | "links";
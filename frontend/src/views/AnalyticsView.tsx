@@ -169,7 +169,7 @@ export function AnalyticsView({
           icon={MousePointer}
         />
         <BentoItem
-          title="Unique Visitors"
+          title={period === "24h" ? "Unique Visitors" : "Daily Unique Visitors (summed)"}
           value={
             isLoading
               ? "..."
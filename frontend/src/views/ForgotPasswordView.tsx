@@ -1,5 +1,6 @@
 import { useState } from "react";
 import { Key, Mail, ArrowRight, ArrowLeft } from "lucide-react";
+import { apiClient } from "../api/client";
 import type { ViewState } from "../types";
 
 interface ForgotPasswordViewProps {
@@ -9,11 +10,22 @@ interface ForgotPasswordViewProps {
 export function ForgotPasswordView({ setView }: ForgotPasswordViewProps) {
   const [email, setEmail] = useState("");
   const [isSubmitted, setIsSubmitted] = useState(false);
+  const [isLoading, setIsLoading] = useState(false);
+  const [error, setError] = useState<string | null>(null);
 
-  const handleSubmit = (e: React.FormEvent) => {
+  const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
-    // TODO: Wire up to backend when password reset endpoint is available
-    setIsSubmitted(true);
+    setError(null);
+    setIsLoading(true);
+
+    try {
+      await apiClient.requestPasswordReset(email);
+      setIsSubmitted(true);
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Failed to send reset link");
+    } finally {
+      setIsLoading(false);
+    }
   };
 
   return (
@@ -53,6 +65,12 @@ export function ForgotPasswordView({ setView }: ForgotPasswordViewProps) {
           </div>
         ) : (
           <form onSubmit={handleSubmit} className="space-y-6">
+            {error && (
+              <div className="p-3 bg-red-50 border-2 border-red-200 text-red-700 text-sm font-mono">
+                {error}
+              </div>
+            )}
+
             <div className="space-y-2">
               <label className="text-xs font-bold uppercase tracking-wider flex items-center gap-2 text-zinc-700">
                 <Mail className="w-3 h-3" />
@@ -70,9 +88,10 @@ export function ForgotPasswordView({ setView }: ForgotPasswordViewProps) {
 
             <button
               type="submit"
+              disabled={isLoading}
               className="w-full bg-[#E11D48] text-white py-3 font-bold uppercase tracking-wider hover:bg-black transition-colors border border-black flex items-center justify-center gap-2 shadow-[4px_4px_0px_0px_rgba(0,0,0,1)] active:shadow-none active:translate-x-[2px] active:translate-y-[2px]"
             >
-              Send Reset Link
+              {isLoading ? "Sending..." : "Send Reset Link"}
               <ArrowRight className="w-4 h-4" />
             </button>
           </form>
@@ -1,4 +1,4 @@
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import {
   Lock,
   Mail,
@@ -7,8 +7,11 @@ import {
   EyeOff,
   ArrowRight,
   Github,
+  KeyRound,
+  Smartphone,
 } from "lucide-react";
 import { useAuth } from "../hooks/useAuth";
+import { apiClient } from "../api/client";
 import type { ViewState } from "../types";
 
 const GoogleIcon = () => (
@@ -32,6 +35,35 @@ const GoogleIcon = () => (
   </svg>
 );
 
+const providerIcons: Record<string, () => React.ReactElement> = {
+  google: GoogleIcon,
+  github: () => (
+    <Github className="w-5 h-5 group-hover:scale-110 transition-transform" />
+  ),
+};
+
+// Reasons the server gives when a provider sign in fails
+const providerErrors: Record<string, string> = {
+  cancelled: "Sign in was cancelled",
+  expired: "Sign in took too long, please try again",
+  email_not_verified: "Your provider did not confirm your email address",
+  account_unverified:
+    "An account with this email exists but isn't verified. Sign in with your password and verify it first",
+  account_exists: "This provider account is linked to another user",
+  provider_unavailable: "The sign in provider is unavailable",
+  failed: "Sign in with the provider failed",
+};
+
+const initialProviderError = () => {
+  const reason = new URLSearchParams(window.location.search).get("error");
+  return reason ? (providerErrors[reason] ?? providerErrors.failed) : null;
+};
+
+// A provider sign in for an account with two-factor authentication comes
+// back with a challenge to finish with a code
+const initialChallenge = () =>
+  new URLSearchParams(window.location.search).get("challenge");
+
 interface LoginViewProps {
   setView: (v: ViewState) => void;
 }
@@ -41,15 +73,42 @@ export function LoginView({ setView }: LoginViewProps) {
   const [isRegister, setIsRegister] = useState(false);
   const [email, setEmail] = useState("");
   const [password, setPassword] = useState("");
-  const [localError, setLocalError] = useState<string | null>(null);
+  const [localError, setLocalError] = useState<string | null>(
+    initialProviderError,
+  );
+  const [providers, setProviders] = useState<string[]>([]);
+  const [challenge, setChallenge] = useState<string | null>(initialChallenge);
+  const [code, setCode] = useState("");
 
-  const { login, register, isLoading, error, clearError } = useAuth();
+  const { login, verifyTwoFactor, register, isLoading, error, clearError } =
+    useAuth();
+
+  useEffect(() => {
+    apiClient
+      .getOIDCProviders()
+      .then(setProviders)
+      .catch(() => setProviders([]));
+  }, []);
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
     setLocalError(null);
     clearError();
 
+    if (challenge) {
+      if (!code) {
+        setLocalError("Please enter your code");
+        return;
+      }
+      try {
+        await verifyTwoFactor(challenge, code);
+        setView("home");
+      } catch {
+        // Error is already set in auth context
+      }
+      return;
+    }
+
     if (!email || !password) {
       setLocalError("Please fill in all fields");
       return;
@@ -59,7 +118,11 @@ export function LoginView({ setView }: LoginViewProps) {
       if (isRegister) {
         await register(email, password);
       } else {
-        await login(email, password);
+        const next = await login(email, password);
+        if (next) {
+          setChallenge(next.challenge_token);
+          return;
+        }
       }
       setView("home");
     } catch {
@@ -84,9 +147,11 @@ export function LoginView({ setView }: LoginViewProps) {
             {isRegister ? "Create Account" : "System Access"}
           </h2>
           <p className="text-zinc-500 text-sm mt-2 font-mono">
-            {isRegister
-              ? "Sign up for a new account"
-              : "Enter credentials to continue"}
+            {challenge
+              ? "Enter the code from your authenticator app"
+              : isRegister
+                ? "Sign up for a new account"
+                : "Enter credentials to continue"}
           </p>
         </div>
 
@@ -97,53 +162,77 @@ export function LoginView({ setView }: LoginViewProps) {
         )}
 
         <form onSubmit={handleSubmit} className="space-y-6">
-          <div className="space-y-2">
-            <label className="text-xs font-bold uppercase tracking-wider flex items-center gap-2 text-zinc-700">
-              <Mail className="w-3 h-3" />
-              Email Address
-            </label>
-            <input
-              type="email"
-              value={email}
-              onChange={(e) => setEmail(e.target.value)}
-              placeholder="user@example.com"
-              className="w-full bg-zinc-50 border-2 border-zinc-200 p-3 text-sm font-mono focus:border-black focus:ring-0 outline-none transition-colors placeholder:text-zinc-400"
-              disabled={isLoading}
-            />
-          </div>
-
-          <div className="space-y-2">
-            <label className="text-xs font-bold uppercase tracking-wider flex items-center gap-2 text-zinc-700">
-              <ShieldCheck className="w-3 h-3" />
-              Password
-            </label>
-            <div className="relative">
+          {challenge ? (
+            <div className="space-y-2">
+              <label className="text-xs font-bold uppercase tracking-wider flex items-center gap-2 text-zinc-700">
+                <Smartphone className="w-3 h-3" />
+                Authentication Code
+              </label>
               <input
-                type={showPassword ? "text" : "password"}
-                value={password}
-                onChange={(e) => setPassword(e.target.value)}
-                placeholder="••••••••••••"
+                type="text"
+                autoComplete="one-time-code"
+                autoFocus
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                placeholder="123456"
                 className="w-full bg-zinc-50 border-2 border-zinc-200 p-3 text-sm font-mono focus:border-black focus:ring-0 outline-none transition-colors placeholder:text-zinc-400"
                 disabled={isLoading}
               />
-              <button
-                type="button"
-                onClick={() => setShowPassword(!showPassword)}
-                className="absolute right-3 top-1/2 -translate-y-1/2 text-zinc-400 hover:text-black transition-colors cursor-pointer"
-              >
-                {showPassword ? (
-                  <EyeOff className="w-4 h-4" />
-                ) : (
-                  <Eye className="w-4 h-4" />
-                )}
-              </button>
-            </div>
-            {isRegister && (
               <p className="text-[10px] text-zinc-400 font-mono">
-                Minimum 8 characters required
+                From your authenticator app, or one of your recovery codes
               </p>
-            )}
-          </div>
+            </div>
+          ) : (
+            <>
+              <div className="space-y-2">
+                <label className="text-xs font-bold uppercase tracking-wider flex items-center gap-2 text-zinc-700">
+                  <Mail className="w-3 h-3" />
+                  Email Address
+                </label>
+                <input
+                  type="email"
+                  value={email}
+                  onChange={(e) => setEmail(e.target.value)}
+                  placeholder="user@example.com"
+                  className="w-full bg-zinc-50 border-2 border-zinc-200 p-3 text-sm font-mono focus:border-black focus:ring-0 outline-none transition-colors placeholder:text-zinc-400"
+                  disabled={isLoading}
+                />
+              </div>
+
+              <div className="space-y-2">
+                <label className="text-xs font-bold uppercase tracking-wider flex items-center gap-2 text-zinc-700">
+                  <ShieldCheck className="w-3 h-3" />
+                  Password
+                </label>
+                <div className="relative">
+                  <input
+                    type={showPassword ? "text" : "password"}
+                    value={password}
+                    onChange={(e) => setPassword(e.target.value)}
+                    placeholder="••••••••••••"
+                    className="w-full bg-zinc-50 border-2 border-zinc-200 p-3 text-sm font-mono focus:border-black focus:ring-0 outline-none transition-colors placeholder:text-zinc-400"
+                    disabled={isLoading}
+                  />
+                  <button
+                    type="button"
+                    onClick={() => setShowPassword(!showPassword)}
+                    className="absolute right-3 top-1/2 -translate-y-1/2 text-zinc-400 hover:text-black transition-colors cursor-pointer"
+                  >
+                    {showPassword ? (
+                      <EyeOff className="w-4 h-4" />
+                    ) : (
+                      <Eye className="w-4 h-4" />
+                    )}
+                  </button>
+                </div>
+                {isRegister && (
+                  <p className="text-[10px] text-zinc-400 font-mono">
+                    Minimum 8 characters required
+                  </p>
+                )}
+              </div>
+            </>
+          )}
 
           <button
             type="submit"
@@ -152,36 +241,54 @@ export function LoginView({ setView }: LoginViewProps) {
           >
             {isLoading
               ? "Processing..."
-              : isRegister
-                ? "Create Account"
-                : "Sign In"}
+              : challenge
+                ? "Verify"
+                : isRegister
+                  ? "Create Account"
+                  : "Sign In"}
             <ArrowRight className="w-4 h-4 group-hover:translate-x-1 transition-transform" />
           </button>
         </form>
 
-        <div className="my-8 flex items-center gap-4">
-          <div className="h-px bg-zinc-200 flex-1"></div>
-          <span className="text-[10px] font-bold uppercase text-zinc-400 tracking-widest">
-            Or continue with
-          </span>
-          <div className="h-px bg-zinc-200 flex-1"></div>
-        </div>
+        {providers.length > 0 && !challenge && (
+          <>
+            <div className="my-8 flex items-center gap-4">
+              <div className="h-px bg-zinc-200 flex-1"></div>
+              <span className="text-[10px] font-bold uppercase text-zinc-400 tracking-widest">
+                Or continue with
+              </span>
+              <div className="h-px bg-zinc-200 flex-1"></div>
+            </div>
 
-        <div className="grid grid-cols-2 gap-4">
-          <button className="flex items-center justify-center gap-2 p-3 border-2 border-zinc-200 hover:border-black hover:bg-zinc-50 transition-all group opacity-50 cursor-not-allowed">
-            <Github className="w-5 h-5 group-hover:scale-110 transition-transform" />
-            <span className="text-xs font-bold uppercase">Github</span>
-          </button>
-          <button className="flex items-center justify-center gap-2 p-3 border-2 border-zinc-200 hover:border-black hover:bg-zinc-50 transition-all group opacity-50 cursor-not-allowed">
-            <GoogleIcon />
-            <span className="text-xs font-bold uppercase">Google</span>
-          </button>
-        </div>
+            <div className="grid grid-cols-2 gap-4">
+              {providers.map((provider) => {
+                const Icon = providerIcons[provider];
+                return (
+                  <a
+                    key={provider}
+                    href={apiClient.oidcLoginURL(provider)}
+                    className="flex items-center justify-center gap-2 p-3 border-2 border-zinc-200 hover:border-black hover:bg-zinc-50 transition-all group"
+                  >
+                    {Icon ? (
+                      <Icon />
+                    ) : (
+                      <KeyRound className="w-5 h-5 group-hover:scale-110 transition-transform" />
+                    )}
+                    <span className="text-xs font-bold uppercase">
+                      {provider}
+                    </span>
+                  </a>
+                );
+              })}
+            </div>
+          </>
+        )}
 
         <div className="mt-8 text-center">
           <button
             onClick={() => {
               setIsRegister(!isRegister);
+              setChallenge(null);
               setLocalError(null);
               clearError();
             }}
@@ -191,16 +298,16 @@ export function LoginView({ setView }: LoginViewProps) {
               ? "Already have an account? Sign in"
               : "Don't have an account? Register"}
           </button>
-          {/* {!isRegister && (
+          {!isRegister && (
             <div>
-              <button 
-                onClick={() => setView('forgot-password')} 
+              <button
+                onClick={() => setView("forgot-password")}
                 className="text-xs font-mono text-zinc-500 hover:text-[#E11D48] underline decoration-1 underline-offset-4 cursor-pointer"
               >
                 Forgot your password?
               </button>
             </div>
-          )} */}
+          )}
         </div>
       </div>
 
@@ -0,0 +1,143 @@
+import { useState } from "react";
+import { Key, ShieldCheck, ArrowRight, ArrowLeft } from "lucide-react";
+import { apiClient } from "../api/client";
+import type { ViewState } from "../types";
+
+interface ResetPasswordViewProps {
+  token: string | null;
+  setView: (v: ViewState) => void;
+}
+
+export function ResetPasswordView({ token, setView }: ResetPasswordViewProps) {
+  const [password, setPassword] = useState("");
+  const [confirm, setConfirm] = useState("");
+  const [isDone, setIsDone] = useState(false);
+  const [isLoading, setIsLoading] = useState(false);
+  const [error, setError] = useState<string | null>(
+    token ? null : "This reset link is missing its token.",
+  );
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError(null);
+
+    if (!token) {
+      setError("This reset link is missing its token.");
+      return;
+    }
+
+    if (password !== confirm) {
+      setError("Passwords do not match");
+      return;
+    }
+
+    setIsLoading(true);
+    try {
+      await apiClient.confirmPasswordReset(token, password);
+      setIsDone(true);
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Failed to reset password");
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <div className="max-w-md mx-auto animate-in fade-in slide-in-from-bottom-8 duration-500 pt-12 pb-20">
+      <div className="bg-white border-2 border-zinc-900 p-8 shadow-[8px_8px_0px_0px_rgba(0,0,0,1)] relative">
+        <div className="absolute top-0 right-0 p-2 bg-black text-white text-[10px] font-mono font-bold uppercase">
+          RECOVERY
+        </div>
+
+        <div className="mb-8 text-center">
+          <div className="w-12 h-12 bg-zinc-100 mx-auto flex items-center justify-center mb-4 border-2 border-zinc-900">
+            <Key className="w-6 h-6 text-[#E11D48]" />
+          </div>
+          <h2 className="text-2xl font-bold tracking-tight text-zinc-900 uppercase">
+            Choose New Password
+          </h2>
+          <p className="text-zinc-500 text-sm mt-2 font-mono">
+            {isDone
+              ? "Your password has been reset."
+              : "All your other sessions will be signed out."}
+          </p>
+        </div>
+
+        {error && (
+          <div className="mb-6 p-3 bg-red-50 border-2 border-red-200 text-red-700 text-sm font-mono">
+            {error}
+          </div>
+        )}
+
+        {isDone ? (
+          <button
+            onClick={() => setView("login")}
+            className="w-full bg-black text-white py-3 font-bold uppercase tracking-wider hover:bg-[#E11D48] transition-colors border border-black flex items-center justify-center gap-2 group cursor-pointer"
+          >
+            Sign In
+            <ArrowRight className="w-4 h-4 group-hover:translate-x-1 transition-transform" />
+          </button>
+        ) : (
+          <form onSubmit={handleSubmit} className="space-y-6">
+            <div className="space-y-2">
+              <label className="text-xs font-bold uppercase tracking-wider flex items-center gap-2 text-zinc-700">
+                <ShieldCheck className="w-3 h-3" />
+                New Password
+              </label>
+              <input
+                type="password"
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+                placeholder="••••••••••••"
+                className="w-full bg-zinc-50 border-2 border-zinc-200 p-3 text-sm font-mono focus:border-black focus:ring-0 outline-none transition-colors placeholder:text-zinc-400"
+                minLength={8}
+                required
+                disabled={isLoading}
+              />
+              <p className="text-[10px] text-zinc-400 font-mono">
+                Minimum 8 characters required
+              </p>
+            </div>
+
+            <div className="space-y-2">
+              <label className="text-xs font-bold uppercase tracking-wider flex items-center gap-2 text-zinc-700">
+                <ShieldCheck className="w-3 h-3" />
+                Confirm Password
+              </label>
+              <input
+                type="password"
+                value={confirm}
+                onChange={(e) => setConfirm(e.target.value)}
+                placeholder="••••••••••••"
+                className="w-full bg-zinc-50 border-2 border-zinc-200 p-3 text-sm font-mono focus:border-black focus:ring-0 outline-none transition-colors placeholder:text-zinc-400"
+                required
+                disabled={isLoading}
+              />
+            </div>
+
+            <button
+              type="submit"
+              disabled={isLoading || !token}
+              className="w-full bg-[#E11D48] text-white py-3 font-bold uppercase tracking-wider hover:bg-black transition-colors border border-black flex items-center justify-center gap-2 shadow-[4px_4px_0px_0px_rgba(0,0,0,1)] active:shadow-none active:translate-x-[2px] active:translate-y-[2px] disabled:opacity-50 disabled:cursor-not-allowed"
+            >
+              {isLoading ? "Saving..." : "Reset Password"}
+              <ArrowRight className="w-4 h-4" />
+            </button>
+          </form>
+        )}
+
+        {!isDone && (
+          <div className="mt-8 pt-6 border-t border-zinc-100 text-center">
+            <button
+              onClick={() => setView("forgot-password")}
+              className="text-xs font-bold uppercase tracking-wider text-zinc-500 hover:text-black flex items-center justify-center gap-2 mx-auto group"
+            >
+              <ArrowLeft className="w-3 h-3 group-hover:-translate-x-1 transition-transform" />
+              Request a New Link
+            </button>
+          </div>
+        )}
+      </div>
+    </div>
+  );
+}
@@ -0,0 +1,74 @@
+import { useEffect, useRef, useState } from "react";
+import { MailCheck, ArrowRight } from "lucide-react";
+import { apiClient } from "../api/client";
+import type { ViewState } from "../types";
+
+interface VerifyEmailViewProps {
+  token: string | null;
+  setView: (v: ViewState) => void;
+}
+
+export function VerifyEmailView({ token, setView }: VerifyEmailViewProps) {
+  const [status, setStatus] = useState<"verifying" | "verified" | "failed">(
+    token ? "verifying" : "failed",
+  );
+  const [error, setError] = useState<string | null>(
+    token ? null : "This verification link is missing its token.",
+  );
+  // Tokens are single-use, so StrictMode's double effect must not send it twice
+  const submitted = useRef(false);
+
+  useEffect(() => {
+    if (!token || submitted.current) return;
+    submitted.current = true;
+
+    apiClient
+      .verifyEmail(token)
+      .then(() => setStatus("verified"))
+      .catch((err) => {
+        setError(err instanceof Error ? err.message : "Failed to verify email");
+        setStatus("failed");
+      });
+  }, [token]);
+
+  return (
+    <div className="max-w-md mx-auto animate-in fade-in slide-in-from-bottom-8 duration-500 pt-12 pb-20">
+      <div className="bg-white border-2 border-zinc-900 p-8 shadow-[8px_8px_0px_0px_rgba(0,0,0,1)] relative">
+        <div className="absolute top-0 right-0 p-2 bg-black text-white text-[10px] font-mono font-bold uppercase">
+          VERIFY
+        </div>
+
+        <div className="mb-8 text-center">
+          <div className="w-12 h-12 bg-zinc-100 mx-auto flex items-center justify-center mb-4 border-2 border-zinc-900">
+            <MailCheck className="w-6 h-6 text-[#E11D48]" />
+          </div>
+          <h2 className="text-2xl font-bold tracking-tight text-zinc-900 uppercase">
+            Email Verification
+          </h2>
+          <p className="text-zinc-500 text-sm mt-2 font-mono">
+            {status === "verifying" && "Confirming your email address..."}
+            {status === "verified" && "Your email address is verified."}
+            {status === "failed" &&
+              "Sign in to request a new verification link."}
+          </p>
+        </div>
+
+        {error && (
+          <div className="mb-6 p-3 bg-red-50 border-2 border-red-200 text-red-700 text-sm font-mono">
+            {error}
+          </div>
+        )}
+
+        {status !== "verifying" && (
+          <button
+            onClick={() => setView(status === "verified" ? "home" : "login")}
+            className="w-full bg-black text-white py-3 font-bold uppercase tracking-wider hover:bg-[#E11D48] transition-colors border border-black flex items-center justify-center gap-2 group cursor-pointer"
+          >
+            {status === "verified" ? "Continue" : "Sign In"}
+            <ArrowRight className="w-4 h-4 group-hover:translate-x-1 transition-transform" />
+          </button>
+        )}
+      </div>
+    </div>
+  );
+}